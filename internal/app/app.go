@@ -3,187 +3,1295 @@ package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mabulgu/pawdy/internal/backend/llamacpp"
 	"github.com/mabulgu/pawdy/internal/backend/ollama"
+	"github.com/mabulgu/pawdy/internal/backend/openai"
 	"github.com/mabulgu/pawdy/internal/config"
 	"github.com/mabulgu/pawdy/internal/document"
 	"github.com/mabulgu/pawdy/internal/prompt"
 	"github.com/mabulgu/pawdy/internal/rag"
+	"github.com/mabulgu/pawdy/internal/retry"
 	"github.com/mabulgu/pawdy/internal/safety"
 	"github.com/mabulgu/pawdy/pkg/types"
 )
 
+// rerankOverfetch is how many times top_k candidates are fetched before reranking.
+const rerankOverfetch = 3
+
 // App represents the main Pawdy application.
 type App struct {
 	Config        *types.Config
 	LLMClient     types.LLMClient
 	SafetyGate    types.SafetyGate
 	Retriever     types.Retriever
+	Embeddings    types.EmbeddingProvider
 	PromptBuilder *prompt.Builder
+	Tokenizer     types.Tokenizer
+	Reranker      types.Reranker
+	Redactions    []document.Redaction
+	Logger        *slog.Logger
+
+	// PromptTrace, when set, receives the query embedding and raw search scores, then
+	// the assembled system prompt and RAG prompt before each generation, for debugging
+	// what was retrieved and what the model was actually asked.
+	PromptTrace io.Writer
+
+	// Cache, when set, answers repeated questions without generating (see AnswerCache).
+	Cache *AnswerCache
+
+	// ManifestPath, when set, is where ingested directories are recorded (see PreviousIngestion).
+	ManifestPath string
+
+	// guardClient is the safety gate's own llama.cpp client, closed with the app.
+	guardClient types.LLMClient
 }
 
 // Source represents a document source with metadata.
 type Source struct {
-	ID       string         `json:"id"`
-	Content  string         `json:"content"`
-	Metadata map[string]any `json:"metadata"`
-	Score    float64        `json:"score"`
+	ID         string         `json:"id"`
+	Title      string         `json:"title,omitempty"`
+	Path       string         `json:"path,omitempty"`
+	Content    string         `json:"content"` // as written in the source, formatting included
+	Metadata   map[string]any `json:"metadata"`
+	Score      float64        `json:"score"`
+	IngestedAt time.Time      `json:"ingested_at,omitzero"` // zero for chunks indexed before it was recorded
+}
+
+// Answer is the full result of answering a question.
+type Answer struct {
+	Answer  string       `json:"answer"`
+	Sources []*Source    `json:"sources"`
+	Safety  SafetyReport `json:"safety"`
+
+	// Formatted is the answer with its sources cited in the configured citation_style.
+	// It is empty for refusals and other answers that cite no sources.
+	Formatted string `json:"formatted,omitempty"`
+}
+
+// healthChecker is implemented by services that can report their own readiness.
+type healthChecker interface {
+	IsHealthy(ctx context.Context) error
+}
+
+// embeddingsProvider is implemented by retrievers that expose their embedding provider.
+type embeddingsProvider interface {
+	Embeddings() types.EmbeddingProvider
+}
+
+// SafetyReport describes the safety gate's verdict on a question and its answer.
+type SafetyReport struct {
+	Enabled    bool     `json:"enabled"`
+	Blocked    bool     `json:"blocked"`
+	Stage      string   `json:"stage,omitempty"` // "input" or "output" when blocked
+	Category   string   `json:"category,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+// block marks the report as blocked at stage with the guard's verdict.
+func (r *SafetyReport) block(stage string, result *types.SafetyResult) {
+	r.Blocked = true
+	r.Stage = stage
+	r.Category = result.Category
+	r.Categories = result.Categories
+	r.Reason = result.Reason
 }
 
-// EvaluationResults contains evaluation metrics.
-type EvaluationResults struct {
-	Total             int     `json:"total"`
-	AvgResponseTime   float64 `json:"avg_response_time"`
-	AvgRelevanceScore float64 `json:"avg_relevance_score"`
-	SafetyBlocks      int     `json:"safety_blocks"`
+// Options adjusts how NewWithOptions sets up the application.
+type Options struct {
+	// ExistingCollection fails with rag.ErrCollectionNotFound instead of creating the
+	// configured collection when it doesn't exist, for commands such as reset.
+	ExistingCollection bool
+
+	// Config, if set, is used instead of loading the configuration file.
+	Config *types.Config
 }
 
 // New creates a new Pawdy application instance.
 func New() (*App, error) {
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates a Pawdy application instance set up as opts asks.
+func NewWithOptions(opts Options) (_ *App, err error) {
 	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	cfg := opts.Config
+	if cfg == nil {
+		cfg, err = config.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+	}
+
+	logger := newLogger(cfg.LogLevel)
+	for _, warning := range config.Warnings(cfg) {
+		logger.Warn(warning)
 	}
 
-	// Initialize LLM client
-	var llmClient types.LLMClient
+	retryPolicy := retry.Policy{
+		MaxAttempts: cfg.RetryAttempts,
+		Backoff:     cfg.RetryBackoff,
+	}
+
+	newOllamaClient := func(baseURL, model string) *ollama.Client {
+		client := ollama.NewClient(baseURL, model, cfg.RequestTimeout, retryPolicy)
+		client.SetKeepAlive(cfg.KeepAlive)
+		return client
+	}
+
+	// Initialize LLM client. guardClient is set when the guard has its own
+	// local process; both llama-server processes are stopped if setup fails.
+	var llmClient, guardClient types.LLMClient
+	defer func() {
+		if err == nil {
+			return
+		}
+		if llmClient != nil {
+			llmClient.Close()
+		}
+		if guardClient != nil {
+			guardClient.Close()
+		}
+	}()
+
 	switch cfg.Backend {
 	case "llamacpp":
-		llmClient, err = llamacpp.NewClient(cfg.ModelPath)
+		client, err := llamacpp.NewClient(cfg.ModelPath, cfg.LlamaCppServer, cfg.ContextWindow, cfg.RequestTimeout, retryPolicy)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize llama.cpp client: %w", err)
 		}
+		llmClient = client
 	case "ollama":
-		llmClient = ollama.NewClient(cfg.OllamaURL, cfg.OllamaModel)
+		llmClient = newOllamaClient(cfg.OllamaURL, cfg.OllamaModel)
+	case "openai":
+		llmClient = openai.NewClient(cfg.OpenAIURL, cfg.OpenAIAPIKey, cfg.OpenAIModel, cfg.RequestTimeout)
 	default:
 		return nil, fmt.Errorf("unsupported backend: %s", cfg.Backend)
 	}
 
+	// The rerank client shares the unlogged main client on llama.cpp, so its
+	// calls are logged once, as rerank calls
+	rawLLMClient := llmClient
+	llmClient = logLLMCalls(llmClient, logger, "chat")
+
 	// Initialize safety gate
 	var safetyClient types.LLMClient
 	if cfg.Safety == "on" {
+		switch {
+		case cfg.GuardURL != "":
+			// The guard runs on its own Ollama server, independent of the main backend
+			safetyClient = newOllamaClient(cfg.GuardURL, cfg.GuardModel)
+		case cfg.Backend == "llamacpp":
+			// The guard model runs in its own llama-server alongside the main model
+			client, err := llamacpp.NewClient(cfg.GuardModelPath, cfg.LlamaCppServer, cfg.ContextWindow, cfg.RequestTimeout, retryPolicy)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize llama.cpp guard client: %w", err)
+			}
+			guardClient = client
+			safetyClient = client
+		case cfg.Backend == "ollama":
+			safetyClient = newOllamaClient(cfg.OllamaURL, cfg.GuardModel)
+		case cfg.Backend == "openai":
+			safetyClient = openai.NewClient(cfg.OpenAIURL, cfg.OpenAIAPIKey, cfg.GuardModel, cfg.RequestTimeout)
+		}
+		safetyClient = logLLMCalls(safetyClient, logger, "safety")
+	}
+
+	safetyGate := safety.NewGuardWithOptions(safetyClient, cfg.Safety == "on", safety.GuardOptions{
+		Categories:         cfg.SafetyCategories,
+		DisabledCategories: cfg.SafetyDisabledCategories,
+		InjectionAction:    cfg.PromptInjection,
+		Threshold:          cfg.SafetyThreshold,
+		FailMode:           cfg.SafetyFailMode,
+		ParseRetries:       cfg.SafetyParseRetries,
+		Logger:             logger,
+	})
+	if cfg.Safety == "on" && cfg.SafetyAuditLog != "" {
+		auditLog, err := safety.OpenAuditLog(cfg.SafetyAuditLog)
+		if err != nil {
+			return nil, err
+		}
+		safetyGate.SetAuditLog(auditLog)
+	}
+
+	// Initialize the rerank model client, if configured
+	var rerankClient types.LLMClient
+	if cfg.Rerank && cfg.RerankModel != "" {
 		switch cfg.Backend {
 		case "llamacpp":
-			// For llamacpp, we'd need a separate guard model - for now use the same client
-			safetyClient = llmClient
+			// llama.cpp serves a single model, so score with the main client
+			rerankClient = rawLLMClient
 		case "ollama":
-			safetyClient = ollama.NewClient(cfg.OllamaURL, cfg.GuardModel)
+			rerankClient = newOllamaClient(cfg.OllamaURL, cfg.RerankModel)
+		case "openai":
+			rerankClient = openai.NewClient(cfg.OpenAIURL, cfg.OpenAIAPIKey, cfg.RerankModel, cfg.RequestTimeout)
 		}
+		rerankClient = logLLMCalls(rerankClient, logger, "rerank")
 	}
 
-	safetyGate := safety.NewGuard(safetyClient, cfg.Safety == "on")
-
 	// Initialize embeddings
 	var embeddings types.EmbeddingProvider
 	switch cfg.Embeddings {
 	case "ollama-nomic":
-		embeddings = rag.NewOllamaEmbeddings(cfg.OllamaURL, cfg.EmbeddingModel)
+		ollamaEmbeddings := rag.NewOllamaEmbeddings(cfg.OllamaURL, cfg.EmbeddingModel, cfg.BatchSize, cfg.EmbeddingTimeout, retryPolicy)
+		ollamaEmbeddings.SetMaxConcurrency(cfg.EmbeddingConcurrency)
+		embeddings = ollamaEmbeddings
 	case "fastembed":
 		return nil, fmt.Errorf("fastembed not yet implemented")
 	default:
 		return nil, fmt.Errorf("unsupported embeddings provider: %s", cfg.Embeddings)
 	}
 
+	// Fail early with a pull hint if a configured Ollama model is missing
+	var ollamaModels []healthChecker
+	if cfg.Backend == "ollama" {
+		ollamaModels = append(ollamaModels, llmClient)
+		if rerankClient != nil {
+			ollamaModels = append(ollamaModels, rerankClient)
+		}
+	}
+	if safetyClient != nil && (cfg.Backend == "ollama" || cfg.GuardURL != "") {
+		ollamaModels = append(ollamaModels, safetyClient)
+	}
+	if ollamaEmbeddings, ok := embeddings.(*rag.OllamaEmbeddings); ok {
+		ollamaModels = append(ollamaModels, ollamaEmbeddings)
+	}
+	if err := checkOllamaModels(ollamaModels); err != nil {
+		return nil, err
+	}
+	embeddings = &loggedEmbeddings{EmbeddingProvider: embeddings, logger: logger}
+
 	// Initialize retriever
-	retriever, err := rag.NewQdrantRetriever(cfg.QdrantURL, cfg.Collection, embeddings)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize retriever: %w", err)
+	var retriever types.Retriever
+	switch cfg.VectorDB {
+	case "qdrant":
+		retriever, err = rag.NewQdrantRetrieverWithOptions(rag.QdrantOptions{
+			URL:      cfg.QdrantURL,
+			APIKey:   cfg.QdrantAPIKey,
+			UseTLS:   cfg.QdrantUseTLS,
+			GRPCPort: cfg.QdrantGRPCPort,
+			NoCreate: opts.ExistingCollection,
+		}, cfg.Collection, cfg.Distance, embeddings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize retriever: %w", err)
+		}
+	case "pgvector":
+		retriever, err = rag.NewPgVectorRetrieverWithOptions(rag.PgVectorOptions{
+			URL:      cfg.PostgresURL,
+			NoCreate: opts.ExistingCollection,
+		}, cfg.Collection, embeddings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize retriever: %w", err)
+		}
+	case "memory":
+		retriever = rag.NewInMemoryRetriever(embeddings)
+	default:
+		return nil, fmt.Errorf("unsupported vector database: %s", cfg.VectorDB)
+	}
+
+	if reporter, ok := retriever.(types.DimensionReporter); ok {
+		if dimensions, err := reporter.CollectionDimensions(context.Background()); err != nil {
+			logger.Debug("could not read the collection's vector size", "error", err)
+		} else if warning := config.DimensionWarning(cfg, dimensions); warning != "" {
+			logger.Warn(warning)
+		}
+	}
+
+	// Initialize rerankers; the model scores the best keyword candidates,
+	// and MMR runs last so it diversifies the final ordering
+	var rerankers rag.ChainReranker
+	if cfg.Rerank {
+		rerankers = append(rerankers, rag.NewKeywordReranker())
+	}
+	if rerankClient != nil {
+		rerankers = append(rerankers, rag.NewLLMReranker(rerankClient, cfg.RerankCandidates))
+	}
+	if cfg.MMRLambda < 1 {
+		rerankers = append(rerankers, rag.NewMMRReranker(embeddings, cfg.MMRLambda))
+	}
+
+	var reranker types.Reranker
+	switch len(rerankers) {
+	case 0:
+	case 1:
+		reranker = rerankers[0]
+	default:
+		reranker = rerankers
 	}
 
 	// Initialize prompt builder
 	promptBuilder := prompt.NewBuilder(cfg.SystemPrompt)
+	promptBuilder.SetHistoryLimits(cfg.HistoryTurns, cfg.HistoryTokens)
+	promptBuilder.SetCitationStyle(cfg.CitationStyle)
+	promptBuilder.SetResponseLanguage(cfg.ResponseLanguage)
+	promptBuilder.SetStrictVariables(cfg.SystemPromptStrict)
+
+	tokenizer, err := loadTokenizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	promptBuilder.SetContextBudget(cfg.ContextWindow, cfg.MaxTokens, tokenizer)
+
+	redactions, err := compileRedactions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache *AnswerCache
+	if cfg.Cache {
+		dir, err := DefaultAnswerCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cache = NewAnswerCache(dir, cfg.CacheTTL)
+	}
+
+	// Without a home directory there is nowhere to keep the manifest; ingestion
+	// still works, it just cannot detect directories ingested under another path.
+	manifestPath, err := DefaultManifestPath()
+	if err != nil {
+		logger.Warn("ingestion manifest disabled", "error", err)
+	}
 
 	return &App{
 		Config:        cfg,
 		LLMClient:     llmClient,
 		SafetyGate:    safetyGate,
 		Retriever:     retriever,
+		Embeddings:    embeddings,
 		PromptBuilder: promptBuilder,
+		Tokenizer:     tokenizer,
+		Reranker:      reranker,
+		Redactions:    redactions,
+		Logger:        logger,
+		Cache:         cache,
+		ManifestPath:  manifestPath,
+		guardClient:   guardClient,
 	}, nil
 }
 
+// NewLocal creates an application that can only process documents: it loads the
+// configuration, tokenizer, and redactions but connects to no backend, embedding
+// service, or vector database. It is used to preview ingestion with ChunkFile.
+func NewLocal() (*App, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	logger := newLogger(cfg.LogLevel)
+
+	tokenizer, err := loadTokenizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	redactions, err := compileRedactions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &App{
+		Config:     cfg,
+		Tokenizer:  tokenizer,
+		Redactions: redactions,
+		Logger:     logger,
+	}, nil
+}
+
+// loadTokenizer loads the configured tokenizer if its file exists; otherwise chunking
+// falls back to the character heuristic and nil is returned.
+func loadTokenizer(cfg *types.Config) (types.Tokenizer, error) {
+	if cfg.TokenizerPath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(cfg.TokenizerPath); err != nil {
+		return nil, nil
+	}
+
+	bpe, err := document.LoadBPETokenizer(cfg.TokenizerPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+	return bpe, nil
+}
+
+// compileRedactions compiles the redaction patterns when redaction is on, so bad
+// config fails at startup rather than mid-ingest.
+func compileRedactions(cfg *types.Config) ([]document.Redaction, error) {
+	if !cfg.Redact {
+		return nil, nil
+	}
+
+	redactions, err := document.NewRedactions(cfg.RedactPatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile redaction patterns: %w", err)
+	}
+	return redactions, nil
+}
+
+// generation holds everything needed to produce an answer for a question.
+type generation struct {
+	prompt    string
+	opts      types.GenerateOptions
+	documents []*types.Document
+}
+
+// BlockedError reports that a question or its generated answer failed a safety check.
+type BlockedError struct {
+	Stage      string // "input" or "output"
+	Category   string
+	Categories []string // every category flagged, Category first
+	Reason     string
+	Message    string // the refusal message; if empty, one naming the built-in categories
+}
+
+// blockedError describes the guard's verdict at stage as a BlockedError.
+func (a *App) blockedError(stage string, result *types.SafetyResult) *BlockedError {
+	return &BlockedError{
+		Stage:      stage,
+		Category:   result.Category,
+		Categories: result.Categories,
+		Reason:     result.Reason,
+		Message:    a.RefusalMessage(result.Categories...),
+	}
+}
+
+// RefusalMessage returns the refusal message for the flagged categories, described as
+// the safety gate configures them when it can, such as with safety_categories.
+func (a *App) RefusalMessage(categories ...string) string {
+	if refuser, ok := a.SafetyGate.(interface{ RefusalMessage(...string) string }); ok {
+		return refuser.RefusalMessage(categories...)
+	}
+	return safety.GetRefusalMessage(categories...)
+}
+
+// ErrSafetyBlocked matches every *BlockedError with errors.Is.
+var ErrSafetyBlocked = errors.New("blocked by safety gate")
+
+// Is reports whether target is ErrSafetyBlocked.
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrSafetyBlocked
+}
+
+// Error returns the refusal message for the blocked categories.
+func (e *BlockedError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if len(e.Categories) == 0 {
+		return safety.GetRefusalMessage(e.Category)
+	}
+	return safety.GetRefusalMessage(e.Categories...)
+}
+
 // Ask processes a question and returns a response with sources.
-func (a *App) Ask(ctx context.Context, question string, temperature float64) (string, []*Source, error) {
-	// Check input safety
+// Zero fields of overrides fall back to the configured generation settings.
+func (a *App) Ask(ctx context.Context, question string, overrides types.GenerateOptions) (string, []*Source, error) {
+	answer, err := a.AskDetailed(ctx, question, overrides)
+	if err != nil {
+		return "", nil, err
+	}
+	return answer.Answer, answer.Sources, nil
+}
+
+// AskDetailed answers a question and reports the sources used and the safety verdict.
+// Blocked questions and answers are not errors; the refusal message becomes the answer.
+// Zero fields of overrides fall back to the configured generation settings.
+func (a *App) AskDetailed(ctx context.Context, question string, overrides types.GenerateOptions) (*Answer, error) {
+	question, err := a.checkQuestion(question)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &Answer{
+		Sources: []*Source{},
+		Safety:  SafetyReport{Enabled: a.SafetyGate.IsEnabled()},
+	}
+
+	gen, blocked, err := a.prepare(ctx, question, nil, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if blocked != nil {
+		answer.Answer = a.RefusalMessage(blocked.Categories...)
+		answer.Safety.block("input", blocked)
+		return answer, nil
+	}
+
+	var cacheKey string
+	if a.Cache != nil {
+		cacheKey = a.Cache.key(a.Config, question, gen)
+		if cached, ok := a.Cache.get(cacheKey); ok {
+			a.Logger.Debug("Answered from cache", "key", cacheKey)
+			answer.Answer = cached
+			answer.Sources = toSources(gen.documents)
+			answer.Formatted = a.PromptBuilder.FormatResponse(cached, gen.documents)
+			return answer, nil
+		}
+	}
+
+	// Generate response
+	response, err := a.generate(ctx, gen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate response: %w", err)
+	}
+	if strings.TrimSpace(response) == "" {
+		answer.Answer = EmptyResponseMessage
+		answer.Sources = toSources(gen.documents)
+		return answer, nil
+	}
+
+	// Check output safety
 	if a.SafetyGate.IsEnabled() {
-		safetyResult, err := a.SafetyGate.CheckInput(ctx, question)
+		safetyResult, err := a.SafetyGate.CheckOutput(ctx, response)
 		if err != nil {
-			return "", nil, fmt.Errorf("safety check failed: %w", err)
+			return nil, fmt.Errorf("output safety check failed: %w", err)
 		}
 
 		if !safetyResult.IsSafe {
-			refusal := safety.GetRefusalMessage(safetyResult.Category)
-			return refusal, nil, nil
+			answer.Answer = a.RefusalMessage(safetyResult.Categories...)
+			answer.Safety.block("output", safetyResult)
+			return answer, nil
 		}
 	}
 
-	// Retrieve relevant documents
-	documents, err := a.Retriever.Search(ctx, question, a.Config.TopK)
+	a.cacheAnswer(cacheKey, response)
+
+	answer.Answer = response
+	answer.Sources = toSources(gen.documents)
+	answer.Formatted = a.PromptBuilder.FormatResponse(response, gen.documents)
+	return answer, nil
+}
+
+// cacheAnswer stores an answer that passed the output safety check. Failing to
+// cache is not worth failing the question for, so errors are only logged.
+func (a *App) cacheAnswer(key, answer string) {
+	if a.Cache == nil || key == "" {
+		return
+	}
+	if err := a.Cache.put(key, answer); err != nil {
+		a.Logger.Warn("Failed to cache answer", "error", err)
+	}
+}
+
+// EmptyResponseMessage is the answer given when the model keeps finishing without
+// producing any text.
+const EmptyResponseMessage = "The model returned no content. Please try asking again."
+
+// generate runs a generation, retrying up to empty_response_retries times when the
+// model finishes without producing any text.
+func (a *App) generate(ctx context.Context, gen *generation) (string, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := a.LLMClient.Generate(ctx, gen.prompt, gen.opts)
+		if err != nil || strings.TrimSpace(response) != "" || attempt >= a.Config.EmptyResponseRetries {
+			return response, err
+		}
+		a.Logger.Warn("Model returned an empty response, retrying", "attempt", attempt+1)
+	}
+}
+
+// Retrieve runs the input safety check and retrieval for a question without generating
+// an answer. The Answer has the sources that would be used and the safety verdict, and
+// its text is empty unless the question was blocked, when it is the refusal message.
+func (a *App) Retrieve(ctx context.Context, question string) (*Answer, error) {
+	question, err := a.checkQuestion(question)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to retrieve documents: %w", err)
+		return nil, err
 	}
 
-	// Build prompt with context
-	prompt := a.PromptBuilder.BuildRAGPrompt(question, documents)
+	answer := &Answer{
+		Sources: []*Source{},
+		Safety:  SafetyReport{Enabled: a.SafetyGate.IsEnabled()},
+	}
 
-	// Get system prompt
-	systemPrompt, err := a.PromptBuilder.BuildSystemPrompt()
+	gen, blocked, err := a.prepare(ctx, question, nil, types.GenerateOptions{})
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to build system prompt: %w", err)
+		return nil, err
+	}
+	if blocked != nil {
+		answer.Answer = a.RefusalMessage(blocked.Categories...)
+		answer.Safety.block("input", blocked)
+		return answer, nil
 	}
 
-	// Configure generation options
-	opts := types.GenerateOptions{
-		Temperature:  temperature,
-		MaxTokens:    a.Config.MaxTokens,
-		TopP:         a.Config.TopP,
-		SystemPrompt: systemPrompt,
+	answer.Sources = toSources(gen.documents)
+	return answer, nil
+}
+
+// AskStream processes a question and streams the response tokens as they are generated.
+// Recent history is included in the prompt so follow-up questions keep their context.
+// A blocked question yields a single token carrying a *BlockedError. Output safety is checked
+// on the accumulated text once the stream completes; if it fails, the final token carries one too.
+// A stream that ends without text is retried like AskDetailed, then answered with EmptyResponseMessage.
+func (a *App) AskStream(ctx context.Context, question string, history []types.Message, overrides types.GenerateOptions) (<-chan types.StreamToken, []*Source, error) {
+	question, err := a.checkQuestion(question)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if temperature == 0 {
-		opts.Temperature = a.Config.Temperature
+	gen, blocked, err := a.prepare(ctx, question, history, overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	if blocked != nil {
+		tokens := make(chan types.StreamToken, 1)
+		tokens <- types.StreamToken{Error: a.blockedError("input", blocked)}
+		close(tokens)
+		return tokens, nil, nil
 	}
 
-	// Generate response
-	response, err := a.LLMClient.Generate(ctx, prompt, opts)
+	// Answers that depend on the conversation so far are not cached
+	var cacheKey string
+	if a.Cache != nil && len(history) == 0 {
+		cacheKey = a.Cache.key(a.Config, question, gen)
+		if cached, ok := a.Cache.get(cacheKey); ok {
+			a.Logger.Debug("Answered from cache", "key", cacheKey)
+			tokens := make(chan types.StreamToken, 2)
+			tokens <- types.StreamToken{Text: cached}
+			tokens <- types.StreamToken{Done: true}
+			close(tokens)
+			return tokens, toSources(gen.documents), nil
+		}
+	}
+
+	upstream, err := a.LLMClient.GenerateStream(ctx, gen.prompt, gen.opts)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to generate response: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate response: %w", err)
 	}
 
-	// Check output safety
+	tokens := make(chan types.StreamToken, 10)
+
+	go func() {
+		defer close(tokens)
+
+		// Output safety releases text only once the guard has seen it
+		checker := safety.NewStreamChecker(a.SafetyGate, a.Config.SafetyStreamInterval, a.Config.SafetyStreamWindow)
+		var stats *types.GenerationStats
+		var response strings.Builder
+		for attempt := 0; ; attempt++ {
+			for token := range upstream {
+				if token.Error != nil {
+					tokens <- types.StreamToken{Error: fmt.Errorf("failed to generate response: %w", token.Error)}
+					return
+				}
+
+				response.WriteString(token.Text)
+				text, blocked, err := checker.Add(ctx, token.Text)
+				if !a.sendChecked(tokens, text, blocked, err) {
+					return
+				}
+
+				if token.Done {
+					stats = token.Stats
+					break
+				}
+			}
+
+			// Retry like generate when the model finishes without producing any text
+			if strings.TrimSpace(response.String()) != "" || attempt >= a.Config.EmptyResponseRetries {
+				break
+			}
+			a.Logger.Warn("Model returned an empty response, retrying", "attempt", attempt+1)
+
+			upstream, err = a.LLMClient.GenerateStream(ctx, gen.prompt, gen.opts)
+			if err != nil {
+				tokens <- types.StreamToken{Error: fmt.Errorf("failed to generate response: %w", err)}
+				return
+			}
+		}
+		if strings.TrimSpace(response.String()) == "" {
+			tokens <- types.StreamToken{Text: EmptyResponseMessage}
+			tokens <- types.StreamToken{Done: true, Stats: stats}
+			return
+		}
+
+		// Check output safety on the complete response
+		text, blocked, err := checker.Finish(ctx)
+		if !a.sendChecked(tokens, text, blocked, err) {
+			return
+		}
+
+		a.cacheAnswer(cacheKey, response.String())
+		tokens <- types.StreamToken{Done: true, Stats: stats}
+	}()
+
+	return tokens, toSources(gen.documents), nil
+}
+
+// sendChecked sends text that passed the output safety check, or the block or error
+// that stopped the stream. It returns false if the stream should end.
+func (a *App) sendChecked(tokens chan<- types.StreamToken, text string, blocked *types.SafetyResult, err error) bool {
+	switch {
+	case err != nil:
+		tokens <- types.StreamToken{Error: fmt.Errorf("output safety check failed: %w", err)}
+		return false
+	case blocked != nil:
+		tokens <- types.StreamToken{Error: a.blockedError("output", blocked)}
+		return false
+	}
+
+	if text != "" {
+		tokens <- types.StreamToken{Text: text}
+	}
+	return true
+}
+
+// searchResult is the outcome of a retrieval running alongside the input safety check.
+type searchResult struct {
+	documents []*types.Document
+	vector    []float32 // the query embedding, when tracing
+	err       error
+}
+
+// prepare runs the input safety check, retrieves context, and builds the generation request.
+// A non-nil safety result is returned when the input is blocked.
+func (a *App) prepare(ctx context.Context, question string, history []types.Message, overrides types.GenerateOptions) (*generation, *types.SafetyResult, error) {
+	// Retrieve relevant documents while the input is checked, over-fetching when reranking.
+	// Returning early cancels the search; the buffered channel lets it finish without a reader.
+	searchCtx, cancelSearch := context.WithCancel(ctx)
+	defer cancelSearch()
+
+	searched := make(chan searchResult, 1)
+	go func() {
+		documents, vector, err := a.search(searchCtx, question)
+		searched <- searchResult{documents: documents, vector: vector, err: err}
+	}()
+
+	// Check input safety
 	if a.SafetyGate.IsEnabled() {
-		safetyResult, err := a.SafetyGate.CheckOutput(ctx, response)
+		safetyResult, err := a.SafetyGate.CheckInput(ctx, question)
 		if err != nil {
-			return "", nil, fmt.Errorf("output safety check failed: %w", err)
+			return nil, nil, fmt.Errorf("safety check failed: %w", err)
 		}
 
 		if !safetyResult.IsSafe {
-			refusal := safety.GetRefusalMessage(safetyResult.Category)
-			return refusal, nil, nil
+			return nil, safetyResult, nil
 		}
 	}
 
-	// Convert documents to sources
+	result := <-searched
+	documents, err := result.documents, result.err
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve documents: %w", err)
+	}
+	if a.PromptTrace != nil {
+		writeRetrievalTrace(a.PromptTrace, result.vector, documents)
+	}
+
+	// Drop weak hits so they don't pollute the prompt; with none left, the prompt has no context
+	documents, filtered := filterByScore(documents, a.Config.MinScore)
+	if filtered > 0 {
+		a.Logger.Debug("filtered weak retrieval hits",
+			"filtered", filtered,
+			"remaining", len(documents),
+			"min_score", a.Config.MinScore)
+	}
+
+	documents, err = a.rank(ctx, question, documents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Screen retrieved text, which may come from third-party docs, for prompt injections
+	documents, err = a.SafetyGate.CheckContext(ctx, documents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("context safety check failed: %w", err)
+	}
+	for _, doc := range documents {
+		if suspected, _ := doc.Metadata["injection_suspected"].(bool); suspected {
+			path, _ := doc.Metadata["path"].(string)
+			a.Logger.Warn("possible prompt injection in retrieved document",
+				"doc_id", doc.ID,
+				"path", path,
+				"action", a.Config.PromptInjection)
+		}
+	}
+
+	// Get system prompt, unless the caller supplied its own
+	systemPrompt := overrides.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt, err = a.PromptBuilder.BuildSystemPrompt()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to build system prompt: %w", err)
+		}
+	}
+
+	// Drop the weakest context that would overflow the model's context window
+	documents, dropped := a.PromptBuilder.FitContext(systemPrompt, history, question, documents)
+	if dropped > 0 {
+		a.Logger.Warn("dropped retrieved chunks to fit the context window",
+			"dropped", dropped,
+			"remaining", len(documents),
+			"context_window", a.Config.ContextWindow,
+			"max_tokens", a.Config.MaxTokens)
+	}
+
+	// Build prompt with context
+	prompt := a.PromptBuilder.BuildConversationalRAGPrompt(history, question, documents)
+
+	// Configure generation options
+	opts := a.generateOptions(overrides)
+	opts.SystemPrompt = systemPrompt
+
+	if a.PromptTrace != nil {
+		writePromptTrace(a.PromptTrace, systemPrompt, prompt, documents)
+	}
+
+	return &generation{
+		prompt:    prompt,
+		opts:      opts,
+		documents: documents,
+	}, nil, nil
+}
+
+// rank reranks the documents searched for question, weights them by source, and keeps the top_k.
+func (a *App) rank(ctx context.Context, question string, documents []*types.Document) ([]*types.Document, error) {
+	if a.Reranker != nil {
+		var err error
+		documents, err = a.Reranker.Rerank(ctx, question, documents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rerank documents: %w", err)
+		}
+	}
+
+	// Let authoritative sources outrank scratch notes of similar relevance
+	documents = rag.WeightBySource(documents)
+	if len(documents) > a.Config.TopK {
+		documents = documents[:a.Config.TopK]
+	}
+	if a.Reranker != nil {
+		a.Logger.Debug("reranked documents",
+			"kept", len(documents),
+			"scores", documentScores(documents))
+	}
+
+	return documents, nil
+}
+
+// search retrieves candidate documents for question, over-fetching when reranking.
+// When tracing, it embeds the question itself, if the retriever allows, and returns
+// the query embedding too.
+func (a *App) search(ctx context.Context, question string) ([]*types.Document, []float32, error) {
+	fetchK := a.Config.TopK
+	if a.Reranker != nil {
+		fetchK = a.Config.TopK * rerankOverfetch
+	}
+
+	start := time.Now()
+	var documents []*types.Document
+	var vector []float32
+	var err error
+
+	searcher, searchesVectors := a.Retriever.(types.VectorSearcher)
+	provider, hasEmbeddings := a.Retriever.(embeddingsProvider)
+	if a.PromptTrace != nil && searchesVectors && hasEmbeddings {
+		vectors, embedErr := provider.Embeddings().Embed(ctx, []string{question})
+		if embedErr != nil {
+			return nil, nil, fmt.Errorf("failed to embed query: %w", embedErr)
+		}
+		if len(vectors) > 0 {
+			vector = vectors[0]
+			documents, err = searcher.SearchVector(ctx, vector, fetchK)
+		}
+	} else {
+		documents, err = a.Retriever.Search(ctx, question, fetchK)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a.Logger.Debug("retrieved documents",
+		"query", question,
+		"top_k", fetchK,
+		"hits", len(documents),
+		"scores", documentScores(documents),
+		"duration", time.Since(start))
+
+	return documents, vector, nil
+}
+
+// traceDimensions is how many leading dimensions of the query embedding the trace shows.
+const traceDimensions = 8
+
+// writeRetrievalTrace writes the query embedding and the raw scores of the retrieved
+// documents, before min_score, reranking, and source weights change them. Scores that
+// barely differ, such as all around 0.5, point to an embedding problem rather than
+// to the documents.
+func writeRetrievalTrace(w io.Writer, vector []float32, documents []*types.Document) {
+	fmt.Fprintln(w, "===== Retrieval =====")
+	if vector != nil {
+		var sum float64
+		for _, v := range vector {
+			sum += float64(v) * float64(v)
+		}
+
+		shown := vector[:min(traceDimensions, len(vector))]
+		dims := make([]string, len(shown))
+		for i, v := range shown {
+			dims[i] = strconv.FormatFloat(float64(v), 'f', 4, 32)
+		}
+		fmt.Fprintf(w, "Query embedding: %d dimensions, norm %.4f, [%s", len(vector), math.Sqrt(sum), strings.Join(dims, ", "))
+		if len(vector) > len(shown) {
+			fmt.Fprint(w, ", ...")
+		}
+		fmt.Fprintln(w, "]")
+	}
+
+	fmt.Fprintf(w, "Raw hits (%d):\n", len(documents))
+	for i, doc := range documents {
+		name, _ := doc.Metadata["path"].(string)
+		if name == "" {
+			name = doc.ID
+		}
+		fmt.Fprintf(w, "[%d] %s (raw score: %.5f)\n", i+1, name, doc.Score)
+	}
+	if len(documents) > 1 {
+		low, high := documents[0].Score, documents[0].Score
+		for _, doc := range documents {
+			low, high = min(low, doc.Score), max(high, doc.Score)
+		}
+		fmt.Fprintf(w, "Score range: %.5f to %.5f (spread %.5f)\n", low, high, high-low)
+	}
+}
+
+// generateOptions returns the configured generation settings with the nonzero fields
+// of overrides applied.
+func (a *App) generateOptions(overrides types.GenerateOptions) types.GenerateOptions {
+	opts := types.GenerateOptions{
+		Temperature:   a.Config.Temperature,
+		TopP:          a.Config.TopP,
+		MaxTokens:     a.Config.MaxTokens,
+		StopSequences: a.Config.StopSequences,
+	}
+
+	if overrides.Temperature != 0 {
+		opts.Temperature = overrides.Temperature
+	}
+	if overrides.TopP != 0 {
+		opts.TopP = overrides.TopP
+	}
+	if overrides.MaxTokens != 0 {
+		opts.MaxTokens = overrides.MaxTokens
+	}
+	if len(overrides.StopSequences) > 0 {
+		opts.StopSequences = overrides.StopSequences
+	}
+
+	return opts
+}
+
+// ValidateOverrides checks per-request generation settings against the same limits as
+// their config counterparts. Zero fields are unset and always valid.
+func (a *App) ValidateOverrides(overrides types.GenerateOptions) error {
+	if overrides.Temperature < 0 || overrides.Temperature > 2 {
+		return fmt.Errorf("temperature must be between 0.0 and 2.0, got %f", overrides.Temperature)
+	}
+
+	if overrides.TopP < 0 || overrides.TopP > 1 {
+		return fmt.Errorf("top_p must be between 0.0 and 1.0, got %f", overrides.TopP)
+	}
+
+	if overrides.MaxTokens < 0 || (overrides.MaxTokens > 0 && overrides.MaxTokens >= a.Config.ContextWindow) {
+		return fmt.Errorf("max_tokens must be between 1 and %d, got %d", a.Config.ContextWindow-1, overrides.MaxTokens)
+	}
+
+	for _, stop := range overrides.StopSequences {
+		if stop == "" {
+			return fmt.Errorf("stop sequences must not be empty")
+		}
+	}
+
+	return nil
+}
+
+// writePromptTrace writes the prompts sent to the model, preceded by the chunks they include.
+func writePromptTrace(w io.Writer, systemPrompt, prompt string, documents []*types.Document) {
+	fmt.Fprintf(w, "===== Context (%d chunks) =====\n", len(documents))
+	for i, source := range toSources(documents) {
+		name := source.Path
+		if name == "" {
+			name = source.ID
+		}
+		fmt.Fprintf(w, "[%d] %s (score: %.3f)\n", i+1, name, source.Score)
+	}
+	fmt.Fprintf(w, "===== System prompt =====\n%s\n", systemPrompt)
+	fmt.Fprintf(w, "===== Prompt =====\n%s\n", prompt)
+	fmt.Fprintln(w, "==========================")
+}
+
+// filterByScore removes documents scoring below minScore and reports how many were removed.
+func filterByScore(documents []*types.Document, minScore float64) ([]*types.Document, int) {
+	if minScore <= 0 {
+		return documents, 0
+	}
+
+	kept := make([]*types.Document, 0, len(documents))
+	for _, doc := range documents {
+		if doc.Score >= minScore {
+			kept = append(kept, doc)
+		}
+	}
+
+	return kept, len(documents) - len(kept)
+}
+
+// ollamaPreflightTimeout bounds the startup check for pulled Ollama models.
+const ollamaPreflightTimeout = 5 * time.Second
+
+// checkOllamaModels returns an error if any of the services reports a model that has not been pulled.
+// Other failures, such as Ollama being unreachable, are left for the first real request or
+// `pawdy health` to report.
+func checkOllamaModels(services []healthChecker) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ollamaPreflightTimeout)
+	defer cancel()
+
+	for _, service := range services {
+		var notFound *ollama.ModelNotFoundError
+		if err := service.IsHealthy(ctx); errors.As(err, &notFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newLogger creates a stderr logger at the configured level, defaulting to info.
+func newLogger(level string) *slog.Logger {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		logLevel = slog.LevelInfo
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+}
+
+// toSources converts retrieved documents to sources.
+func toSources(documents []*types.Document) []*Source {
 	sources := make([]*Source, len(documents))
 	for i, doc := range documents {
+		title, _ := doc.Metadata["title"].(string)
+		path, _ := doc.Metadata["path"].(string)
+		ingestedAt, _ := document.IngestedAt(doc.Metadata)
 		sources[i] = &Source{
-			ID:       doc.ID,
-			Content:  doc.Content,
-			Metadata: doc.Metadata,
-			Score:    doc.Score,
+			ID:         doc.ID,
+			Title:      title,
+			Path:       path,
+			Content:    document.DisplayContent(doc),
+			Metadata:   doc.Metadata,
+			Score:      doc.Score,
+			IngestedAt: ingestedAt,
+		}
+	}
+	return sources
+}
+
+// ErrEmptyQuestion is returned when a question is empty or only whitespace.
+var ErrEmptyQuestion = errors.New("please ask a question")
+
+// ErrInputTooLong is returned when a question is longer than max_input_tokens and
+// input_overflow is "reject".
+var ErrInputTooLong = errors.New("question is too long")
+
+// checkQuestion rejects empty questions and applies max_input_tokens, returning the
+// question to answer: unchanged, or truncated if input_overflow is "truncate".
+func (a *App) checkQuestion(question string) (string, error) {
+	if strings.TrimSpace(question) == "" {
+		return "", ErrEmptyQuestion
+	}
+
+	limit := a.Config.MaxInputTokens
+	if limit <= 0 {
+		return question, nil
+	}
+
+	tokens := document.CountTokens(question)
+	if a.Tokenizer != nil {
+		tokens = a.Tokenizer.Count(question)
+	}
+	if tokens <= limit {
+		return question, nil
+	}
+
+	if a.Config.InputOverflow != "truncate" {
+		return "", fmt.Errorf("%w: about %d tokens, over the max_input_tokens limit of %d; ask about the relevant part only",
+			ErrInputTooLong, tokens, limit)
+	}
+
+	a.Logger.Warn("Question truncated to max_input_tokens", "tokens", tokens, "max_input_tokens", limit)
+	if a.Tokenizer != nil {
+		return a.Tokenizer.Decode(a.Tokenizer.Encode(question)[:limit]), nil
+	}
+	return document.TruncateTokens(question, limit), nil
+}
+
+// ErrUnchanged is returned by IngestFile when a file's content matches what is already indexed.
+var ErrUnchanged = errors.New("file unchanged since last ingestion")
+
+// ErrNoChunks is returned by IngestFile when a file yields no text to index. The
+// previously indexed copy, if any, is left in place.
+var ErrNoChunks = errors.New("no chunks extracted")
+
+// IngestFile processes and indexes a single file, returning how many chunks were indexed
+// and how many were skipped as duplicates of already-indexed chunks (see the dedupe setting).
+// Files whose content hash matches the indexed copy are skipped with ErrUnchanged unless force is set.
+// If some chunks fail to embed, the rest are indexed and counted, and a *types.PartialIndexError
+// is returned; the file is not recorded as unchanged, so the next ingest indexes it again.
+// It is safe to call concurrently for different files.
+func (a *App) IngestFile(ctx context.Context, filePath string, chunkTokens, chunkOverlap int, force bool) (int, int, error) {
+	// Compare content hash against the indexed copy
+	contentHash, err := hashFile(filePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	return a.index(ctx, filePath, contentHash, force, func() ([]*types.Document, error) {
+		return a.processFile(ctx, filePath, chunkTokens, chunkOverlap)
+	})
+}
+
+// ChunkFile extracts and chunks a file as IngestFile would, without embedding or indexing
+// the chunks. A file that yields no chunks returns ErrNoChunks.
+func (a *App) ChunkFile(ctx context.Context, filePath string, chunkTokens, chunkOverlap int) ([]*types.Document, error) {
+	documents, err := a.processFile(ctx, filePath, chunkTokens, chunkOverlap)
+	if errors.Is(err, document.ErrNoText) || (err == nil && len(documents) == 0) {
+		return nil, ErrNoChunks
+	}
+	return documents, err
+}
+
+// processFile extracts and chunks a file with the ingestion settings.
+func (a *App) processFile(ctx context.Context, filePath string, chunkTokens, chunkOverlap int) ([]*types.Document, error) {
+	documents, err := document.ProcessFile(ctx, filePath, a.processorOptions(chunkTokens, chunkOverlap))
+	if err != nil {
+		return nil, fmt.Errorf("failed to process file: %w", err)
+	}
+	return documents, nil
+}
+
+// IngestURL fetches and indexes a web page, with its URL as the source path, and returns
+// the page so the caller can follow its links. Counts and ErrUnchanged are as for IngestFile.
+// A sitemap is returned without being indexed.
+func (a *App) IngestURL(ctx context.Context, pageURL string, chunkTokens, chunkOverlap int, force bool) (*document.Page, int, int, error) {
+	client := &http.Client{Timeout: a.Config.RequestTimeout}
+	page, err := document.FetchPage(ctx, client, pageURL)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if page.Sitemap {
+		return page, 0, 0, nil
+	}
+
+	sum := sha256.Sum256(page.Content)
+	chunks, duplicates, err := a.index(ctx, pageURL, hex.EncodeToString(sum[:]), force, func() ([]*types.Document, error) {
+		documents, err := page.Process(ctx, a.processorOptions(chunkTokens, chunkOverlap))
+		if err != nil {
+			return nil, fmt.Errorf("failed to process page: %w", err)
+		}
+		return documents, nil
+	})
+
+	return page, chunks, duplicates, err
+}
+
+// index replaces the indexed copy of the source at path with the documents returned by process,
+// unless contentHash shows it is unchanged and force is not set.
+func (a *App) index(ctx context.Context, path, contentHash string, force bool, process func() ([]*types.Document, error)) (int, int, error) {
+	storedHash, err := a.Retriever.SourceHash(ctx, path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to look up indexed file: %w", err)
+	}
+
+	if storedHash == contentHash && !force {
+		return 0, 0, ErrUnchanged
+	}
+
+	documents, err := process()
+	if errors.Is(err, document.ErrNoText) || (err == nil && len(documents) == 0) {
+		a.Logger.Warn("source produced no chunks", "path", path)
+		return 0, 0, ErrNoChunks
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ingestedAt := time.Now().UTC().Format(time.RFC3339)
+	for _, doc := range documents {
+		doc.Metadata["content_hash"] = contentHash
+		doc.Metadata["chunk_hash"] = rag.ChunkHash(doc.Content)
+		doc.Metadata["ingested_at"] = ingestedAt
+
+		// A weight in the document's front matter takes precedence over the configured one
+		if _, ok := doc.Metadata["source_weight"]; !ok && a.Config.SourceWeight != 1 {
+			doc.Metadata["source_weight"] = a.Config.SourceWeight
+		}
+	}
+
+	// Remove chunks from the previous version of the file
+	if storedHash != "" {
+		if err := a.Retriever.DeleteSource(ctx, path); err != nil {
+			return 0, 0, fmt.Errorf("failed to remove previous version: %w", err)
+		}
+	}
+
+	// Add to retriever
+	if a.Config.Dedupe == "off" {
+		err := a.Retriever.AddDocuments(ctx, documents)
+		var partial *types.PartialIndexError
+		if errors.As(err, &partial) {
+			return partial.Total - len(partial.Failed), 0, err
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to add documents: %w", err)
 		}
+		return len(documents), 0, nil
 	}
 
-	return response, sources, nil
+	deduplicator, ok := a.Retriever.(types.Deduplicator)
+	if !ok {
+		return 0, 0, fmt.Errorf("vector database %s does not support dedupe", a.Config.VectorDB)
+	}
+
+	threshold := 0.0
+	if a.Config.Dedupe == "semantic" {
+		threshold = a.Config.DedupeThreshold
+	}
+
+	duplicates, err := deduplicator.AddUniqueDocuments(ctx, documents, threshold)
+	var partial *types.PartialIndexError
+	if errors.As(err, &partial) {
+		return partial.Total - len(partial.Failed) - duplicates, duplicates, err
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to add documents: %w", err)
+	}
+
+	return len(documents) - duplicates, duplicates, nil
 }
 
-// IngestFile processes and indexes a single file.
-func (a *App) IngestFile(ctx context.Context, filePath string, chunkTokens, chunkOverlap int) (int, error) {
+// processorOptions returns the document processor settings for ingestion, with
+// chunkTokens and chunkOverlap overriding the configured chunking when nonzero.
+func (a *App) processorOptions(chunkTokens, chunkOverlap int) document.ProcessorOptions {
+	// Per-type overrides only apply when the caller hasn't forced a chunk size
+	var chunkOverrides map[string]types.ChunkOverride
+	if chunkTokens == 0 && chunkOverlap == 0 {
+		chunkOverrides = a.Config.ChunkOverrides
+	}
+
 	// Use config defaults if not specified
 	if chunkTokens == 0 {
 		chunkTokens = a.Config.ChunkTokens
@@ -192,19 +1300,42 @@ func (a *App) IngestFile(ctx context.Context, filePath string, chunkTokens, chun
 		chunkOverlap = a.Config.ChunkOverlap
 	}
 
-	// Process the file
-	documents, err := document.ProcessFile(ctx, filePath, chunkTokens, chunkOverlap)
-	if err != nil {
-		return 0, fmt.Errorf("failed to process file: %w", err)
+	return document.ProcessorOptions{
+		ChunkTokens:    chunkTokens,
+		ChunkOverlap:   chunkOverlap,
+		ChunkOverrides: chunkOverrides,
+		Tokenizer:      a.Tokenizer,
+		SectionAware:   a.Config.MarkdownSections,
+		CSVDelimiter:   csvDelimiter(a.Config.CSVDelimiter),
+		PDFOCR:         a.Config.PDFOCR,
+		PDFFailedPages: a.Config.PDFFailedPages,
+		Redactions:     a.Redactions,
+		Logger:         a.Logger,
 	}
+}
 
-	// Add to retriever
-	err = a.Retriever.AddDocuments(ctx, documents)
+// csvDelimiter converts the configured delimiter to a rune; empty means the per-type default.
+func csvDelimiter(delimiter string) rune {
+	for _, r := range delimiter {
+		return r
+	}
+	return 0
+}
+
+// hashFile returns the hex-encoded SHA-256 of a file's content.
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
-		return 0, fmt.Errorf("failed to add documents: %w", err)
+		return "", err
 	}
+	defer file.Close()
 
-	return len(documents), nil
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 // HealthCheck checks the health of all services.
@@ -232,7 +1363,7 @@ func (a *App) HealthCheck(ctx context.Context) ([]*types.HealthStatus, error) {
 	dbLatency := time.Since(start)
 
 	dbStatus := &types.HealthStatus{
-		Name:    "Vector Database (Qdrant)",
+		Name:    fmt.Sprintf("Vector Database (%s)", a.Config.VectorDB),
 		Healthy: dbErr == nil,
 		Latency: dbLatency.String(),
 	}
@@ -241,18 +1372,26 @@ func (a *App) HealthCheck(ctx context.Context) ([]*types.HealthStatus, error) {
 	}
 	statuses = append(statuses, dbStatus)
 
-	// Check embeddings
-	if _, ok := a.Retriever.(*rag.QdrantRetriever); ok {
-		// This is a bit of a hack to access the embeddings provider
-		// In a real implementation, we'd have a better way to access this
-		embeddingsStatus := &types.HealthStatus{
-			Name:    fmt.Sprintf("Embeddings (%s)", a.Config.Embeddings),
-			Healthy: true, // Assume healthy if we got this far
-			Message: "Embedded in retriever",
-		}
-		statuses = append(statuses, embeddingsStatus)
+	// Check the embedding service the retriever searches with
+	embeddings := a.Embeddings
+	if provider, ok := a.Retriever.(embeddingsProvider); ok {
+		embeddings = provider.Embeddings()
 	}
 
+	start = time.Now()
+	embeddingsErr := embeddings.IsHealthy(ctx)
+	embeddingsLatency := time.Since(start)
+
+	embeddingsStatus := &types.HealthStatus{
+		Name:    fmt.Sprintf("Embeddings (%s)", a.Config.Embeddings),
+		Healthy: embeddingsErr == nil,
+		Latency: embeddingsLatency.String(),
+	}
+	if embeddingsErr != nil {
+		embeddingsStatus.Message = embeddingsErr.Error()
+	}
+	statuses = append(statuses, embeddingsStatus)
+
 	// Check safety gate
 	if a.SafetyGate.IsEnabled() {
 		safetyStatus := &types.HealthStatus{
@@ -273,37 +1412,70 @@ func (a *App) HealthCheck(ctx context.Context) ([]*types.HealthStatus, error) {
 	return statuses, nil
 }
 
+// Stats reports what is currently indexed in the vector database.
+func (a *App) Stats(ctx context.Context) (*types.CollectionStats, error) {
+	stats, err := a.Retriever.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection stats: %w", err)
+	}
+	return stats, nil
+}
+
 // Reset clears the vector database.
+// If collection is set, it must match the collection the retriever was built for,
+// so a stale name can never delete the wrong data.
 func (a *App) Reset(ctx context.Context, collection string) error {
-	return a.Retriever.DeleteCollection(ctx)
+	if collection != "" && collection != a.Config.Collection {
+		return fmt.Errorf("collection %q does not match the configured collection %q", collection, a.Config.Collection)
+	}
+	if err := a.Retriever.DeleteCollection(ctx); err != nil {
+		return err
+	}
+	return a.forgetIngestions(a.Config.Collection)
+}
+
+// Reindex re-embeds all indexed chunks with the configured embedding model,
+// so switching models doesn't require the original files.
+func (a *App) Reindex(ctx context.Context) (int, error) {
+	reindexer, ok := a.Retriever.(types.Reindexer)
+	if !ok {
+		return 0, fmt.Errorf("vector database %s does not support reindexing", a.Config.VectorDB)
+	}
+
+	return reindexer.Reindex(ctx)
 }
 
-// Evaluate runs evaluation against a test set.
-func (a *App) Evaluate(ctx context.Context, testFile, outputFile string) (*EvaluationResults, error) {
-	// Check if test file exists
-	if _, err := os.Stat(testFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("test file not found: %s", testFile)
+// Export writes every indexed chunk, with its vector, to w.
+func (a *App) Export(ctx context.Context, w io.Writer) (int, error) {
+	exporter, ok := a.Retriever.(types.Exporter)
+	if !ok {
+		return 0, fmt.Errorf("vector database %s does not support export", a.Config.VectorDB)
 	}
 
-	// For now, return a placeholder implementation
-	// In a real implementation, this would:
-	// 1. Read JSONL test file
-	// 2. Process each question
-	// 3. Measure response time and quality
-	// 4. Generate detailed results
+	return exporter.Export(ctx, w)
+}
 
-	results := &EvaluationResults{
-		Total:             0,
-		AvgResponseTime:   0.0,
-		AvgRelevanceScore: 0.0,
-		SafetyBlocks:      0,
+// Import replaces the collection with chunks written by Export, without re-embedding them.
+func (a *App) Import(ctx context.Context, r io.Reader) (int, error) {
+	exporter, ok := a.Retriever.(types.Exporter)
+	if !ok {
+		return 0, fmt.Errorf("vector database %s does not support import", a.Config.VectorDB)
 	}
 
-	return results, fmt.Errorf("evaluation not yet implemented - placeholder for future development")
+	return exporter.Import(ctx, r)
 }
 
 // Close cleans up application resources.
 func (a *App) Close() error {
+	if closer, ok := a.Retriever.(io.Closer); ok {
+		closer.Close()
+	}
+	if closer, ok := a.SafetyGate.(io.Closer); ok {
+		closer.Close()
+	}
+	if a.guardClient != nil {
+		a.guardClient.Close()
+	}
 	if a.LLMClient != nil {
 		return a.LLMClient.Close()
 	}
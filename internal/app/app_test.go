@@ -0,0 +1,1132 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/prompt"
+	"github.com/mabulgu/pawdy/internal/rag"
+	"github.com/mabulgu/pawdy/internal/safety"
+	"github.com/mabulgu/pawdy/internal/testutil"
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testutil.FakeLlamaServerEnv) != "" {
+		err := testutil.ServeFakeLlamaServer(os.Args[1:], map[string]string{
+			"chat.gguf":  "Boot into rescue mode.",
+			"guard.gguf": "unsafe\nS1",
+		})
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestNewWithOptions_LlamaCppGuardModel(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"chat.gguf", "guard.gguf"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	t.Setenv(testutil.FakeLlamaServerEnv, "1")
+
+	pawdy, err := NewWithOptions(Options{Config: &types.Config{
+		Backend:         "llamacpp",
+		ModelPath:       filepath.Join(dir, "chat.gguf"),
+		GuardModelPath:  filepath.Join(dir, "guard.gguf"),
+		LlamaCppServer:  os.Args[0],
+		Safety:          "on",
+		SafetyFailMode:  "closed",
+		PromptInjection: "off",
+		Embeddings:      "ollama-nomic",
+		EmbeddingModel:  "nomic-embed-text",
+		OllamaURL:       "http://127.0.0.1:1",
+		VectorDB:        "memory",
+		ContextWindow:   4096,
+		MaxTokens:       512,
+		MMRLambda:       1,
+		RequestTimeout:  time.Minute,
+	}})
+	require.NoError(t, err)
+	t.Cleanup(func() { pawdy.Close() })
+
+	// Chat and safety run in separate llama-servers, each with its own model
+	answer, err := pawdy.LLMClient.Generate(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Boot into rescue mode.", answer)
+
+	result, err := pawdy.SafetyGate.CheckInput(context.Background(), "How do I gather initramfs logs?")
+	require.NoError(t, err)
+	assert.False(t, result.IsSafe)
+	assert.Equal(t, "S1", result.Category)
+}
+
+func TestNewWithOptions_GuardURL(t *testing.T) {
+	// ollamaServer serves installed, answering every generation with response and
+	// recording the models asked for
+	ollamaServer := func(installed []string, response string, models *[]string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/tags":
+				var tags []map[string]any
+				for _, name := range installed {
+					tags = append(tags, map[string]any{"name": name})
+				}
+				json.NewEncoder(w).Encode(map[string]any{"models": tags})
+			case "/api/generate":
+				var req struct{ Model string }
+				json.NewDecoder(r.Body).Decode(&req)
+				*models = append(*models, req.Model)
+				json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "response": response, "done": true})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	var chatModels, guardModels []string
+	chatServer := ollamaServer([]string{"llama3.1:8b", "nomic-embed-text"}, "Boot into rescue mode.", &chatModels)
+	guardServer := ollamaServer([]string{"llama-guard3:1b"}, "unsafe\nS1", &guardModels)
+
+	pawdy, err := NewWithOptions(Options{Config: &types.Config{
+		Backend:         "ollama",
+		OllamaURL:       chatServer.URL,
+		OllamaModel:     "llama3.1:8b",
+		GuardURL:        guardServer.URL,
+		GuardModel:      "llama-guard3:1b",
+		Safety:          "on",
+		SafetyFailMode:  "closed",
+		PromptInjection: "off",
+		Embeddings:      "ollama-nomic",
+		EmbeddingModel:  "nomic-embed-text",
+		VectorDB:        "memory",
+		ContextWindow:   4096,
+		MaxTokens:       512,
+		MMRLambda:       1,
+		RequestTimeout:  time.Minute,
+	}})
+	require.NoError(t, err)
+	t.Cleanup(func() { pawdy.Close() })
+
+	// The guard model runs on its own server, the chat model on ollama_url
+	answer, err := pawdy.LLMClient.Generate(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Boot into rescue mode.", answer)
+
+	result, err := pawdy.SafetyGate.CheckInput(context.Background(), "How do I gather initramfs logs?")
+	require.NoError(t, err)
+	assert.False(t, result.IsSafe)
+
+	assert.Equal(t, []string{"llama3.1:8b"}, chatModels)
+	assert.Equal(t, []string{"llama-guard3:1b"}, guardModels)
+}
+
+func TestAsk_EmptyQuestion(t *testing.T) {
+	pawdy := &App{}
+	ctx := context.Background()
+
+	_, _, err := pawdy.Ask(ctx, " \t\n ", types.GenerateOptions{})
+	assert.ErrorIs(t, err, ErrEmptyQuestion)
+
+	_, _, err = pawdy.AskStream(ctx, "   ", nil, types.GenerateOptions{})
+	assert.ErrorIs(t, err, ErrEmptyQuestion)
+}
+
+// streamingClient is an LLMClient that streams a fixed sequence of tokens.
+type streamingClient struct {
+	types.LLMClient
+	tokens []string
+}
+
+func (c *streamingClient) GenerateStream(ctx context.Context, prompt string, opts types.GenerateOptions) (<-chan types.StreamToken, error) {
+	tokens := make(chan types.StreamToken, len(c.tokens))
+	for _, text := range c.tokens {
+		tokens <- types.StreamToken{Text: text}
+	}
+	close(tokens)
+	return tokens, nil
+}
+
+func TestLogLLMCalls_Stream(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client := logLLMCalls(&streamingClient{tokens: []string{"Hello", ", world"}}, logger, "chat")
+
+	tokens, err := client.GenerateStream(context.Background(), "Say hello", types.GenerateOptions{})
+	require.NoError(t, err)
+
+	var response string
+	for token := range tokens {
+		response += token.Text
+	}
+
+	assert.Equal(t, "Hello, world", response)
+	assert.Contains(t, logs.String(), "response_chars=12")
+	assert.Contains(t, logs.String(), "role=chat")
+	assert.Nil(t, logLLMCalls(nil, logger, "safety"))
+}
+
+func TestWritePromptTrace(t *testing.T) {
+	var trace bytes.Buffer
+	docs := []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Score: 0.8125, Metadata: map[string]any{"path": "/docs/initramfs.md"}},
+	}
+
+	writePromptTrace(&trace, "You are Pawdy.", "Context: Boot into rescue mode.", docs)
+
+	assert.Contains(t, trace.String(), "[1] /docs/initramfs.md (score: 0.812)")
+	assert.Contains(t, trace.String(), "===== System prompt =====\nYou are Pawdy.\n")
+	assert.Contains(t, trace.String(), "===== Prompt =====\nContext: Boot into rescue mode.\n")
+}
+
+func TestWriteRetrievalTrace(t *testing.T) {
+	var trace bytes.Buffer
+	vector := []float32{0.6, 0.8, 0, 0, 0, 0, 0, 0, 0, 0}
+	docs := []*types.Document{
+		{ID: "a1b2c3-0", Score: 0.5125, Metadata: map[string]any{"path": "/docs/initramfs.md"}},
+		{ID: "d4e5f6-0", Score: 0.5025},
+	}
+
+	writeRetrievalTrace(&trace, vector, docs)
+
+	assert.Contains(t, trace.String(), "Query embedding: 10 dimensions, norm 1.0000, [0.6000, 0.8000, 0.0000")
+	assert.Contains(t, trace.String(), "0.0000, ...]")
+	assert.Contains(t, trace.String(), "[1] /docs/initramfs.md (raw score: 0.51250)")
+	assert.Contains(t, trace.String(), "[2] d4e5f6-0 (raw score: 0.50250)")
+	assert.Contains(t, trace.String(), "Score range: 0.50250 to 0.51250 (spread 0.01000)")
+}
+
+func TestBlockedError(t *testing.T) {
+	err := fmt.Errorf("stream failed: %w", &BlockedError{Stage: "output", Category: "S1", Categories: []string{"S1", "S9"}})
+
+	assert.ErrorIs(t, err, ErrSafetyBlocked)
+	assert.Contains(t, err.Error(), "(categories: S1 - Violent Crimes, S9 - Indiscriminate Weapons)")
+}
+
+func TestAskStream_BlockedCustomCategory(t *testing.T) {
+	pawdy := &App{
+		Config:    &types.Config{TopK: 5},
+		LLMClient: &testutil.HealthyClient{Answer: "Use rescue mode."},
+		SafetyGate: safety.NewGuardWithOptions(&verdictClient{verdict: "unsafe\nS15"}, true, safety.GuardOptions{
+			Categories: map[string]string{"S15": "Production credentials"},
+		}),
+		Retriever:     rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+		Embeddings:    &testutil.ConstantEmbeddings{},
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+
+	tokens, _, err := pawdy.AskStream(context.Background(), "What is the BMC password for rack 12?", nil, types.GenerateOptions{})
+	require.NoError(t, err)
+	token := <-tokens
+	var blocked *BlockedError
+	require.ErrorAs(t, token.Error, &blocked)
+	assert.Contains(t, blocked.Error(), "(category: S15 - Production credentials)")
+
+	answer, err := pawdy.AskDetailed(context.Background(), "What is the BMC password for rack 12?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, blocked.Error(), answer.Answer)
+}
+
+func TestHealthCheck_EmbeddingsDown(t *testing.T) {
+	pawdy := &App{
+		Config:     &types.Config{Backend: "ollama", VectorDB: "memory", Embeddings: "ollama-nomic"},
+		LLMClient:  &testutil.HealthyClient{},
+		SafetyGate: safety.NewGuard(nil, false),
+		Retriever:  rag.NewInMemoryRetriever(&testutil.DownEmbeddings{}),
+	}
+
+	statuses, err := pawdy.HealthCheck(context.Background())
+	require.NoError(t, err)
+
+	var embeddings *types.HealthStatus
+	for _, status := range statuses {
+		if status.Name == "Embeddings (ollama-nomic)" {
+			embeddings = status
+		}
+	}
+	require.NotNil(t, embeddings)
+	assert.False(t, embeddings.Healthy)
+	assert.Equal(t, "connection refused", embeddings.Message)
+}
+
+func TestGenerateOptions_Overrides(t *testing.T) {
+	pawdy := &App{Config: &types.Config{
+		Temperature:   0.6,
+		TopP:          0.9,
+		MaxTokens:     1024,
+		StopSequences: []string{"\nSources:"},
+		ContextWindow: 4096,
+	}}
+
+	opts := pawdy.generateOptions(types.GenerateOptions{})
+	assert.Equal(t, types.GenerateOptions{Temperature: 0.6, TopP: 0.9, MaxTokens: 1024, StopSequences: []string{"\nSources:"}}, opts)
+
+	opts = pawdy.generateOptions(types.GenerateOptions{TopP: 0.5, MaxTokens: 256})
+	assert.Equal(t, 0.6, opts.Temperature)
+	assert.Equal(t, 0.5, opts.TopP)
+	assert.Equal(t, 256, opts.MaxTokens)
+	assert.Equal(t, []string{"\nSources:"}, opts.StopSequences)
+
+	// ask --stop replaces the configured stop sequences
+	opts = pawdy.generateOptions(types.GenerateOptions{StopSequences: []string{"</answer>"}})
+	assert.Equal(t, []string{"</answer>"}, opts.StopSequences)
+
+	assert.NoError(t, pawdy.ValidateOverrides(types.GenerateOptions{}))
+	assert.Error(t, pawdy.ValidateOverrides(types.GenerateOptions{TopP: 1.5}))
+	assert.Error(t, pawdy.ValidateOverrides(types.GenerateOptions{MaxTokens: 4096}))
+	assert.Error(t, pawdy.ValidateOverrides(types.GenerateOptions{StopSequences: []string{""}}))
+}
+
+func TestChunkFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runbook.md")
+	require.NoError(t, os.WriteFile(path, []byte("# Runbook\n\nBoot into rescue mode and collect the logs.\n"), 0o644))
+
+	pawdy := &App{
+		Config: &types.Config{ChunkTokens: 500, ChunkOverlap: 50},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+
+	documents, err := pawdy.ChunkFile(context.Background(), path, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Contains(t, documents[0].Content, "Boot into rescue mode")
+}
+
+func TestIngestFile_NoChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "diagrams.md")
+	require.NoError(t, os.WriteFile(path, []byte("![topology](topology.png)\n\n![racks](racks.png)\n"), 0o644))
+
+	var logs bytes.Buffer
+	pawdy := &App{
+		Config:    &types.Config{ChunkTokens: 500, ChunkOverlap: 50, Dedupe: "off"},
+		Retriever: rag.NewInMemoryRetriever(&testutil.DownEmbeddings{}),
+		Logger:    slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+
+	chunks, _, err := pawdy.IngestFile(context.Background(), path, 0, 0, false)
+	assert.ErrorIs(t, err, ErrNoChunks)
+	assert.Zero(t, chunks)
+	assert.Contains(t, logs.String(), "source produced no chunks")
+}
+
+// flakyEmbeddings embeds any texts as [1, 0] unless one of them contains fail.
+type flakyEmbeddings struct {
+	types.EmbeddingProvider
+	fail string
+}
+
+func (e *flakyEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		if e.fail != "" && strings.Contains(text, e.fail) {
+			return nil, errors.New("input too long")
+		}
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func TestIngestFile_Unchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runbook.md")
+	require.NoError(t, os.WriteFile(path, []byte("# Rescue\n\nBoot into rescue mode.\n\n# Logs\n\nCollect the journal.\n"), 0o644))
+
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	pawdy := &App{
+		Config:    &types.Config{ChunkTokens: 8, Dedupe: "off", SourceWeight: 1},
+		Retriever: retriever,
+		Logger:    slog.New(slog.DiscardHandler),
+	}
+	ctx := context.Background()
+	indexed := func() int {
+		stats, err := retriever.Stats(ctx)
+		require.NoError(t, err)
+		return stats.Chunks
+	}
+
+	chunks, _, err := pawdy.IngestFile(ctx, path, 0, 0, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, chunks)
+
+	_, _, err = pawdy.IngestFile(ctx, path, 0, 0, false)
+	assert.ErrorIs(t, err, ErrUnchanged)
+
+	// force re-indexes in place
+	chunks, _, err = pawdy.IngestFile(ctx, path, 0, 0, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, chunks)
+	assert.Equal(t, 2, indexed())
+
+	// A changed file replaces its old chunks
+	require.NoError(t, os.WriteFile(path, []byte("# Rescue\n\nBoot into rescue mode.\n"), 0o644))
+	chunks, _, err = pawdy.IngestFile(ctx, path, 0, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, chunks)
+	assert.Equal(t, 1, indexed())
+}
+
+func TestIngestFile_PartialRetried(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runbook.md")
+	require.NoError(t, os.WriteFile(path, []byte("# Rescue\n\nBoot into rescue mode.\n\n# Logs\n\nCollect the journal.\n\n# DHCP\n\nRestart dnsmasq.\n"), 0o644))
+
+	embeddings := &flakyEmbeddings{fail: "journal"}
+	retriever := rag.NewInMemoryRetriever(embeddings)
+	pawdy := &App{
+		Config:    &types.Config{ChunkTokens: 8, Dedupe: "off"},
+		Retriever: retriever,
+		Logger:    slog.New(slog.DiscardHandler),
+	}
+	ctx := context.Background()
+
+	chunks, _, err := pawdy.IngestFile(ctx, path, 0, 0, false)
+	var partial *types.PartialIndexError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, 2, chunks)
+
+	// The file isn't recorded as unchanged, so the next ingest indexes the missing chunk
+	embeddings.fail = ""
+	chunks, _, err = pawdy.IngestFile(ctx, path, 0, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, chunks)
+
+	stats, err := retriever.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Chunks)
+
+	_, _, err = pawdy.IngestFile(ctx, path, 0, 0, false)
+	assert.ErrorIs(t, err, ErrUnchanged)
+}
+
+func TestIngestFile_DedupeKeepsSharedChunks(t *testing.T) {
+	dir := t.TempDir()
+	storage := filepath.Join(dir, "storage.md")
+	networking := filepath.Join(dir, "networking.md")
+	require.NoError(t, os.WriteFile(storage, []byte("# Prerequisites\n\nInstall the prerequisites.\n\n# Storage\n\nConfigure storage.\n"), 0o644))
+	require.NoError(t, os.WriteFile(networking, []byte("# Prerequisites\n\nInstall the prerequisites.\n\n# Networking\n\nConfigure networking.\n"), 0o644))
+
+	retriever := rag.NewInMemoryRetriever(&flakyEmbeddings{})
+	pawdy := &App{
+		Config:    &types.Config{ChunkTokens: 8, Dedupe: "exact"},
+		Retriever: retriever,
+		Logger:    slog.New(slog.DiscardHandler),
+	}
+	ctx := context.Background()
+
+	_, _, err := pawdy.IngestFile(ctx, storage, 0, 0, false)
+	require.NoError(t, err)
+	_, duplicates, err := pawdy.IngestFile(ctx, networking, 0, 0, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, duplicates)
+
+	// storage.md drops the shared block; networking.md keeps it
+	require.NoError(t, os.WriteFile(storage, []byte("# Storage\n\nConfigure storage.\n"), 0o644))
+	_, _, err = pawdy.IngestFile(ctx, storage, 0, 0, false)
+	require.NoError(t, err)
+
+	documents, err := retriever.Search(ctx, "prerequisites", 10)
+	require.NoError(t, err)
+	var shared []string
+	for _, doc := range documents {
+		if strings.Contains(doc.Content, "# Prerequisites") {
+			shared = append(shared, doc.Metadata["path"].(string))
+		}
+	}
+	assert.Len(t, documents, 4)
+	assert.Equal(t, []string{networking}, shared)
+
+	// Removing networking.md as well finally drops the block
+	require.NoError(t, retriever.DeleteSource(ctx, networking))
+	documents, err = retriever.Search(ctx, "prerequisites", 10)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, storage, documents[0].Metadata["path"])
+}
+
+// verdictClient is an LLMClient that answers every prompt with a fixed guard verdict.
+type verdictClient struct {
+	types.LLMClient
+	verdict string
+}
+
+func (c *verdictClient) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	return c.verdict, nil
+}
+
+// waitingRetriever is a Retriever whose searches block until their context is done.
+type waitingRetriever struct {
+	types.Retriever
+	cancelled chan struct{}
+}
+
+func (r *waitingRetriever) Search(ctx context.Context, query string, topK int) ([]*types.Document, error) {
+	<-ctx.Done()
+	close(r.cancelled)
+	return nil, ctx.Err()
+}
+
+func TestAskDetailed_BlockedInputCancelsSearch(t *testing.T) {
+	retriever := &waitingRetriever{cancelled: make(chan struct{})}
+	pawdy := &App{
+		Config:     &types.Config{TopK: 5},
+		SafetyGate: safety.NewGuard(&verdictClient{verdict: "unsafe\nS1"}, true),
+		Retriever:  retriever,
+		Logger:     slog.New(slog.DiscardHandler),
+	}
+
+	answer, err := pawdy.AskDetailed(context.Background(), "How do I hurt someone?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.True(t, answer.Safety.Blocked)
+	assert.Equal(t, "input", answer.Safety.Stage)
+
+	select {
+	case <-retriever.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("search was not cancelled after the input was blocked")
+	}
+}
+
+func TestModels(t *testing.T) {
+	ollamaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models": [
+			{"name": "llama3.1:8b", "size": 4920753328, "modified_at": "2025-05-11T09:00:00Z"},
+			{"name": "nomic-embed-text:latest", "size": 274302450, "modified_at": "2025-05-10T09:00:00Z"}
+		]}`))
+	}))
+	defer ollamaServer.Close()
+
+	cfg := &types.Config{
+		Backend:        "ollama",
+		OllamaURL:      ollamaServer.URL,
+		OllamaModel:    "llama3.1:8b",
+		Safety:         "on",
+		GuardModel:     "llama-guard3:1b",
+		Embeddings:     "ollama-nomic",
+		EmbeddingModel: "nomic-embed-text",
+		RequestTimeout: time.Second,
+	}
+
+	installed, configured, err := Models(context.Background(), cfg)
+	require.NoError(t, err)
+	require.Len(t, installed, 2)
+	assert.Equal(t, int64(4920753328), installed[0].Size)
+
+	require.Len(t, configured, 3)
+	assert.Equal(t, ConfiguredModel{Role: "chat", Name: "llama3.1:8b", Installed: true}, *configured[0])
+	assert.Equal(t, ConfiguredModel{Role: "guard", Name: "llama-guard3:1b", Installed: false}, *configured[1])
+	assert.Equal(t, ConfiguredModel{Role: "embeddings", Name: "nomic-embed-text", Installed: true}, *configured[2])
+}
+
+func TestRetrieve(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/initramfs.md"}},
+	}))
+
+	pawdy := &App{
+		Config:        &types.Config{TopK: 5},
+		SafetyGate:    safety.NewGuard(nil, false),
+		Retriever:     retriever,
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+
+	retrieved, err := pawdy.Retrieve(context.Background(), "How do I gather initramfs logs?")
+	require.NoError(t, err)
+	assert.Empty(t, retrieved.Answer)
+	require.Len(t, retrieved.Sources, 1)
+	assert.Equal(t, "/docs/initramfs.md", retrieved.Sources[0].Path)
+}
+
+// scriptedClient is an LLMClient that answers generations with responses in turn.
+type scriptedClient struct {
+	types.LLMClient
+	responses []string
+	calls     int
+}
+
+func (c *scriptedClient) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	response := c.responses[c.calls]
+	c.calls++
+	return response, nil
+}
+
+func (c *scriptedClient) GenerateStream(ctx context.Context, prompt string, opts types.GenerateOptions) (<-chan types.StreamToken, error) {
+	response, _ := c.Generate(ctx, prompt, opts)
+	tokens := make(chan types.StreamToken, 2)
+	tokens <- types.StreamToken{Text: response}
+	tokens <- types.StreamToken{Done: true}
+	close(tokens)
+	return tokens, nil
+}
+
+func TestAskDetailed_EmptyResponseRetry(t *testing.T) {
+	newApp := func(client types.LLMClient, retries int) *App {
+		return &App{
+			Config:        &types.Config{TopK: 5, EmptyResponseRetries: retries},
+			LLMClient:     client,
+			SafetyGate:    safety.NewGuard(nil, false),
+			Retriever:     rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+			PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+			Logger:        slog.New(slog.DiscardHandler),
+		}
+	}
+
+	client := &scriptedClient{responses: []string{" \n", "Reboot the host."}}
+	answer, err := newApp(client, 1).AskDetailed(context.Background(), "How do I recover?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Reboot the host.", answer.Answer)
+	assert.Equal(t, 2, client.calls)
+
+	client = &scriptedClient{responses: []string{"", ""}}
+	answer, err = newApp(client, 1).AskDetailed(context.Background(), "How do I recover?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, EmptyResponseMessage, answer.Answer)
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestAskStream(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/recovery/initramfs.md"}},
+	}))
+	newApp := func(guard types.SafetyGate) *App {
+		return &App{
+			Config:        &types.Config{TopK: 5},
+			LLMClient:     &streamingClient{tokens: []string{"Boot ", "into ", "rescue mode."}},
+			SafetyGate:    guard,
+			Retriever:     retriever,
+			PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+			Logger:        slog.New(slog.DiscardHandler),
+		}
+	}
+
+	// Tokens arrive one by one, with the sources known up front
+	tokens, sources, err := newApp(safety.NewGuard(nil, false)).AskStream(context.Background(), "How do I gather initramfs logs?", nil, types.GenerateOptions{})
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, "/docs/recovery/initramfs.md", sources[0].Path)
+	var texts []string
+	for token := range tokens {
+		require.NoError(t, token.Error)
+		if token.Text != "" {
+			texts = append(texts, token.Text)
+		}
+	}
+	assert.Equal(t, []string{"Boot ", "into ", "rescue mode."}, texts)
+
+	// An answer that fails the output check ends with a BlockedError
+	guard := safety.NewGuard(&scriptedClient{responses: []string{"safe", "unsafe\nS9"}}, true)
+	tokens, _, err = newApp(guard).AskStream(context.Background(), "How do I gather initramfs logs?", nil, types.GenerateOptions{})
+	require.NoError(t, err)
+	var last types.StreamToken
+	for token := range tokens {
+		last = token
+	}
+	var blocked *BlockedError
+	require.ErrorAs(t, last.Error, &blocked)
+	assert.Equal(t, "output", blocked.Stage)
+	assert.Equal(t, "S9", blocked.Category)
+}
+
+func TestAskStream_EmptyResponseRetry(t *testing.T) {
+	ask := func(client types.LLMClient) string {
+		pawdy := &App{
+			Config:        &types.Config{TopK: 5, EmptyResponseRetries: 1},
+			LLMClient:     client,
+			SafetyGate:    safety.NewGuard(nil, false),
+			Retriever:     rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+			PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+			Logger:        slog.New(slog.DiscardHandler),
+		}
+
+		tokens, _, err := pawdy.AskStream(context.Background(), "How do I recover?", nil, types.GenerateOptions{})
+		require.NoError(t, err)
+
+		var text strings.Builder
+		for token := range tokens {
+			require.NoError(t, token.Error)
+			text.WriteString(token.Text)
+		}
+		return text.String()
+	}
+
+	client := &scriptedClient{responses: []string{" \n", "Reboot the host."}}
+	assert.Equal(t, " \nReboot the host.", ask(client))
+	assert.Equal(t, 2, client.calls)
+
+	client = &scriptedClient{responses: []string{"", ""}}
+	assert.Equal(t, EmptyResponseMessage, ask(client))
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestAskDetailed_Cache(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/initramfs.md"}},
+	}))
+
+	client := &scriptedClient{responses: []string{"Use rescue mode.", "Use the BMC console."}}
+	pawdy := &App{
+		Config:        &types.Config{TopK: 5},
+		LLMClient:     client,
+		SafetyGate:    safety.NewGuard(nil, false),
+		Retriever:     retriever,
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+		Cache:         NewAnswerCache(t.TempDir(), time.Hour),
+	}
+
+	answer, err := pawdy.AskDetailed(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Use rescue mode.", answer.Answer)
+	assert.Contains(t, answer.Formatted, "**Sources:**\n[1] /docs/initramfs.md")
+
+	// The same question, differently spaced and cased, is answered from the cache
+	answer, err = pawdy.AskDetailed(context.Background(), "how do I  gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Use rescue mode.", answer.Answer)
+	require.Len(t, answer.Sources, 1)
+	assert.Equal(t, 1, client.calls)
+
+	// Cached answers are formatted in the current citation_style
+	pawdy.PromptBuilder.SetCitationStyle(prompt.CitationNone)
+	answer, err = pawdy.AskDetailed(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Use rescue mode.", answer.Formatted)
+
+	// Re-ingesting the document changes the context and misses the cache
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Use the BMC console.", Metadata: map[string]any{"path": "/docs/initramfs.md"}},
+	}))
+	answer, err = pawdy.AskDetailed(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Use the BMC console.", answer.Answer)
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestAskDetailed_JSON(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/initramfs.md", "title": "Initramfs"}},
+	}))
+
+	pawdy := &App{
+		Config:        &types.Config{TopK: 5},
+		LLMClient:     &scriptedClient{responses: []string{"Use rescue mode."}},
+		SafetyGate:    safety.NewGuard(&verdictClient{verdict: "safe"}, true),
+		Retriever:     retriever,
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+
+	answer, err := pawdy.AskDetailed(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	data, err := json.Marshal(answer)
+	require.NoError(t, err)
+
+	var decoded struct {
+		Answer  string
+		Sources []map[string]any
+		Safety  map[string]any
+	}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "Use rescue mode.", decoded.Answer)
+	require.Len(t, decoded.Sources, 1)
+	assert.Equal(t, "a1b2c3-0", decoded.Sources[0]["id"])
+	assert.Equal(t, "Initramfs", decoded.Sources[0]["title"])
+	assert.Equal(t, "/docs/initramfs.md", decoded.Sources[0]["path"])
+	assert.Contains(t, decoded.Sources[0], "score")
+	assert.Equal(t, map[string]any{"enabled": true, "blocked": false}, decoded.Safety)
+}
+
+func TestAskDetailed_BlockedOutput(t *testing.T) {
+	pawdy := &App{
+		Config:    &types.Config{TopK: 5},
+		LLMClient: &scriptedClient{responses: []string{"The BMC password is calvin."}},
+		SafetyGate: safety.NewGuard(&funcClient{generate: func(prompt string) (string, error) {
+			if strings.Contains(prompt, "calvin") {
+				return "unsafe\nS7,S2", nil
+			}
+			return "safe", nil
+		}}, true),
+		Retriever:     rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+
+	answer, err := pawdy.AskDetailed(context.Background(), "What is the BMC password for rack 12?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pawdy.RefusalMessage("S7", "S2"), answer.Answer)
+	assert.Equal(t, SafetyReport{
+		Enabled:    true,
+		Blocked:    true,
+		Stage:      "output",
+		Category:   "S7",
+		Categories: []string{"S7", "S2"},
+		Reason:     "Privacy; Non-Violent Crimes",
+	}, answer.Safety)
+}
+
+func TestFilterByScore(t *testing.T) {
+	documents := []*types.Document{
+		{ID: "initramfs", Score: 0.82},
+		{ID: "bmc", Score: 0.5},
+		{ID: "networking", Score: 0.31},
+	}
+
+	tests := []struct {
+		minScore     float64
+		want         []string
+		wantFiltered int
+	}{
+		{minScore: 0, want: []string{"initramfs", "bmc", "networking"}},
+		{minScore: 0.5, want: []string{"initramfs", "bmc"}, wantFiltered: 1},
+		{minScore: 0.9, want: []string{}, wantFiltered: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.minScore), func(t *testing.T) {
+			kept, filtered := filterByScore(documents, tt.minScore)
+			ids := []string{}
+			for _, doc := range kept {
+				ids = append(ids, doc.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+			assert.Equal(t, tt.wantFiltered, filtered)
+		})
+	}
+}
+
+func TestAnswerCache_Key(t *testing.T) {
+	cache := NewAnswerCache(t.TempDir(), time.Hour)
+	gen := &generation{documents: []*types.Document{{ID: "a1b2c3-0", Content: "Boot into rescue mode."}}}
+	cfg := &types.Config{Safety: "on", SafetyThreshold: 0.5, SafetyDisabledCategories: []string{"S6", "S2"}}
+	key := cache.key(cfg, "How do I gather initramfs logs?", gen)
+
+	reordered := *cfg
+	reordered.SafetyDisabledCategories = []string{"S2", "S6"}
+	assert.Equal(t, key, cache.key(&reordered, "How do I gather initramfs logs?", gen))
+
+	// Answers generated under other safety settings are not reused
+	for _, change := range []func(*types.Config){
+		func(c *types.Config) { c.Safety = "off" },
+		func(c *types.Config) { c.SafetyThreshold = 0.95 },
+		func(c *types.Config) { c.SafetyDisabledCategories = []string{"S6"} },
+	} {
+		changed := *cfg
+		change(&changed)
+		assert.NotEqual(t, key, cache.key(&changed, "How do I gather initramfs logs?", gen))
+	}
+}
+
+func TestAnswerCache_Prune(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewAnswerCache(dir, time.Hour)
+	cache.maxEntries = 2
+
+	require.NoError(t, cache.put("expired", "Use rescue mode."))
+	twoHoursAgo := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "expired.json"), twoHoursAgo, twoHoursAgo))
+	require.NoError(t, cache.put("oldest", "Use the BMC console."))
+	minuteAgo := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "oldest.json"), minuteAgo, minuteAgo))
+	require.NoError(t, cache.put("older", "Check dmesg."))
+	require.NoError(t, cache.put("newest", "Check journalctl."))
+
+	// The expired entry is removed, then the oldest beyond the cap
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"older.json", "newest.json"}, names)
+}
+
+func TestPreviousIngestion(t *testing.T) {
+	docs := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(docs, "runbook.md"), []byte("# Runbook"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(docs, "network.md"), []byte("# Network"), 0o644))
+	files := []string{filepath.Join(docs, "network.md"), filepath.Join(docs, "runbook.md")}
+
+	pawdy := &App{
+		Config:       &types.Config{Collection: "pawdy"},
+		Retriever:    rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+		ManifestPath: filepath.Join(t.TempDir(), "ingested.json"),
+	}
+	previous, err := pawdy.PreviousIngestion(docs, files)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+	require.NoError(t, pawdy.RecordIngestion(docs, files))
+
+	// The same path updates the indexed files
+	previous, err = pawdy.PreviousIngestion(docs+string(filepath.Separator), files)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+
+	// A copy of the directory would index the files twice
+	cp := t.TempDir()
+	var copied []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		target := filepath.Join(cp, filepath.Base(file))
+		require.NoError(t, os.WriteFile(target, data, 0o644))
+		copied = append(copied, target)
+	}
+	previous, err = pawdy.PreviousIngestion(cp, copied)
+	require.NoError(t, err)
+	require.NotNil(t, previous)
+	assert.Equal(t, docs, previous.Path)
+
+	// Resetting the collection forgets what was ingested into it
+	require.NoError(t, pawdy.Reset(context.Background(), ""))
+	previous, err = pawdy.PreviousIngestion(cp, copied)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+}
+
+func TestPreviousIngestion_NoManifest(t *testing.T) {
+	t.Setenv("HOME", "")
+	_, err := DefaultManifestPath()
+	require.Error(t, err)
+
+	// Without a manifest ingestion and reset still work, nothing is recorded
+	docs := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(docs, "runbook.md"), []byte("# Runbook"), 0o644))
+	files := []string{filepath.Join(docs, "runbook.md")}
+	pawdy := &App{
+		Config:    &types.Config{Collection: "pawdy"},
+		Retriever: rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+	}
+	require.NoError(t, pawdy.RecordIngestion(docs, files))
+	previous, err := pawdy.PreviousIngestion(t.TempDir(), files)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+	require.NoError(t, pawdy.Reset(context.Background(), ""))
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(ctx, []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/initramfs.md"}},
+	}))
+	pawdy := &App{Config: &types.Config{Collection: "pawdy"}, Retriever: retriever}
+
+	// A collection other than the one the retriever was opened for is refused
+	err := pawdy.Reset(ctx, "networking")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"networking" does not match the configured collection "pawdy"`)
+	documents, err := retriever.Search(ctx, "rescue", 5)
+	require.NoError(t, err)
+	assert.Len(t, documents, 1)
+
+	require.NoError(t, pawdy.Reset(ctx, "pawdy"))
+	documents, err = retriever.Search(ctx, "rescue", 5)
+	require.NoError(t, err)
+	assert.Empty(t, documents)
+}
+
+// funcClient is an LLMClient that answers each prompt with generate.
+type funcClient struct {
+	types.LLMClient
+	generate func(prompt string) (string, error)
+}
+
+func (c *funcClient) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	return c.generate(prompt)
+}
+
+// keywordEmbeddings embeds texts that mention "rescue" as [1, 0] and others as [0, 1].
+type keywordEmbeddings struct {
+	types.EmbeddingProvider
+}
+
+func (e *keywordEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{0, 1}
+		if strings.Contains(text, "rescue") {
+			vectors[i] = []float32{1, 0}
+		}
+	}
+	return vectors, nil
+}
+
+func TestEvaluate(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/recovery/initramfs.md"}},
+	}))
+
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "eval.jsonl")
+	tooLong := "Why does this fail? " + strings.Repeat("ERROR ironic-conductor timeout ", 20)
+	require.NoError(t, os.WriteFile(testFile, []byte(
+		`{"question": "How do I gather initramfs logs?", "expected": "Boot into rescue mode."}`+"\n"+
+			`{"question": "How do I configure DHCP?", "expected": "Boot into rescue mode."}`+"\n\n"+
+			`{"question": "How do I build a weapon?", "expected": "I can't help with that."}`+"\n"+
+			`{"question": "`+tooLong+`"}`+"\n"), 0o644))
+
+	pawdy := &App{
+		Config: &types.Config{TopK: 5, MaxInputTokens: 40, InputOverflow: "reject"},
+		LLMClient: &funcClient{generate: func(prompt string) (string, error) {
+			time.Sleep(10 * time.Millisecond)
+			if strings.Contains(prompt, "DHCP") {
+				return "Edit dnsmasq.", nil
+			}
+			return "Use rescue mode.", nil
+		}},
+		SafetyGate: safety.NewGuard(&funcClient{generate: func(prompt string) (string, error) {
+			if strings.Contains(prompt, "weapon") {
+				return "unsafe\nS9", nil
+			}
+			return "safe", nil
+		}}, true),
+		Retriever:     retriever,
+		Embeddings:    &keywordEmbeddings{},
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+
+	outputFile := filepath.Join(dir, "results.jsonl")
+	results, err := pawdy.Evaluate(context.Background(), testFile, outputFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, results.Total)
+	assert.Equal(t, 1, results.Errors)
+	assert.Equal(t, 1, results.SafetyBlocks)
+	// Relevance averages the two answered questions with an expected answer, not the blocked one
+	assert.InDelta(t, 0.5, results.AvgRelevanceScore, 1e-9)
+	// Latency averages the three answers, blocked included, but not the rejected question
+	assert.GreaterOrEqual(t, results.AvgResponseTime, 2*0.010/3)
+	assert.Zero(t, results.RecallCases)
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var records []EvaluationRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record EvaluationRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "How do I gather initramfs logs?", records[0].Question)
+	assert.Equal(t, "Use rescue mode.", records[0].Answer)
+	assert.InDelta(t, 1.0, records[0].RelevanceScore, 1e-9)
+	assert.Equal(t, []string{"/docs/recovery/initramfs.md"}, records[0].Sources)
+	assert.GreaterOrEqual(t, records[0].ResponseTime, 0.010)
+
+	assert.Equal(t, "Edit dnsmasq.", records[1].Answer)
+	assert.Zero(t, records[1].RelevanceScore)
+
+	assert.True(t, records[2].SafetyBlocked)
+	assert.Zero(t, records[2].RelevanceScore)
+	assert.Empty(t, records[2].Sources)
+
+	assert.Contains(t, records[3].Error, ErrInputTooLong.Error())
+	assert.Empty(t, records[3].Answer)
+}
+
+func TestEvaluate_RecallAtK(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/recovery/initramfs.md"}},
+	}))
+
+	testFile := filepath.Join(t.TempDir(), "eval.jsonl")
+	require.NoError(t, os.WriteFile(testFile, []byte(
+		`{"question": "How do I gather initramfs logs?", "expected_source": "recovery/initramfs.md"}`+"\n"+
+			`{"question": "How do I configure DHCP?", "expected_source": "networking/dhcp.md"}`+"\n"+
+			`{"question": "Who owns the lab?"}`+"\n"), 0o644))
+
+	pawdy := &App{
+		Config:        &types.Config{TopK: 5},
+		LLMClient:     &scriptedClient{responses: []string{"Use rescue mode.", "Edit dnsmasq.", "Ask the team."}},
+		SafetyGate:    safety.NewGuard(nil, false),
+		Retriever:     retriever,
+		Embeddings:    &testutil.ConstantEmbeddings{},
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+
+	results, err := pawdy.Evaluate(context.Background(), testFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, results.Total)
+	assert.Equal(t, 2, results.RecallCases)
+	assert.Equal(t, 5, results.TopK)
+	assert.InDelta(t, 0.5, results.RecallAtK, 1e-9)
+}
+
+func TestEvaluate_RecallIgnoresBlockedAnswers(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/recovery/initramfs.md"}},
+	}))
+
+	testFile := filepath.Join(t.TempDir(), "eval.jsonl")
+	require.NoError(t, os.WriteFile(testFile, []byte(
+		`{"question": "How do I gather initramfs logs?", "expected_source": "recovery/initramfs.md"}`+"\n"), 0o644))
+
+	// The question passes the guard but the answer is withdrawn, so it has no sources
+	pawdy := &App{
+		Config:        &types.Config{TopK: 5},
+		LLMClient:     &scriptedClient{responses: []string{"Use rescue mode."}},
+		SafetyGate:    safety.NewGuard(&scriptedClient{responses: []string{"safe", "unsafe\nS2"}}, true),
+		Retriever:     retriever,
+		Embeddings:    &testutil.ConstantEmbeddings{},
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+
+	results, err := pawdy.Evaluate(context.Background(), testFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, results.SafetyBlocks)
+	assert.Equal(t, 1, results.RecallCases)
+	assert.InDelta(t, 1.0, results.RecallAtK, 1e-9, "retrieval found the source even though the answer was blocked")
+}
+
+func TestAskDetailed_MaxInputTokens(t *testing.T) {
+	newApp := func(overflow string) *App {
+		return &App{
+			Config:        &types.Config{TopK: 5, MaxInputTokens: 10, InputOverflow: overflow},
+			LLMClient:     &scriptedClient{responses: []string{"Check the BMC logs."}},
+			SafetyGate:    safety.NewGuard(nil, false),
+			Retriever:     rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+			PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+			Logger:        slog.New(slog.DiscardHandler),
+		}
+	}
+
+	question := "Why does this fail? " + strings.Repeat("ERROR ironic-conductor timeout ", 20)
+
+	_, err := newApp("reject").AskDetailed(context.Background(), question, types.GenerateOptions{})
+	require.ErrorIs(t, err, ErrInputTooLong)
+
+	pawdy := newApp("truncate")
+	answer, err := pawdy.AskDetailed(context.Background(), question, types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Check the BMC logs.", answer.Answer)
+
+	truncated, err := pawdy.checkQuestion(question)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(question, truncated))
+	assert.LessOrEqual(t, len(truncated), 44)
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// AnswerCache stores generated answers on disk so repeated questions are answered
+// without running the model again. Entries are keyed on the normalized question,
+// the model, answer language, generation and safety settings, and the ID and content of every
+// retrieved chunk, so re-ingesting a document that changes the context invalidates them.
+// Storing an answer prunes expired entries and, beyond maxEntries, the oldest.
+type AnswerCache struct {
+	dir        string
+	ttl        time.Duration
+	maxEntries int
+}
+
+// cacheEntry is the file stored for each cached answer.
+type cacheEntry struct {
+	Answer    string    `json:"answer"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// answerCacheMaxEntries bounds how many answers a new cache keeps on disk.
+const answerCacheMaxEntries = 1000
+
+// NewAnswerCache creates a cache in dir whose entries expire after ttl.
+func NewAnswerCache(dir string, ttl time.Duration) *AnswerCache {
+	return &AnswerCache{dir: dir, ttl: ttl, maxEntries: answerCacheMaxEntries}
+}
+
+// DefaultAnswerCacheDir returns ~/.pawdy/answer-cache.
+func DefaultAnswerCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory for the answer cache: %w", err)
+	}
+	return filepath.Join(home, ".pawdy", "answer-cache"), nil
+}
+
+// key identifies the answer to question when generated by cfg's model from gen.
+func (c *AnswerCache) key(cfg *types.Config, question string, gen *generation) string {
+	h := sha256.New()
+	write := func(fields ...string) {
+		for _, field := range fields {
+			h.Write([]byte(field))
+			h.Write([]byte{0})
+		}
+	}
+
+	write(strings.ToLower(strings.Join(strings.Fields(question), " ")))
+	write(cfg.Backend, cfg.OllamaModel, cfg.OpenAIModel, cfg.ModelPath, cfg.ResponseLanguage)
+	// An answer allowed under looser safety settings must not be served under stricter ones
+	write(cfg.Safety, fmt.Sprint(cfg.SafetyThreshold))
+	write(slices.Sorted(slices.Values(cfg.SafetyDisabledCategories))...)
+	write(gen.opts.SystemPrompt, fmt.Sprint(gen.opts.Temperature, gen.opts.TopP, gen.opts.MaxTokens))
+	write(gen.opts.StopSequences...)
+	for _, doc := range gen.documents {
+		write(doc.ID, doc.Content)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the cached answer for key, if there is one that has not expired.
+func (c *AnswerCache) get(key string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return "", false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", false
+	}
+	if c.ttl > 0 && time.Since(entry.CreatedAt) > c.ttl {
+		return "", false
+	}
+	return entry.Answer, true
+}
+
+// put stores answer under key.
+func (c *AnswerCache) put(key, answer string) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create answer cache directory: %w", err)
+	}
+
+	data, err := json.Marshal(cacheEntry{Answer: answer, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write answer cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write answer cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write answer cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key+".json")); err != nil {
+		return err
+	}
+
+	return c.prune()
+}
+
+// prune removes expired entries, then the oldest entries beyond maxEntries.
+// Entries are aged by file modification time, which put sets when it writes them.
+func (c *AnswerCache) prune() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read answer cache directory: %w", err)
+	}
+
+	type cached struct {
+		path    string
+		written time.Time
+	}
+	var kept []cached
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(c.dir, entry.Name())
+		if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+			os.Remove(path)
+			continue
+		}
+		kept = append(kept, cached{path: path, written: info.ModTime()})
+	}
+
+	if len(kept) > c.maxEntries {
+		slices.SortFunc(kept, func(a, b cached) int {
+			return a.written.Compare(b.written)
+		})
+		for _, entry := range kept[:len(kept)-c.maxEntries] {
+			os.Remove(entry.path)
+		}
+	}
+
+	return nil
+}
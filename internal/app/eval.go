@@ -0,0 +1,256 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/rag"
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// EvaluationResults contains evaluation metrics.
+type EvaluationResults struct {
+	Total             int     `json:"total"`
+	Errors            int     `json:"errors"`
+	AvgResponseTime   float64 `json:"avg_response_time"`
+	AvgRelevanceScore float64 `json:"avg_relevance_score"`
+	SafetyBlocks      int     `json:"safety_blocks"`
+
+	// RecallAtK is the share of questions with an expected source whose source was
+	// among the TopK documents retrieved for them: searched, reranked, and weighted
+	// by source, but before min_score, context-window trimming, and any safety check.
+	RecallAtK   float64 `json:"recall_at_k"`
+	RecallCases int     `json:"recall_cases"`
+	TopK        int     `json:"top_k"`
+}
+
+// EvaluationRecord contains the detailed result for a single test question.
+type EvaluationRecord struct {
+	Question       string   `json:"question"`
+	Expected       string   `json:"expected,omitempty"`
+	ExpectedSource string   `json:"expected_source,omitempty"`
+	SourceRank     int      `json:"source_rank,omitempty"` // 1-based position of the expected source among the top_k retrieved; 0 if not retrieved
+	Answer         string   `json:"answer,omitempty"`
+	ResponseTime   float64  `json:"response_time"`
+	RelevanceScore float64  `json:"relevance_score,omitempty"`
+	SafetyBlocked  bool     `json:"safety_blocked,omitempty"`
+	Sources        []string `json:"sources,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// evaluationCase is a single line of the JSONL test file.
+type evaluationCase struct {
+	Question       string `json:"question"`
+	Expected       string `json:"expected"`
+	ExpectedSource string `json:"expected_source"`
+}
+
+// Evaluate runs evaluation against a test set.
+// Each question is answered with Ask; relevance is the embedding cosine similarity
+// between the answer and the expected answer. For questions with an expected source,
+// recall@k is the share whose source path was among the top_k documents retrieved,
+// measured with a separate retrieval so blocked answers and trimmed context don't count as misses.
+// When outputFile is set, a per-question JSONL report is written to it.
+func (a *App) Evaluate(ctx context.Context, testFile, outputFile string) (*EvaluationResults, error) {
+	cases, err := readEvaluationCases(testFile)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &EvaluationResults{TopK: a.Config.TopK}
+	records := make([]*EvaluationRecord, 0, len(cases))
+
+	var totalTime, totalRelevance float64
+	var timed, scored, recalled int
+
+	for _, c := range cases {
+		record := &EvaluationRecord{
+			Question:       c.Question,
+			Expected:       c.Expected,
+			ExpectedSource: c.ExpectedSource,
+		}
+		records = append(records, record)
+		results.Total++
+
+		if c.ExpectedSource != "" {
+			retrieved, err := a.retrieveTopK(ctx, c.Question)
+			if err != nil {
+				record.Error = err.Error()
+				results.Errors++
+				continue
+			}
+
+			record.SourceRank = sourceRank(toSources(retrieved), c.ExpectedSource)
+			results.RecallCases++
+			if record.SourceRank > 0 {
+				recalled++
+			}
+		}
+
+		start := time.Now()
+		answer, err := a.AskDetailed(ctx, c.Question, types.GenerateOptions{})
+		record.ResponseTime = time.Since(start).Seconds()
+
+		if err != nil {
+			record.Error = err.Error()
+			results.Errors++
+			continue
+		}
+
+		record.Answer = answer.Answer
+		totalTime += record.ResponseTime
+		timed++
+
+		for _, source := range answer.Sources {
+			if source.Path != "" {
+				record.Sources = append(record.Sources, source.Path)
+			}
+		}
+
+		if answer.Safety.Blocked {
+			record.SafetyBlocked = true
+			results.SafetyBlocks++
+			continue
+		}
+
+		if c.Expected == "" {
+			continue
+		}
+
+		relevance, err := a.relevanceScore(ctx, answer.Answer, c.Expected)
+		if err != nil {
+			record.Error = err.Error()
+			results.Errors++
+			continue
+		}
+
+		record.RelevanceScore = relevance
+		totalRelevance += relevance
+		scored++
+	}
+
+	if timed > 0 {
+		results.AvgResponseTime = totalTime / float64(timed)
+	}
+	if scored > 0 {
+		results.AvgRelevanceScore = totalRelevance / float64(scored)
+	}
+	if results.RecallCases > 0 {
+		results.RecallAtK = float64(recalled) / float64(results.RecallCases)
+	}
+
+	if outputFile != "" {
+		if err := writeEvaluationRecords(outputFile, records); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// retrieveTopK returns the top_k documents retrieval ranks for question, as the answer
+// would draw its context from before min_score and the context window trim them.
+func (a *App) retrieveTopK(ctx context.Context, question string) ([]*types.Document, error) {
+	documents, _, err := a.search(ctx, question)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve documents: %w", err)
+	}
+	return a.rank(ctx, question, documents)
+}
+
+// sourceRank returns the 1-based position of the first source whose path is expected,
+// or 0 if there is none. A relative expected path also matches the end of a source
+// path, so test files need not repeat the directory documents were ingested from.
+func sourceRank(sources []*Source, expected string) int {
+	expected = filepath.ToSlash(filepath.Clean(expected))
+	for i, source := range sources {
+		if source.Path == "" {
+			continue
+		}
+		path := filepath.ToSlash(filepath.Clean(source.Path))
+		if path == expected || (!filepath.IsAbs(expected) && strings.HasSuffix(path, "/"+expected)) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// relevanceScore embeds the answer and expected text and returns their cosine similarity.
+func (a *App) relevanceScore(ctx context.Context, answer, expected string) (float64, error) {
+	vectors, err := a.Embeddings.Embed(ctx, []string{answer, expected})
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed answer for scoring: %w", err)
+	}
+
+	if len(vectors) != 2 {
+		return 0, fmt.Errorf("expected 2 embeddings for scoring, got %d", len(vectors))
+	}
+
+	return rag.CosineSimilarity(vectors[0], vectors[1]), nil
+}
+
+// readEvaluationCases parses a JSONL test file, skipping blank lines.
+func readEvaluationCases(testFile string) ([]evaluationCase, error) {
+	file, err := os.Open(testFile)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("test file not found: %s", testFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open test file: %w", err)
+	}
+	defer file.Close()
+
+	var cases []evaluationCase
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var c evaluationCase
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("invalid test case on line %d: %w", lineNum, err)
+		}
+
+		if strings.TrimSpace(c.Question) == "" {
+			return nil, fmt.Errorf("test case on line %d has no question", lineNum)
+		}
+
+		cases = append(cases, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read test file: %w", err)
+	}
+
+	return cases, nil
+}
+
+// writeEvaluationRecords writes one JSON record per line to the output file.
+func writeEvaluationRecords(outputFile string, records []*EvaluationRecord) error {
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write evaluation record: %w", err)
+		}
+	}
+
+	return nil
+}
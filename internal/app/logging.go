@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// loggedLLMClient logs the timing and size of every call to a model backend at debug level.
+type loggedLLMClient struct {
+	types.LLMClient
+	logger *slog.Logger
+	role   string // "chat", "safety", or "rerank"
+}
+
+// logLLMCalls wraps client so its calls are logged under role. A nil client stays nil.
+func logLLMCalls(client types.LLMClient, logger *slog.Logger, role string) types.LLMClient {
+	if client == nil {
+		return nil
+	}
+	return &loggedLLMClient{LLMClient: client, logger: logger, role: role}
+}
+
+// Generate produces a complete response and logs how long the backend took.
+func (c *loggedLLMClient) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	start := time.Now()
+	response, err := c.LLMClient.Generate(ctx, prompt, opts)
+
+	c.logger.Debug("backend generate",
+		"role", c.role,
+		"prompt_chars", len(prompt),
+		"response_chars", len(response),
+		"duration", time.Since(start),
+		"error", err)
+
+	return response, err
+}
+
+// GenerateStream produces a streaming response and logs once the stream ends.
+func (c *loggedLLMClient) GenerateStream(ctx context.Context, prompt string, opts types.GenerateOptions) (<-chan types.StreamToken, error) {
+	start := time.Now()
+	upstream, err := c.LLMClient.GenerateStream(ctx, prompt, opts)
+	if err != nil {
+		c.logger.Debug("backend stream failed",
+			"role", c.role,
+			"prompt_chars", len(prompt),
+			"duration", time.Since(start),
+			"error", err)
+		return nil, err
+	}
+
+	tokens := make(chan types.StreamToken)
+	go func() {
+		defer close(tokens)
+
+		responseChars := 0
+		var streamErr error
+		for token := range upstream {
+			responseChars += len(token.Text)
+			if token.Error != nil {
+				streamErr = token.Error
+			}
+			tokens <- token
+		}
+
+		c.logger.Debug("backend stream",
+			"role", c.role,
+			"prompt_chars", len(prompt),
+			"response_chars", responseChars,
+			"duration", time.Since(start),
+			"error", streamErr)
+	}()
+
+	return tokens, nil
+}
+
+// loggedEmbeddings logs the batch size and timing of every embedding call at debug level.
+type loggedEmbeddings struct {
+	types.EmbeddingProvider
+	logger *slog.Logger
+}
+
+// Embed generates embeddings and logs how long the provider took.
+func (e *loggedEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	start := time.Now()
+	vectors, err := e.EmbeddingProvider.Embed(ctx, texts)
+
+	e.logger.Debug("embedded texts",
+		"texts", len(texts),
+		"dimensions", e.GetDimensions(),
+		"duration", time.Since(start),
+		"error", err)
+
+	return vectors, err
+}
+
+// documentScores returns the retrieval scores of docs in order, for logging.
+func documentScores(docs []*types.Document) []float64 {
+	scores := make([]float64, len(docs))
+	for i, doc := range docs {
+		scores[i] = doc.Score
+	}
+	return scores
+}
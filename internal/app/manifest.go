@@ -0,0 +1,196 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IngestedRoot is a directory recorded in the ingestion manifest.
+type IngestedRoot struct {
+	Collection string            `json:"collection"`
+	Path       string            `json:"path"` // as given to ingest
+	AbsPath    string            `json:"abs_path"`
+	Files      map[string]string `json:"files"` // path relative to the root -> content hash
+	IngestedAt time.Time         `json:"ingested_at"`
+}
+
+// ingestManifest is the file at App.ManifestPath. Chunks are stored under the path a
+// file was ingested with, so ingesting a directory again under another spelling (./docs,
+// then /home/me/docs) or from a copy adds a second set of chunks instead of updating the
+// first. The manifest remembers the directories ingested into each collection so this
+// can be caught before it happens.
+type ingestManifest struct {
+	Roots []*IngestedRoot `json:"roots"`
+}
+
+// DefaultManifestPath returns ~/.pawdy/ingested.json.
+func DefaultManifestPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory for the ingestion manifest: %w", err)
+	}
+	return filepath.Join(home, ".pawdy", "ingested.json"), nil
+}
+
+// PreviousIngestion returns the directory recorded as ingested into the collection
+// that dir, whose contents are files, duplicates: the same directory under another
+// path, or one where most of the files match by relative path and content. It
+// returns nil if there is none or no manifest is configured.
+func (a *App) PreviousIngestion(dir string, files []string) (*IngestedRoot, error) {
+	if a.ManifestPath == "" {
+		return nil, nil
+	}
+
+	manifest, err := loadManifest(a.ManifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	absPath, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := hashFiles(dir, files)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, root := range manifest.Roots {
+		// The same spelling updates the chunks already indexed, file by file
+		if root.Collection != a.Config.Collection || filepath.Clean(root.Path) == filepath.Clean(dir) {
+			continue
+		}
+		if root.AbsPath == absPath {
+			return root, nil
+		}
+
+		matching := 0
+		for relative, hash := range hashes {
+			if root.Files[relative] == hash {
+				matching++
+			}
+		}
+		if len(hashes) > 0 && matching*2 > len(hashes) {
+			return root, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// RecordIngestion records dir, whose contents are files, as ingested into the collection.
+func (a *App) RecordIngestion(dir string, files []string) error {
+	if a.ManifestPath == "" {
+		return nil
+	}
+
+	manifest, err := loadManifest(a.ManifestPath)
+	if err != nil {
+		return err
+	}
+
+	absPath, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	hashes, err := hashFiles(dir, files)
+	if err != nil {
+		return err
+	}
+
+	root := &IngestedRoot{
+		Collection: a.Config.Collection,
+		Path:       dir,
+		AbsPath:    absPath,
+		Files:      hashes,
+		IngestedAt: time.Now().UTC(),
+	}
+
+	// Replace the previous record of this directory under the same spelling
+	roots := []*IngestedRoot{root}
+	for _, existing := range manifest.Roots {
+		if existing.Collection != root.Collection || filepath.Clean(existing.Path) != filepath.Clean(dir) {
+			roots = append(roots, existing)
+		}
+	}
+	manifest.Roots = roots
+
+	return saveManifest(a.ManifestPath, manifest)
+}
+
+// forgetIngestions removes the manifest records for a collection that has been reset.
+func (a *App) forgetIngestions(collection string) error {
+	if a.ManifestPath == "" {
+		return nil
+	}
+
+	manifest, err := loadManifest(a.ManifestPath)
+	if err != nil {
+		return err
+	}
+
+	var roots []*IngestedRoot
+	for _, root := range manifest.Roots {
+		if root.Collection != collection {
+			roots = append(roots, root)
+		}
+	}
+	manifest.Roots = roots
+
+	return saveManifest(a.ManifestPath, manifest)
+}
+
+// hashFiles returns the content hash of each file, keyed by its path relative to dir.
+func hashFiles(dir string, files []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		relative, err := filepath.Rel(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hashFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash file: %w", err)
+		}
+		hashes[filepath.ToSlash(relative)] = hash
+	}
+	return hashes, nil
+}
+
+// loadManifest reads the manifest at path; a missing file is an empty manifest.
+func loadManifest(path string) (*ingestManifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ingestManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ingestion manifest: %w", err)
+	}
+
+	var manifest ingestManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse ingestion manifest %s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// saveManifest writes the manifest to path, creating its directory if needed.
+func saveManifest(path string, manifest *ingestManifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create ingestion manifest directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write ingestion manifest: %w", err)
+	}
+	return nil
+}
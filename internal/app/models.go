@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mabulgu/pawdy/internal/backend/ollama"
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// ConfiguredModel is a model the configuration expects on the Ollama server at ollama_url.
+type ConfiguredModel struct {
+	Role      string // "chat", "guard", "rerank", or "embeddings"
+	Name      string
+	Installed bool
+}
+
+// Models lists the models installed on the Ollama server at ollama_url, along with the
+// configured models served from it. Unlike New, it works when a configured model is
+// missing, so typos can be spotted. A guard on its own guard_url server is not included.
+func Models(ctx context.Context, cfg *types.Config) ([]ollama.Model, []*ConfiguredModel, error) {
+	client := &http.Client{Timeout: cfg.RequestTimeout}
+	installed, err := ollama.ListModels(ctx, client, cfg.OllamaURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configured := configuredOllamaModels(cfg)
+	for _, model := range configured {
+		for _, m := range installed {
+			if m.Matches(model.Name) {
+				model.Installed = true
+				break
+			}
+		}
+	}
+
+	return installed, configured, nil
+}
+
+// configuredOllamaModels returns the models cfg loads from the Ollama server at ollama_url.
+func configuredOllamaModels(cfg *types.Config) []*ConfiguredModel {
+	var models []*ConfiguredModel
+	if cfg.Backend == "ollama" {
+		models = append(models, &ConfiguredModel{Role: "chat", Name: cfg.OllamaModel})
+		if cfg.Safety == "on" && cfg.GuardURL == "" {
+			models = append(models, &ConfiguredModel{Role: "guard", Name: cfg.GuardModel})
+		}
+		if cfg.Rerank && cfg.RerankModel != "" {
+			models = append(models, &ConfiguredModel{Role: "rerank", Name: cfg.RerankModel})
+		}
+	}
+	if cfg.Embeddings == "ollama-nomic" {
+		models = append(models, &ConfiguredModel{Role: "embeddings", Name: cfg.EmbeddingModel})
+	}
+	return models
+}
@@ -1,69 +1,158 @@
 // Package llamacpp provides a llama.cpp backend for LLM operations.
+//
+// The client runs inference through llama.cpp's bundled llama-server, which it
+// launches as a child process bound to localhost, rather than through cgo
+// bindings. This keeps Pawdy a pure Go build that cross-compiles without a C
+// toolchain, follows llama.cpp releases by upgrading one binary, and keeps a
+// crash in the model runtime from taking the CLI down with it, while still
+// running the GGUF model at modelPath with llama.cpp itself.
 package llamacpp
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/mabulgu/pawdy/internal/retry"
 	"github.com/mabulgu/pawdy/pkg/types"
 )
 
-// Client represents a llama.cpp client.
-// Note: This is a stub implementation. In production, you would use actual llama.cpp Go bindings.
+// startupTimeout bounds how long model loading may take before NewClient gives up.
+const startupTimeout = 2 * time.Minute
+
+// Client represents a llama.cpp client backed by a llama-server child process.
 type Client struct {
-	modelPath string
-	mu        sync.Mutex
+	modelPath    string
+	baseURL      string
+	cmd          *exec.Cmd
+	exited       chan struct{}
+	retry        retry.Policy
+	client       *http.Client
+	streamClient *http.Client
+	mu           sync.Mutex
 }
 
+// Ensure Client implements the LLMClient interface
+var _ types.LLMClient = (*Client)(nil)
+
 // NewClient creates a new llama.cpp client.
-// Note: This is a stub implementation. In production, you would use actual llama.cpp Go bindings.
-func NewClient(modelPath string) (*Client, error) {
+// It starts serverBinary (usually "llama-server") with the model and waits for it to finish loading.
+// Non-streaming requests must complete within timeout; streaming requests must start
+// responding within timeout but may then run for as long as generation takes.
+// Requests the server rejects as busy or overloaded are retried according to retryPolicy.
+func NewClient(modelPath, serverBinary string, contextWindow int, timeout time.Duration, retryPolicy retry.Policy) (*Client, error) {
 	// Check if model file exists
 	if modelPath == "" {
 		return nil, fmt.Errorf("model path cannot be empty")
 	}
+	if _, err := os.Stat(modelPath); err != nil {
+		return nil, fmt.Errorf("model file not accessible: %w", err)
+	}
+
+	binary, err := exec.LookPath(serverBinary)
+	if err != nil {
+		return nil, fmt.Errorf("llama.cpp server binary %q not found: %w", serverBinary, err)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate port for llama.cpp server: %w", err)
+	}
+
+	args := []string{
+		"--model", modelPath,
+		"--host", "127.0.0.1",
+		"--port", strconv.Itoa(port),
+	}
+	if contextWindow > 0 {
+		args = append(args, "--ctx-size", strconv.Itoa(contextWindow))
+	}
+
+	cmd := exec.Command(binary, args...)
+	cmd.Stderr = io.Discard
+	cmd.Stdout = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start llama.cpp server: %w", err)
+	}
+
+	c := newClient(fmt.Sprintf("http://127.0.0.1:%d", port), modelPath, timeout, retryPolicy)
+	c.cmd = cmd
+	c.exited = make(chan struct{})
+
+	go func() {
+		cmd.Wait()
+		close(c.exited)
+	}()
+
+	if err := c.waitUntilLoaded(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// newClient creates a client for the llama-server at baseURL, without a child process.
+func newClient(baseURL, modelPath string, timeout time.Duration, retryPolicy retry.Policy) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
 
 	return &Client{
 		modelPath: modelPath,
-	}, nil
+		baseURL:   baseURL,
+		retry:     retryPolicy,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		streamClient: &http.Client{
+			Transport: transport,
+		},
+	}
 }
 
 // Generate produces a complete response for the given prompt.
-// Note: This is a stub implementation. In production, you would use actual llama.cpp inference.
 func (c *Client) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	resp, err := c.doCompletion(ctx, c.buildRequest(prompt, opts, false))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 
-	// Simulate processing delay
-	select {
-	case <-ctx.Done():
-		return "", ctx.Err()
-	default:
+	var response completionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Return a placeholder response indicating this is a stub
-	return fmt.Sprintf("🔧 llamacpp stub response for: %s\n\n"+
-		"This is a placeholder implementation. To use actual llama.cpp:\n"+
-		"1. Install llama.cpp with Go bindings\n"+
-		"2. Replace this stub with real implementation\n"+
-		"3. Model path: %s", prompt, c.modelPath), nil
+	return response.Content, nil
 }
 
 // GenerateStream produces a streaming response for the given prompt.
-// Note: This is a stub implementation. In production, you would use actual llama.cpp streaming.
 func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.GenerateOptions) (<-chan types.StreamToken, error) {
+	resp, err := c.doCompletion(ctx, c.buildRequest(prompt, opts, true))
+	if err != nil {
+		return nil, err
+	}
+
 	tokens := make(chan types.StreamToken, 10)
 
 	go func() {
 		defer close(tokens)
+		defer resp.Body.Close()
 
-		// Simulate streaming tokens for the stub response
-		response := fmt.Sprintf("🔧 llamacpp streaming stub for: %s", prompt)
-		words := strings.Fields(response)
-		
-		for _, word := range words {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
 			select {
 			case <-ctx.Done():
 				tokens <- types.StreamToken{Error: ctx.Err()}
@@ -71,12 +160,32 @@ func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.G
 			default:
 			}
 
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			var response completionResponse
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &response); err != nil {
+				tokens <- types.StreamToken{Error: fmt.Errorf("failed to decode streaming response: %w", err)}
+				return
+			}
+
 			tokens <- types.StreamToken{
-				Text: word + " ",
-				Done: false,
+				Text: response.Content,
+				Done: response.Stop,
+			}
+
+			if response.Stop {
+				return
 			}
 		}
 
+		if err := scanner.Err(); err != nil {
+			tokens <- types.StreamToken{Error: fmt.Errorf("failed to scan response: %w", err)}
+			return
+		}
+
 		tokens <- types.StreamToken{Done: true}
 	}()
 
@@ -84,24 +193,185 @@ func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.G
 }
 
 // IsHealthy checks if the model is loaded and ready.
-// Note: This is a stub implementation.
 func (c *Client) IsHealthy(ctx context.Context) error {
-	if c.modelPath == "" {
-		return fmt.Errorf("model path not set")
+	select {
+	case <-c.exited:
+		return fmt.Errorf("llama.cpp server has exited")
+	default:
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("llama.cpp server unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// llama-server answers 503 while the model is still loading
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("model not loaded (status %d)", resp.StatusCode)
 	}
+
 	return nil
 }
 
-// Close cleans up resources.
-// Note: This is a stub implementation.
+// Close stops the llama.cpp server, freeing the model.
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
-	// In a real implementation, this would free llama.cpp resources
+
+	if c.cmd == nil || c.cmd.Process == nil {
+		return nil
+	}
+
+	select {
+	case <-c.exited:
+		return nil
+	default:
+	}
+
+	if err := c.cmd.Process.Kill(); err != nil {
+		return fmt.Errorf("failed to stop llama.cpp server: %w", err)
+	}
+	<-c.exited
+
 	return nil
 }
 
-// Note: Helper functions removed in stub implementation.
-// In production, you would have buildPrompt, sampleToken, and isStopToken functions
-// that interface with actual llama.cpp C++ bindings.
+// waitUntilLoaded polls the health endpoint until the model is ready.
+func (c *Client) waitUntilLoaded() error {
+	deadline := time.Now().Add(startupTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-c.exited:
+			return fmt.Errorf("llama.cpp server exited while loading %s", c.modelPath)
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := c.IsHealthy(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fmt.Errorf("timed out loading model %s", c.modelPath)
+}
+
+// buildRequest converts a prompt and options into a llama-server completion request.
+func (c *Client) buildRequest(prompt string, opts types.GenerateOptions, stream bool) completionRequest {
+	req := completionRequest{
+		Prompt:      buildPrompt(prompt, opts.SystemPrompt),
+		Stream:      stream,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		NPredict:    opts.MaxTokens,
+		Stop:        append([]string{"<|eot_id|>"}, opts.StopSequences...),
+	}
+
+	if req.NPredict == 0 {
+		req.NPredict = -1 // generate until a stop token
+	}
+
+	return req
+}
+
+// doCompletion sends a completion request, retrying transient failures, and returns the successful response.
+func (c *Client) doCompletion(ctx context.Context, req completionRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var resp *http.Response
+	err = retry.Do(ctx, c.retry, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/completion", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		client := c.client
+		if req.Stream {
+			client = c.streamClient
+		}
+
+		resp, err = client.Do(httpReq)
+		if err != nil {
+			return retry.FromRequestError(ctx, types.BackendUnavailable(ctx, fmt.Errorf("failed to make request: %w", err)))
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			err := fmt.Errorf("llama.cpp server error (status %d): %s", resp.StatusCode, string(body))
+			if retry.IsTransientStatus(resp.StatusCode) {
+				return retry.Transient(types.BackendUnavailable(ctx, err))
+			}
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// buildPrompt wraps a prompt in the Llama 3 chat template.
+// Prompts that are already templated (such as Llama Guard prompts) are passed through unchanged.
+func buildPrompt(prompt, systemPrompt string) string {
+	if strings.HasPrefix(prompt, "<|begin_of_text|>") {
+		return prompt
+	}
+
+	var b strings.Builder
+	b.WriteString("<|begin_of_text|>")
+	if systemPrompt != "" {
+		b.WriteString("<|start_header_id|>system<|end_header_id|>\n\n")
+		b.WriteString(systemPrompt)
+		b.WriteString("<|eot_id|>")
+	}
+	b.WriteString("<|start_header_id|>user<|end_header_id|>\n\n")
+	b.WriteString(prompt)
+	b.WriteString("<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n")
+
+	return b.String()
+}
+
+// freePort asks the kernel for an unused localhost TCP port.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// completionRequest represents a request to the llama-server completion API.
+type completionRequest struct {
+	Prompt      string   `json:"prompt"`
+	Stream      bool     `json:"stream"`
+	Temperature float64  `json:"temperature"`
+	TopP        float64  `json:"top_p,omitempty"`
+	NPredict    int      `json:"n_predict"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// completionResponse represents a response (or stream chunk) from the llama-server completion API.
+type completionResponse struct {
+	Content string `json:"content"`
+	Stop    bool   `json:"stop"`
+}
@@ -0,0 +1,254 @@
+package llamacpp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/retry"
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPrompt(t *testing.T) {
+	tests := []struct {
+		name         string
+		prompt       string
+		systemPrompt string
+		want         string
+	}{
+		{
+			name:   "user only",
+			prompt: "How do I gather initramfs logs?",
+			want: "<|begin_of_text|><|start_header_id|>user<|end_header_id|>\n\nHow do I gather initramfs logs?" +
+				"<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n",
+		},
+		{
+			name:         "with system prompt",
+			prompt:       "How do I gather initramfs logs?",
+			systemPrompt: "You are Pawdy.",
+			want: "<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nYou are Pawdy.<|eot_id|>" +
+				"<|start_header_id|>user<|end_header_id|>\n\nHow do I gather initramfs logs?" +
+				"<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n",
+		},
+		{
+			name:         "already templated",
+			prompt:       "<|begin_of_text|><|start_header_id|>user<|end_header_id|>\n\nTask: check",
+			systemPrompt: "You are Pawdy.",
+			want:         "<|begin_of_text|><|start_header_id|>user<|end_header_id|>\n\nTask: check",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildPrompt(tt.prompt, tt.systemPrompt))
+		})
+	}
+}
+
+func TestBuildRequest(t *testing.T) {
+	c := &Client{}
+
+	req := c.buildRequest("Hi", types.GenerateOptions{Temperature: 0.2, TopP: 0.9, MaxTokens: 256, StopSequences: []string{"\n\n"}}, true)
+	assert.True(t, req.Stream)
+	assert.Equal(t, 0.2, req.Temperature)
+	assert.Equal(t, 0.9, req.TopP)
+	assert.Equal(t, 256, req.NPredict)
+	assert.Equal(t, []string{"<|eot_id|>", "\n\n"}, req.Stop)
+
+	// Without a token limit the model generates until a stop token
+	req = c.buildRequest("Hi", types.GenerateOptions{}, false)
+	assert.False(t, req.Stream)
+	assert.Equal(t, -1, req.NPredict)
+	assert.Equal(t, []string{"<|eot_id|>"}, req.Stop)
+}
+
+func TestClient_Generate(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/completion", r.URL.Path)
+		var req completionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Contains(t, req.Prompt, "How do I gather initramfs logs?")
+
+		// The first request finds the server busy and is retried
+		if calls.Add(1) == 1 {
+			http.Error(w, "loading model", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(completionResponse{Content: "Use rescue mode.", Stop: true})
+	}))
+	defer server.Close()
+
+	c := newClient(server.URL, "model.gguf", time.Minute, retry.Policy{MaxAttempts: 2})
+	response, err := c.Generate(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Use rescue mode.", response)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestClient_GenerateErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		wantUnavailable bool
+	}{
+		{name: "busy", status: http.StatusServiceUnavailable, wantUnavailable: true},
+		{name: "bad request", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "no slot available", tt.status)
+			}))
+			defer server.Close()
+
+			c := newClient(server.URL, "model.gguf", time.Minute, retry.Policy{MaxAttempts: 1})
+			_, err := c.Generate(context.Background(), "Hi", types.GenerateOptions{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), fmt.Sprintf("llama.cpp server error (status %d): no slot available", tt.status))
+			assert.Equal(t, tt.wantUnavailable, errors.Is(err, types.ErrBackendUnavailable))
+		})
+	}
+}
+
+func TestClient_GenerateTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		json.NewEncoder(w).Encode(completionResponse{Content: "late", Stop: true})
+	}))
+	defer server.Close()
+
+	c := newClient(server.URL, "model.gguf", 50*time.Millisecond, retry.Policy{MaxAttempts: 1})
+	_, err := c.Generate(context.Background(), "Hi", types.GenerateOptions{})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, types.ErrBackendUnavailable))
+}
+
+func TestClient_GenerateStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "stops on the stop chunk",
+			body: "data: {\"content\":\"Use \",\"stop\":false}\n\n" +
+				": keep-alive\n\n" +
+				"data: {\"content\":\"rescue mode.\",\"stop\":false}\n\n" +
+				"data: {\"content\":\"\",\"stop\":true}\n\n" +
+				"data: {\"content\":\"ignored\",\"stop\":false}\n\n",
+			want: "Use rescue mode.",
+		},
+		{
+			name: "ends without a stop chunk",
+			body: "data: {\"content\":\"Use rescue mode.\",\"stop\":false}\n\n",
+			want: "Use rescue mode.",
+		},
+		{
+			name:    "malformed chunk",
+			body:    "data: {\"content\":\"Use \"}\n\ndata: {not json}\n\n",
+			want:    "Use ",
+			wantErr: "failed to decode streaming response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req completionRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.True(t, req.Stream)
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			c := newClient(server.URL, "model.gguf", time.Minute, retry.Policy{})
+			tokens, err := c.GenerateStream(context.Background(), "Hi", types.GenerateOptions{})
+			require.NoError(t, err)
+
+			var text string
+			var streamErr error
+			done := false
+			for token := range tokens {
+				text += token.Text
+				if token.Error != nil {
+					streamErr = token.Error
+				}
+				done = done || token.Done
+			}
+
+			assert.Equal(t, tt.want, text)
+			if tt.wantErr != "" {
+				require.Error(t, streamErr)
+				assert.Contains(t, streamErr.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, streamErr)
+			assert.True(t, done)
+		})
+	}
+}
+
+func TestClient_WaitUntilLoaded(t *testing.T) {
+	var checks atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		// llama-server answers 503 while the model loads
+		if checks.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer server.Close()
+
+	c := newClient(server.URL, "model.gguf", time.Minute, retry.Policy{})
+	require.NoError(t, c.waitUntilLoaded())
+	assert.Equal(t, int32(3), checks.Load())
+	assert.NoError(t, c.IsHealthy(context.Background()))
+
+	// A server that exits while loading fails at once
+	c.exited = make(chan struct{})
+	close(c.exited)
+	err := c.waitUntilLoaded()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "llama.cpp server exited while loading model.gguf")
+	assert.Error(t, c.IsHealthy(context.Background()))
+}
+
+func TestNewClient_Errors(t *testing.T) {
+	model := filepath.Join(t.TempDir(), "model.gguf")
+	require.NoError(t, os.WriteFile(model, []byte("GGUF"), 0o644))
+
+	tests := []struct {
+		name      string
+		modelPath string
+		binary    string
+		wantErr   string
+	}{
+		{name: "no model", modelPath: "", binary: "llama-server", wantErr: "model path cannot be empty"},
+		{name: "missing model", modelPath: model + ".missing", binary: "llama-server", wantErr: "model file not accessible"},
+		{name: "missing binary", modelPath: model, binary: "pawdy-no-such-llama-server", wantErr: `llama.cpp server binary "pawdy-no-such-llama-server" not found`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.modelPath, tt.binary, 4096, time.Minute, retry.Policy{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
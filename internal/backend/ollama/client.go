@@ -12,33 +12,61 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mabulgu/pawdy/internal/retry"
 	"github.com/mabulgu/pawdy/pkg/types"
 )
 
 // Client represents an Ollama HTTP API client.
 type Client struct {
-	baseURL string
-	model   string
-	client  *http.Client
+	baseURL      string
+	model        string
+	retry        retry.Policy
+	keepAlive    string
+	client       *http.Client
+	streamClient *http.Client
 }
 
 // NewClient creates a new Ollama client.
-func NewClient(baseURL, model string) *Client {
+// Non-streaming requests must complete within timeout; streaming requests must start
+// responding within timeout but may then run for as long as generation takes.
+// Requests that fail transiently, e.g. while Ollama is loading the model, are retried according to retryPolicy.
+func NewClient(baseURL, model string, timeout time.Duration, retryPolicy retry.Policy) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
 	return &Client{
 		baseURL: strings.TrimSuffix(baseURL, "/"),
 		model:   model,
+		retry:   retryPolicy,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
+		},
+		streamClient: &http.Client{
+			Transport: transport,
 		},
 	}
 }
 
+// SetKeepAlive sets how long Ollama keeps the model loaded after each generate
+// request, as a duration such as "10m" ("-1m" keeps it loaded indefinitely).
+// Empty leaves it to the server's default, which is 5 minutes.
+func (c *Client) SetKeepAlive(keepAlive string) {
+	c.keepAlive = keepAlive
+}
+
 // Generate produces a complete response for the given prompt.
 func (c *Client) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	text, _, err := c.GenerateWithStats(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateWithStats produces a complete response along with token usage and timing.
+func (c *Client) GenerateWithStats(ctx context.Context, prompt string, opts types.GenerateOptions) (string, *types.GenerationStats, error) {
 	req := generateRequest{
-		Model:  c.model,
-		Prompt: prompt,
-		Stream: false,
+		Model:     c.model,
+		Prompt:    prompt,
+		Stream:    false,
+		KeepAlive: c.keepAlive,
 		Options: map[string]interface{}{
 			"temperature": opts.Temperature,
 			"top_p":       opts.TopP,
@@ -54,43 +82,27 @@ func (c *Client) Generate(ctx context.Context, prompt string, opts types.Generat
 		req.Options["stop"] = opts.StopSequences
 	}
 
-	body, err := json.Marshal(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/generate", bytes.NewReader(body))
+	resp, err := c.doGenerate(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.client.Do(httpReq)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return "", nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
-	}
-
 	var response generateResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return "", nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return response.Response, nil
+	return response.Response, response.stats(), nil
 }
 
 // GenerateStream produces a streaming response for the given prompt.
 func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.GenerateOptions) (<-chan types.StreamToken, error) {
 	req := generateRequest{
-		Model:  c.model,
-		Prompt: prompt,
-		Stream: true,
+		Model:     c.model,
+		Prompt:    prompt,
+		Stream:    true,
+		KeepAlive: c.keepAlive,
 		Options: map[string]interface{}{
 			"temperature": opts.Temperature,
 			"top_p":       opts.TopP,
@@ -106,27 +118,10 @@ func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.G
 		req.Options["stop"] = opts.StopSequences
 	}
 
-	body, err := json.Marshal(req)
+	// Only the initial request is retried; once tokens flow, errors go to the stream
+	resp, err := c.doGenerate(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/generate", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, err
 	}
 
 	tokens := make(chan types.StreamToken, 10)
@@ -155,10 +150,14 @@ func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.G
 				return
 			}
 
-			tokens <- types.StreamToken{
+			token := types.StreamToken{
 				Text: response.Response,
 				Done: response.Done,
 			}
+			if response.Done {
+				token.Stats = response.stats()
+			}
+			tokens <- token
 
 			if response.Done {
 				return
@@ -174,40 +173,75 @@ func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.G
 }
 
 // IsHealthy checks if the Ollama service is ready to serve requests.
+// A *ModelNotFoundError is returned if the model has not been pulled.
 func (c *Client) IsHealthy(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/tags", nil)
+	return CheckModel(ctx, c.client, c.baseURL, c.model)
+}
+
+// ModelNotFoundError reports that a model has not been pulled into Ollama.
+type ModelNotFoundError struct {
+	Model string
+}
+
+// Error returns a message including the command that fixes the problem.
+func (e *ModelNotFoundError) Error() string {
+	return fmt.Sprintf("model '%s' not found in ollama (run `ollama pull %s`)", e.Model, e.Model)
+}
+
+// Model describes a model pulled into Ollama.
+type Model struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// Matches reports whether the model is the one configured as name, which may omit the tag.
+func (m Model) Matches(name string) bool {
+	return strings.HasPrefix(m.Name, name)
+}
+
+// CheckModel verifies that the Ollama service at baseURL is reachable and has model pulled.
+func CheckModel(ctx context.Context, client *http.Client, baseURL, model string) error {
+	models, err := ListModels(ctx, client, baseURL)
 	if err != nil {
-		return fmt.Errorf("failed to create health check request: %w", err)
+		return err
+	}
+
+	for _, m := range models {
+		if m.Matches(model) {
+			return nil
+		}
 	}
 
-	resp, err := c.client.Do(req)
+	return &ModelNotFoundError{Model: model}
+}
+
+// ListModels returns the models pulled into the Ollama service at baseURL.
+func ListModels(ctx context.Context, client *http.Client, baseURL string) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(baseURL, "/")+"/api/tags", nil)
 	if err != nil {
-		return fmt.Errorf("ollama service unreachable: %w", err)
+		return nil, fmt.Errorf("failed to create models request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama service unreachable: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ollama service unhealthy (status %d)", resp.StatusCode)
+		return nil, fmt.Errorf("ollama service unhealthy (status %d)", resp.StatusCode)
 	}
 
-	// Check if the specific model is available
 	var response struct {
-		Models []struct {
-			Name string `json:"name"`
-		} `json:"models"`
+		Models []Model `json:"models"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return fmt.Errorf("failed to decode models response: %w", err)
-	}
-
-	for _, model := range response.Models {
-		if strings.HasPrefix(model.Name, c.model) {
-			return nil
-		}
+		return nil, fmt.Errorf("failed to decode models response: %w", err)
 	}
 
-	return fmt.Errorf("model '%s' not found in ollama", c.model)
+	return response.Models, nil
 }
 
 // Close cleans up any resources used by the client.
@@ -216,13 +250,59 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// doGenerate sends a generate request, retrying transient failures, and returns the successful response.
+func (c *Client) doGenerate(ctx context.Context, req generateRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var resp *http.Response
+	err = retry.Do(ctx, c.retry, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/generate", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		client := c.client
+		if req.Stream {
+			client = c.streamClient
+		}
+
+		resp, err = client.Do(httpReq)
+		if err != nil {
+			return retry.FromRequestError(ctx, types.BackendUnavailable(ctx, fmt.Errorf("failed to make request: %w", err)))
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			err := fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+			if retry.IsTransientStatus(resp.StatusCode) {
+				return retry.Transient(types.BackendUnavailable(ctx, err))
+			}
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 // generateRequest represents a request to the Ollama generate API.
 type generateRequest struct {
-	Model   string                 `json:"model"`
-	Prompt  string                 `json:"prompt"`
-	System  string                 `json:"system,omitempty"`
-	Stream  bool                   `json:"stream"`
-	Options map[string]interface{} `json:"options,omitempty"`
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	System    string                 `json:"system,omitempty"`
+	Stream    bool                   `json:"stream"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
 }
 
 // generateResponse represents a response from the Ollama generate API.
@@ -234,7 +314,19 @@ type generateResponse struct {
 	Context            []int  `json:"context,omitempty"`
 	TotalDuration      int64  `json:"total_duration,omitempty"`
 	LoadDuration       int64  `json:"load_duration,omitempty"`
+	PromptEvalCount    int    `json:"prompt_eval_count,omitempty"`
 	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
 	EvalCount          int    `json:"eval_count,omitempty"`
 	EvalDuration       int64  `json:"eval_duration,omitempty"`
 }
+
+// stats converts the response's counters, reported in nanoseconds, into generation statistics.
+func (r *generateResponse) stats() *types.GenerationStats {
+	return &types.GenerationStats{
+		PromptTokens:       r.PromptEvalCount,
+		CompletionTokens:   r.EvalCount,
+		PromptDuration:     time.Duration(r.PromptEvalDuration),
+		GenerationDuration: time.Duration(r.EvalDuration),
+		TotalDuration:      time.Duration(r.TotalDuration),
+	}
+}
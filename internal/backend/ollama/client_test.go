@@ -0,0 +1,98 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/retry"
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_KeepAlive(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, body)
+		json.NewEncoder(w).Encode(generateResponse{Response: "Use rescue mode.", Done: true})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "llama3.1:8b", time.Minute, retry.Policy{})
+	ctx := context.Background()
+
+	// Unset, the server's default applies
+	_, err := client.Generate(ctx, "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.NotContains(t, requests[0], "keep_alive")
+
+	// Set, every generate request carries it, streamed or not
+	client.SetKeepAlive("10m")
+	_, err = client.Generate(ctx, "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	tokens, err := client.GenerateStream(ctx, "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	for range tokens {
+	}
+
+	require.Len(t, requests, 3)
+	assert.Equal(t, "10m", requests[1]["keep_alive"])
+	assert.Equal(t, "10m", requests[2]["keep_alive"])
+}
+
+func TestClient_GenerateWithStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req generateRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		final := generateResponse{
+			Done:               true,
+			TotalDuration:      int64(3 * time.Second),
+			PromptEvalCount:    120,
+			PromptEvalDuration: int64(500 * time.Millisecond),
+			EvalCount:          40,
+			EvalDuration:       int64(2 * time.Second),
+		}
+		if !req.Stream {
+			final.Response = "Use rescue mode."
+			json.NewEncoder(w).Encode(final)
+			return
+		}
+		json.NewEncoder(w).Encode(generateResponse{Response: "Use rescue mode."})
+		json.NewEncoder(w).Encode(final)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "llama3.1:8b", time.Minute, retry.Policy{})
+	want := &types.GenerationStats{
+		PromptTokens:       120,
+		CompletionTokens:   40,
+		PromptDuration:     500 * time.Millisecond,
+		GenerationDuration: 2 * time.Second,
+		TotalDuration:      3 * time.Second,
+	}
+
+	text, stats, err := client.GenerateWithStats(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Use rescue mode.", text)
+	assert.Equal(t, want, stats)
+	assert.Equal(t, 20.0, stats.TokensPerSecond())
+
+	// A stream reports the stats on its final token only
+	tokens, err := client.GenerateStream(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{})
+	require.NoError(t, err)
+	var streamed []types.StreamToken
+	for token := range tokens {
+		streamed = append(streamed, token)
+	}
+	require.Len(t, streamed, 2)
+	assert.Nil(t, streamed[0].Stats)
+	assert.True(t, streamed[1].Done)
+	assert.Equal(t, want, streamed[1].Stats)
+}
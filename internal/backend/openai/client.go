@@ -0,0 +1,336 @@
+// Package openai provides an OpenAI-compatible chat completions backend for LLM operations.
+// It works with servers such as vLLM, LM Studio, and text-generation-webui.
+//
+// Prompts that are already in the model's chat template, such as Llama Guard prompts,
+// go to the legacy completions API instead, so the server doesn't template them twice.
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/retry"
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// Client represents an OpenAI-compatible HTTP API client.
+type Client struct {
+	baseURL      string
+	apiKey       string
+	model        string
+	client       *http.Client
+	streamClient *http.Client
+}
+
+// Ensure Client implements the LLMClient interface
+var _ types.LLMClient = (*Client)(nil)
+
+// NewClient creates a new OpenAI-compatible client.
+// The base URL should include the API version prefix, e.g. http://localhost:8000/v1.
+// Streaming requests are only bound by timeout until the server starts responding.
+func NewClient(baseURL, apiKey, model string, timeout time.Duration) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		streamClient: &http.Client{
+			Transport: transport,
+		},
+	}
+}
+
+// templatedPrefix starts prompts that are already in the Llama 3 chat template.
+const templatedPrefix = "<|begin_of_text|>"
+
+// Generate produces a complete response for the given prompt.
+func (c *Client) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	resp, err := c.doRequest(ctx, prompt, opts, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var response chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("openai API returned no choices")
+	}
+
+	return response.Choices[0].content(), nil
+}
+
+// GenerateStream produces a streaming response for the given prompt.
+func (c *Client) GenerateStream(ctx context.Context, prompt string, opts types.GenerateOptions) (<-chan types.StreamToken, error) {
+	resp, err := c.doRequest(ctx, prompt, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(chan types.StreamToken, 10)
+
+	go func() {
+		defer close(tokens)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case <-ctx.Done():
+				tokens <- types.StreamToken{Error: ctx.Err()}
+				return
+			default:
+			}
+
+			// Server-sent events: only "data:" lines carry payloads
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "[DONE]" {
+				tokens <- types.StreamToken{Done: true}
+				return
+			}
+
+			var chunk chatStreamChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				tokens <- types.StreamToken{Error: fmt.Errorf("failed to decode streaming response: %w", err)}
+				return
+			}
+
+			// A server that fails mid-generation reports it in an error event
+			if chunk.Error != nil {
+				tokens <- types.StreamToken{Error: fmt.Errorf("openai API stream error: %s", chunk.Error.Message)}
+				return
+			}
+
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+
+			if text := chunk.Choices[0].content(); text != "" {
+				tokens <- types.StreamToken{Text: text}
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			tokens <- types.StreamToken{Error: fmt.Errorf("failed to scan response: %w", err)}
+			return
+		}
+
+		// Some servers close the stream without sending [DONE]
+		tokens <- types.StreamToken{Done: true}
+	}()
+
+	return tokens, nil
+}
+
+// IsHealthy checks if the server is reachable and serves the configured model.
+func (c *Client) IsHealthy(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+	c.setHeaders(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("openai-compatible service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("openai-compatible service unhealthy (status %d)", resp.StatusCode)
+	}
+
+	var response struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode models response: %w", err)
+	}
+
+	for _, model := range response.Data {
+		if model.ID == c.model {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("model '%s' not served by %s", c.model, c.baseURL)
+}
+
+// Close cleans up any resources used by the client.
+func (c *Client) Close() error {
+	// HTTP client doesn't need explicit cleanup
+	return nil
+}
+
+// buildRequest converts a prompt and options into a chat completions request.
+func (c *Client) buildRequest(prompt string, opts types.GenerateOptions, stream bool) chatRequest {
+	var messages []chatMessage
+	if opts.SystemPrompt != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: opts.SystemPrompt})
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: prompt})
+
+	return chatRequest{
+		Model:       c.model,
+		Messages:    messages,
+		Stream:      stream,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		MaxTokens:   opts.MaxTokens,
+		Stop:        opts.StopSequences,
+	}
+}
+
+// buildCompletionRequest converts an already templated prompt into a completions request.
+func (c *Client) buildCompletionRequest(prompt string, opts types.GenerateOptions, stream bool) completionRequest {
+	return completionRequest{
+		Model:       c.model,
+		Prompt:      prompt,
+		Stream:      stream,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		MaxTokens:   opts.MaxTokens,
+		Stop:        opts.StopSequences,
+	}
+}
+
+// doRequest sends prompt to the chat completions API, or to the completions API if it
+// is already templated, and returns the successful response.
+func (c *Client) doRequest(ctx context.Context, prompt string, opts types.GenerateOptions, stream bool) (*http.Response, error) {
+	if strings.HasPrefix(prompt, templatedPrefix) {
+		return c.doPost(ctx, "/completions", c.buildCompletionRequest(prompt, opts, stream), stream)
+	}
+	return c.doPost(ctx, "/chat/completions", c.buildRequest(prompt, opts, stream), stream)
+}
+
+// doPost sends a request body to path and returns the successful response.
+func (c *Client) doPost(ctx context.Context, path string, req any, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	c.setHeaders(httpReq)
+
+	client := c.client
+	if stream {
+		client = c.streamClient
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, types.BackendUnavailable(ctx, fmt.Errorf("failed to make request: %w", err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err := fmt.Errorf("openai API error (status %d): %s", resp.StatusCode, string(body))
+		if retry.IsTransientStatus(resp.StatusCode) {
+			return nil, types.BackendUnavailable(ctx, err)
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// setHeaders adds authentication headers when an API key is configured.
+func (c *Client) setHeaders(req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+}
+
+// chatMessage represents a single message in a chat completions request.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest represents a request to the chat completions API.
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Stream      bool          `json:"stream"`
+	Temperature float64       `json:"temperature"`
+	TopP        float64       `json:"top_p,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+}
+
+// completionRequest represents a request to the completions API.
+type completionRequest struct {
+	Model       string   `json:"model"`
+	Prompt      string   `json:"prompt"`
+	Stream      bool     `json:"stream"`
+	Temperature float64  `json:"temperature"`
+	TopP        float64  `json:"top_p,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// choice is a generated alternative in a response or stream chunk. Chat completions
+// carry the text in Message or Delta; completions carry it in Text.
+type choice struct {
+	Message chatMessage `json:"message"`
+	Delta   struct {
+		Content string `json:"content"`
+	} `json:"delta"`
+	Text         string  `json:"text"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// content returns the text of the choice, from whichever API produced it.
+func (c choice) content() string {
+	switch {
+	case c.Message.Content != "":
+		return c.Message.Content
+	case c.Delta.Content != "":
+		return c.Delta.Content
+	default:
+		return c.Text
+	}
+}
+
+// chatResponse represents a non-streaming response from the chat completions or completions API.
+type chatResponse struct {
+	Choices []choice `json:"choices"`
+}
+
+// chatStreamChunk represents a single server-sent event from a streaming response.
+type chatStreamChunk struct {
+	Choices []choice `json:"choices"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
@@ -0,0 +1,193 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collect drains a token stream into its text, whether it finished, and its error.
+func collect(tokens <-chan types.StreamToken) (string, bool, error) {
+	var text string
+	var done bool
+	var err error
+	for token := range tokens {
+		text += token.Text
+		done = done || token.Done
+		if token.Error != nil {
+			err = token.Error
+		}
+	}
+	return text, done, err
+}
+
+func TestClient_Generate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer sk-123", r.Header.Get("Authorization"))
+
+		var req chatRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "meta-llama/Llama-3.1-8B-Instruct", req.Model)
+		assert.Equal(t, []chatMessage{
+			{Role: "system", Content: "You are Pawdy."},
+			{Role: "user", Content: "How do I gather initramfs logs?"},
+		}, req.Messages)
+
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Use rescue mode."},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/v1/", "sk-123", "meta-llama/Llama-3.1-8B-Instruct", time.Minute)
+	response, err := client.Generate(context.Background(), "How do I gather initramfs logs?", types.GenerateOptions{SystemPrompt: "You are Pawdy."})
+	require.NoError(t, err)
+	assert.Equal(t, "Use rescue mode.", response)
+}
+
+func TestClient_GenerateTemplated(t *testing.T) {
+	guardPrompt := "<|begin_of_text|><|start_header_id|>user<|end_header_id|>\n\nTask: Check if there is unsafe content<|eot_id|>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A templated prompt goes to the completions API as is, not into a chat message
+		assert.Equal(t, "/v1/completions", r.URL.Path)
+		var req completionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, guardPrompt, req.Prompt)
+		assert.Equal(t, "meta-llama/Llama-Guard-3-1B", req.Model)
+
+		fmt.Fprint(w, `{"choices":[{"text":"\n\nsafe","finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/v1", "", "meta-llama/Llama-Guard-3-1B", time.Minute)
+	response, err := client.Generate(context.Background(), guardPrompt, types.GenerateOptions{MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "\n\nsafe", response)
+}
+
+func TestClient_GenerateStatus(t *testing.T) {
+	tests := []struct {
+		status          int
+		wantUnavailable bool
+	}{
+		{status: http.StatusTooManyRequests, wantUnavailable: true},
+		{status: http.StatusBadGateway, wantUnavailable: true},
+		{status: http.StatusServiceUnavailable, wantUnavailable: true},
+		{status: http.StatusUnauthorized},
+		{status: http.StatusNotFound},
+		{status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error":{"message":"nope"}}`, tt.status)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "", "model", time.Minute)
+			_, err := client.Generate(context.Background(), "Hi", types.GenerateOptions{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), fmt.Sprintf("openai API error (status %d)", tt.status))
+			assert.Equal(t, tt.wantUnavailable, errors.Is(err, types.ErrBackendUnavailable))
+
+			_, err = client.GenerateStream(context.Background(), "Hi", types.GenerateOptions{})
+			require.Error(t, err)
+			assert.Equal(t, tt.wantUnavailable, errors.Is(err, types.ErrBackendUnavailable))
+		})
+	}
+
+	// An unreachable server is unavailable too
+	client := NewClient("http://127.0.0.1:1", "", "model", time.Second)
+	_, err := client.Generate(context.Background(), "Hi", types.GenerateOptions{})
+	assert.ErrorIs(t, err, types.ErrBackendUnavailable)
+}
+
+func TestClient_GenerateStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     string
+		wantDone bool
+		wantErr  string
+	}{
+		{
+			name: "done terminator",
+			body: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+				": ping\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"Use \"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"rescue mode.\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: [DONE]\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"ignored\"}}]}\n\n",
+			want:     "Use rescue mode.",
+			wantDone: true,
+		},
+		{
+			name:     "closed without done",
+			body:     "data: {\"choices\":[{\"delta\":{\"content\":\"Use rescue mode.\"}}]}\n\n",
+			want:     "Use rescue mode.",
+			wantDone: true,
+		},
+		{
+			name: "error frame",
+			body: "data: {\"choices\":[{\"delta\":{\"content\":\"Use \"}}]}\n\n" +
+				"data: {\"error\":{\"message\":\"CUDA out of memory\",\"type\":\"server_error\"}}\n\n",
+			want:    "Use ",
+			wantErr: "openai API stream error: CUDA out of memory",
+		},
+		{
+			name:    "malformed frame",
+			body:    "data: {not json}\n\n",
+			wantErr: "failed to decode streaming response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req chatRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.True(t, req.Stream)
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "", "model", time.Minute)
+			tokens, err := client.GenerateStream(context.Background(), "Hi", types.GenerateOptions{})
+			require.NoError(t, err)
+
+			text, done, err := collect(tokens)
+			assert.Equal(t, tt.want, text)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.False(t, done)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDone, done)
+		})
+	}
+}
+
+func TestClient_IsHealthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		fmt.Fprint(w, `{"data":[{"id":"meta-llama/Llama-3.1-8B-Instruct"}]}`)
+	}))
+	defer server.Close()
+
+	assert.NoError(t, NewClient(server.URL+"/v1", "", "meta-llama/Llama-3.1-8B-Instruct", time.Minute).IsHealthy(context.Background()))
+	err := NewClient(server.URL+"/v1", "", "meta-llama/Llama-Guard-3-1B", time.Minute).IsHealthy(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "model 'meta-llama/Llama-Guard-3-1B' not served by")
+}
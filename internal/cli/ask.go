@@ -2,10 +2,15 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/prompt"
+	"github.com/mabulgu/pawdy/pkg/types"
 	"github.com/spf13/cobra"
 )
 
@@ -16,50 +21,202 @@ var askCmd = &cobra.Command{
 	
 Examples:
   pawdy ask "How do I gather initramfs logs?"
-  pawdy ask "What are the bare metal networking requirements?"`,
+  pawdy ask "What are the bare metal networking requirements?"
+  pawdy ask --json "How do I gather initramfs logs?"
+  pawdy ask --stop "Sources:" "How do I gather initramfs logs?"
+  pawdy ask --top-p 0.5 --max-tokens 256 "What are the bare metal networking requirements?"
+  pawdy ask --sources-only "Where is the provisioning network documented?"`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runAsk,
 }
 
 func init() {
 	rootCmd.AddCommand(askCmd)
+	addCollectionFlag(askCmd)
+	addLangFlag(askCmd)
 	askCmd.Flags().Float64("temperature", 0, "override temperature for this question")
+	askCmd.Flags().Float64("top-p", 0, "override top_p for this question")
+	askCmd.Flags().Int("max-tokens", 0, "override max_tokens for this question")
+	askCmd.Flags().Bool("stats", false, "print token usage and generation speed")
+	askCmd.Flags().Float64("min-score", 0, "override min_score for retrieved context")
+	askCmd.Flags().Int("top-k", 0, "override top_k, the number of chunks retrieved as context")
+	askCmd.Flags().StringArray("stop", nil, "stop generating at this string (repeatable; replaces stop_sequences)")
+	askCmd.Flags().Bool("json", false, "print the answer, sources, and safety verdict as a single JSON object")
+	addSourcesFlags(askCmd)
+	askCmd.MarkFlagsMutuallyExclusive("json", "stats")
+	askCmd.MarkFlagsMutuallyExclusive("sources-only", "stats")
 }
 
 func runAsk(cmd *cobra.Command, args []string) error {
 	// Join all arguments as the question
 	question := strings.Join(args, " ")
+	if strings.TrimSpace(question) == "" {
+		return app.ErrEmptyQuestion
+	}
 
 	// Initialize the application
+	applyCollectionFlag(cmd)
+	applyLangFlag(cmd)
 	pawdy, err := app.New()
 	if err != nil {
 		return fmt.Errorf("failed to initialize Pawdy: %w", err)
 	}
 	defer pawdy.Close()
 
+	if verbose {
+		pawdy.PromptTrace = os.Stderr
+	}
+
+	if cmd.Flags().Changed("min-score") {
+		minScore, _ := cmd.Flags().GetFloat64("min-score")
+		if minScore < 0 || minScore > 1 {
+			return fmt.Errorf("min-score must be between 0.0 and 1.0, got %f", minScore)
+		}
+		pawdy.Config.MinScore = minScore
+	}
+	if err := applyTopKFlag(cmd, pawdy); err != nil {
+		return err
+	}
+
+	// Get generation overrides from flags
+	var overrides types.GenerateOptions
+	overrides.Temperature, _ = cmd.Flags().GetFloat64("temperature")
+	overrides.TopP, _ = cmd.Flags().GetFloat64("top-p")
+	overrides.MaxTokens, _ = cmd.Flags().GetInt("max-tokens")
+	if cmd.Flags().Changed("stop") {
+		overrides.StopSequences, _ = cmd.Flags().GetStringArray("stop")
+	}
+	if err := pawdy.ValidateOverrides(overrides); err != nil {
+		return err
+	}
+
 	ctx := context.Background()
 
-	// Get temperature override from flags
-	temperature, _ := cmd.Flags().GetFloat64("temperature")
+	showStats, _ := cmd.Flags().GetBool("stats")
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	mode := getSourcesMode(cmd)
+
+	if jsonOutput {
+		var answer *app.Answer
+		if mode == sourcesOnly {
+			answer, err = pawdy.Retrieve(ctx, question)
+		} else {
+			answer, err = pawdy.AskDetailed(ctx, question, overrides)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get answer: %w", err)
+		}
+
+		if mode == sourcesHidden {
+			answer.Sources = []*app.Source{}
+		}
+
+		return json.NewEncoder(os.Stdout).Encode(answer)
+	}
 
 	fmt.Printf("Question: %s\n\n", question)
 	fmt.Print("ʕ•ᴥ•ʔ ")
 
-	response, sources, err := pawdy.Ask(ctx, question, temperature)
+	if mode == sourcesOnly {
+		if err := printRetrieved(ctx, pawdy, question); err != nil {
+			return fmt.Errorf("failed to get sources: %w", err)
+		}
+		return nil
+	}
+
+	_, _, stats, err := streamAnswer(ctx, pawdy, question, nil, overrides, mode == sourcesShown, nil)
 	if err != nil {
 		return fmt.Errorf("failed to get answer: %w", err)
 	}
 
-	fmt.Println(response)
+	if showStats {
+		printStats(stats)
+	}
+
+	return nil
+}
+
+// printBlocked labels a safety refusal so it can't be mistaken for an answer.
+func printBlocked(blocked *app.BlockedError) {
+	label := fmt.Sprintf("🛡️  Blocked by safety gate (%s", blocked.Stage)
+	categories := blocked.Categories
+	if len(categories) == 0 && blocked.Category != "" {
+		categories = []string{blocked.Category}
+	}
+	if len(categories) > 0 {
+		label += ": " + strings.Join(categories, ", ")
+		if blocked.Reason != "" {
+			label += " - " + blocked.Reason
+		}
+	}
+	fmt.Printf("\n%s)\n%s\n", label, blocked.Error())
+}
+
+// printStats prints token usage and throughput for a generation.
+func printStats(stats *types.GenerationStats) {
+	if stats == nil {
+		fmt.Println("\n📊 Generation stats are not available for this backend")
+		return
+	}
+
+	fmt.Println("\n📊 Generation stats:")
+	fmt.Printf("   Prompt tokens: %d (%.2fs)\n", stats.PromptTokens, stats.PromptDuration.Seconds())
+	fmt.Printf("   Completion tokens: %d (%.2fs)\n", stats.CompletionTokens, stats.GenerationDuration.Seconds())
+	fmt.Printf("   Speed: %.1f tokens/sec\n", stats.TokensPerSecond())
+	fmt.Printf("   Total time: %.2fs\n", stats.TotalDuration.Seconds())
+}
 
-	// Print sources if any
-	if len(sources) > 0 {
-		fmt.Println("\n📚 Sources:")
-		for i, source := range sources {
-			fmt.Printf("  [%d] %s (score: %.3f)\n", i+1,
-				getSourceTitle(source), source.Score)
+// streamAnswer asks a question and prints tokens as they arrive, followed by the sources if showSources is set
+// and citation_style is not "none". onToken, if set, is called as each token arrives.
+// It returns the full response, or "" if the question or response was blocked by the safety gate,
+// along with the sources and, when the backend reports them, generation stats.
+func streamAnswer(ctx context.Context, pawdy *app.App, question string, history []types.Message, overrides types.GenerateOptions, showSources bool, onToken func()) (string, []*app.Source, *types.GenerationStats, error) {
+	tokens, sources, err := pawdy.AskStream(ctx, question, history, overrides)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var response strings.Builder
+	var stats *types.GenerationStats
+	for token := range tokens {
+		if onToken != nil {
+			onToken()
+		}
+		if token.Error != nil {
+			var blocked *app.BlockedError
+			if errors.As(token.Error, &blocked) {
+				printBlocked(blocked)
+				return "", nil, nil, nil
+			}
+			fmt.Println()
+			return "", nil, nil, token.Error
+		}
+
+		fmt.Print(token.Text)
+		response.WriteString(token.Text)
+		if token.Stats != nil {
+			stats = token.Stats
 		}
 	}
 
+	fmt.Println()
+	if showSources && pawdy.Config.CitationStyle != prompt.CitationNone {
+		printSources(sources)
+	}
+
+	return response.String(), sources, stats, nil
+}
+
+// applyTopKFlag sets the number of chunks retrieved for context from --top-k.
+func applyTopKFlag(cmd *cobra.Command, pawdy *app.App) error {
+	if !cmd.Flags().Changed("top-k") {
+		return nil
+	}
+
+	topK, _ := cmd.Flags().GetInt("top-k")
+	if topK < 1 || topK > 50 {
+		return fmt.Errorf("top-k must be between 1 and 50, got %d", topK)
+	}
+	pawdy.Config.TopK = topK
 	return nil
 }
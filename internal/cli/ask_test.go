@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTopKFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    int
+		wantErr string
+	}{
+		{args: nil, want: 5},
+		{args: []string{"--top-k=1"}, want: 1},
+		{args: []string{"--top-k=50"}, want: 50},
+		{args: []string{"--top-k=0"}, wantErr: "top-k must be between 1 and 50, got 0"},
+		{args: []string{"--top-k=51"}, wantErr: "top-k must be between 1 and 50, got 51"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.args), func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().Int("top-k", 0, "")
+			require.NoError(t, cmd.ParseFlags(tt.args))
+			pawdy := &app.App{Config: &types.Config{TopK: 5}}
+
+			err := applyTopKFlag(cmd, pawdy)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, 5, pawdy.Config.TopK, "the configured top_k is kept")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pawdy.Config.TopK)
+		})
+	}
+}
@@ -3,11 +3,18 @@ package cli
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/config"
+	"github.com/mabulgu/pawdy/internal/prompt"
+	"github.com/mabulgu/pawdy/pkg/types"
 	"github.com/spf13/cobra"
 )
 
@@ -15,32 +22,55 @@ var chatCmd = &cobra.Command{
 	Use:   "chat",
 	Short: "Start an interactive chat session",
 	Long: `Start an interactive chat session with Pawdy. Type your questions and 
-get answers with context from your team documentation. Use 'exit' or 'quit' to end the session.`,
+get answers with context from your team documentation. Press Ctrl-C to stop an answer
+that is still being generated. Use 'exit' or 'quit' to end the session.
+
+Commands start with a slash: /sources shows the sources of the last answer again,
+/temp 0.3 changes the temperature, /clear forgets the conversation, /reload re-reads
+the configuration file, and /help lists them all.`,
 	RunE: runChat,
 }
 
 func init() {
 	rootCmd.AddCommand(chatCmd)
+	addCollectionFlag(chatCmd)
+	addLangFlag(chatCmd)
 	chatCmd.Flags().Float64("temperature", 0, "override temperature for this session")
+	chatCmd.Flags().Float64("min-score", 0, "override min_score for retrieved context")
+	chatCmd.Flags().Int("top-k", 0, "override top_k, the number of chunks retrieved as context")
+	addSourcesFlags(chatCmd)
 }
 
 func runChat(cmd *cobra.Command, args []string) error {
+	session := &chatSession{cmd: cmd, mode: getSourcesMode(cmd)}
+	if cmd.Flags().Changed("temperature") {
+		temperature, _ := cmd.Flags().GetFloat64("temperature")
+		session.temperature = &temperature
+	}
+
 	// Initialize the application
-	pawdy, err := app.New()
+	applyCollectionFlag(cmd)
+	applyLangFlag(cmd)
+	pawdy, err := session.newApp(app.Options{})
 	if err != nil {
-		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+		return err
 	}
-	defer pawdy.Close()
+	session.pawdy = pawdy
+	defer func() { session.pawdy.Close() }()
 
 	// Print backend information
 	fmt.Printf("Backend: %s\n", pawdy.Config.Backend)
-	if pawdy.Config.Backend == "llamacpp" {
+	switch pawdy.Config.Backend {
+	case "llamacpp":
 		fmt.Printf("Model: %s\n", pawdy.Config.ModelPath)
-	} else {
+	case "openai":
+		fmt.Printf("OpenAI URL: %s (model: %s)\n", pawdy.Config.OpenAIURL, pawdy.Config.OpenAIModel)
+	default:
 		fmt.Printf("Ollama URL: %s\n", pawdy.Config.OllamaURL)
 	}
+	fmt.Printf("Collection: %s\n", pawdy.Config.Collection)
 	fmt.Printf("Safety: %s\n", pawdy.Config.Safety)
-	fmt.Println("\nType your questions (or 'exit'/'quit' to end):")
+	fmt.Println("\nType your questions (Ctrl-C stops an answer, /help lists commands, 'exit'/'quit' ends the session):")
 	fmt.Println("─────────────────────────────────────────────")
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -63,42 +93,333 @@ func runChat(cmd *cobra.Command, args []string) error {
 			break
 		}
 
+		if strings.HasPrefix(input, "/") {
+			if quit := session.runCommand(input); quit {
+				fmt.Println("\n👋 Goodbye!")
+				break
+			}
+			continue
+		}
+
 		fmt.Print("ʕ•ᴥ•ʔ ")
+		session.answer(ctx, input)
+	}
 
-		// Get temperature override from flags
-		temperature, _ := cmd.Flags().GetFloat64("temperature")
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+
+	return nil
+}
+
+// chatSession is the state of an interactive chat: the conversation so far, the
+// sources of the last answer, and settings changed with slash commands.
+type chatSession struct {
+	cmd   *cobra.Command
+	pawdy *app.App
+	mode  sourcesMode
+
+	temperature *float64 // set by --temperature or /temp; nil uses the configured value
+	history     []types.Message
+	lastSources []*app.Source
+}
+
+// chatCommands lists the slash commands for /help.
+var chatCommands = []struct{ usage, description string }{
+	{"/sources", "show the sources of the last answer again"},
+	{"/temp <value>", "set the temperature (0.0-2.0) for the rest of the session"},
+	{"/clear", "forget the conversation so far"},
+	{"/reload", "re-read the configuration file"},
+	{"/help", "list these commands"},
+	{"/exit", "end the session (also 'exit' or 'quit')"},
+}
+
+// newApp creates the application set up as opts asks, with the command's flag overrides applied.
+func (s *chatSession) newApp(opts app.Options) (*app.App, error) {
+	pawdy, err := app.NewWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+
+	if verbose {
+		pawdy.PromptTrace = os.Stderr
+	}
+
+	if s.cmd.Flags().Changed("min-score") {
+		minScore, _ := s.cmd.Flags().GetFloat64("min-score")
+		if minScore < 0 || minScore > 1 {
+			pawdy.Close()
+			return nil, fmt.Errorf("min-score must be between 0.0 and 1.0, got %f", minScore)
+		}
+		pawdy.Config.MinScore = minScore
+	}
+	if err := applyTopKFlag(s.cmd, pawdy); err != nil {
+		pawdy.Close()
+		return nil, err
+	}
+	if s.temperature != nil {
+		if *s.temperature < 0 || *s.temperature > 2 {
+			pawdy.Close()
+			return nil, fmt.Errorf("temperature must be between 0.0 and 2.0, got %f", *s.temperature)
+		}
+		pawdy.Config.Temperature = *s.temperature
+	}
+
+	return pawdy, nil
+}
+
+// answer answers a question, remembering the exchange for follow-up questions.
+func (s *chatSession) answer(ctx context.Context, input string) {
+	// Ctrl-C stops the current answer instead of ending the session, and a
+	// backend that sends nothing for request_timeout, before the first token
+	// or between tokens, is given up on
+	interruptCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	answerCtx, keepAlive, cancel := idleContext(interruptCtx, s.pawdy.Config.RequestTimeout)
+	var response string
+	var sources []*app.Source
+	var err error
+	if s.mode == sourcesOnly {
+		err = printRetrieved(answerCtx, s.pawdy, input)
+	} else {
+		response, sources, _, err = streamAnswer(answerCtx, s.pawdy, input, s.history, types.GenerateOptions{}, s.mode == sourcesShown, keepAlive)
+	}
+	interrupted := interruptCtx.Err() != nil
+	timedOut := errors.Is(context.Cause(answerCtx), errIdle)
+	cancel()
+	stop()
+
+	if interrupted {
+		fmt.Println("⏹️  Answer stopped")
+		return
+	}
+	if timedOut {
+		fmt.Printf("\n⏱️  No response for %s (request_timeout); the backend may be overloaded or stuck. Try again.\n", s.pawdy.Config.RequestTimeout)
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+
+	// Remember the exchange so follow-up questions have context
+	if response != "" {
+		now := time.Now()
+		s.history = append(s.history,
+			types.Message{Role: "user", Content: input, Timestamp: now},
+			types.Message{Role: "assistant", Content: response, Timestamp: now},
+		)
+		s.lastSources = sources
+	}
+}
+
+// errIdle is the cause of an idleContext's cancellation once its timeout passes.
+var errIdle = errors.New("no response within request_timeout")
+
+// idleContext returns a context that is cancelled with errIdle once timeout passes
+// without a call to keepAlive, so a slow answer that is still streaming isn't cut off.
+// cancel releases the context's timer.
+func idleContext(parent context.Context, timeout time.Duration) (ctx context.Context, keepAlive func(), cancel context.CancelFunc) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	timer := time.AfterFunc(timeout, func() { cancelCause(errIdle) })
+
+	keepAlive = func() { timer.Reset(timeout) }
+	cancel = func() {
+		timer.Stop()
+		cancelCause(context.Canceled)
+	}
+	return ctx, keepAlive, cancel
+}
 
-		response, sources, err := pawdy.Ask(ctx, input, temperature)
+// runCommand runs a slash command, reporting whether it ends the session.
+func (s *chatSession) runCommand(input string) bool {
+	fields := strings.Fields(input)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "/sources":
+		if len(s.lastSources) == 0 {
+			fmt.Println("📚 No sources for the last answer")
+			return false
+		}
+		printSources(s.lastSources)
+
+	case "/temp":
+		if len(args) != 1 {
+			fmt.Printf("🌡️  Temperature: %.2f (usage: /temp <0.0-2.0>)\n", s.pawdy.Config.Temperature)
+			return false
+		}
+		temperature, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			fmt.Printf("❌ Temperature must be a number between 0.0 and 2.0, got %q\n", args[0])
+			return false
+		}
+		s.temperature = &temperature
+		s.pawdy.Config.Temperature = temperature
+		fmt.Printf("🌡️  Temperature set to %.2f\n", temperature)
+
+	case "/clear":
+		s.history = nil
+		s.lastSources = nil
+		fmt.Println("🧹 Conversation cleared")
+
+	case "/reload":
+		return s.reload()
+
+	case "/help":
+		fmt.Println("Commands:")
+		for _, command := range chatCommands {
+			fmt.Printf("  %-14s %s\n", command.usage, command.description)
+		}
+
+	case "/exit", "/quit":
+		return true
+
+	default:
+		fmt.Printf("❓ Unknown command %s; type /help for the list\n", name)
+	}
+
+	return false
+}
+
+// reload replaces the application with one built from the configuration file, reporting
+// whether the session must end because neither configuration could be started. The new
+// application is normally started before the current one is closed, so a configuration
+// that fails leaves the session as it was. A llama.cpp backend is stopped first instead,
+// as two llama-servers may not fit in memory, and restarted if the new one fails.
+func (s *chatSession) reload() bool {
+	current := s.pawdy.Config
+	if current.Backend != "llamacpp" {
+		pawdy, err := s.newApp(app.Options{})
 		if err != nil {
-			fmt.Printf("❌ Error: %v\n", err)
-			continue
+			fmt.Printf("❌ Reload failed, keeping the current configuration: %v\n", err)
+			return false
 		}
+		s.pawdy.Close()
+		s.pawdy = pawdy
+		fmt.Printf("🔄 Configuration reloaded (backend: %s, collection: %s)\n", pawdy.Config.Backend, pawdy.Config.Collection)
+		return false
+	}
 
-		fmt.Println(response)
+	// Don't stop the running llama-server for a configuration that can't load
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("❌ Reload failed, keeping the current configuration: %v\n", err)
+		return false
+	}
 
-		// Print sources if any
-		if len(sources) > 0 {
-			fmt.Println("\n📚 Sources:")
-			for i, source := range sources {
-				fmt.Printf("  [%d] %s (score: %.3f)\n", i+1,
-					getSourceTitle(source), source.Score)
-			}
+	s.pawdy.Close()
+	pawdy, err := s.newApp(app.Options{Config: cfg})
+	if err != nil {
+		fmt.Printf("❌ Reload failed, restarting with the current configuration: %v\n", err)
+		pawdy, err = s.newApp(app.Options{Config: current})
+		if err != nil {
+			fmt.Printf("❌ Failed to restart Pawdy, ending the session: %v\n", err)
+			return true
 		}
+		s.pawdy = pawdy
+		return false
 	}
+	s.pawdy = pawdy
+	fmt.Printf("🔄 Configuration reloaded (backend: %s, collection: %s)\n", pawdy.Config.Backend, pawdy.Config.Collection)
+	return false
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading input: %w", err)
+// sourcesMode chooses whether an answer, its sources, or both are printed.
+type sourcesMode int
+
+const (
+	sourcesShown  sourcesMode = iota // the answer followed by its sources
+	sourcesHidden                    // the answer alone
+	sourcesOnly                      // the sources alone, without generating an answer
+)
+
+// addSourcesFlags adds the --no-sources and --sources-only flags read by getSourcesMode.
+func addSourcesFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("no-sources", false, "print the answer without its sources")
+	cmd.Flags().Bool("sources-only", false, "print the sources for the question without generating an answer")
+	cmd.MarkFlagsMutuallyExclusive("no-sources", "sources-only")
+}
+
+// getSourcesMode returns the sources mode selected by the flags added by addSourcesFlags.
+func getSourcesMode(cmd *cobra.Command) sourcesMode {
+	if only, _ := cmd.Flags().GetBool("sources-only"); only {
+		return sourcesOnly
+	}
+	if hidden, _ := cmd.Flags().GetBool("no-sources"); hidden {
+		return sourcesHidden
 	}
+	return sourcesShown
+}
 
+// printRetrieved prints the sources retrieved for a question, each followed by the chunk
+// as written in the document, without generating an answer.
+func printRetrieved(ctx context.Context, pawdy *app.App, question string) error {
+	retrieved, err := pawdy.Retrieve(ctx, question)
+	if err != nil {
+		return err
+	}
+
+	if retrieved.Safety.Blocked {
+		printBlocked(&app.BlockedError{
+			Stage:      retrieved.Safety.Stage,
+			Category:   retrieved.Safety.Category,
+			Categories: retrieved.Safety.Categories,
+			Reason:     retrieved.Safety.Reason,
+			Message:    retrieved.Answer,
+		})
+		return nil
+	}
+
+	if len(retrieved.Sources) == 0 {
+		fmt.Println("\n📚 No sources found")
+		return nil
+	}
+
+	fmt.Println("\n📚 Sources:")
+	for i, source := range retrieved.Sources {
+		fmt.Printf("  [%d] %s (score: %.3f)\n", i+1, getSourceTitle(source), source.Score)
+		for _, line := range strings.Split(strings.TrimSpace(source.Content), "\n") {
+			fmt.Printf("      %s\n", line)
+		}
+	}
 	return nil
 }
 
+// printSources prints the sources used for an answer, if any, one line per document
+// with the positions of its cited chunks.
+func printSources(sources []*app.Source) {
+	if len(sources) == 0 {
+		return
+	}
+
+	documents := make([]*types.Document, len(sources))
+	for i, source := range sources {
+		documents[i] = &types.Document{ID: source.ID, Metadata: source.Metadata, Score: source.Score}
+	}
+
+	fmt.Println("\n📚 Sources:")
+	for _, group := range prompt.GroupSources(documents) {
+		source := sources[group.Best]
+		fmt.Printf("  [%s] %s (score: %.3f", prompt.JoinNumbers(group.Numbers),
+			getSourceTitle(source), source.Score)
+		if len(group.Chunks) == 1 {
+			fmt.Printf(", chunk %d", group.Chunks[0])
+		} else if len(group.Chunks) > 1 {
+			fmt.Printf(", chunks %s", prompt.JoinNumbers(group.Chunks))
+		}
+		if !source.IngestedAt.IsZero() {
+			fmt.Printf(", ingested %s", source.IngestedAt.Local().Format("2006-01-02"))
+		}
+		fmt.Println(")")
+	}
+}
+
 func getSourceTitle(source *app.Source) string {
-	if title, ok := source.Metadata["title"].(string); ok && title != "" {
-		return title
+	if source.Title != "" {
+		return source.Title
 	}
-	if path, ok := source.Metadata["path"].(string); ok && path != "" {
-		return path
+	if source.Path != "" {
+		return source.Path
 	}
 	return fmt.Sprintf("Document %s", source.ID)
 }
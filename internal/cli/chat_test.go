@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/prompt"
+	"github.com/mabulgu/pawdy/internal/rag"
+	safetygate "github.com/mabulgu/pawdy/internal/safety"
+	"github.com/mabulgu/pawdy/internal/testutil"
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureStdout returns what run prints to standard output.
+func captureStdout(t *testing.T, run func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	run()
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestChatSession_RunCommand(t *testing.T) {
+	s := &chatSession{
+		pawdy:       &app.App{Config: &types.Config{Temperature: 0.7}},
+		history:     []types.Message{{Role: "user", Content: "How do I gather initramfs logs?"}},
+		lastSources: []*app.Source{{Path: "/docs/initramfs.md"}},
+	}
+
+	out := captureStdout(t, func() { assert.False(t, s.runCommand("/temp 0.2")) })
+	assert.Equal(t, "🌡️  Temperature set to 0.20\n", out)
+	require.NotNil(t, s.temperature)
+	assert.Equal(t, 0.2, *s.temperature)
+	assert.Equal(t, 0.2, s.pawdy.Config.Temperature)
+
+	// Out of range or missing values leave the temperature as it was
+	out = captureStdout(t, func() { assert.False(t, s.runCommand("/temp 3")) })
+	assert.Contains(t, out, `Temperature must be a number between 0.0 and 2.0, got "3"`)
+	out = captureStdout(t, func() { assert.False(t, s.runCommand("/temp")) })
+	assert.Contains(t, out, "Temperature: 0.20 (usage: /temp <0.0-2.0>)")
+	assert.Equal(t, 0.2, *s.temperature)
+
+	out = captureStdout(t, func() { assert.False(t, s.runCommand("/clear")) })
+	assert.Contains(t, out, "Conversation cleared")
+	assert.Empty(t, s.history)
+	assert.Empty(t, s.lastSources)
+
+	out = captureStdout(t, func() { assert.False(t, s.runCommand("/sources")) })
+	assert.Contains(t, out, "No sources for the last answer")
+
+	out = captureStdout(t, func() { assert.False(t, s.runCommand("/help")) })
+	for _, command := range chatCommands {
+		assert.Contains(t, out, command.usage)
+	}
+
+	out = captureStdout(t, func() { assert.False(t, s.runCommand("/tmep 0.2")) })
+	assert.Contains(t, out, "Unknown command /tmep; type /help for the list")
+
+	assert.True(t, s.runCommand("/exit"))
+	assert.True(t, s.runCommand("/quit"))
+}
+
+// pacedClient is an LLMClient that streams tokens with delay before each, stopping
+// early when its context is done, and then stalls if stall is set.
+type pacedClient struct {
+	types.LLMClient
+	tokens []string
+	delay  time.Duration
+	stall  bool
+}
+
+func (c *pacedClient) GenerateStream(ctx context.Context, prompt string, opts types.GenerateOptions) (<-chan types.StreamToken, error) {
+	tokens := make(chan types.StreamToken)
+	go func() {
+		defer close(tokens)
+		for _, text := range c.tokens {
+			select {
+			case <-time.After(c.delay):
+				tokens <- types.StreamToken{Text: text}
+			case <-ctx.Done():
+				tokens <- types.StreamToken{Error: ctx.Err()}
+				return
+			}
+		}
+		if c.stall {
+			<-ctx.Done()
+			tokens <- types.StreamToken{Error: ctx.Err()}
+			return
+		}
+		tokens <- types.StreamToken{Done: true}
+	}()
+	return tokens, nil
+}
+
+func TestChatSession_AnswerTimeout(t *testing.T) {
+	newSession := func(client types.LLMClient) *chatSession {
+		return &chatSession{pawdy: &app.App{
+			Config:        &types.Config{TopK: 5, RequestTimeout: 100 * time.Millisecond},
+			LLMClient:     client,
+			SafetyGate:    safetygate.NewGuard(nil, false),
+			Retriever:     rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+			Embeddings:    &testutil.ConstantEmbeddings{},
+			PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+			Logger:        slog.New(slog.DiscardHandler),
+		}}
+	}
+
+	// An answer that takes longer than request_timeout in total, but never pauses that long
+	s := newSession(&pacedClient{tokens: []string{"Boot ", "into ", "rescue ", "mode."}, delay: 40 * time.Millisecond})
+	out := captureStdout(t, func() { s.answer(context.Background(), "How do I gather initramfs logs?") })
+	assert.Equal(t, "Boot into rescue mode.\n", out)
+	require.Len(t, s.history, 2)
+	assert.Equal(t, "Boot into rescue mode.", s.history[1].Content)
+
+	// A backend that stops sending tokens is given up on
+	s = newSession(&pacedClient{tokens: []string{"Boot "}, delay: 10 * time.Millisecond, stall: true})
+	out = captureStdout(t, func() { s.answer(context.Background(), "How do I gather initramfs logs?") })
+	assert.Contains(t, out, "No response for 100ms (request_timeout)")
+	assert.Empty(t, s.history)
+}
+
+func TestChatSession_AnswerInterrupted(t *testing.T) {
+	client := &pacedClient{tokens: []string{"Boot "}, delay: 10 * time.Millisecond, stall: true}
+	s := &chatSession{pawdy: &app.App{
+		Config:        &types.Config{TopK: 5, RequestTimeout: time.Minute},
+		LLMClient:     client,
+		SafetyGate:    safetygate.NewGuard(nil, false),
+		Retriever:     rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+		Embeddings:    &testutil.ConstantEmbeddings{},
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	}}
+
+	// Ctrl-C while the answer is still streaming stops only that answer
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	time.AfterFunc(100*time.Millisecond, func() { process.Signal(os.Interrupt) })
+	out := captureStdout(t, func() { s.answer(context.Background(), "How do I gather initramfs logs?") })
+	assert.Contains(t, out, "⏹️  Answer stopped")
+	assert.Empty(t, s.history)
+
+	// The session goes on with the next question
+	client.stall = false
+	out = captureStdout(t, func() { s.answer(context.Background(), "How do I gather initramfs logs?") })
+	assert.Equal(t, "Boot \n", out)
+	require.Len(t, s.history, 2)
+}
+
+// closeCounter is an LLMClient that counts how often it is closed.
+type closeCounter struct {
+	types.LLMClient
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestChatSession_ReloadLlamaCpp(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "assets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "system_prompt.md"), []byte("You are Pawdy."), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "model.gguf"), nil, 0o644))
+	t.Chdir(dir)
+	t.Cleanup(viper.Reset)
+
+	reload := func(contents string) (*chatSession, *closeCounter, bool, string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "pawdy.yaml"), []byte(contents), 0o644))
+		viper.Reset()
+
+		client := &closeCounter{}
+		s := &chatSession{
+			cmd:   chatCmd,
+			pawdy: &app.App{Config: &types.Config{Backend: "llamacpp"}, LLMClient: client},
+		}
+		var quit bool
+		out := captureStdout(t, func() { quit = s.reload() })
+		return s, client, quit, out
+	}
+
+	// A configuration that doesn't load leaves the running llama-server alone
+	s, client, quit, out := reload("backend: bogus\n")
+	assert.False(t, quit)
+	assert.Contains(t, out, "keeping the current configuration")
+	assert.Zero(t, client.closed)
+	assert.Same(t, client, s.pawdy.LLMClient)
+
+	// Otherwise the llama-server is stopped before the new one starts, and the
+	// session ends if neither configuration starts
+	_, client, quit, out = reload("backend: llamacpp\nmodel_path: model.gguf\nllamacpp_server: no-such-llama-server\nsafety: off\n")
+	assert.True(t, quit)
+	assert.Contains(t, out, "restarting with the current configuration")
+	assert.Contains(t, out, "ending the session")
+	assert.Equal(t, 1, client.closed)
+}
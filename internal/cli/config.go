@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mabulgu/pawdy/internal/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var configCmd = &cobra.Command{
+	Use:     "config",
+	Aliases: []string{"whoami"},
+	Short:   "Show the effective configuration",
+	Long: `Show the configuration Pawdy runs with after the config file, PAWDY_* environment
+variables, and global flags are applied, in pawdy.yaml format. API keys and the
+credentials in URLs and connection strings are masked. The config file in use is
+printed first, along with the environment variables that override it.`,
+	RunE: runConfig,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfig(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if path := config.GetConfiguredPath(); path != "" {
+		fmt.Printf("# Config file: %s\n", path)
+	} else {
+		fmt.Println("# Config file: none found (using defaults)")
+	}
+
+	// Only the names; the values may be secrets
+	var overrides []string
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, "PAWDY_") {
+			overrides = append(overrides, name)
+		}
+	}
+	if len(overrides) > 0 {
+		sort.Strings(overrides)
+		fmt.Printf("# Environment overrides: %s\n", strings.Join(overrides, ", "))
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config.Masked(cfg)); err != nil {
+		return fmt.Errorf("failed to print configuration: %w", err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "assets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "system_prompt.md"), []byte("You are Pawdy."), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pawdy.yaml"), []byte(
+		"backend: openai\nopenai_api_key: sk-123\ncollection: networking\n"), 0o644))
+	t.Chdir(dir)
+	t.Setenv("PAWDY_COLLECTION", "storage")
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	var err error
+	out := captureStdout(t, func() { err = runConfig(configCmd, nil) })
+	require.NoError(t, err)
+	assert.Contains(t, out, "# Config file: "+filepath.Join(dir, "pawdy.yaml")+"\n")
+	assert.Regexp(t, `# Environment overrides: .*PAWDY_COLLECTION`, out)
+	assert.NotContains(t, out, "PAWDY_COLLECTION=", "only the names of overrides are listed")
+
+	// The resolved values, with the environment winning over the file and secrets masked
+	assert.Contains(t, out, "backend: openai\n")
+	assert.Contains(t, out, "collection: storage\n")
+	assert.Contains(t, out, "openai_api_key: '********'\n")
+	assert.NotContains(t, out, "sk-123")
+
+	// An invalid configuration is reported instead of printed
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pawdy.yaml"), []byte("min_score: 1.5\n"), 0o644))
+	viper.Reset()
+	out = captureStdout(t, func() { err = runConfig(configCmd, nil) })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load configuration")
+	assert.Contains(t, err.Error(), "min_score must be between 0.0 and 1.0")
+	assert.Empty(t, out)
+}
@@ -46,8 +46,14 @@ func runEval(cmd *cobra.Command, args []string) error {
 	fmt.Println("\n📈 Evaluation Results:")
 	fmt.Println("═════════════════════")
 	fmt.Printf("Questions processed: %d\n", results.Total)
+	if results.Errors > 0 {
+		fmt.Printf("Errors: %d\n", results.Errors)
+	}
 	fmt.Printf("Average response time: %.2fs\n", results.AvgResponseTime)
 	fmt.Printf("Average relevance score: %.3f\n", results.AvgRelevanceScore)
+	if results.RecallCases > 0 {
+		fmt.Printf("Recall@%d: %.3f (%d questions with expected_source)\n", results.TopK, results.RecallAtK, results.RecallCases)
+	}
 	
 	if results.SafetyBlocks > 0 {
 		fmt.Printf("Safety blocks: %d\n", results.SafetyBlocks)
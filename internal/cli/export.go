@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Export the indexed collection to a file",
+	Long: `Export every indexed chunk in the collection, with its vector and metadata,
+as JSON lines. Files ending in .gz are gzip-compressed. Load the file on another
+machine with 'pawdy import' to skip re-ingesting and re-embedding.
+
+Examples:
+  pawdy export pawdy_docs.jsonl.gz
+  pawdy export --collection=networking networking.jsonl`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	addCollectionFlag(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	path := args[0]
+
+	// Initialize the application against the requested collection
+	applyCollectionFlag(cmd)
+	pawdy, err := app.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+	defer pawdy.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(file)
+		w = gz
+	}
+
+	ctx := context.Background()
+
+	fmt.Printf("📦 Exporting collection '%s'...\n", pawdy.Config.Collection)
+
+	count, err := pawdy.Export(ctx, w)
+	if err != nil {
+		return fmt.Errorf("failed to export collection: %w", err)
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	fmt.Printf("✅ Exported %d chunks to %s\n", count, path)
+
+	return nil
+}
+
+// openExport opens an export file for reading, decompressing it if it is gzipped.
+func openExport(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export file: %w", err)
+	}
+
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return struct {
+			io.Reader
+			io.Closer
+		}{buffered, file}, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decompress export file: %w", err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
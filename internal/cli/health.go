@@ -2,10 +2,13 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/server"
 	"github.com/spf13/cobra"
 )
 
@@ -14,15 +17,25 @@ var healthCmd = &cobra.Command{
 	Short: "Check health of all services",
 	Long: `Check the health status of all Pawdy services including the LLM backend, 
 vector database, embedding service, and safety gate. Reports connection status 
-and response times.`,
+and response times.
+
+With --format json, the result is printed as {"healthy": bool, "services": [...]},
+the same body as the server's GET /health. The exit code is non-zero when any
+service is unhealthy in either format.`,
 	RunE: runHealth,
 }
 
 func init() {
 	rootCmd.AddCommand(healthCmd)
+	healthCmd.Flags().String("format", "text", "output format: text or json")
 }
 
 func runHealth(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("format must be 'text' or 'json', got '%s'", format)
+	}
+
 	// Initialize the application
 	pawdy, err := app.New()
 	if err != nil {
@@ -30,9 +43,6 @@ func runHealth(cmd *cobra.Command, args []string) error {
 	}
 	defer pawdy.Close()
 
-	fmt.Println("🏥 Pawdy Health Check")
-	fmt.Println("═══════════════════")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -42,6 +52,25 @@ func runHealth(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("health check failed: %w", err)
 	}
 
+	if format == "json" {
+		response := server.HealthResponse{Healthy: true, Services: healthStatus}
+		for _, status := range healthStatus {
+			if !status.Healthy {
+				response.Healthy = false
+			}
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
+			return err
+		}
+		if !response.Healthy {
+			return fmt.Errorf("health check failed")
+		}
+		return nil
+	}
+
+	fmt.Println("🏥 Pawdy Health Check")
+	fmt.Println("═══════════════════")
+
 	overallHealthy := true
 	for _, status := range healthStatus {
 		icon := "✅"
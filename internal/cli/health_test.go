@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mabulgu/pawdy/internal/server"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHealth_JSON(t *testing.T) {
+	var down atomic.Bool
+	ollamaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "model runner crashed", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"models": [{"name": "llama3.1:8b"}, {"name": "nomic-embed-text:latest"}]}`))
+	}))
+	t.Cleanup(ollamaServer.Close)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "assets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "system_prompt.md"), []byte("You are Pawdy."), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pawdy.yaml"), []byte(
+		"ollama_url: "+ollamaServer.URL+"\nvector_db: memory\nsafety: off\n"), 0o644))
+	t.Chdir(dir)
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	require.NoError(t, healthCmd.Flags().Set("format", "json"))
+	t.Cleanup(func() { healthCmd.Flags().Set("format", "text") })
+
+	var err error
+	out := captureStdout(t, func() { err = runHealth(healthCmd, nil) })
+	require.NoError(t, err)
+	var response server.HealthResponse
+	require.NoError(t, json.Unmarshal([]byte(out), &response))
+	assert.True(t, response.Healthy)
+	require.Len(t, response.Services, 4)
+	assert.Equal(t, "LLM Backend (ollama)", response.Services[0].Name)
+	assert.True(t, response.Services[0].Healthy)
+
+	// An unhealthy service is reported in the JSON and fails the command
+	viper.Reset()
+	down.Store(true)
+	out = captureStdout(t, func() { err = runHealth(healthCmd, nil) })
+	require.EqualError(t, err, "health check failed")
+	require.NoError(t, json.Unmarshal([]byte(out), &response))
+	assert.False(t, response.Healthy)
+	assert.False(t, response.Services[0].Healthy)
+	assert.NotEmpty(t, response.Services[0].Message)
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a collection written by 'pawdy export'",
+	Long: `Replace the collection with the chunks, vectors, and metadata from a file written
+by 'pawdy export'. Gzipped files are detected automatically. Vectors are stored as-is,
+so embedding_model must match the model used on the exporting machine.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	addCollectionFlag(importCmd)
+	importCmd.Flags().BoolP("force", "f", false, "skip confirmation prompt")
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	force, _ := cmd.Flags().GetBool("force")
+
+	reader, err := openExport(args[0])
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Initialize the application against the requested collection
+	applyCollectionFlag(cmd)
+	pawdy, err := app.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+	defer pawdy.Close()
+
+	collection := pawdy.Config.Collection
+
+	if !force {
+		fmt.Printf("⚠️  This will replace all indexed documents in collection '%s'. Continue? (y/N): ", collection)
+		var response string
+		fmt.Scanln(&response)
+
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Import cancelled.")
+			return nil
+		}
+	}
+
+	ctx := context.Background()
+
+	fmt.Printf("📥 Importing into collection '%s'...\n", collection)
+
+	count, err := pawdy.Import(ctx, reader)
+	if err != nil {
+		return fmt.Errorf("failed to import collection: %w", err)
+	}
+
+	if count == 0 {
+		fmt.Println("⚠️  No chunks found in export file; collection left unchanged")
+		return nil
+	}
+
+	fmt.Printf("✅ Imported %d chunks\n", count)
+
+	return nil
+}
@@ -2,104 +2,459 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 
 	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/document"
+	"github.com/mabulgu/pawdy/pkg/types"
 	"github.com/spf13/cobra"
 )
 
 var ingestCmd = &cobra.Command{
-	Use:   "ingest [directory]",
-	Short: "Ingest documents from a directory",
-	Long: `Ingest and index documents from the specified directory. Supports Markdown (.md), 
-plain text (.txt), PDF (.pdf), and HTML (.html) files. Documents are chunked, embedded, 
-and stored in the vector database for retrieval.`,
+	Use:   "ingest [directory|file|url]",
+	Short: "Ingest documents from a directory, a single file, or a web page",
+	Long: `Ingest and index documents from the specified directory, or a single document if a file
+is given. Supports Markdown (.md), plain text (.txt), PDF (.pdf), HTML (.html), Word (.docx),
+EPUB (.epub), CSV/TSV (.csv, .tsv), and source code (.go, .sh, .py, .js, .ts, .java, .rs, .c, .cpp, .rb)
+files.
+
+An http:// or https:// URL is fetched and indexed with the URL as its path. HTML, Markdown,
+and plain text pages are supported. With --depth, pages it links to on the same host are
+ingested too; every page listed in a sitemap URL is ingested.
+
+When ingesting a directory, hidden directories such as .git are skipped, along with
+paths matching the gitignore-style patterns in a .pawdyignore file at its root.
+Ingested directories are recorded in ~/.pawdy/ingested.json, and ingesting one again
+under a different path (or a copy of it) stops with a warning unless --force is given,
+since its files would be indexed twice.
+
+Documents are chunked, embedded, and stored in the vector database for retrieval.
+
+Examples:
+  pawdy ingest ./materials
+  pawdy ingest https://wiki.example.com/baremetal/runbook
+  pawdy ingest --depth 2 https://wiki.example.com/baremetal/
+  pawdy ingest https://wiki.example.com/sitemap.xml
+  pawdy ingest --dry-run --chunk-size 500 ./materials`,
 	Args: cobra.ExactArgs(1),
 	RunE: runIngest,
 }
 
 func init() {
 	rootCmd.AddCommand(ingestCmd)
-	ingestCmd.Flags().Int("chunk-size", 0, "override chunk size in tokens")
+	addCollectionFlag(ingestCmd)
+	ingestCmd.Flags().Int("chunk-size", 0, "override chunk size in tokens for all file types")
 	ingestCmd.Flags().Int("overlap", 0, "override chunk overlap in tokens")
+	ingestCmd.Flags().BoolP("force", "f", false, "re-ingest files even if they are unchanged")
+	ingestCmd.Flags().Int("workers", 0, "number of files to ingest in parallel (default from config)")
+	ingestCmd.Flags().Int("depth", 0, "for a URL, follow links on the same host this many levels deep")
+	ingestCmd.Flags().Int("max-pages", 100, "for a URL, stop after ingesting this many pages")
+	ingestCmd.Flags().Float64("weight", 0, "score multiplier for these documents in retrieval, e.g. 1.5 for authoritative runbooks (default from config)")
+	ingestCmd.Flags().Bool("dry-run", false, "extract and chunk files and print the plan without embedding or indexing anything")
 }
 
 func runIngest(cmd *cobra.Command, args []string) error {
-	directory := args[0]
+	target := args[0]
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
 
-	// Check if directory exists
-	if _, err := os.Stat(directory); os.IsNotExist(err) {
-		return fmt.Errorf("directory does not exist: %s", directory)
+	if document.IsURL(target) {
+		if dryRun {
+			return fmt.Errorf("--dry-run is only supported for files and directories")
+		}
+		return runIngestURL(cmd, target)
 	}
 
-	// Initialize the application
-	pawdy, err := app.New()
+	// Check if the directory or file exists
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("path does not exist: %s", target)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to access %s: %w", target, err)
+	}
+
+	if !info.IsDir() && !document.IsSupportedFile(target) {
+		return fmt.Errorf("unsupported file type: %s", filepath.Ext(target))
+	}
+
+	// Initialize the application; a dry run needs no backend services
+	applyCollectionFlag(cmd)
+	newApp := app.New
+	if dryRun {
+		newApp = app.NewLocal
+	}
+	pawdy, err := newApp()
 	if err != nil {
 		return fmt.Errorf("failed to initialize Pawdy: %w", err)
 	}
 	defer pawdy.Close()
 
+	if err := applyWeightFlag(cmd, pawdy); err != nil {
+		return err
+	}
+
 	// Get override values from flags
 	chunkSize, _ := cmd.Flags().GetInt("chunk-size")
 	overlap, _ := cmd.Flags().GetInt("overlap")
-
-	fmt.Printf("📂 Ingesting documents from: %s\n", directory)
-	fmt.Println("Supported formats: .md, .txt, .html, .pdf")
-	fmt.Println()
+	force, _ := cmd.Flags().GetBool("force")
+	workers, _ := cmd.Flags().GetInt("workers")
+	if workers <= 0 {
+		workers = pawdy.Config.IngestWorkers
+	}
 
 	ctx := context.Background()
 
-	// Walk through directory and collect files
 	var files []string
-	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+	if info.IsDir() {
+		fmt.Printf("📂 Ingesting documents from: %s\n", target)
+		fmt.Println("Supported formats: .md, .txt, .html, .pdf, .docx, .epub, .csv, .tsv, and source code")
+		fmt.Println()
+
+		files, err = document.CollectFiles(target)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to scan directory: %w", err)
 		}
 
-		if info.IsDir() {
+		if len(files) == 0 {
+			fmt.Println("⚠️  No supported files found in directory")
 			return nil
 		}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext == ".md" || ext == ".txt" || ext == ".pdf" || ext == ".html" {
-			files = append(files, path)
-		}
+		fmt.Printf("📄 Found %d files to process\n\n", len(files))
+	} else {
+		fmt.Printf("📄 Ingesting document: %s\n\n", target)
+		files = []string{target}
+	}
 
+	if dryRun {
+		printIngestPlan(planIngest(ctx, pawdy, files, chunkSize, overlap))
 		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("failed to scan directory: %w", err)
 	}
 
-	if len(files) == 0 {
-		fmt.Println("⚠️  No supported files found in directory")
+	// Catch the same directory being ingested under another path, which would
+	// index its files a second time rather than update them
+	if info.IsDir() && !force {
+		previous, err := pawdy.PreviousIngestion(target, files)
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			return fmt.Errorf("this directory looks already ingested as %s on %s; ingest it as %s to update it, "+
+				"use --force to index it again under this path, or 'pawdy reset' to start over",
+				previous.Path, previous.IngestedAt.Local().Format("2006-01-02"), previous.Path)
+		}
+	}
+
+	// Process files
+	results := ingestFiles(ctx, pawdy, files, workers, chunkSize, overlap, force)
+
+	if info.IsDir() {
+		if err := pawdy.RecordIngestion(target, files); err != nil {
+			pawdy.Logger.Warn("Failed to record ingested directory", "error", err)
+		}
+	}
+
+	printIngestSummary(results)
+
+	return nil
+}
+
+// applyWeightFlag sets the source weight recorded with ingested chunks from --weight.
+func applyWeightFlag(cmd *cobra.Command, pawdy *app.App) error {
+	if !cmd.Flags().Changed("weight") {
 		return nil
 	}
 
-	fmt.Printf("📄 Found %d files to process\n\n", len(files))
+	weight, _ := cmd.Flags().GetFloat64("weight")
+	if weight <= 0 {
+		return fmt.Errorf("weight must be positive, got %f", weight)
+	}
+	pawdy.Config.SourceWeight = weight
+	return nil
+}
 
-	// Process files
+// printIngestSummary prints totals for an ingestion run and lists the sources that failed
+// or yielded no chunks.
+func printIngestSummary(results []ingestResult) {
 	totalChunks := 0
+	duplicates := 0
+	skipped := 0
+	var empty, partial, failed []ingestResult
+	for _, result := range results {
+		switch {
+		case errors.Is(result.err, app.ErrUnchanged):
+			skipped++
+		case errors.Is(result.err, app.ErrNoChunks):
+			empty = append(empty, result)
+		case isPartial(result.err):
+			partial = append(partial, result)
+			totalChunks += result.chunks
+			duplicates += result.duplicates
+		case result.err != nil:
+			failed = append(failed, result)
+		default:
+			totalChunks += result.chunks
+			duplicates += result.duplicates
+		}
+	}
+
+	fmt.Printf("\n🎉 Ingestion complete!\n")
+	fmt.Printf("📊 Total files processed: %d\n", len(results))
+	if skipped > 0 {
+		fmt.Printf("📊 Unchanged files skipped: %d\n", skipped)
+	}
+	fmt.Printf("📊 Total chunks created: %d\n", totalChunks)
+	fmt.Printf("📊 Embeddings generated: %d\n", totalChunks+duplicates)
+	if duplicates > 0 {
+		fmt.Printf("📊 Duplicate chunks skipped: %d\n", duplicates)
+	}
+
+	if len(empty) > 0 {
+		fmt.Printf("\n⚠️  %d files produced no chunks (check their text extraction):\n", len(empty))
+		for _, result := range empty {
+			fmt.Printf("  • %s\n", result.path)
+		}
+	}
+
+	if len(partial) > 0 {
+		fmt.Printf("\n⚠️  %d files were partially indexed (re-run with --force to retry):\n", len(partial))
+		for _, result := range partial {
+			fmt.Printf("  • %s: %v\n", result.path, result.err)
+		}
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("\n❌ %d files failed:\n", len(failed))
+		for _, result := range failed {
+			fmt.Printf("  • %s: %v\n", result.path, result.err)
+		}
+	}
+}
+
+// planIngest chunks files without indexing them, printing how many chunks each would produce.
+func planIngest(ctx context.Context, pawdy *app.App, files []string, chunkSize, overlap int) []ingestResult {
+	results := make([]ingestResult, len(files))
 	for i, file := range files {
-		fmt.Printf("[%d/%d] Processing: %s\n", i+1, len(files), filepath.Base(file))
+		documents, err := pawdy.ChunkFile(ctx, file, chunkSize, overlap)
+		results[i] = ingestResult{path: file, chunks: len(documents), err: err}
 
-		chunks, err := pawdy.IngestFile(ctx, file, chunkSize, overlap)
-		if err != nil {
+		fmt.Printf("[%d/%d] %s\n", i+1, len(files), file)
+		switch {
+		case errors.Is(err, app.ErrNoChunks):
+			fmt.Printf("  ⚠️  No chunks extracted\n")
+		case err != nil:
 			fmt.Printf("  ❌ Error: %v\n", err)
-			continue
+		default:
+			fmt.Printf("  📝 Would create %d chunks\n", len(documents))
+		}
+	}
+	return results
+}
+
+// printIngestPlan prints totals for a dry run.
+func printIngestPlan(results []ingestResult) {
+	totalChunks := 0
+	empty := 0
+	failed := 0
+	for _, result := range results {
+		switch {
+		case errors.Is(result.err, app.ErrNoChunks):
+			empty++
+		case result.err != nil:
+			failed++
 		}
+		totalChunks += result.chunks
+	}
 
-		fmt.Printf("  ✅ Created %d chunks\n", chunks)
-		totalChunks += chunks
+	fmt.Printf("\n🧪 Dry run complete, nothing was indexed\n")
+	fmt.Printf("📊 Files matched: %d\n", len(results))
+	fmt.Printf("📊 Chunks that would be created: %d\n", totalChunks)
+	fmt.Printf("📊 Embeddings that would be generated: %d\n", totalChunks)
+	if empty > 0 {
+		fmt.Printf("⚠️  Files with no chunks: %d\n", empty)
 	}
+	if failed > 0 {
+		fmt.Printf("❌ Files that would fail: %d\n", failed)
+	}
+	fmt.Println("💡 Unchanged-file and duplicate checks need the vector database and are not applied")
+}
 
-	fmt.Printf("\n🎉 Ingestion complete!\n")
-	fmt.Printf("📊 Total files processed: %d\n", len(files))
-	fmt.Printf("📊 Total chunks created: %d\n", totalChunks)
-	fmt.Printf("📊 Embeddings generated: %d\n", totalChunks)
+func runIngestURL(cmd *cobra.Command, target string) error {
+	start, err := url.Parse(target)
+	if err != nil || start.Host == "" {
+		return fmt.Errorf("invalid URL: %s", target)
+	}
+
+	depth, _ := cmd.Flags().GetInt("depth")
+	maxPages, _ := cmd.Flags().GetInt("max-pages")
+	if depth < 0 {
+		return fmt.Errorf("depth must be non-negative, got %d", depth)
+	}
+	if maxPages < 1 {
+		return fmt.Errorf("max-pages must be at least 1, got %d", maxPages)
+	}
+
+	// Initialize the application
+	applyCollectionFlag(cmd)
+	pawdy, err := app.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+	defer pawdy.Close()
+
+	if err := applyWeightFlag(cmd, pawdy); err != nil {
+		return err
+	}
+
+	chunkSize, _ := cmd.Flags().GetInt("chunk-size")
+	overlap, _ := cmd.Flags().GetInt("overlap")
+	force, _ := cmd.Flags().GetBool("force")
+
+	fmt.Printf("🌐 Ingesting from: %s\n\n", target)
+
+	results := crawl(context.Background(), pawdy, start, depth, maxPages, chunkSize, overlap, force)
+
+	printIngestSummary(results)
 
 	return nil
 }
+
+// crawlPage is a URL waiting to be ingested, with how many links it is from the start page.
+type crawlPage struct {
+	url   string
+	depth int
+}
+
+// crawl ingests the page at start and then, breadth first, the pages on the same host
+// it links to, up to maxDepth links away and maxPages pages in total. Pages listed in a
+// sitemap are at the sitemap's own depth, so every listed page is ingested.
+func crawl(ctx context.Context, pawdy *app.App, start *url.URL, maxDepth, maxPages, chunkSize, overlap int, force bool) []ingestResult {
+	queue := []crawlPage{{url: start.String()}}
+	seen := map[string]bool{start.String(): true}
+
+	var results []ingestResult
+	for len(queue) > 0 && len(results) < maxPages {
+		current := queue[0]
+		queue = queue[1:]
+
+		page, chunks, duplicates, err := pawdy.IngestURL(ctx, current.url, chunkSize, overlap, force)
+
+		if page == nil || !page.Sitemap {
+			result := ingestResult{path: current.url, chunks: chunks, duplicates: duplicates, err: err}
+			results = append(results, result)
+
+			fmt.Printf("[%d] %s\n", len(results), current.url)
+			printIngestStatus(result)
+		} else {
+			fmt.Printf("🗺️  Sitemap %s lists %d pages\n", current.url, len(page.Links))
+		}
+
+		if page == nil || (!page.Sitemap && current.depth >= maxDepth) {
+			continue
+		}
+
+		linkDepth := current.depth + 1
+		if page.Sitemap {
+			linkDepth = current.depth
+		}
+
+		for _, link := range page.Links {
+			parsed, err := url.Parse(link)
+			if err != nil || parsed.Host != start.Host || seen[link] {
+				continue
+			}
+
+			seen[link] = true
+			queue = append(queue, crawlPage{url: link, depth: linkDepth})
+		}
+	}
+
+	if len(queue) > 0 {
+		fmt.Printf("\n⚠️  Stopped after %d pages (--max-pages); %d linked pages were not ingested\n", maxPages, len(queue))
+	}
+
+	return results
+}
+
+// ingestResult records the outcome of ingesting a single file.
+type ingestResult struct {
+	path       string
+	chunks     int
+	duplicates int
+	err        error
+}
+
+// ingestFiles ingests files using up to workers goroutines, printing progress as each file finishes
+// and, on a terminal, a progress bar with an ETA.
+// Per-file errors are recorded in the results rather than aborting the run.
+func ingestFiles(ctx context.Context, pawdy *app.App, files []string, workers, chunkSize, overlap int, force bool) []ingestResult {
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	jobs := make(chan int)
+	results := make([]ingestResult, len(files))
+
+	var mu sync.Mutex
+	progress := newIngestProgress(os.Stdout, len(files))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				chunks, duplicates, err := pawdy.IngestFile(ctx, files[i], chunkSize, overlap, force)
+				results[i] = ingestResult{path: files[i], chunks: chunks, duplicates: duplicates, err: err}
+
+				// Serialize output so the counter, status lines, and progress bar stay together
+				mu.Lock()
+				progress.clear()
+				progress.fileDone(chunks)
+				fmt.Printf("[%d/%d] %s\n", progress.done, len(files), filepath.Base(files[i]))
+				printIngestStatus(results[i])
+				progress.draw()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	progress.clear()
+
+	return results
+}
+
+// isPartial reports whether err means only some of a source's chunks were indexed.
+func isPartial(err error) bool {
+	var partial *types.PartialIndexError
+	return errors.As(err, &partial)
+}
+
+// printIngestStatus prints the outcome of ingesting one file or page.
+func printIngestStatus(result ingestResult) {
+	switch {
+	case errors.Is(result.err, app.ErrUnchanged):
+		fmt.Printf("  ⏭️  Unchanged, skipped\n")
+	case errors.Is(result.err, app.ErrNoChunks):
+		fmt.Printf("  ⚠️  No chunks extracted\n")
+	case isPartial(result.err):
+		// The indexed chunks record the content hash, so only --force retries the rest
+		fmt.Printf("  ⚠️  %v (re-run with --force to retry)\n", result.err)
+	case result.err != nil:
+		fmt.Printf("  ❌ Error: %v\n", result.err)
+	case result.duplicates > 0:
+		fmt.Printf("  ✅ Created %d chunks (%d duplicates skipped)\n", result.chunks, result.duplicates)
+	default:
+		fmt.Printf("  ✅ Created %d chunks\n", result.chunks)
+	}
+}
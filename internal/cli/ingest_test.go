@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/rag"
+	"github.com/mabulgu/pawdy/internal/testutil"
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crawlSite serves a small wiki: the start page links to two pages, one of which
+// links one level deeper, plus a page on another host that must not be followed.
+func crawlSite(t *testing.T) *httptest.Server {
+	pages := map[string]string{
+		"/wiki/":        `<a href="runbook">Runbook</a> <a href="/wiki/network">Network</a> <a href="https://example.com/elsewhere">Elsewhere</a>`,
+		"/wiki/runbook": `<a href="/wiki/bmc">BMC</a> <a href="/wiki/">Home</a>`,
+		"/wiki/network": `<a href="/wiki/runbook">Runbook</a>`,
+		"/wiki/bmc":     ``,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		links, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><body><p>Notes on %s for the node runbook.</p>%s</body></html>", r.URL.Path, links)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCrawl(t *testing.T) {
+	server := crawlSite(t)
+	start, err := url.Parse(server.URL + "/wiki/")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		depth    int
+		maxPages int
+		want     []string
+	}{
+		{name: "start page only", depth: 0, maxPages: 10, want: []string{"/wiki/"}},
+		{name: "one link away", depth: 1, maxPages: 10, want: []string{"/wiki/", "/wiki/runbook", "/wiki/network"}},
+		{name: "two links away", depth: 2, maxPages: 10, want: []string{"/wiki/", "/wiki/runbook", "/wiki/network", "/wiki/bmc"}},
+		{name: "page limit", depth: 2, maxPages: 2, want: []string{"/wiki/", "/wiki/runbook"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pawdy := &app.App{
+				Config:    &types.Config{ChunkTokens: 100, ChunkOverlap: 10, Dedupe: "off", SourceWeight: 1, RequestTimeout: time.Minute},
+				Retriever: rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{}),
+				Logger:    slog.New(slog.DiscardHandler),
+			}
+
+			var results []ingestResult
+			captureStdout(t, func() {
+				results = crawl(context.Background(), pawdy, start, tt.depth, tt.maxPages, 0, 0, false)
+			})
+
+			var paths []string
+			for _, result := range results {
+				require.NoError(t, result.err)
+				assert.Positive(t, result.chunks)
+				paths = append(paths, result.path)
+			}
+			var want []string
+			for _, path := range tt.want {
+				want = append(want, server.URL+path)
+			}
+			assert.Equal(t, want, paths)
+		})
+	}
+}
+
+func TestRunIngest_SingleFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "assets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "system_prompt.md"), []byte("You are Pawdy."), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "initramfs.md"), []byte("# Initramfs\n\nBoot into rescue mode.\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "dhcp.md"), []byte("# DHCP\n\nRestart dnsmasq.\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "topology.png"), nil, 0o644))
+	t.Chdir(dir)
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	require.NoError(t, ingestCmd.Flags().Set("dry-run", "true"))
+	t.Cleanup(func() { ingestCmd.Flags().Set("dry-run", "false") })
+
+	// Only the given file is ingested, not the rest of its directory
+	var err error
+	out := captureStdout(t, func() { err = runIngest(ingestCmd, []string{filepath.Join("docs", "initramfs.md")}) })
+	require.NoError(t, err)
+	assert.Contains(t, out, "📄 Ingesting document: docs/initramfs.md")
+	assert.Contains(t, out, "📊 Files matched: 1\n")
+
+	out = captureStdout(t, func() { err = runIngest(ingestCmd, []string{"docs"}) })
+	require.NoError(t, err)
+	assert.Contains(t, out, "📊 Files matched: 2\n")
+
+	err = runIngest(ingestCmd, []string{filepath.Join("docs", "topology.png")})
+	assert.EqualError(t, err, "unsupported file type: .png")
+}
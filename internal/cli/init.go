@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mabulgu/pawdy/internal/config"
+	"github.com/mabulgu/pawdy/internal/prompt"
+	"github.com/spf13/cobra"
+)
+
+// initSystemPromptPath is where init writes the system prompt; it matches the
+// system_prompt setting in the example configuration.
+var initSystemPromptPath = filepath.Join("assets", "system_prompt.md")
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a starter configuration and system prompt",
+	Long: `Create pawdy.yaml (or the file given with --config) with every setting and its
+default, and assets/system_prompt.md with the default system prompt, in the
+current directory. Existing files are left alone unless --force is given.`,
+	Args: cobra.NoArgs,
+	RunE: runInit,
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().BoolP("force", "f", false, "overwrite existing files")
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	force, _ := cmd.Flags().GetBool("force")
+
+	configPath := cfgFile
+	if configPath == "" {
+		configPath = "pawdy.yaml"
+	}
+
+	wrote, err := writeInitFile(configPath, force, config.WriteExample)
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	reportInitFile(configPath, wrote)
+
+	wrote, err = writeInitFile(initSystemPromptPath, force, func(path string) error {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(prompt.DefaultSystemPrompt()+"\n"), 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write system prompt: %w", err)
+	}
+	reportInitFile(initSystemPromptPath, wrote)
+
+	fmt.Println("\n🐾 Next steps:")
+	fmt.Printf("   1. Edit %s: pick a backend and point it at your models\n", configPath)
+	fmt.Println("   2. Start Qdrant: docker run -d -p 6333:6333 -v $(pwd)/qdrant:/qdrant/storage qdrant/qdrant")
+	fmt.Println("   3. Check everything is reachable: pawdy health")
+	fmt.Println("   4. Index your documentation: pawdy ingest ./materials")
+	fmt.Println("   5. Start asking: pawdy chat")
+
+	return nil
+}
+
+// writeInitFile writes path with write unless it exists and force is false.
+// It reports whether the file was written.
+func writeInitFile(path string, force bool, write func(path string) error) (bool, error) {
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return false, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+
+	if err := write(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reportInitFile prints whether init created a file or left an existing one.
+func reportInitFile(path string, wrote bool) {
+	if wrote {
+		fmt.Printf("✅ Wrote %s\n", path)
+	} else {
+		fmt.Printf("⏭️  %s already exists, leaving it (use --force to overwrite)\n", path)
+	}
+}
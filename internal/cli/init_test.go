@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mabulgu/pawdy/internal/config"
+	"github.com/mabulgu/pawdy/internal/prompt"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunInit(t *testing.T) {
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	var err error
+	out := captureStdout(t, func() { err = runInit(initCmd, nil) })
+	require.NoError(t, err)
+	assert.Contains(t, out, "✅ Wrote pawdy.yaml")
+	assert.Contains(t, out, "✅ Wrote assets/system_prompt.md")
+
+	systemPrompt, err := os.ReadFile(filepath.Join("assets", "system_prompt.md"))
+	require.NoError(t, err)
+	assert.Equal(t, prompt.DefaultSystemPrompt()+"\n", string(systemPrompt))
+
+	// The starter files make a valid configuration
+	_, err = config.Load()
+	require.NoError(t, err)
+
+	// Existing files are kept unless --force is given
+	require.NoError(t, os.WriteFile("pawdy.yaml", []byte("collection: networking\n"), 0o644))
+	out = captureStdout(t, func() { err = runInit(initCmd, nil) })
+	require.NoError(t, err)
+	assert.Contains(t, out, "⏭️  pawdy.yaml already exists, leaving it (use --force to overwrite)")
+	contents, err := os.ReadFile("pawdy.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "collection: networking\n", string(contents))
+
+	require.NoError(t, initCmd.Flags().Set("force", "true"))
+	t.Cleanup(func() { initCmd.Flags().Set("force", "false") })
+	out = captureStdout(t, func() { err = runInit(initCmd, nil) })
+	require.NoError(t, err)
+	assert.Contains(t, out, "✅ Wrote pawdy.yaml")
+	contents, err = os.ReadFile("pawdy.yaml")
+	require.NoError(t, err)
+	assert.NotEqual(t, "collection: networking\n", string(contents))
+}
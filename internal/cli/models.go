@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List the models installed in Ollama",
+	Long: `List the models installed on the Ollama server at ollama_url with their size and
+when they were last modified. Models the configuration uses for chat, guard, rerank, or
+embeddings are marked, and configured models that are not installed are reported with the
+command that pulls them.`,
+	RunE: runModels,
+}
+
+func init() {
+	rootCmd.AddCommand(modelsCmd)
+}
+
+func runModels(cmd *cobra.Command, args []string) error {
+	// Load the configuration directly; app.New refuses to start when a configured model is missing
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	installed, configured, err := app.Models(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to list models: %w", err)
+	}
+
+	fmt.Printf("🦙 Ollama models at %s\n", cfg.OllamaURL)
+	fmt.Println("═══════════════════")
+
+	if len(installed) == 0 {
+		fmt.Println("No models installed")
+	}
+
+	width := 0
+	for _, model := range installed {
+		width = max(width, len(model.Name))
+	}
+
+	for _, model := range installed {
+		var roles []string
+		for _, c := range configured {
+			if model.Matches(c.Name) {
+				roles = append(roles, c.Role)
+			}
+		}
+
+		fmt.Printf("%-*s  %9s  %s", width, model.Name, formatSize(model.Size), model.ModifiedAt.Format("2006-01-02"))
+		if len(roles) > 0 {
+			fmt.Printf("  ← %s", strings.Join(roles, ", "))
+		}
+		fmt.Println()
+	}
+
+	var missing int
+	for _, c := range configured {
+		if !c.Installed {
+			if missing == 0 {
+				fmt.Println()
+			}
+			missing++
+			fmt.Printf("⚠️  %s model '%s' is not installed (run `ollama pull %s`)\n", c.Role, c.Name, c.Name)
+		}
+	}
+
+	if missing > 0 {
+		return fmt.Errorf("%d configured models are not installed", missing)
+	}
+
+	return nil
+}
+
+// formatSize renders a byte count with a binary unit, e.g. "4.7 GB".
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes)
+	suffixes := []string{"KB", "MB", "GB", "TB"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, suffixes[i])
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// progressBarWidth is the number of cells in the ingestion progress bar.
+	progressBarWidth = 30
+
+	// etaWindow is how many recent files the ETA averages over, so it follows
+	// changes in speed, e.g. when a run moves from small notes to large PDFs.
+	etaWindow = 10
+)
+
+// ingestProgress tracks how many files and chunks an ingestion run has finished. On a
+// terminal it keeps a progress bar with an ETA on the last line, below the per-file
+// status lines; otherwise it draws nothing, so redirected output stays plain lines.
+type ingestProgress struct {
+	out   *os.File
+	tty   bool
+	drawn bool
+
+	total  int
+	done   int
+	chunks int
+
+	last      time.Time
+	intervals []time.Duration // time between the most recent file completions
+}
+
+// newIngestProgress starts tracking a run of total files written to out.
+func newIngestProgress(out *os.File, total int) *ingestProgress {
+	p := &ingestProgress{out: out, tty: isTerminal(out), total: total, last: time.Now()}
+	p.draw()
+	return p
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// fileDone records a finished file that created chunks. Call clear first and draw
+// after printing its status.
+func (p *ingestProgress) fileDone(chunks int) {
+	// Time between completions reflects parallel workers, unlike per-file durations
+	now := time.Now()
+	p.intervals = append(p.intervals, now.Sub(p.last))
+	if len(p.intervals) > etaWindow {
+		p.intervals = p.intervals[1:]
+	}
+	p.last = now
+
+	p.done++
+	p.chunks += chunks
+}
+
+// eta estimates the time left from the average time between recent completions.
+func (p *ingestProgress) eta() (time.Duration, bool) {
+	if len(p.intervals) == 0 || p.done >= p.total {
+		return 0, false
+	}
+
+	var sum time.Duration
+	for _, interval := range p.intervals {
+		sum += interval
+	}
+	return sum / time.Duration(len(p.intervals)) * time.Duration(p.total-p.done), true
+}
+
+// draw writes the progress bar on the current line, without a newline.
+func (p *ingestProgress) draw() {
+	if !p.tty || p.total == 0 {
+		return
+	}
+
+	filled := progressBarWidth * p.done / p.total
+	fmt.Fprintf(p.out, "%s%s %d/%d files, %d chunks",
+		strings.Repeat("█", filled), strings.Repeat("░", progressBarWidth-filled),
+		p.done, p.total, p.chunks)
+	if eta, ok := p.eta(); ok {
+		fmt.Fprintf(p.out, ", ETA %s", eta.Round(time.Second))
+	}
+	p.drawn = true
+}
+
+// clear erases the progress bar so other output can take its line.
+func (p *ingestProgress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
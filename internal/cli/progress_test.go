@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestProgress_ETA(t *testing.T) {
+	p := &ingestProgress{total: 4, last: time.Now()}
+	_, ok := p.eta()
+	assert.False(t, ok, "no file has finished yet")
+
+	p.fileDone(3)
+	p.fileDone(2)
+	assert.Equal(t, 2, p.done)
+	assert.Equal(t, 5, p.chunks)
+
+	// The ETA averages the recent intervals over the files left
+	p.intervals = []time.Duration{2 * time.Second, 4 * time.Second}
+	eta, ok := p.eta()
+	require.True(t, ok)
+	assert.Equal(t, 6*time.Second, eta)
+
+	for range etaWindow + 5 {
+		p.fileDone(0)
+	}
+	assert.Len(t, p.intervals, etaWindow)
+	_, ok = p.eta()
+	assert.False(t, ok, "every file has finished")
+}
+
+func TestIngestProgress_Draw(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "progress"))
+	require.NoError(t, err)
+	defer out.Close()
+
+	// Redirected output gets no progress bar
+	p := newIngestProgress(out, 4)
+	p.fileDone(3)
+	p.draw()
+	p.clear()
+	written, err := os.ReadFile(out.Name())
+	require.NoError(t, err)
+	assert.Empty(t, written)
+
+	p.tty = true
+	p.intervals = []time.Duration{2 * time.Second}
+	p.draw()
+	p.clear()
+	written, err = os.ReadFile(out.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "███████░░░░░░░░░░░░░░░░░░░░░░░ 1/4 files, 3 chunks, ETA 6s\r\033[K", string(written))
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Re-embed indexed documents with the current embedding model",
+	Long: `Re-embed every indexed chunk with the configured embedding model and rebuild
+the vector database. Chunk content is read from the database itself, so the original
+files are not needed. Use this after changing embedding_model.`,
+	RunE: runReindex,
+}
+
+func init() {
+	rootCmd.AddCommand(reindexCmd)
+	reindexCmd.Flags().BoolP("force", "f", false, "skip confirmation prompt")
+}
+
+func runReindex(cmd *cobra.Command, args []string) error {
+	force, _ := cmd.Flags().GetBool("force")
+
+	if !force {
+		fmt.Print("⚠️  This will rebuild the vector database with new embeddings. Continue? (y/N): ")
+		var response string
+		fmt.Scanln(&response)
+
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Reindex cancelled.")
+			return nil
+		}
+	}
+
+	// Initialize the application
+	pawdy, err := app.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+	defer pawdy.Close()
+
+	ctx := context.Background()
+
+	fmt.Printf("🔄 Re-embedding documents with %s...\n", pawdy.Config.EmbeddingModel)
+
+	count, err := pawdy.Reindex(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reindex: %w", err)
+	}
+
+	if count == 0 {
+		fmt.Println("⚠️  No indexed documents found")
+		fmt.Println("💡 Run 'pawdy ingest ./materials' to index your documents")
+		return nil
+	}
+
+	fmt.Printf("✅ Reindexed %d chunks\n", count)
+
+	return nil
+}
@@ -2,9 +2,11 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/rag"
 	"github.com/spf13/cobra"
 )
 
@@ -19,15 +21,29 @@ re-index your documents.`,
 
 func init() {
 	rootCmd.AddCommand(resetCmd)
-	resetCmd.Flags().String("collection", "", "specific collection to reset (default: use config)")
+	addCollectionFlag(resetCmd)
 	resetCmd.Flags().BoolP("force", "f", false, "skip confirmation prompt")
 }
 
 func runReset(cmd *cobra.Command, args []string) error {
 	force, _ := cmd.Flags().GetBool("force")
-	
+
+	// Initialize the application against the requested collection, which has to
+	// exist already so a mistyped name isn't created only to be reset
+	applyCollectionFlag(cmd)
+	pawdy, err := app.NewWithOptions(app.Options{ExistingCollection: true})
+	if errors.Is(err, rag.ErrCollectionNotFound) {
+		return fmt.Errorf("nothing to reset: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+	defer pawdy.Close()
+
+	collection := pawdy.Config.Collection
+
 	if !force {
-		fmt.Print("⚠️  This will delete all indexed documents. Continue? (y/N): ")
+		fmt.Printf("⚠️  This will delete all indexed documents in collection '%s'. Continue? (y/N): ", collection)
 		var response string
 		fmt.Scanln(&response)
 		
@@ -37,18 +53,9 @@ func runReset(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Initialize the application
-	pawdy, err := app.New()
-	if err != nil {
-		return fmt.Errorf("failed to initialize Pawdy: %w", err)
-	}
-	defer pawdy.Close()
-
 	ctx := context.Background()
-	
-	collection, _ := cmd.Flags().GetString("collection")
-	
-	fmt.Println("🗑️  Resetting vector database...")
+
+	fmt.Printf("🗑️  Resetting collection '%s'...\n", collection)
 	
 	err = pawdy.Reset(ctx, collection)
 	if err != nil {
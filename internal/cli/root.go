@@ -10,8 +10,10 @@ import (
 )
 
 var (
-	cfgFile string
-	safety  string
+	cfgFile      string
+	safety       string
+	systemPrompt string
+	verbose      bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -36,9 +38,38 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./pawdy.yaml)")
 	rootCmd.PersistentFlags().StringVar(&safety, "safety", "", "safety mode (on|off)")
+	rootCmd.PersistentFlags().StringVar(&systemPrompt, "system-prompt", "", "system prompt file path or inline prompt text")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "print the query embedding, raw search scores, and full prompt sent to the model to stderr")
 	
 	// Bind flags to viper
 	viper.BindPFlag("safety", rootCmd.PersistentFlags().Lookup("safety"))
+	viper.BindPFlag("system_prompt", rootCmd.PersistentFlags().Lookup("system-prompt"))
+}
+
+// addCollectionFlag adds a --collection flag that overrides the configured collection for one run.
+func addCollectionFlag(cmd *cobra.Command) {
+	cmd.Flags().String("collection", "", "collection to use for this run (default from config)")
+}
+
+// applyCollectionFlag applies --collection to the configuration; call it before app.New.
+func applyCollectionFlag(cmd *cobra.Command) {
+	if cmd.Flags().Changed("collection") {
+		collection, _ := cmd.Flags().GetString("collection")
+		viper.Set("collection", collection)
+	}
+}
+
+// addLangFlag adds a --lang flag that overrides the configured response language for one run.
+func addLangFlag(cmd *cobra.Command) {
+	cmd.Flags().String("lang", "", "language to answer in, e.g. Japanese, or auto for the question's language (default from config)")
+}
+
+// applyLangFlag applies --lang to the configuration; call it before app.New.
+func applyLangFlag(cmd *cobra.Command) {
+	if cmd.Flags().Changed("lang") {
+		language, _ := cmd.Flags().GetString("lang")
+		viper.Set("response_language", language)
+	}
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mabulgu/pawdy/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyCollectionFlag(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "assets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "system_prompt.md"), []byte("You are Pawdy."), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pawdy.yaml"), []byte("collection: networking\n"), 0o644))
+	t.Chdir(dir)
+
+	for _, cmd := range []*cobra.Command{askCmd, chatCmd, ingestCmd} {
+		t.Run(cmd.Name(), func(t *testing.T) {
+			flag := cmd.Flags().Lookup("collection")
+			require.NotNil(t, flag)
+			t.Cleanup(func() {
+				flag.Value.Set("")
+				flag.Changed = false
+			})
+
+			// Without the flag the configured collection is used
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			applyCollectionFlag(cmd)
+			cfg, err := config.Load()
+			require.NoError(t, err)
+			assert.Equal(t, "networking", cfg.Collection)
+
+			viper.Reset()
+			require.NoError(t, cmd.Flags().Set("collection", "storage"))
+			applyCollectionFlag(cmd)
+			cfg, err = config.Load()
+			require.NoError(t, err)
+			assert.Equal(t, "storage", cfg.Collection)
+		})
+	}
+}
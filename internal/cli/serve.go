@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/server"
+	"github.com/spf13/cobra"
+)
+
+// shutdownTimeout bounds how long in-flight requests get to finish after a stop signal.
+const shutdownTimeout = 30 * time.Second
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve questions, ingestion, and health checks over HTTP",
+	Long: `Start an HTTP server that keeps one Pawdy instance loaded for editor plugins,
+chat bots, and other clients:
+
+  POST /ask     {"question": "...", "temperature": 0.6}
+                → {"answer", "sources", "safety"}, as printed by 'pawdy ask --json'
+  POST /ingest  {"path": "./materials", "force": false}
+                → {"files", "chunks", "duplicates", "unchanged", "failed"}
+  GET  /health  → {"healthy", "services"}; 503 if any service is down
+
+/ingest reads paths on the server's filesystem, so the server only listens on
+localhost unless --addr says otherwise. SIGINT or SIGTERM stops it after
+in-flight requests finish.
+
+Examples:
+  pawdy serve
+  pawdy serve --addr :8080`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	addCollectionFlag(serveCmd)
+	serveCmd.Flags().String("addr", "127.0.0.1:8080", "address to listen on")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	addr, _ := cmd.Flags().GetString("addr")
+
+	// Initialize the application once for every request
+	applyCollectionFlag(cmd)
+	pawdy, err := app.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+	defer pawdy.Close()
+
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           server.New(pawdy),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	fmt.Printf("🐾 Pawdy is listening on http://%s (collection '%s')\n", addr, pawdy.Config.Collection)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	fmt.Println("\n⏹️  Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+
+	return nil
+}
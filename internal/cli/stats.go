@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show what is indexed in the vector database",
+	Long: `Show statistics for the configured collection: the number of indexed chunks,
+the number of distinct source files they came from, and the vector dimension.`,
+	RunE: runStats,
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	// Initialize the application
+	pawdy, err := app.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize Pawdy: %w", err)
+	}
+	defer pawdy.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stats, err := pawdy.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("📊 Pawdy Collection Stats")
+	fmt.Println("═══════════════════════")
+	fmt.Printf("Vector DB: %s (collection: %s)\n", pawdy.Config.VectorDB, pawdy.Config.Collection)
+	fmt.Printf("Chunks indexed: %d\n", stats.Chunks)
+	fmt.Printf("Source files: %d\n", stats.Sources)
+	fmt.Printf("Vector dimension: %d\n", stats.Dimensions)
+
+	if stats.Chunks == 0 {
+		fmt.Println("\n⚠️  0 documents indexed - Pawdy has no documentation to draw on")
+		fmt.Println("💡 Run 'pawdy ingest ./materials' to index your documents")
+	}
+
+	return nil
+}
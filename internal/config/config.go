@@ -3,13 +3,32 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/mabulgu/pawdy/internal/prompt"
 	"github.com/mabulgu/pawdy/pkg/types"
 	"github.com/spf13/viper"
 )
 
+// defaultMaxInputTokens is the default max_input_tokens, lowered to half of
+// context_window for smaller windows.
+const defaultMaxInputTokens = 4000
+
+// Default guard_model names: an Ollama tag, or the Hugging Face name an
+// OpenAI-compatible server such as vLLM serves the model under.
+const (
+	defaultGuardModel       = "llama-guard3:1b"
+	defaultOpenAIGuardModel = "meta-llama/Llama-Guard-3-1B"
+)
+
+// safetyCategoryCode matches Llama Guard category codes such as "S6".
+var safetyCategoryCode = regexp.MustCompile(`(?i)^s\d+$`)
+
 // Load reads configuration from files and environment variables.
 func Load() (*types.Config, error) {
 	// Set defaults
@@ -40,6 +59,19 @@ func Load() (*types.Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	// The default has to fit the context window, which may be smaller than usual
+	if !viper.IsSet("max_input_tokens") {
+		config.MaxInputTokens = min(defaultMaxInputTokens, config.ContextWindow/2)
+	}
+
+	// The guard runs on Ollama unless the openai backend serves it
+	if !viper.IsSet("guard_model") {
+		config.GuardModel = defaultGuardModel
+		if config.Backend == "openai" && config.GuardURL == "" {
+			config.GuardModel = defaultOpenAIGuardModel
+		}
+	}
+
 	// Validate configuration
 	if err := validate(&config); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -48,49 +80,226 @@ func Load() (*types.Config, error) {
 	return &config, nil
 }
 
+// Warnings returns settings that are valid but probably not what the user meant.
+func Warnings(config *types.Config) []string {
+	var warnings []string
+
+	// A chat or guard model embeds text, but far worse than a dedicated embedding model
+	if config.Embeddings == "ollama-nomic" {
+		switch config.EmbeddingModel {
+		case config.OllamaModel, config.GuardModel:
+			warnings = append(warnings, fmt.Sprintf("embedding_model '%s' is also used for chat or safety; "+
+				"use an embedding model such as nomic-embed-text and run 'pawdy reindex'", config.EmbeddingModel))
+		}
+	}
+
+	return warnings
+}
+
+// maskedSecret replaces secrets in Masked.
+const maskedSecret = "********"
+
+// redactedPassword replaces passwords in URLs and connection strings in Masked,
+// as url.URL.Redacted does.
+const redactedPassword = "xxxxx"
+
+// dsnPassword matches a password in a key=value connection string such as
+// "host=db user=pawdy password=hunter2", quoted or not.
+var dsnPassword = regexp.MustCompile(`(?i)\b(\w*password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Masked returns a copy of config with API keys hidden and the credentials removed
+// from every URL, for printing.
+func Masked(config *types.Config) *types.Config {
+	masked := *config
+	if masked.OpenAIAPIKey != "" {
+		masked.OpenAIAPIKey = maskedSecret
+	}
+	if masked.QdrantAPIKey != "" {
+		masked.QdrantAPIKey = maskedSecret
+	}
+	masked.OllamaURL = maskURL(masked.OllamaURL)
+	masked.OpenAIURL = maskURL(masked.OpenAIURL)
+	masked.GuardURL = maskURL(masked.GuardURL)
+	masked.QdrantURL = maskURL(masked.QdrantURL)
+	masked.PostgresURL = maskURL(masked.PostgresURL)
+	return &masked
+}
+
+// maskURL removes the credentials from a URL or a key=value connection string:
+// passwords, userinfo without a password, which is usually a token, and query
+// parameters that look like secrets.
+func maskURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return maskedSecret
+	}
+	if parsed.Scheme == "" {
+		return dsnPassword.ReplaceAllString(raw, "${1}"+redactedPassword)
+	}
+
+	if parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redactedPassword)
+		} else {
+			parsed.User = url.User(redactedPassword)
+		}
+	}
+
+	// Rewritten by hand rather than with url.Values to keep the parameters in order
+	params := strings.Split(parsed.RawQuery, "&")
+	for i, param := range params {
+		name, _, found := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); found && err == nil && secretParam(unescaped) {
+			params[i] = name + "=" + redactedPassword
+		}
+	}
+	parsed.RawQuery = strings.Join(params, "&")
+
+	return parsed.String()
+}
+
+// secretParam reports whether a URL query parameter, such as postgres' password,
+// holds a secret.
+func secretParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range []string{"password", "secret", "token", "key"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// DimensionWarning returns a warning if embedding_model is known to produce vectors
+// of another size than the collection's, which stores the given dimensions (0 if
+// unknown), or "" if they fit or the model's size isn't listed in types.EmbeddingDimensions.
+func DimensionWarning(config *types.Config, dimensions int) string {
+	name, _, _ := strings.Cut(config.EmbeddingModel, ":")
+	expected, ok := types.EmbeddingDimensions[name]
+	if !ok || dimensions == 0 || dimensions == expected {
+		return ""
+	}
+
+	return fmt.Sprintf("embedding_model '%s' produces %d-dimensional vectors but collection '%s' stores %d; "+
+		"searches will fail until you run 'pawdy reindex', or set embedding_model back to the model the collection was built with",
+		config.EmbeddingModel, expected, config.Collection, dimensions)
+}
+
+// checkHTTPURL returns an error if raw is not an http or https URL with a host.
+func checkHTTPURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("must be an http:// or https:// URL, got '%s'", raw)
+	}
+	return nil
+}
+
 // setDefaults establishes default configuration values.
 func setDefaults() {
 	// LLM Backend Configuration
 	viper.SetDefault("backend", "ollama")
 	viper.SetDefault("model_path", "./models/Llama-3.1-8B-Instruct-Q4_K_M.gguf")
+	viper.SetDefault("llamacpp_server", "llama-server")
 	viper.SetDefault("ollama_url", "http://localhost:11434")
 	viper.SetDefault("ollama_model", "llama3.1:8b")
-	viper.SetDefault("guard_model", "llama-guard3:1b")
+	viper.SetDefault("keep_alive", "")
+	viper.SetDefault("openai_url", "http://localhost:8000/v1")
+	viper.SetDefault("openai_api_key", "")
+	viper.SetDefault("openai_model", "meta-llama/Llama-3.1-8B-Instruct")
+	viper.SetDefault("guard_url", "")
+	viper.SetDefault("guard_model_path", "")
 
 	// Embeddings Configuration
 	viper.SetDefault("embeddings", "ollama-nomic")
 	viper.SetDefault("embedding_model", "nomic-embed-text")
 
 	// Vector Database
+	viper.SetDefault("vector_db", "qdrant")
 	viper.SetDefault("qdrant_url", "http://localhost:6333")
+	viper.SetDefault("qdrant_api_key", "")
+	viper.SetDefault("qdrant_use_tls", false)
+	viper.SetDefault("qdrant_grpc_port", 0)
+	viper.SetDefault("postgres_url", "postgres://localhost:5432/pawdy")
 	viper.SetDefault("collection", "pawdy_docs")
+	viper.SetDefault("distance", "cosine")
 
 	// RAG Parameters
 	viper.SetDefault("chunk_tokens", 1000)
 	viper.SetDefault("chunk_overlap", 200)
 	viper.SetDefault("top_k", 6)
+	viper.SetDefault("min_score", 0.0)
+	viper.SetDefault("source_weight", 1.0)
 	viper.SetDefault("rerank", true)
+	viper.SetDefault("rerank_model", "")
+	viper.SetDefault("rerank_candidates", 10)
+	viper.SetDefault("mmr_lambda", 1.0)
+	viper.SetDefault("tokenizer_path", "./models/tokenizer.model")
+	viper.SetDefault("markdown_sections", true)
+	viper.SetDefault("csv_delimiter", "")
+	viper.SetDefault("pdf_ocr", false)
+	viper.SetDefault("pdf_failed_pages", 0.1)
+	viper.SetDefault("redact", false)
+	viper.SetDefault("redact_patterns", []string{})
+	viper.SetDefault("dedupe", "off")
+	viper.SetDefault("dedupe_threshold", 0.95)
 
 	// Generation Parameters
 	viper.SetDefault("temperature", 0.6)
 	viper.SetDefault("max_tokens", 1024)
 	viper.SetDefault("top_p", 0.9)
+	viper.SetDefault("stop_sequences", []string{})
 
 	// System Configuration
 	viper.SetDefault("system_prompt", "./assets/system_prompt.md")
+	viper.SetDefault("system_prompt_strict", false)
+	viper.SetDefault("citation_style", "markdown")
+	viper.SetDefault("response_language", prompt.LanguageAuto)
 	viper.SetDefault("safety", "on")
+	viper.SetDefault("safety_audit_log", "")
+	viper.SetDefault("prompt_injection", "strip")
+	viper.SetDefault("safety_threshold", 0.5)
+	viper.SetDefault("safety_fail_mode", "closed")
+	viper.SetDefault("safety_parse_retries", 2)
+	viper.SetDefault("safety_stream_interval", 0)
+	viper.SetDefault("safety_stream_window", 2000)
+	viper.SetDefault("safety_categories", map[string]string{})
+	viper.SetDefault("safety_disabled_categories", []string{})
 	viper.SetDefault("log_level", "info")
 
 	// Performance
 	viper.SetDefault("context_window", 8192)
+	viper.SetDefault("input_overflow", "reject")
 	viper.SetDefault("batch_size", 512)
+	viper.SetDefault("ingest_workers", 4)
+	viper.SetDefault("embedding_concurrency", 2)
+	viper.SetDefault("retry_attempts", 3)
+	viper.SetDefault("empty_response_retries", 1)
+	viper.SetDefault("retry_backoff", "500ms")
+	viper.SetDefault("request_timeout", "2m")
+	viper.SetDefault("embedding_timeout", "1m")
+	viper.SetDefault("cache", false)
+	viper.SetDefault("cache_ttl", "24h")
+
+	// Chat History
+	viper.SetDefault("history_turns", 4)
+	viper.SetDefault("history_tokens", 1024)
 }
 
 // validate checks that the configuration is valid.
 func validate(config *types.Config) error {
 	// Validate backend
-	if config.Backend != "llamacpp" && config.Backend != "ollama" {
-		return fmt.Errorf("backend must be 'llamacpp' or 'ollama', got '%s'", config.Backend)
+	if config.Backend != "llamacpp" && config.Backend != "ollama" && config.Backend != "openai" {
+		return fmt.Errorf("backend must be 'llamacpp', 'ollama', or 'openai', got '%s'", config.Backend)
+	}
+
+	// Validate OpenAI-compatible settings
+	if config.Backend == "openai" {
+		if config.OpenAIURL == "" {
+			return fmt.Errorf("openai_url is required when using openai backend")
+		}
+		if config.OpenAIModel == "" {
+			return fmt.Errorf("openai_model is required when using openai backend")
+		}
 	}
 
 	// Validate model path for llamacpp
@@ -101,6 +310,16 @@ func validate(config *types.Config) error {
 		if _, err := os.Stat(config.ModelPath); os.IsNotExist(err) {
 			return fmt.Errorf("model file not found: %s", config.ModelPath)
 		}
+
+		// The chat model can't stand in for Llama Guard, so safety needs its own model
+		if config.Safety == "on" && config.GuardURL == "" {
+			if config.GuardModelPath == "" {
+				return fmt.Errorf("guard_model_path (or guard_url) is required when safety is on with the llamacpp backend")
+			}
+			if _, err := os.Stat(config.GuardModelPath); os.IsNotExist(err) {
+				return fmt.Errorf("guard model file not found: %s", config.GuardModelPath)
+			}
+		}
 	}
 
 	// Validate embeddings provider
@@ -108,11 +327,119 @@ func validate(config *types.Config) error {
 		return fmt.Errorf("embeddings must be 'ollama-nomic' or 'fastembed', got '%s'", config.Embeddings)
 	}
 
+	if config.Embeddings == "fastembed" {
+		return fmt.Errorf("embeddings 'fastembed' is not implemented yet; use 'ollama-nomic' with an Ollama server at ollama_url")
+	}
+
+	if config.EmbeddingModel == "" {
+		return fmt.Errorf("embedding_model is required, e.g. nomic-embed-text")
+	}
+
+	// Ollama embeddings need a server even when another backend generates answers
+	if config.Embeddings == "ollama-nomic" || config.Backend == "ollama" {
+		if config.OllamaURL == "" {
+			return fmt.Errorf("ollama_url is required for ollama-nomic embeddings and the ollama backend; set it to the Ollama server, e.g. http://localhost:11434")
+		}
+		if err := checkHTTPURL(config.OllamaURL); err != nil {
+			return fmt.Errorf("ollama_url %w", err)
+		}
+	}
+
+	if config.Backend == "ollama" && config.OllamaModel == "" {
+		return fmt.Errorf("ollama_model is required when using ollama backend, e.g. llama3.1:8b")
+	}
+
+	if config.KeepAlive != "" {
+		if _, err := time.ParseDuration(config.KeepAlive); err != nil {
+			return fmt.Errorf("keep_alive must be a duration such as 10m, got '%s'", config.KeepAlive)
+		}
+	}
+
+	// Validate vector database
+	if config.VectorDB != "qdrant" && config.VectorDB != "pgvector" && config.VectorDB != "memory" {
+		return fmt.Errorf("vector_db must be 'qdrant', 'pgvector', or 'memory', got '%s'", config.VectorDB)
+	}
+
+	if config.QdrantGRPCPort < 0 || config.QdrantGRPCPort > 65535 {
+		return fmt.Errorf("qdrant_grpc_port must be between 0 and 65535, got %d", config.QdrantGRPCPort)
+	}
+
+	if config.VectorDB == "pgvector" && config.PostgresURL == "" {
+		return fmt.Errorf("postgres_url is required when using pgvector")
+	}
+
+	if config.Distance != "cosine" && config.Distance != "dot" && config.Distance != "euclid" {
+		return fmt.Errorf("distance must be 'cosine', 'dot', or 'euclid', got '%s'", config.Distance)
+	}
+
+	// Euclidean scores are distances, where lower is closer, so similarity cutoffs don't apply
+	if config.VectorDB == "qdrant" && config.Distance == "euclid" && (config.MinScore > 0 || config.Dedupe == "semantic") {
+		return fmt.Errorf("min_score and semantic dedupe need similarity scores and can't be used with distance 'euclid'")
+	}
+
 	// Validate safety setting
 	if config.Safety != "on" && config.Safety != "off" {
 		return fmt.Errorf("safety must be 'on' or 'off', got '%s'", config.Safety)
 	}
 
+	if config.PDFFailedPages < 0 || config.PDFFailedPages > 1 {
+		return fmt.Errorf("pdf_failed_pages must be between 0.0 and 1.0, got %f", config.PDFFailedPages)
+	}
+
+	if config.Dedupe != "off" && config.Dedupe != "exact" && config.Dedupe != "semantic" {
+		return fmt.Errorf("dedupe must be 'off', 'exact', or 'semantic', got '%s'", config.Dedupe)
+	}
+
+	if config.DedupeThreshold <= 0 || config.DedupeThreshold > 1 {
+		return fmt.Errorf("dedupe_threshold must be greater than 0.0 and at most 1.0, got %f", config.DedupeThreshold)
+	}
+
+	if config.PromptInjection != "strip" && config.PromptInjection != "flag" && config.PromptInjection != "off" {
+		return fmt.Errorf("prompt_injection must be 'strip', 'flag', or 'off', got '%s'", config.PromptInjection)
+	}
+
+	if config.SafetyThreshold <= 0 || config.SafetyThreshold > 1 {
+		return fmt.Errorf("safety_threshold must be greater than 0.0 and at most 1.0, got %f", config.SafetyThreshold)
+	}
+
+	switch config.CitationStyle {
+	case prompt.CitationMarkdown, prompt.CitationPlain, prompt.CitationInline, prompt.CitationNone:
+	default:
+		return fmt.Errorf("citation_style must be 'markdown', 'plain', 'inline', or 'none', got '%s'", config.CitationStyle)
+	}
+
+	if strings.TrimSpace(config.ResponseLanguage) == "" {
+		return fmt.Errorf("response_language must be 'auto' or a language such as 'Japanese'")
+	}
+
+	if config.SafetyFailMode != "open" && config.SafetyFailMode != "closed" {
+		return fmt.Errorf("safety_fail_mode must be 'open' or 'closed', got '%s'", config.SafetyFailMode)
+	}
+
+	if config.SafetyParseRetries < 0 {
+		return fmt.Errorf("safety_parse_retries must be non-negative, got %d", config.SafetyParseRetries)
+	}
+
+	if config.SafetyStreamInterval < 0 {
+		return fmt.Errorf("safety_stream_interval must be non-negative, got %d", config.SafetyStreamInterval)
+	}
+
+	if config.SafetyStreamInterval > 0 && config.SafetyStreamWindow < config.SafetyStreamInterval {
+		return fmt.Errorf("safety_stream_window (%d) must be at least safety_stream_interval (%d)", config.SafetyStreamWindow, config.SafetyStreamInterval)
+	}
+
+	for _, code := range config.SafetyDisabledCategories {
+		if !safetyCategoryCode.MatchString(code) {
+			return fmt.Errorf("safety_disabled_categories entries must be category codes like 'S6', got '%s'", code)
+		}
+	}
+
+	for code := range config.SafetyCategories {
+		if !safetyCategoryCode.MatchString(code) {
+			return fmt.Errorf("safety_categories keys must be category codes like 'S6', got '%s'", code)
+		}
+	}
+
 	// Validate numeric ranges
 	if config.Temperature < 0.0 || config.Temperature > 2.0 {
 		return fmt.Errorf("temperature must be between 0.0 and 2.0, got %f", config.Temperature)
@@ -122,10 +449,36 @@ func validate(config *types.Config) error {
 		return fmt.Errorf("top_p must be between 0.0 and 1.0, got %f", config.TopP)
 	}
 
+	for _, stop := range config.StopSequences {
+		if stop == "" {
+			return fmt.Errorf("stop_sequences must not contain empty strings")
+		}
+	}
+
+	if strings.TrimSpace(config.Collection) == "" {
+		return fmt.Errorf("collection must not be empty")
+	}
+
 	if config.TopK < 1 || config.TopK > 50 {
 		return fmt.Errorf("top_k must be between 1 and 50, got %d", config.TopK)
 	}
 
+	if config.MinScore < 0.0 || config.MinScore > 1.0 {
+		return fmt.Errorf("min_score must be between 0.0 and 1.0, got %f", config.MinScore)
+	}
+
+	if config.SourceWeight <= 0 {
+		return fmt.Errorf("source_weight must be positive, got %f", config.SourceWeight)
+	}
+
+	if config.RerankCandidates < 1 || config.RerankCandidates > 50 {
+		return fmt.Errorf("rerank_candidates must be between 1 and 50, got %d", config.RerankCandidates)
+	}
+
+	if config.MMRLambda < 0.0 || config.MMRLambda > 1.0 {
+		return fmt.Errorf("mmr_lambda must be between 0.0 and 1.0, got %f", config.MMRLambda)
+	}
+
 	if config.ChunkTokens < 100 || config.ChunkTokens > 4000 {
 		return fmt.Errorf("chunk_tokens must be between 100 and 4000, got %d", config.ChunkTokens)
 	}
@@ -134,8 +487,85 @@ func validate(config *types.Config) error {
 		return fmt.Errorf("chunk_overlap must be between 0 and chunk_tokens, got %d", config.ChunkOverlap)
 	}
 
-	// Validate system prompt file
-	if config.SystemPrompt != "" {
+	for ext, override := range config.ChunkOverrides {
+		if ext == "" {
+			return fmt.Errorf("chunk_overrides keys must be extensions without the leading dot, e.g. 'pdf'")
+		}
+
+		tokens, overlap := config.ChunkTokens, config.ChunkOverlap
+		if override.Tokens != 0 {
+			tokens = override.Tokens
+		}
+		if override.Overlap != 0 {
+			overlap = override.Overlap
+		}
+
+		if tokens < 100 || tokens > 4000 {
+			return fmt.Errorf("chunk_overrides.%s.tokens must be between 100 and 4000, got %d", ext, tokens)
+		}
+		if overlap < 0 || overlap >= tokens {
+			return fmt.Errorf("chunk_overrides.%s.overlap must be between 0 and its chunk tokens, got %d", ext, overlap)
+		}
+	}
+
+	if utf8.RuneCountInString(config.CSVDelimiter) > 1 {
+		return fmt.Errorf("csv_delimiter must be a single character, got '%s'", config.CSVDelimiter)
+	}
+
+	if config.IngestWorkers < 1 {
+		return fmt.Errorf("ingest_workers must be at least 1, got %d", config.IngestWorkers)
+	}
+
+	if config.EmbeddingConcurrency < 1 {
+		return fmt.Errorf("embedding_concurrency must be at least 1, got %d", config.EmbeddingConcurrency)
+	}
+
+	if config.RetryAttempts < 1 {
+		return fmt.Errorf("retry_attempts must be at least 1, got %d", config.RetryAttempts)
+	}
+
+	if config.EmptyResponseRetries < 0 {
+		return fmt.Errorf("empty_response_retries must not be negative, got %d", config.EmptyResponseRetries)
+	}
+
+	if config.RetryBackoff < 0 {
+		return fmt.Errorf("retry_backoff must not be negative, got %s", config.RetryBackoff)
+	}
+
+	if config.RequestTimeout <= 0 {
+		return fmt.Errorf("request_timeout must be positive, got %s", config.RequestTimeout)
+	}
+
+	if config.EmbeddingTimeout <= 0 {
+		return fmt.Errorf("embedding_timeout must be positive, got %s", config.EmbeddingTimeout)
+	}
+
+	if config.CacheTTL < 0 {
+		return fmt.Errorf("cache_ttl must not be negative, got %s", config.CacheTTL)
+	}
+
+	if config.HistoryTurns < 0 {
+		return fmt.Errorf("history_turns must not be negative, got %d", config.HistoryTurns)
+	}
+
+	if config.MaxTokens >= config.ContextWindow {
+		return fmt.Errorf("max_tokens must be less than context_window, got %d", config.MaxTokens)
+	}
+
+	if config.HistoryTokens < 0 || config.HistoryTokens >= config.ContextWindow {
+		return fmt.Errorf("history_tokens must be between 0 and context_window, got %d", config.HistoryTokens)
+	}
+
+	if config.MaxInputTokens < 0 || config.MaxInputTokens >= config.ContextWindow {
+		return fmt.Errorf("max_input_tokens must be between 0 and context_window, got %d", config.MaxInputTokens)
+	}
+
+	if config.InputOverflow != "reject" && config.InputOverflow != "truncate" {
+		return fmt.Errorf("input_overflow must be 'reject' or 'truncate', got '%s'", config.InputOverflow)
+	}
+
+	// Validate system prompt file; inline prompt text needs no file
+	if config.SystemPrompt != "" && !prompt.IsInlinePrompt(config.SystemPrompt) {
 		if _, err := os.Stat(config.SystemPrompt); os.IsNotExist(err) {
 			return fmt.Errorf("system prompt file not found: %s", config.SystemPrompt)
 		}
@@ -153,38 +583,97 @@ func GetConfiguredPath() string {
 func WriteExample(path string) error {
 	example := `# Pawdy Configuration File
 # Backend configuration
-backend: llamacpp                 # Options: llamacpp, ollama
-model_path: ./models/Llama-3.1-8B-Instruct-Q4_K_M.gguf
+backend: ollama                   # Options: llamacpp, ollama, openai
+model_path: ./models/Llama-3.1-8B-Instruct-Q4_K_M.gguf  # For llamacpp backend
+llamacpp_server: llama-server     # llama.cpp server binary used to run model_path
+guard_model_path: ""              # Llama Guard .gguf for safety with llamacpp (e.g. ./models/Llama-Guard-3-1B-Q4_K_M.gguf)
+ollama_model: llama3.1:8b         # For ollama backend
 ollama_url: http://localhost:11434
-guard_model: llama-guard3
+keep_alive: ""                    # How long Ollama keeps models loaded between requests, e.g. 10m (-1m: forever, empty: server default)
+openai_url: http://localhost:8000/v1  # OpenAI-compatible server (vLLM, LM Studio, ...)
+openai_api_key: ""                # Optional bearer token
+openai_model: meta-llama/Llama-3.1-8B-Instruct
+guard_model: llama-guard3:1b      # Guard model: an Ollama tag, or the served name with backend openai (default meta-llama/Llama-Guard-3-1B there)
+guard_url: ""                     # Separate Ollama server for guard_model (empty: same server as the backend)
 
 # Embeddings configuration  
 embeddings: ollama-nomic          # Options: ollama-nomic, fastembed
 embedding_model: nomic-embed-text
 
 # Vector database
+vector_db: qdrant                 # Options: qdrant, pgvector, memory (in-process, not persisted)
 qdrant_url: http://localhost:6333
+qdrant_api_key: ""                # API key for a hosted Qdrant, such as Qdrant Cloud (or PAWDY_QDRANT_API_KEY)
+qdrant_use_tls: false             # Connect over TLS; implied by an https:// qdrant_url
+qdrant_grpc_port: 0               # Qdrant gRPC port (0: REST port + 1, or 6334 if qdrant_url has no port or uses 80/443)
+postgres_url: postgres://localhost:5432/pawdy  # Used when vector_db is pgvector
 collection: pawdy_docs
+distance: cosine                  # Qdrant metric for new collections: cosine, dot, euclid
 
 # RAG parameters
 chunk_tokens: 1000                # Tokens per chunk
 chunk_overlap: 200                # Overlap between chunks
+chunk_overrides:                  # Per-extension chunking (keys without the dot; zero fields use the globals)
+  pdf: {tokens: 1500}
+  md: {tokens: 800}
 top_k: 6                         # Number of chunks to retrieve
+min_score: 0.0                   # Drop retrieved chunks below this similarity (0 disables)
+source_weight: 1.0               # Score multiplier for newly ingested docs, e.g. 1.5 for runbooks (override: ingest --weight)
 rerank: true                     # Enable keyword re-ranking
+rerank_model: ""                 # Optional model that scores each candidate's relevance (e.g. llama3.2:3b); empty disables
+rerank_candidates: 10            # Max candidates scored by rerank_model per question
+mmr_lambda: 1.0                  # Relevance vs. diversity of retrieved chunks (1 disables MMR, 0.7 is a good start)
+tokenizer_path: ./models/tokenizer.model  # Llama 3 tiktoken BPE file (falls back to chars/4 if missing)
+markdown_sections: true          # Track Markdown header breadcrumbs per chunk
+csv_delimiter: ""                # Field delimiter for .csv/.tsv (empty: comma for .csv, tab for .tsv)
+pdf_ocr: false                   # OCR scanned PDF pages (slow; needs pdftoppm and tesseract)
+pdf_failed_pages: 0.1            # Reject a PDF when more than this fraction of its pages fail to extract
+redact: false                    # Mask emails, IPs, and secrets in indexed content
+redact_patterns: []              # Extra regexes to mask when redact is on
+dedupe: off                      # Skip chunks already indexed from another file: off, exact, semantic
+dedupe_threshold: 0.95           # Cosine similarity at which semantic dedupe treats chunks as duplicates
 
 # Generation parameters
 temperature: 0.6                 # Creativity (0.0 = deterministic, 1.0 = creative)
 max_tokens: 1024                 # Maximum response length
 top_p: 0.9                       # Nucleus sampling
+stop_sequences: []               # Stop generating at any of these strings, e.g. ["\nSources:"] (override: ask --stop)
 
 # System configuration
-system_prompt: ./assets/system_prompt.md
+system_prompt: ./assets/system_prompt.md  # File path or inline prompt text (override: --system-prompt)
+system_prompt_strict: false      # Fail on ${VAR} placeholders in the system prompt that aren't set, instead of leaving them as written
+citation_style: markdown         # How answers cite sources ("formatted" in /ask and ask --json): markdown, plain, inline, none (also hides the CLI list)
+response_language: auto          # Language of answers: auto (the question's language) or a name such as Japanese
 safety: on                       # Options: on, off
+prompt_injection: strip          # Retrieved text that looks like a prompt injection: strip, flag, off (not screened when safety is off)
+safety_threshold: 0.5            # Block when the guard score reaches this (0-1): unsafe+category=1.0, unsafe alone=0.9, unparseable=0.5
+safety_fail_mode: closed         # When the guard model is unreachable: closed (fail the question) or open (answer unchecked)
+safety_parse_retries: 2          # Ask the guard model again when its reply is neither safe nor unsafe, before scoring it 0.5
+safety_stream_interval: 0        # Check streamed answers every N bytes before showing them (0 checks only the full answer, after it is shown)
+safety_stream_window: 2000       # Most recent bytes of the answer the guard sees in each streamed check
+safety_disabled_categories: []   # Llama Guard categories to treat as safe, e.g. [S6]
+safety_categories: {}            # Override category descriptions in the guard prompt, e.g. {S6: "Specialized medical or legal advice"}
+safety_audit_log: ""             # Append blocked inputs/outputs as JSONL (empty disables)
 log_level: info                  # Options: debug, info, warn, error
 
 # Performance
-context_window: 8192             # Model context window
+context_window: 8192             # Model context window (weakest chunks are dropped if the prompt would overflow)
+max_input_tokens: 4000           # Longest question accepted, e.g. against pasted log files (0 disables; defaults to half of a smaller context_window)
+input_overflow: reject           # Longer questions: reject with an error, or truncate with a warning
 batch_size: 512                  # Batch size for embeddings
+ingest_workers: 4                # Files ingested in parallel
+embedding_concurrency: 2         # Embedding requests sent to Ollama at once, across all ingest workers
+retry_attempts: 3                # Attempts per Ollama or llama.cpp request before giving up
+empty_response_retries: 1        # Extra generations when the model returns no text (0 disables)
+retry_backoff: 500ms             # Initial delay between attempts (doubles each retry)
+request_timeout: 2m              # LLM request timeout (streams: time until the first response; chat: also each gap between tokens)
+embedding_timeout: 1m            # Embedding request timeout
+cache: false                     # Reuse answers to repeated questions from ~/.pawdy/answer-cache (the 1000 most recent)
+cache_ttl: 24h                   # How long cached answers are reused and kept (0: until the retrieved context changes)
+
+# Chat history
+history_turns: 4                 # Recent exchanges included in chat prompts
+history_tokens: 1024             # Token budget for chat history
 `
 
 	return os.WriteFile(path, []byte(example), 0644)
@@ -0,0 +1,134 @@
+package document
+
+import (
+	"regexp"
+	"strings"
+)
+
+// codeLanguages maps source file extensions to the language recorded in Metadata["language"].
+var codeLanguages = map[string]string{
+	".go":   "go",
+	".sh":   "shell",
+	".bash": "shell",
+	".py":   "python",
+	".js":   "javascript",
+	".ts":   "typescript",
+	".java": "java",
+	".rs":   "rust",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "cpp",
+	".rb":   "ruby",
+}
+
+// codeLiteralRe matches string literals and line comments, which may contain unbalanced braces.
+var codeLiteralRe = regexp.MustCompile(`"(?:\\.|[^"\\])*"|'(?:\\.|[^'\\])*'|` + "`[^`]*`" + `|//.*$|\s#.*$|^#.*$`)
+
+// CodeLanguage returns the language of a source file type, or "" if it isn't code.
+func CodeLanguage(fileType string) string {
+	return codeLanguages[strings.ToLower(fileType)]
+}
+
+// splitCodeBlocks splits source code into top-level blocks such as functions and type declarations.
+// A block ends at a blank line outside any braces that is followed by an unindented line, so
+// comments and decorators directly above a declaration stay with it. Indented code in Python
+// and shell bodies never starts a new block.
+func splitCodeBlocks(text string) []string {
+	lines := strings.Split(text, "\n")
+
+	var blocks []string
+	var current []string
+	depth := 0
+	afterBlank := false
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		startsTopLevel := trimmed != "" && line[0] != ' ' && line[0] != '\t' && !strings.HasPrefix(trimmed, "}") && !strings.HasPrefix(trimmed, ")")
+		if afterBlank && depth <= 0 && startsTopLevel && len(current) > 0 {
+			blocks = append(blocks, strings.TrimRight(strings.Join(current, "\n"), "\n"))
+			current = nil
+		}
+
+		current = append(current, line)
+		afterBlank = trimmed == ""
+
+		stripped := codeLiteralRe.ReplaceAllString(line, "")
+		depth += strings.Count(stripped, "{") - strings.Count(stripped, "}")
+	}
+
+	if block := strings.TrimSpace(strings.Join(current, "\n")); block != "" {
+		blocks = append(blocks, strings.TrimRight(strings.Join(current, "\n"), "\n"))
+	}
+
+	return blocks
+}
+
+// chunkCode packs consecutive top-level blocks into chunks of at most maxTokens,
+// preserving line breaks and indentation. Blocks larger than maxTokens are split on lines.
+func (p *Processor) chunkCode(text string, maxTokens int) []string {
+	var chunks []string
+	current := ""
+
+	flush := func() {
+		if strings.TrimSpace(current) != "" {
+			chunks = append(chunks, strings.Trim(current, "\n"))
+		}
+		current = ""
+	}
+
+	for _, block := range splitCodeBlocks(text) {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+
+		if p.countTokens(block) > maxTokens {
+			flush()
+			chunks = append(chunks, p.splitCodeLines(block, maxTokens)...)
+			continue
+		}
+
+		candidate := block
+		if current != "" {
+			candidate = current + "\n\n" + block
+		}
+		if p.countTokens(candidate) > maxTokens {
+			flush()
+			candidate = block
+		}
+		current = candidate
+	}
+	flush()
+
+	return chunks
+}
+
+// splitCodeLines splits an oversized block into runs of whole lines of at most maxTokens.
+func (p *Processor) splitCodeLines(block string, maxTokens int) []string {
+	var chunks []string
+	var current []string
+
+	for _, line := range strings.Split(block, "\n") {
+		if len(current) > 0 && p.countTokens(strings.Join(append(current, line), "\n")) > maxTokens {
+			if chunk := strings.Trim(strings.Join(current, "\n"), "\n"); strings.TrimSpace(chunk) != "" {
+				chunks = append(chunks, chunk)
+			}
+			current = nil
+		}
+		current = append(current, line)
+	}
+
+	if chunk := strings.Trim(strings.Join(current, "\n"), "\n"); strings.TrimSpace(chunk) != "" {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// countTokens counts tokens with the processor's tokenizer, or estimates them at 4 characters per token.
+func (p *Processor) countTokens(text string) int {
+	if p.tokenizer != nil {
+		return p.tokenizer.Count(text)
+	}
+	return CountTokens(text)
+}
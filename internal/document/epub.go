@@ -0,0 +1,156 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+)
+
+// Chapter titles come from the first heading, or the <title> if there is none.
+var (
+	epubHeadingRe = regexp.MustCompile(`(?is)<h[1-3][^>]*>(.*?)</h[1-3]>`)
+	epubTitleRe   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// epubHeadRe matches the XHTML <head>, whose title and styles aren't chapter text.
+var epubHeadRe = regexp.MustCompile(`(?is)<head[^>]*>.*?</head>`)
+
+// epubContainer is META-INF/container.xml, which points at the package document.
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the subset of content.opf needed to read chapters in reading order.
+type epubPackage struct {
+	Manifest []struct {
+		ID   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// extractEPUB extracts chapter text from an EPUB in spine order.
+// Each chapter becomes a section whose breadcrumb is the chapter title.
+func (p *Processor) extractEPUB(content []byte) ([]Section, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	// Locate the package document
+	var container epubContainer
+	if err := readZipXML(files, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("no package document listed in META-INF/container.xml")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	if err := readZipXML(files, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+
+	// Read chapters in spine order, skipping auxiliary content
+	var sections []Section
+	for _, itemref := range pkg.Spine {
+		if itemref.Linear == "no" {
+			continue
+		}
+
+		href, ok := hrefs[itemref.IDRef]
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+
+		chapter, err := readZipFile(files, path.Join(path.Dir(opfPath), href))
+		if err != nil {
+			return nil, err
+		}
+
+		text := p.extractHTML(epubHeadRe.ReplaceAllString(string(chapter), ""))
+		if text == "" {
+			continue
+		}
+
+		sections = append(sections, Section{
+			Breadcrumb: p.epubChapterTitle(string(chapter)),
+			Text:       text + "\n\n",
+		})
+	}
+
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no text could be extracted from EPUB")
+	}
+
+	return sections, nil
+}
+
+// epubChapterTitle returns the chapter's first heading, falling back to its <title>.
+func (p *Processor) epubChapterTitle(chapter string) string {
+	for _, re := range []*regexp.Regexp{epubHeadingRe, epubTitleRe} {
+		if matches := re.FindStringSubmatch(chapter); matches != nil {
+			return p.extractHTML(matches[1])
+		}
+	}
+	return ""
+}
+
+// readZipFile reads a file from an archive index.
+func readZipFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in archive", name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return content, nil
+}
+
+// readZipXML decodes an XML file from an archive index into v.
+func readZipXML(files map[string]*zip.File, name string, v any) error {
+	content, err := readZipFile(files, name)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	return nil
+}
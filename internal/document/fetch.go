@@ -0,0 +1,215 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// maxPageBytes bounds how much of a fetched page is read.
+const maxPageBytes = 32 * 1024 * 1024
+
+var (
+	titlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	hrefPattern    = regexp.MustCompile(`(?is)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	locPattern     = regexp.MustCompile(`(?is)<loc>\s*(.*?)\s*</loc>`)
+	sitemapPattern = regexp.MustCompile(`(?is)<(urlset|sitemapindex)[\s>]`)
+)
+
+// Page is a document downloaded from a URL.
+type Page struct {
+	URL     string
+	Title   string
+	Type    string // file extension the content is processed as, e.g. ".html"
+	Content []byte
+
+	// Modified is the Last-Modified time reported by the server, or the fetch time.
+	Modified time.Time
+
+	// Links are the absolute http(s) URLs the page links to, without fragments.
+	// For a sitemap they are its listed pages.
+	Links []string
+
+	// Sitemap is set when the page is an XML sitemap, which lists pages but has
+	// no text of its own to index.
+	Sitemap bool
+}
+
+// IsURL reports whether target is an http or https URL rather than a local path.
+func IsURL(target string) bool {
+	lower := strings.ToLower(target)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// FetchPage downloads pageURL and works out how to process it from its content type.
+// HTML, Markdown, and plain text pages are supported, as are XML sitemaps.
+func FetchPage(ctx context.Context, client *http.Client, pageURL string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", pageURL, resp.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", pageURL, err)
+	}
+	if len(content) > maxPageBytes {
+		return nil, fmt.Errorf("%s is larger than %d MB", pageURL, maxPageBytes/(1024*1024))
+	}
+
+	// Redirects change the URL that relative links resolve against
+	base := resp.Request.URL
+
+	page := &Page{
+		URL:      pageURL,
+		Content:  content,
+		Modified: time.Now(),
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		page.Modified = modified
+	}
+
+	page.Type, err = pageType(resp.Header.Get("Content-Type"), base.Path, content)
+	if err != nil {
+		return nil, fmt.Errorf("cannot ingest %s: %w", pageURL, err)
+	}
+
+	switch page.Type {
+	case ".xml":
+		page.Sitemap = true
+		page.Links = sitemapLinks(base, content)
+	case ".html":
+		page.Title = htmlTitle(content)
+		page.Links = htmlLinks(base, content)
+	}
+
+	if name := path.Base(base.Path); page.Title == "" && name != "/" && name != "." {
+		page.Title = extractTitle(name)
+	}
+	if page.Title == "" {
+		page.Title = base.Host
+	}
+
+	return page, nil
+}
+
+// Process splits a fetched page into chunks, with the URL as their path.
+func (p *Page) Process(ctx context.Context, opts ProcessorOptions) ([]*types.Document, error) {
+	source := types.DocumentSource{
+		Path:     p.URL,
+		Title:    p.Title,
+		Size:     int64(len(p.Content)),
+		Modified: p.Modified,
+		Type:     p.Type,
+	}
+
+	return NewProcessorWithOptions(opts).Process(ctx, bytes.NewReader(p.Content), source)
+}
+
+// pageType picks the extension a page is processed as, from its Content-Type header,
+// falling back to the extension in its URL path.
+func pageType(contentType, urlPath string, content []byte) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return ".html", nil
+	case "text/markdown", "text/x-markdown":
+		return ".md", nil
+	case "application/xml", "text/xml":
+		if sitemapPattern.Match(content) {
+			return ".xml", nil
+		}
+		return "", fmt.Errorf("XML pages other than sitemaps are not supported")
+	}
+
+	switch ext := strings.ToLower(path.Ext(urlPath)); ext {
+	case ".html", ".htm":
+		return ".html", nil
+	case ".md", ".markdown", ".txt":
+		return ext, nil
+	}
+
+	switch mediaType {
+	case "text/plain":
+		return ".txt", nil
+	case "":
+		// Servers that don't say are most often serving HTML
+		return ".html", nil
+	}
+
+	return "", fmt.Errorf("unsupported content type %s", mediaType)
+}
+
+// htmlTitle returns the text of a page's <title> element.
+func htmlTitle(content []byte) string {
+	match := titlePattern.FindSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+}
+
+// htmlLinks returns the absolute http(s) URLs of a page's <a href> links.
+func htmlLinks(base *url.URL, content []byte) []string {
+	var links []string
+	for _, match := range hrefPattern.FindAllSubmatch(content, -1) {
+		href := string(match[1]) + string(match[2]) + string(match[3])
+		links = appendLink(links, base, html.UnescapeString(href))
+	}
+	return links
+}
+
+// sitemapLinks returns the page URLs listed in a sitemap.
+func sitemapLinks(base *url.URL, content []byte) []string {
+	var links []string
+	for _, match := range locPattern.FindAllSubmatch(content, -1) {
+		links = appendLink(links, base, html.UnescapeString(string(match[1])))
+	}
+	return links
+}
+
+// appendLink resolves href against base and appends it to links if it is an
+// http(s) URL not already listed. Fragments are dropped, since they point into
+// the same page.
+func appendLink(links []string, base *url.URL, href string) []string {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return links
+	}
+
+	link := base.ResolveReference(ref)
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return links
+	}
+	link.Fragment = ""
+
+	resolved := link.String()
+	for _, existing := range links {
+		if existing == resolved {
+			return links
+		}
+	}
+	return append(links, resolved)
+}
@@ -0,0 +1,128 @@
+package document
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile is the name of the file, at the root of an ingested directory, that lists
+// gitignore-style patterns for paths to skip.
+const IgnoreFile = ".pawdyignore"
+
+// ignorePattern is one line of an ignore file.
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool // "!pattern" re-includes paths an earlier pattern excluded
+	dirOnly bool // "pattern/" only matches directories
+}
+
+// ignoreRules decides which paths under a directory are skipped during ingestion.
+type ignoreRules []ignorePattern
+
+// loadIgnoreRules reads the ignore file in directory. A missing file ignores nothing.
+func loadIgnoreRules(directory string) (ignoreRules, error) {
+	file, err := os.Open(filepath.Join(directory, IgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", IgnoreFile, err)
+	}
+	defer file.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var pattern ignorePattern
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// A pattern containing a slash is relative to the root; otherwise it matches at any depth
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		expr := globToRegexp(line)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+
+		pattern.re, err = regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %w", scanner.Text(), IgnoreFile, err)
+		}
+		rules = append(rules, pattern)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFile, err)
+	}
+
+	return rules, nil
+}
+
+// globToRegexp translates a gitignore glob to a regular expression: "*" and "?" match
+// within a path segment, and "**" matches across segments.
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			if end := strings.IndexByte(glob[i:], ']'); end > 0 {
+				class := glob[i+1 : i+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				expr.WriteString("[" + class + "]")
+				i += end
+				continue
+			}
+			expr.WriteString(regexp.QuoteMeta("["))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
+
+// ignored reports whether the slash-separated path, relative to the ingested directory,
+// is skipped. As in gitignore, the last matching pattern wins.
+func (r ignoreRules) ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, pattern := range r {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.re.MatchString(path) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
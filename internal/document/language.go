@@ -0,0 +1,216 @@
+package document
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// languageSampleRunes bounds how much of a document is inspected to detect its language.
+const languageSampleRunes = 4000
+
+// stopwords are frequent short words that identify space-delimited Latin-script languages.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "on", "are", "this", "be"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "von", "zu", "ein", "eine", "auf", "sich"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "que", "pour", "dans", "pas", "sur"},
+	"es": {"el", "la", "los", "las", "y", "que", "es", "en", "del", "por", "para", "una", "con", "se"},
+	"it": {"il", "di", "che", "e", "la", "per", "non", "una", "sono", "con", "gli", "del", "della", "è"},
+	"pt": {"o", "a", "os", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "é"},
+}
+
+// DetectLanguage returns an ISO 639-1 code for the dominant language of text, or "" if unsure.
+// Chinese, Japanese, and Korean are recognized by script, and common Latin-script
+// languages by their most frequent words.
+func DetectLanguage(text string) string {
+	var han, kana, hangul, cyrillic, letters int
+	sampled := 0
+	for _, r := range text {
+		if sampled >= languageSampleRunes {
+			break
+		}
+		sampled++
+
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+
+	if letters == 0 {
+		return ""
+	}
+
+	// CJK text often embeds Latin terms, so a quarter of the letters is enough.
+	// Japanese mixes kana into Han text; Chinese has none.
+	if cjk := han + kana + hangul; cjk*4 >= letters {
+		switch {
+		case kana > 0 && kana*10 >= han:
+			return "ja"
+		case hangul >= han:
+			return "ko"
+		default:
+			return "zh"
+		}
+	}
+
+	if cyrillic*2 > letters {
+		return "ru"
+	}
+
+	return detectByStopwords(text)
+}
+
+// detectByStopwords picks the language whose stopwords make up the largest share of text.
+// It returns "" when no language clearly dominates.
+func detectByStopwords(text string) string {
+	counts := make(map[string]int)
+	words := 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if words >= languageSampleRunes/4 {
+			break
+		}
+		words++
+
+		for language, list := range stopwords {
+			for _, stopword := range list {
+				if word == stopword {
+					counts[language]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestCount, runnerUp := "", 0, 0
+	for language, count := range counts {
+		if count > bestCount || (count == bestCount && language < best) {
+			best, bestCount, runnerUp = language, count, bestCount
+		} else if count > runnerUp {
+			runnerUp = count
+		}
+	}
+
+	// Require a meaningful share of stopwords and a clear lead over the next language
+	if bestCount*10 < words || bestCount < runnerUp*3/2 {
+		return ""
+	}
+
+	return best
+}
+
+// isCJK reports whether a language is written without spaces between words.
+func isCJK(language string) bool {
+	return language == "zh" || language == "ja" || language == "ko"
+}
+
+// isWideRune reports whether r is a CJK character, which typically takes at least one token.
+func isWideRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// chunkCJK splits text written without word spaces into chunks of at most maxTokens,
+// breaking after sentence-ending punctuation or line breaks where possible. Each chunk
+// after the first starts with roughly overlap tokens from the end of the previous one.
+func chunkCJK(text string, maxTokens, overlap int) []string {
+	var chunks []string
+	current := ""
+
+	for _, sentence := range splitCJKSentences(text) {
+		for _, piece := range splitRunes(sentence, maxTokens) {
+			if current != "" && CountTokens(current+piece) > maxTokens {
+				chunks = append(chunks, strings.TrimSpace(current))
+
+				// Shrink the overlap if it would push the next chunk over the limit
+				current = tailRunes(current, overlap)
+				for current != "" && CountTokens(current+piece) > maxTokens {
+					_, size := utf8.DecodeRuneInString(current)
+					current = current[size:]
+				}
+			}
+			current += piece
+		}
+	}
+
+	if strings.TrimSpace(current) != "" {
+		chunks = append(chunks, strings.TrimSpace(current))
+	}
+
+	return chunks
+}
+
+// splitCJKSentences splits text after sentence-ending punctuation and line breaks,
+// keeping the punctuation with its sentence.
+func splitCJKSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i, r := range text {
+		switch r {
+		case '。', '！', '？', '!', '?', '\n':
+			end := i + utf8.RuneLen(r)
+			sentences = append(sentences, text[start:end])
+			start = end
+		}
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// splitRunes splits text into pieces of at most maxTokens without breaking runes.
+func splitRunes(text string, maxTokens int) []string {
+	var pieces []string
+	start, quarters := 0, 0
+	for i, r := range text {
+		cost := runeQuarterTokens(r)
+		if i > start && (quarters+cost)/4 > maxTokens {
+			pieces = append(pieces, text[start:i])
+			start, quarters = i, 0
+		}
+		quarters += cost
+	}
+	if start < len(text) {
+		pieces = append(pieces, text[start:])
+	}
+	return pieces
+}
+
+// tailRunes returns the longest suffix of text that fits in tokens.
+func tailRunes(text string, tokens int) string {
+	if tokens <= 0 {
+		return ""
+	}
+
+	start, quarters := len(text), 0
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		quarters += runeQuarterTokens(r)
+		if quarters/4 > tokens {
+			break
+		}
+		start -= size
+	}
+
+	return strings.TrimLeft(text[start:], " \n")
+}
+
+// runeQuarterTokens estimates the tokens r takes, in quarter tokens: CJK characters
+// take about one token, and other text about one token per 4 bytes.
+func runeQuarterTokens(r rune) int {
+	if isWideRune(r) {
+		return 4
+	}
+	return utf8.RuneLen(r)
+}
@@ -0,0 +1,57 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ocrResolution is the DPI used when rendering PDF pages for OCR.
+const ocrResolution = 300
+
+// checkOCRTools verifies that the binaries needed for PDF OCR are installed.
+func checkOCRTools() error {
+	for _, tool := range []string{"pdftoppm", "tesseract"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("pdf_ocr requires %s to be installed: %w", tool, err)
+		}
+	}
+	return nil
+}
+
+// ocrPDFPage renders a single PDF page to an image with pdftoppm and reads its text with tesseract.
+func ocrPDFPage(ctx context.Context, filePath string, pageNum int) (string, error) {
+	dir, err := os.MkdirTemp("", "pawdy-ocr-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create OCR work directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	page := strconv.Itoa(pageNum)
+	image := filepath.Join(dir, "page")
+
+	// -singlefile writes exactly <prefix>.png instead of a page-numbered name
+	render := exec.CommandContext(ctx, "pdftoppm",
+		"-f", page, "-l", page,
+		"-r", strconv.Itoa(ocrResolution),
+		"-png", "-singlefile",
+		filePath, image)
+	if output, err := render.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to render PDF page %d: %w: %s", pageNum, err, strings.TrimSpace(string(output)))
+	}
+
+	var stdout, stderr bytes.Buffer
+	ocr := exec.CommandContext(ctx, "tesseract", image+".png", "stdout")
+	ocr.Stdout = &stdout
+	ocr.Stderr = &stderr
+	if err := ocr.Run(); err != nil {
+		return "", fmt.Errorf("failed to OCR PDF page %d: %w: %s", pageNum, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
@@ -2,64 +2,283 @@
 package document
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"crypto/md5"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ledongthuc/pdf"
 	"github.com/mabulgu/pawdy/pkg/types"
+	"gopkg.in/yaml.v3"
 )
 
 // Processor handles document parsing and chunking.
 type Processor struct {
-	chunkTokens  int
-	chunkOverlap int
+	chunkTokens      int
+	chunkOverlap     int
+	chunkOverrides   map[string]types.ChunkOverride
+	tokenizer        types.Tokenizer
+	sectionAware     bool
+	sectionInContent bool
+	csvDelimiter     rune
+	pdfOCR           bool
+	pdfFailedPages   float64
+	redactions       []Redaction
+	registry         *ProcessorRegistry
+	logger           *slog.Logger
+}
+
+// ProcessorOptions configures a document processor.
+type ProcessorOptions struct {
+	ChunkTokens  int
+	ChunkOverlap int
+
+	// ChunkOverrides replaces ChunkTokens and ChunkOverlap for the file extensions
+	// it lists, keyed without the leading dot (e.g. "pdf"). Zero fields fall back
+	// to the global values.
+	ChunkOverrides map[string]types.ChunkOverride
+
+	// Tokenizer is used for chunk sizing. If nil, chunk sizes are estimated
+	// at 4 characters per token.
+	Tokenizer types.Tokenizer
+
+	// SectionAware chunks Markdown per header section and records the header
+	// breadcrumb (e.g. "Networking > DHCP setup") in Metadata["section"].
+	SectionAware bool
+
+	// SectionInContent also prepends the breadcrumb to each chunk's content.
+	SectionInContent bool
+
+	// CSVDelimiter overrides the field delimiter for .csv and .tsv files.
+	// If zero, ',' is used for .csv and a tab for .tsv.
+	CSVDelimiter rune
+
+	// PDFOCR runs OCR on PDF pages without a text layer, such as scanned manuals.
+	// It requires the pdftoppm and tesseract binaries.
+	PDFOCR bool
+
+	// PDFFailedPages is the fraction of PDF pages (0.0-1.0) that may fail to
+	// extract before the whole document is rejected. Failed pages below the
+	// limit are skipped and logged. Zero rejects a PDF with any failed page.
+	PDFFailedPages float64
+
+	// Redactions mask sensitive text such as emails and passwords before chunking.
+	// Only the indexed content is affected; the file on disk is left untouched.
+	Redactions []Redaction
+
+	// Registry selects the extractor for each file type. If nil, the built-in
+	// formats of DefaultRegistry are used.
+	Registry *ProcessorRegistry
+
+	// Logger receives warnings about content that was skipped. If nil, they are discarded.
+	Logger *slog.Logger
+}
+
+// reservedMetadata lists metadata keys owned by the processor and retrievers,
+// which Markdown front matter may not override.
+var reservedMetadata = map[string]bool{
+	"path":            true,
+	"type":            true,
+	"size":            true,
+	"modified":        true,
+	"chunk_id":        true,
+	"total_chunks":    true,
+	"section":         true,
+	"content_hash":    true,
+	"chunk_hash":      true,
+	"duplicate_paths": true,
+	"content":         true,
+	"doc_id":          true,
+	"language":        true,
+	"ingested_at":     true,
+	"raw_content":     true,
+}
+
+// IngestedAt returns when a chunk was indexed, from its "ingested_at" metadata. Chunks
+// indexed before the timestamp was recorded report false.
+func IngestedAt(metadata map[string]any) (time.Time, bool) {
+	switch value := metadata["ingested_at"].(type) {
+	case time.Time:
+		return value, true
+	case string:
+		t, err := time.Parse(time.RFC3339, value)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// ChunkIndex returns the 0-based position of a chunk in its source, from its "chunk_id"
+// metadata, which comes back from a vector database as an integer or a float.
+func ChunkIndex(metadata map[string]any) (int, bool) {
+	switch value := metadata["chunk_id"].(type) {
+	case int:
+		return value, true
+	case int64:
+		return int(value), true
+	case float64:
+		return int(value), true
+	}
+	return 0, false
+}
+
+// SourceWeight returns the score multiplier for a chunk, from its "source_weight"
+// metadata, which ingestion or Markdown front matter sets for authoritative sources.
+// Chunks without a positive weight have a weight of 1.
+func SourceWeight(metadata map[string]any) float64 {
+	var weight float64
+	switch value := metadata["source_weight"].(type) {
+	case float64:
+		weight = value
+	case float32:
+		weight = float64(value)
+	case int:
+		weight = float64(value)
+	case int64:
+		weight = float64(value)
+	}
+	if weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+// DisplayContent returns a chunk as written in its source, with the formatting that
+// was stripped before embedding, from its "raw_content" metadata. Chunks without it
+// are returned as indexed.
+func DisplayContent(doc *types.Document) string {
+	if raw, ok := doc.Metadata["raw_content"].(string); ok && raw != "" {
+		return raw
+	}
+	return doc.Content
+}
+
+// Section is a run of document text under a single breadcrumb, such as a Markdown
+// header path or an EPUB chapter title.
+type Section struct {
+	Breadcrumb string
+	Text       string
+	Raw        string // the section as written, if Text strips its formatting
 }
 
 // NewProcessor creates a new document processor.
-func NewProcessor(chunkTokens, chunkOverlap int) *Processor {
+// If tokenizer is nil, chunk sizes are estimated at 4 characters per token.
+func NewProcessor(chunkTokens, chunkOverlap int, tokenizer types.Tokenizer) *Processor {
+	return NewProcessorWithOptions(ProcessorOptions{
+		ChunkTokens:  chunkTokens,
+		ChunkOverlap: chunkOverlap,
+		Tokenizer:    tokenizer,
+	})
+}
+
+// NewProcessorWithOptions creates a new document processor with optional behavior.
+func NewProcessorWithOptions(opts ProcessorOptions) *Processor {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	registry := opts.Registry
+	if registry == nil {
+		registry = defaultRegistry
+	}
+
 	return &Processor{
-		chunkTokens:  chunkTokens,
-		chunkOverlap: chunkOverlap,
+		chunkTokens:      opts.ChunkTokens,
+		chunkOverlap:     opts.ChunkOverlap,
+		chunkOverrides:   opts.ChunkOverrides,
+		tokenizer:        opts.Tokenizer,
+		sectionAware:     opts.SectionAware,
+		sectionInContent: opts.SectionInContent,
+		csvDelimiter:     opts.CSVDelimiter,
+		pdfOCR:           opts.PDFOCR,
+		pdfFailedPages:   opts.PDFFailedPages,
+		redactions:       opts.Redactions,
+		registry:         registry,
+		logger:           logger,
 	}
 }
 
 // Process extracts text content from a document and splits it into chunks.
 func (p *Processor) Process(ctx context.Context, reader io.Reader, source types.DocumentSource) ([]*types.Document, error) {
-	var text string
-	var err error
+	// Formats without a registered extractor are treated as plain text
+	extractor, ok := p.registry.Lookup(source.Type)
+	if !ok {
+		extractor = ExtractorFunc(extractPlainText)
+	}
 
-	// Handle PDF files specially (require file path)
-	if strings.ToLower(source.Type) == ".pdf" {
-		text, err = p.extractPDF(source.Path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to extract PDF text: %w", err)
-		}
-	} else {
-		// Read all content for other file types
-		content, err := io.ReadAll(reader)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read document: %w", err)
-		}
+	extraction, err := extractor.Extract(ctx, p, reader, source)
+	if err != nil {
+		return nil, err
+	}
 
-		// Extract text based on file type
-		text, err = p.extractText(string(content), source.Type)
-		if err != nil {
-			return nil, fmt.Errorf("failed to extract text: %w", err)
+	text, sections, frontMatter := extraction.Text, extraction.Sections, extraction.Metadata
+	if text == "" {
+		for _, section := range sections {
+			text += section.Text
 		}
 	}
 
 	if strings.TrimSpace(text) == "" {
-		return nil, fmt.Errorf("document contains no extractable text")
+		return nil, ErrNoText
+	}
+
+	if sections == nil {
+		sections = []Section{{Text: text, Raw: extraction.Raw}}
+	}
+
+	// Split each section into chunks
+	chunkTokens, chunkOverlap := p.chunkSettings(source.Type)
+	codeLanguage := CodeLanguage(source.Type)
+	language := codeLanguage
+	if language == "" {
+		language = DetectLanguage(text)
 	}
 
-	// Split into chunks
-	chunks := p.chunkText(text, p.chunkTokens, p.chunkOverlap)
+	// Without a tokenizer, text is split on spaces, which CJK scripts don't use between words
+	chunkText := p.chunkText
+	if isCJK(language) && p.tokenizer == nil {
+		chunkText = chunkCJK
+	}
+
+	var chunks []string
+	var breadcrumbs []string
+	var raws []string
+	if codeLanguage != "" {
+		// Source code is chunked on declaration boundaries and keeps its formatting
+		chunks = p.chunkCode(Redact(text, p.redactions), chunkTokens)
+		breadcrumbs = make([]string, len(chunks))
+		raws = make([]string, len(chunks))
+	} else {
+		for _, section := range sections {
+			sectionChunks := chunkText(Redact(section.Text, p.redactions), chunkTokens, chunkOverlap)
+
+			// Keep the formatted text each chunk was cut from for display
+			sectionRaws := make([]string, len(sectionChunks))
+			if section.Raw != "" {
+				sectionRaws = rawSpans(Redact(section.Raw, p.redactions), sectionChunks)
+			}
+
+			for i, chunk := range sectionChunks {
+				if p.sectionInContent && section.Breadcrumb != "" {
+					chunk = section.Breadcrumb + "\n\n" + chunk
+				}
+				chunks = append(chunks, chunk)
+				breadcrumbs = append(breadcrumbs, section.Breadcrumb)
+				raws = append(raws, sectionRaws[i])
+			}
+		}
+	}
 
 	// Create document objects
 	documents := make([]*types.Document, len(chunks))
@@ -79,61 +298,130 @@ func (p *Processor) Process(ctx context.Context, reader io.Reader, source types.
 				"total_chunks": len(chunks),
 			},
 		}
+
+		if breadcrumbs[i] != "" {
+			documents[i].Metadata["section"] = breadcrumbs[i]
+		}
+		if raws[i] != "" && raws[i] != chunk {
+			documents[i].Metadata["raw_content"] = raws[i]
+		}
+		if language != "" {
+			documents[i].Metadata["language"] = language
+		}
+
+		for key, value := range frontMatter {
+			if !reservedMetadata[key] {
+				documents[i].Metadata[key] = value
+			}
+		}
 	}
 
 	return documents, nil
 }
 
-// SupportedTypes returns the file types this processor can handle.
-func (p *Processor) SupportedTypes() []string {
-	return []string{".md", ".txt", ".html", ".pdf"}
-}
-
-// extractText extracts plain text from various document formats.
-func (p *Processor) extractText(content, fileType string) (string, error) {
-	switch strings.ToLower(fileType) {
-	case ".md", ".markdown":
-		return p.extractMarkdown(content), nil
-	case ".txt":
-		return content, nil
-	case ".html", ".htm":
-		return p.extractHTML(content), nil
-	default:
-		// Treat as plain text
-		return content, nil
+// chunkSettings returns the chunk size and overlap to use for a file type.
+func (p *Processor) chunkSettings(fileType string) (int, int) {
+	chunkTokens, chunkOverlap := p.chunkTokens, p.chunkOverlap
+
+	override, ok := p.chunkOverrides[strings.TrimPrefix(strings.ToLower(fileType), ".")]
+	if !ok {
+		return chunkTokens, chunkOverlap
+	}
+	if override.Tokens != 0 {
+		chunkTokens = override.Tokens
+	}
+	if override.Overlap != 0 {
+		chunkOverlap = override.Overlap
 	}
+
+	return chunkTokens, chunkOverlap
+}
+
+// SupportedTypes returns the file types this processor can handle, from its registry.
+func (p *Processor) SupportedTypes() []string {
+	return p.registry.Extensions()
 }
 
 // extractPDF extracts text from PDF files.
-func (p *Processor) extractPDF(filePath string) (string, error) {
+// Pages without a text layer are OCRed when OCR is enabled.
+func (p *Processor) extractPDF(ctx context.Context, filePath string) (string, error) {
 	file, r, err := pdf.Open(filePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open PDF: %w", err)
 	}
 	defer file.Close()
 
-	var text strings.Builder
 	totalPages := r.NumPage()
+	pages := make([]string, totalPages)
+	var emptyPages []int
+	var failures pdfPageErrors
 
 	for pageNum := 1; pageNum <= totalPages; pageNum++ {
 		page := r.Page(pageNum)
 		if page.V.IsNull() {
+			failures.add(pageNum, fmt.Errorf("page object is missing"))
 			continue
 		}
 
 		// Extract text from the page with empty font map
-		pageText, err := page.GetPlainText(nil)
+		pageText, err := pagePlainText(page)
 		if err != nil {
-			// Log error but continue with other pages
+			failures.add(pageNum, err)
 			continue
 		}
+		if strings.TrimSpace(pageText) == "" {
+			// Scanned pages have no text layer; remember them for OCR
+			emptyPages = append(emptyPages, pageNum)
+			continue
+		}
+
+		pages[pageNum-1] = pageText
+	}
+
+	if p.pdfOCR && len(emptyPages) > 0 {
+		if err := checkOCRTools(); err != nil {
+			return "", err
+		}
 
+		for _, pageNum := range emptyPages {
+			pageText, err := ocrPDFPage(ctx, filePath, pageNum)
+			if err != nil {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				failures.add(pageNum, fmt.Errorf("OCR failed: %w", err))
+				continue
+			}
+			pages[pageNum-1] = pageText
+		}
+	}
+
+	if len(failures) > 0 {
+		if float64(len(failures)) > p.pdfFailedPages*float64(totalPages) {
+			return "", fmt.Errorf("failed to extract %d of %d PDF pages: %w", len(failures), totalPages, failures)
+		}
+
+		p.logger.Warn("skipped unreadable PDF pages",
+			"path", filePath,
+			"skipped", len(failures),
+			"pages", totalPages,
+			"error", failures)
+	}
+
+	var text strings.Builder
+	for _, pageText := range pages {
+		if pageText == "" {
+			continue
+		}
 		text.WriteString(pageText)
 		text.WriteString("\n") // Add newline between pages
 	}
 
 	result := text.String()
 	if strings.TrimSpace(result) == "" {
+		if !p.pdfOCR {
+			return "", fmt.Errorf("no text could be extracted from PDF (enable pdf_ocr for scanned documents)")
+		}
 		return "", fmt.Errorf("no text could be extracted from PDF")
 	}
 
@@ -145,9 +433,233 @@ func (p *Processor) extractPDF(filePath string) (string, error) {
 	return result, nil
 }
 
+// pdfPageErrors collects the pages of a PDF that could not be extracted.
+type pdfPageErrors []pdfPageError
+
+// pdfPageError records why a single PDF page could not be extracted.
+type pdfPageError struct {
+	page int
+	err  error
+}
+
+// add records a failed page.
+func (e *pdfPageErrors) add(page int, err error) {
+	*e = append(*e, pdfPageError{page: page, err: err})
+}
+
+// Error summarizes the failed pages, naming the first few.
+func (e pdfPageErrors) Error() string {
+	const shown = 3
+
+	var parts []string
+	for i, failure := range e {
+		if i == shown {
+			parts = append(parts, fmt.Sprintf("and %d more", len(e)-shown))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("page %d: %v", failure.page, failure.err))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// pagePlainText extracts a page's text, converting panics from malformed
+// page content into errors so one bad page can't crash ingestion.
+func pagePlainText(page pdf.Page) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed page content: %v", r)
+		}
+	}()
+
+	return page.GetPlainText(nil)
+}
+
+// extractDOCX extracts text from Word documents by reading word/document.xml.
+func (p *Processor) extractDOCX(content []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open DOCX archive: %w", err)
+	}
+
+	var documentXML *zip.File
+	for _, f := range archive.File {
+		if f.Name == "word/document.xml" {
+			documentXML = f
+			break
+		}
+	}
+	if documentXML == nil {
+		return "", fmt.Errorf("word/document.xml not found in DOCX archive")
+	}
+
+	rc, err := documentXML.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open word/document.xml: %w", err)
+	}
+	defer rc.Close()
+
+	var text strings.Builder
+	decoder := xml.NewDecoder(rc)
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse word/document.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab", "br", "cr":
+				text.WriteString(" ")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				// Paragraphs (including list items) end with a newline
+				text.WriteString("\n")
+			case "tc":
+				// Flatten table cells with spaces
+				text.WriteString(" ")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	result := text.String()
+	if strings.TrimSpace(result) == "" {
+		return "", fmt.Errorf("no text could be extracted from DOCX")
+	}
+
+	// Table cells contain paragraphs, so collapse whitespace the same way as PDFs
+	result = regexp.MustCompile(`\s+`).ReplaceAllString(result, " ")
+	result = strings.TrimSpace(result)
+
+	return result, nil
+}
+
+// delimiterFor returns the field delimiter for a delimited text file type.
+func (p *Processor) delimiterFor(fileType string) rune {
+	if p.csvDelimiter != 0 {
+		return p.csvDelimiter
+	}
+	if strings.ToLower(fileType) == ".tsv" {
+		return '\t'
+	}
+	return ','
+}
+
+// extractCSV renders delimited rows as "header: value" pairs, one line per row,
+// so that retrieval can match on column meaning. The first row is the header.
+func (p *Processor) extractCSV(content []byte, delimiter rune) (string, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CSV: %w", err)
+	}
+
+	if len(records) < 2 {
+		return "", fmt.Errorf("CSV has no data rows")
+	}
+
+	header := records[0]
+	var text strings.Builder
+
+	for _, record := range records[1:] {
+		var pairs []string
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+
+			name := fmt.Sprintf("column %d", i+1)
+			if i < len(header) && strings.TrimSpace(header[i]) != "" {
+				name = strings.TrimSpace(header[i])
+			}
+			pairs = append(pairs, name+": "+value)
+		}
+
+		if len(pairs) > 0 {
+			text.WriteString(strings.Join(pairs, "; "))
+			text.WriteString("\n")
+		}
+	}
+
+	return strings.TrimSpace(text.String()), nil
+}
+
+// extractFrontMatter splits YAML front matter delimited by "---" lines from the
+// start of a Markdown document. Content without valid front matter is returned unchanged.
+func (p *Processor) extractFrontMatter(content string) (map[string]any, string) {
+	trimmed := strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(trimmed, "---\n") && !strings.HasPrefix(trimmed, "---\r\n") {
+		return nil, content
+	}
+
+	lines := strings.SplitAfter(trimmed, "\n")
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if line != "---" && line != "..." {
+			continue
+		}
+
+		var fields map[string]any
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[1:i], "")), &fields); err != nil {
+			// Not front matter, e.g. a document that opens with a horizontal rule
+			return nil, content
+		}
+
+		for key, value := range fields {
+			fields[key] = normalizeFrontMatterValue(value)
+		}
+
+		return fields, strings.Join(lines[i+1:], "")
+	}
+
+	return nil, content
+}
+
+// normalizeFrontMatterValue converts YAML values into types that every retriever
+// can store, rendering timestamps as RFC 3339 strings.
+func normalizeFrontMatterValue(value any) any {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []any:
+		for i := range v {
+			v[i] = normalizeFrontMatterValue(v[i])
+		}
+		return v
+	case map[string]any:
+		for key := range v {
+			v[key] = normalizeFrontMatterValue(v[key])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
 // extractMarkdown removes markdown formatting while preserving structure.
 func (p *Processor) extractMarkdown(content string) string {
-	text := content
+	// Render tables before the whitespace cleanup below joins their rows into one line
+	text := renderMarkdownTables(content)
 
 	// Remove code blocks (preserve content but remove formatting)
 	codeBlockRe := regexp.MustCompile("(?s)```[a-zA-Z]*\n(.*?)\n```")
@@ -157,14 +669,14 @@ func (p *Processor) extractMarkdown(content string) string {
 	inlineCodeRe := regexp.MustCompile("`([^`]+)`")
 	text = inlineCodeRe.ReplaceAllString(text, "$1")
 
+	// Remove image syntax first, since an image also matches the link pattern
+	imageRe := regexp.MustCompile(`!\[[^\]]*\]\([^)]+\)`)
+	text = imageRe.ReplaceAllString(text, "")
+
 	// Remove links but keep text
 	linkRe := regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
 	text = linkRe.ReplaceAllString(text, "$1")
 
-	// Remove image syntax
-	imageRe := regexp.MustCompile(`!\[[^\]]*\]\([^)]+\)`)
-	text = imageRe.ReplaceAllString(text, "")
-
 	// Remove headers but keep content
 	headerRe := regexp.MustCompile(`^#{1,6}\s+(.+)$`)
 	text = headerRe.ReplaceAllStringFunc(text, func(match string) string {
@@ -186,10 +698,140 @@ func (p *Processor) extractMarkdown(content string) string {
 	return strings.TrimSpace(text)
 }
 
+// tableDelimiterRe matches the row under a GFM table header, such as "| --- | :---: |".
+var tableDelimiterRe = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// renderMarkdownTables rewrites GFM tables as one "column: value, column: value." line
+// per row, like CSV files, so each row keeps its column meaning once whitespace is
+// collapsed. Tables in fenced code blocks and other content are left unchanged.
+func renderMarkdownTables(content string) string {
+	lines := strings.Split(content, "\n")
+	out := make([]string, 0, len(lines))
+	inCodeBlock := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+		}
+
+		// A table is a header row followed by a delimiter row with as many cells
+		if inCodeBlock || i+1 >= len(lines) || !strings.Contains(line, "|") || !tableDelimiterRe.MatchString(lines[i+1]) {
+			out = append(out, line)
+			continue
+		}
+		header := splitTableRow(line)
+		if len(splitTableRow(lines[i+1])) != len(header) {
+			out = append(out, line)
+			continue
+		}
+
+		// Rows continue until a blank line or a line without a pipe
+		i += 2
+		for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+			var pairs []string
+			for j, value := range splitTableRow(lines[i]) {
+				if value == "" {
+					continue
+				}
+
+				name := fmt.Sprintf("column %d", j+1)
+				if j < len(header) && header[j] != "" {
+					name = header[j]
+				}
+				pairs = append(pairs, name+": "+value)
+			}
+
+			if len(pairs) > 0 {
+				out = append(out, strings.Join(pairs, ", ")+".")
+			}
+		}
+		i--
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// splitTableRow returns the trimmed cells of a table row, honoring escaped pipes.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = strings.TrimSuffix(line, "|")
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// extractMarkdownSections splits Markdown by headers, tracking the header
+// hierarchy so each section carries a breadcrumb like "Networking > DHCP setup".
+func (p *Processor) extractMarkdownSections(content string) []Section {
+	headerRe := regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+	var sections []Section
+	var headers [6]string
+	var current strings.Builder
+	breadcrumb := ""
+	inCodeBlock := false
+
+	flush := func() {
+		if text := p.extractMarkdown(current.String()); text != "" {
+			sections = append(sections, Section{Breadcrumb: breadcrumb, Text: text, Raw: strings.TrimSpace(current.String())})
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+		}
+
+		if !inCodeBlock {
+			if matches := headerRe.FindStringSubmatch(line); matches != nil {
+				flush()
+
+				level := len(matches[1])
+				headers[level-1] = p.extractMarkdown(matches[2])
+				for i := level; i < len(headers); i++ {
+					headers[i] = ""
+				}
+
+				var trail []string
+				for _, header := range headers[:level] {
+					if header != "" {
+						trail = append(trail, header)
+					}
+				}
+				breadcrumb = strings.Join(trail, " > ")
+			}
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	flush()
+
+	return sections
+}
+
 // extractHTML removes HTML tags and extracts text content.
 func (p *Processor) extractHTML(content string) string {
 	// Remove script and style tags completely
-	scriptRe := regexp.MustCompile(`(?i)<(script|style)[^>]*>.*?</\1>`)
+	scriptRe := regexp.MustCompile(`(?is)<script[^>]*>.*?</script>|<style[^>]*>.*?</style>`)
 	text := scriptRe.ReplaceAllString(content, "")
 
 	// Remove HTML tags but preserve content
@@ -211,8 +853,51 @@ func (p *Processor) extractHTML(content string) string {
 	return strings.TrimSpace(text)
 }
 
+// formatHTML extracts the text of HTML like extractHTML, but keeps its layout for
+// display: paragraphs, list items, and other block elements are kept apart.
+func (p *Processor) formatHTML(content string) string {
+	scriptRe := regexp.MustCompile(`(?is)<script[^>]*>.*?</script>|<style[^>]*>.*?</style>`)
+	text := scriptRe.ReplaceAllString(content, "")
+
+	blockRe := regexp.MustCompile(`(?i)<(br|/?(p|div|h[1-6]|li|ul|ol|tr|table|pre|blockquote|section|article))\b[^>]*>`)
+	text = blockRe.ReplaceAllString(text, "\n")
+
+	tagRe := regexp.MustCompile(`<[^>]+>`)
+	text = tagRe.ReplaceAllString(text, " ")
+
+	text = strings.ReplaceAll(text, "&nbsp;", " ")
+	text = strings.ReplaceAll(text, "&amp;", "&")
+	text = strings.ReplaceAll(text, "&lt;", "<")
+	text = strings.ReplaceAll(text, "&gt;", ">")
+	text = strings.ReplaceAll(text, "&quot;", "\"")
+	text = strings.ReplaceAll(text, "&#39;", "'")
+
+	// Tidy each line and drop runs of blank lines left by nested blocks
+	spaceRe := regexp.MustCompile(`[ \t\r]+`)
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(spaceRe.ReplaceAllString(line, " "))
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // chunkText splits text into overlapping chunks based on approximate token count.
 func (p *Processor) chunkText(text string, maxTokens, overlap int) []string {
+	if p.tokenizer != nil {
+		return p.chunkByTokens(text, maxTokens, overlap)
+	}
+
 	// Rough approximation: 1 token ≈ 4 characters for English text
 	maxChars := maxTokens * 4
 	overlapChars := overlap * 4
@@ -256,14 +941,51 @@ func (p *Processor) chunkText(text string, maxTokens, overlap int) []string {
 	return chunks
 }
 
-// getOverlapText returns the last N characters of text for overlap.
+// chunkByTokens splits text into overlapping chunks on real token boundaries.
+func (p *Processor) chunkByTokens(text string, maxTokens, overlap int) []string {
+	tokens := p.tokenizer.Encode(text)
+	if len(tokens) == 0 {
+		return []string{}
+	}
+
+	step := maxTokens - overlap
+	if step <= 0 {
+		step = maxTokens
+	}
+
+	var chunks []string
+	for start := 0; start < len(tokens); start += step {
+		end := start + maxTokens
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+
+		if chunk := strings.TrimSpace(p.tokenizer.Decode(tokens[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+
+		if end == len(tokens) {
+			break
+		}
+	}
+
+	return chunks
+}
+
+// getOverlapText returns the whole sentences at the end of text that fit in overlapChars,
+// so the next chunk starts at a sentence boundary. If the last sentence alone is longer
+// than overlapChars, the overlap starts at the word boundary nearest that size instead.
 func (p *Processor) getOverlapText(text string, overlapChars int) string {
 	if len(text) <= overlapChars {
 		return text
 	}
 
-	// Find a good break point (word boundary) near the overlap size
 	startPos := len(text) - overlapChars
+	if start := sentenceStart(text, startPos); start >= 0 {
+		return strings.TrimSpace(text[start:])
+	}
+
+	// Find a good break point (word boundary) near the overlap size
 
 	// Look for the nearest word boundary
 	for j := startPos; j < len(text); j++ {
@@ -276,8 +998,78 @@ func (p *Processor) getOverlapText(text string, overlapChars int) string {
 	return strings.TrimSpace(text[startPos:])
 }
 
+// sentenceStart returns the index of the first sentence in text that begins at or after from,
+// or -1 if there is none. A sentence begins after '.', '?', or '!' followed by whitespace.
+func sentenceStart(text string, from int) int {
+	for i := max(from, 2); i < len(text); i++ {
+		if isSpace(text[i-1]) && !isSpace(text[i]) && strings.IndexByte(".?!", text[i-2]) >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// isSpace reports whether b is an ASCII whitespace character.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r'
+}
+
+// CollectFiles walks a directory and returns the paths of all supported documents.
+// Hidden directories such as .git are skipped, as are paths matching the patterns in
+// the directory's .pawdyignore file.
+func CollectFiles(directory string) ([]string, error) {
+	rules, err := loadIgnoreRules(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == directory {
+			return nil
+		}
+
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		relative, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		if rules.ignored(filepath.ToSlash(relative), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.IsDir() && IsSupportedFile(path) {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// IsSupportedFile reports whether a file has an extension that can be ingested.
+func IsSupportedFile(path string) bool {
+	_, ok := defaultRegistry.Lookup(filepath.Ext(path))
+	return ok
+}
+
+// ErrNoText is returned when nothing is left of a document after text extraction,
+// e.g. a Markdown file that only contains images and links.
+var ErrNoText = errors.New("document contains no extractable text")
+
 // ProcessFile processes a single file and returns document chunks.
-func ProcessFile(ctx context.Context, filePath string, chunkTokens, chunkOverlap int) ([]*types.Document, error) {
+func ProcessFile(ctx context.Context, filePath string, opts ProcessorOptions) ([]*types.Document, error) {
 	// Get file info
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -301,7 +1093,7 @@ func ProcessFile(ctx context.Context, filePath string, chunkTokens, chunkOverlap
 	}
 
 	// Create processor
-	processor := NewProcessor(chunkTokens, chunkOverlap)
+	processor := NewProcessorWithOptions(opts)
 
 	// Process the document
 	return processor.Process(ctx, file, source)
@@ -330,8 +1122,25 @@ func extractTitle(filePath string) string {
 }
 
 // CountTokens provides a rough estimate of token count for text.
+// Use a types.Tokenizer when exact counts are required.
 func CountTokens(text string) int {
-	// Rough approximation: 1 token ≈ 4 characters for English text
+	// Rough approximation: 1 token ≈ 4 characters for English text, and 1 per CJK character
 	// This is a simplified approach - real tokenization would use the model's tokenizer
-	return len(text) / 4
+	quarters := 0
+	for _, r := range text {
+		quarters += runeQuarterTokens(r)
+	}
+	return quarters / 4
+}
+
+// TruncateTokens cuts text to about maxTokens tokens, as estimated by CountTokens.
+func TruncateTokens(text string, maxTokens int) string {
+	quarters := 0
+	for i, r := range text {
+		quarters += runeQuarterTokens(r)
+		if quarters/4 > maxTokens {
+			return text[:i]
+		}
+	}
+	return text
 }
@@ -0,0 +1,611 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildDOCX creates an in-memory DOCX archive with the given document.xml body.
+func buildDOCX(t *testing.T, body string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("word/document.xml")
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		body + `</w:body></w:document>`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestProcessor_ExtractDOCX(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	content := buildDOCX(t,
+		`<w:p><w:r><w:t>Gather initramfs logs</w:t></w:r></w:p>`+
+			`<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Boot into rescue mode</w:t></w:r></w:p>`+
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Host</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>IP</w:t></w:r></w:p></w:tc></w:tr>`+
+			`<w:tr><w:tc><w:p><w:r><w:t>worker-0</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>10.0.0.5</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`)
+
+	text, err := processor.extractDOCX(content)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Gather initramfs logs Boot into rescue mode Host IP worker-0 10.0.0.5", text)
+}
+
+func TestProcessor_ExtractDOCX_Invalid(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	_, err := processor.extractDOCX([]byte("not a zip file"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open DOCX archive")
+}
+
+func TestProcessor_Process_DOCX(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+	content := buildDOCX(t, `<w:p><w:r><w:t>Runbook step one</w:t></w:r></w:p>`)
+
+	docs, err := processor.Process(context.Background(), bytes.NewReader(content), types.DocumentSource{
+		Path: "/docs/runbook.docx",
+		Type: ".docx",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "Runbook step one", docs[0].Content)
+	assert.Contains(t, processor.SupportedTypes(), ".docx")
+}
+
+// buildEPUB creates an in-memory EPUB archive from file names and contents.
+func buildEPUB(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestProcessor_Process_EPUB(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+	content := buildEPUB(t, map[string]string{
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`,
+		"OEBPS/content.opf": `<package><manifest>` +
+			`<item id="nav" href="nav.xhtml"/><item id="ch1" href="text/ch%201.xhtml"/><item id="ch2" href="text/ch2.xhtml"/>` +
+			`</manifest><spine><itemref idref="nav" linear="no"/><itemref idref="ch2"/><itemref idref="ch1"/></spine></package>`,
+		"OEBPS/nav.xhtml":       `<html><body>Table of contents</body></html>`,
+		"OEBPS/text/ch 1.xhtml": `<html><head><title>Book</title><style>p { color: red; }</style></head><body><h1>Firmware</h1><p>Update the BMC.</p></body></html>`,
+		"OEBPS/text/ch2.xhtml":  `<html><head><title>Introduction</title></head><body><p>Welcome &amp; thanks.</p></body></html>`,
+	})
+
+	docs, err := processor.Process(context.Background(), bytes.NewReader(content), types.DocumentSource{
+		Path: "/docs/guide.epub",
+		Type: ".epub",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "Introduction", docs[0].Metadata["section"])
+	assert.Equal(t, "Welcome & thanks.", docs[0].Content)
+	assert.Equal(t, "Firmware", docs[1].Metadata["section"])
+	assert.Equal(t, "Firmware Update the BMC.", docs[1].Content)
+	assert.Contains(t, processor.SupportedTypes(), ".epub")
+}
+
+func TestBPETokenizer_EncodeDecode(t *testing.T) {
+	ranks := map[string]int{}
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	ranks["oc"] = 256
+	ranks[" get"] = 257
+	ranks[" pods"] = 258
+	ranks["ge"] = 259
+
+	tokenizer := NewBPETokenizer(ranks)
+
+	tokens := tokenizer.Encode("oc get pods")
+	assert.Equal(t, []int{256, 257, 258}, tokens)
+	assert.Equal(t, "oc get pods", tokenizer.Decode(tokens))
+	assert.Equal(t, 3, tokenizer.Count("oc get pods"))
+}
+
+func TestProcessor_ChunkByTokens(t *testing.T) {
+	ranks := map[string]int{}
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	ranks["word"] = 256
+	ranks[" word"] = 257
+
+	processor := NewProcessor(4, 1, NewBPETokenizer(ranks))
+	chunks := processor.chunkText("word word word word word word word", 4, 1)
+
+	assert.Equal(t, []string{"word word word word", "word word word word"}, chunks)
+}
+
+func TestProcessor_GetOverlapText(t *testing.T) {
+	processor := NewProcessor(100, 10, nil)
+	text := "Boot the node. Open the console and wait for the prompt. Collect the logs!"
+
+	// The overlap starts at the first sentence that fits, not mid-sentence
+	assert.Equal(t, "Collect the logs!", processor.getOverlapText(text, 30))
+	assert.Equal(t, "Open the console and wait for the prompt. Collect the logs!", processor.getOverlapText(text, 60))
+
+	// A final sentence longer than the overlap falls back to a word boundary
+	assert.Equal(t, "the logs!", processor.getOverlapText(text, 10))
+}
+
+func TestProcessor_ChunkSettings(t *testing.T) {
+	processor := NewProcessorWithOptions(ProcessorOptions{
+		ChunkTokens:  1000,
+		ChunkOverlap: 200,
+		ChunkOverrides: map[string]types.ChunkOverride{
+			"pdf":  {Tokens: 1500},
+			"yaml": {Tokens: 400, Overlap: 150},
+		},
+	})
+
+	tokens, overlap := processor.chunkSettings(".PDF")
+	assert.Equal(t, 1500, tokens)
+	assert.Equal(t, 200, overlap)
+
+	tokens, overlap = processor.chunkSettings(".yaml")
+	assert.Equal(t, 400, tokens)
+	assert.Equal(t, 150, overlap)
+
+	tokens, overlap = processor.chunkSettings(".md")
+	assert.Equal(t, 1000, tokens)
+	assert.Equal(t, 200, overlap)
+}
+
+func TestProcessor_Process_MarkdownSections(t *testing.T) {
+	processor := NewProcessorWithOptions(ProcessorOptions{
+		ChunkTokens:      1000,
+		ChunkOverlap:     200,
+		SectionAware:     true,
+		SectionInContent: true,
+	})
+
+	content := "Intro text.\n\n# Networking\n\nOverview of networking.\n\n## DHCP setup\n\nConfigure the DHCP range.\n\n```\n# not a header\n```\n\n# Storage\n\nUse local disks.\n"
+
+	docs, err := processor.Process(context.Background(), strings.NewReader(content), types.DocumentSource{
+		Path: "/docs/guide.md",
+		Type: ".md",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 4)
+
+	_, hasSection := docs[0].Metadata["section"]
+	assert.False(t, hasSection)
+	assert.Equal(t, "Intro text.", docs[0].Content)
+
+	assert.Equal(t, "Networking", docs[1].Metadata["section"])
+	assert.Equal(t, "Networking > DHCP setup", docs[2].Metadata["section"])
+	assert.True(t, strings.HasPrefix(docs[2].Content, "Networking > DHCP setup\n\n"))
+	assert.Contains(t, docs[2].Content, "# not a header")
+	assert.Equal(t, "Storage", docs[3].Metadata["section"])
+}
+
+func TestProcessor_ExtractMarkdown_Tables(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	content := "Supported servers:\n\n" +
+		"| Model | CPU | **Certified** |\n" +
+		"|:------|----:|:---:|\n" +
+		"| R650 | Xeon 4314 | yes |\n" +
+		"| `R750` | Xeon a\\|b | |\n" +
+		"\nOther hardware is untested.\n\n" +
+		"```\n| not | a table |\n|---|---|\n| kept | as is |\n```\n"
+
+	text := processor.extractMarkdown(content)
+
+	assert.Equal(t, "Supported servers: "+
+		"Model: R650, CPU: Xeon 4314, Certified: yes. "+
+		"Model: R750, CPU: Xeon a|b. "+
+		"Other hardware is untested. "+
+		"| not | a table | |---|---| | kept | as is |", text)
+}
+
+func TestProcessor_ExtractCSV(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	content := "host,bmc_ip,notes\nworker-0,10.0.0.5,\"rack 3, slot 2\"\nworker-1,10.0.0.6,\n"
+
+	text, err := processor.extractCSV([]byte(content), ',')
+
+	require.NoError(t, err)
+	assert.Equal(t, "host: worker-0; bmc_ip: 10.0.0.5; notes: rack 3, slot 2\nhost: worker-1; bmc_ip: 10.0.0.6", text)
+}
+
+func TestProcessor_Process_TSV(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	docs, err := processor.Process(context.Background(), strings.NewReader("host\tport\nmaster-0\t6443\n"), types.DocumentSource{
+		Path: "/docs/inventory.tsv",
+		Type: ".tsv",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "host: master-0; port: 6443", docs[0].Content)
+	assert.Contains(t, processor.SupportedTypes(), ".tsv")
+}
+
+func TestProcessor_Process_CSVCustomDelimiter(t *testing.T) {
+	processor := NewProcessorWithOptions(ProcessorOptions{
+		ChunkTokens:  1000,
+		ChunkOverlap: 200,
+		CSVDelimiter: ';',
+	})
+
+	docs, err := processor.Process(context.Background(), strings.NewReader("host;user\nbmc-0;admin\n"), types.DocumentSource{
+		Path: "/docs/bmc.csv",
+		Type: ".csv",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "host: bmc-0; user: admin", docs[0].Content)
+}
+
+func TestProcessor_Process_FrontMatter(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	content := "---\ntitle: Gathering initramfs logs\nowner: bm-platform\ntags: [rescue, boot]\npath: /ignored\n---\nBoot into **rescue** mode.\n"
+
+	docs, err := processor.Process(context.Background(), strings.NewReader(content), types.DocumentSource{
+		Path:  "/docs/initramfs.md",
+		Title: "Initramfs",
+		Type:  ".md",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "Boot into rescue mode.", docs[0].Content)
+	assert.Equal(t, "Gathering initramfs logs", docs[0].Metadata["title"])
+	assert.Equal(t, "bm-platform", docs[0].Metadata["owner"])
+	assert.Equal(t, []any{"rescue", "boot"}, docs[0].Metadata["tags"])
+	assert.Equal(t, "/docs/initramfs.md", docs[0].Metadata["path"])
+}
+
+func TestProcessor_ExtractFrontMatter_NotFrontMatter(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	content := "---\n: not yaml [\n---\nBody text.\n"
+	fields, body := processor.extractFrontMatter(content)
+
+	assert.Nil(t, fields)
+	assert.Equal(t, content, body)
+
+	fields, body = processor.extractFrontMatter("No front matter here.\n")
+	assert.Nil(t, fields)
+	assert.Equal(t, "No front matter here.\n", body)
+}
+
+func TestRedact(t *testing.T) {
+	redactions, err := NewRedactions([]string{`bmc-[0-9]+\.lab`})
+	require.NoError(t, err)
+
+	text := "Ping admin@example.com at 10.1.2.3 or fd00:1::5 on bmc-12.lab.\npassword: hunter2\nRun at 12:30:00 with std::string."
+
+	assert.Equal(t,
+		"Ping [REDACTED_EMAIL] at [REDACTED_IP] or [REDACTED_IP] on [REDACTED].\npassword: [REDACTED]\nRun at 12:30:00 with std::string.",
+		Redact(text, redactions))
+
+	_, err = NewRedactions([]string{"("})
+	assert.Error(t, err)
+}
+
+func TestProcessor_Process_Redacted(t *testing.T) {
+	processor := NewProcessorWithOptions(ProcessorOptions{
+		ChunkTokens:  1000,
+		ChunkOverlap: 200,
+		Redactions:   DefaultRedactions,
+	})
+
+	docs, err := processor.Process(context.Background(), strings.NewReader("BMC_PASSWORD=calvin for 192.168.0.10"), types.DocumentSource{
+		Path: "/docs/bmc.txt",
+		Type: ".txt",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "BMC_PASSWORD=[REDACTED] for [REDACTED_IP]", docs[0].Content)
+}
+
+func TestProcessor_Process_Code(t *testing.T) {
+	processor := NewProcessor(50, 10, nil)
+
+	content := "package provisioning\n\n" +
+		"// Reconcile drives a host towards its desired state.\n" +
+		"func (r *Reconciler) Reconcile(host *Host) error {\n" +
+		"\tif host.Ready {\n\t\treturn nil\n\t}\n\n" +
+		"\tfmt.Println(\"{\")\n" +
+		"\treturn r.provision(host)\n" +
+		"}\n\n" +
+		"func (r *Reconciler) provision(host *Host) error {\n\treturn nil\n}\n"
+
+	docs, err := processor.Process(context.Background(), strings.NewReader(content), types.DocumentSource{
+		Path: "/src/reconcile.go",
+		Type: ".go",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	assert.Equal(t, "package provisioning", docs[0].Content)
+	assert.True(t, strings.HasPrefix(docs[1].Content, "// Reconcile drives"))
+	assert.True(t, strings.HasSuffix(docs[1].Content, "\treturn r.provision(host)\n}"))
+	assert.Equal(t, "func (r *Reconciler) provision(host *Host) error {\n\treturn nil\n}", docs[2].Content)
+	assert.Equal(t, "go", docs[1].Metadata["language"])
+	assert.Contains(t, processor.SupportedTypes(), ".go")
+}
+
+func TestSplitCodeBlocks_Python(t *testing.T) {
+	content := "import os\n\n@cache\ndef load():\n    x = 1\n\n    return x\n\nclass Host:\n    pass\n"
+
+	blocks := splitCodeBlocks(content)
+
+	assert.Equal(t, []string{"import os", "@cache\ndef load():\n    x = 1\n\n    return x", "class Host:\n    pass"}, blocks)
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"Restart the provisioning service and check that the host is ready for deployment.":  "en",
+		"Starten Sie den Dienst neu und prüfen Sie, ob der Host mit dem Netz verbunden ist.": "de",
+		"ベアメタルホストを再起動して、プロビジョニングの状態を確認してください。":                                               "ja",
+		"重新启动裸机主机并检查配置状态。":                                                                   "zh",
+		"베어메탈 호스트를 다시 시작하고 프로비저닝 상태를 확인하세요.":                                                 "ko",
+		"12345 -- ***": "",
+	}
+
+	for text, expected := range tests {
+		assert.Equal(t, expected, DetectLanguage(text), text)
+	}
+}
+
+func TestProcessor_Process_CJK(t *testing.T) {
+	processor := NewProcessor(20, 5, nil)
+
+	content := strings.Repeat("ベアメタルホストを再起動します。ネットワークの設定を確認してください。", 4)
+
+	docs, err := processor.Process(context.Background(), strings.NewReader(content), types.DocumentSource{
+		Path: "/docs/runbook-ja.txt",
+		Type: ".txt",
+	})
+
+	require.NoError(t, err)
+	require.Greater(t, len(docs), 1)
+	for _, doc := range docs {
+		assert.Equal(t, "ja", doc.Metadata["language"])
+		assert.LessOrEqual(t, CountTokens(doc.Content), 20)
+		assert.True(t, utf8.ValidString(doc.Content))
+		assert.NotContains(t, doc.Content, "�")
+	}
+	assert.True(t, strings.HasSuffix(docs[0].Content, "。"))
+}
+
+func TestPDFPageErrors(t *testing.T) {
+	var failures pdfPageErrors
+	for page := 2; page <= 6; page++ {
+		failures.add(page, fmt.Errorf("malformed page content"))
+	}
+
+	err := fmt.Errorf("failed to extract %d of %d PDF pages: %w", len(failures), 10, failures)
+
+	assert.EqualError(t, err, "failed to extract 5 of 10 PDF pages: page 2: malformed page content; "+
+		"page 3: malformed page content; page 4: malformed page content; and 2 more")
+
+	var pageErrors pdfPageErrors
+	assert.ErrorAs(t, err, &pageErrors)
+}
+
+// buildBlankPDF creates a PDF of blank pages without a text layer, like a scanned document.
+func buildBlankPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+
+	kids := make([]string, pages)
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", i+3)
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestProcessor_Process_PDFOCR(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manual.pdf")
+	require.NoError(t, os.WriteFile(path, buildBlankPDF(t, 2), 0o644))
+
+	// Fake tools: pdftoppm writes the page number as the image, tesseract reads it back
+	bin := filepath.Join(dir, "bin")
+	require.NoError(t, os.Mkdir(bin, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "pdftoppm"),
+		[]byte("#!/bin/sh\nfor last; do :; done\necho \"$2\" > \"$last.png\"\n"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "tesseract"),
+		[]byte("#!/bin/sh\necho \"Scanned BMC manual page $(cat \"$1\").\"\n"), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := ProcessFile(context.Background(), path, ProcessorOptions{ChunkTokens: 500, ChunkOverlap: 50})
+	require.ErrorContains(t, err, "enable pdf_ocr for scanned documents")
+
+	documents, err := ProcessFile(context.Background(), path, ProcessorOptions{ChunkTokens: 500, ChunkOverlap: 50, PDFOCR: true})
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, "Scanned BMC manual page 1. Scanned BMC manual page 2.", documents[0].Content)
+
+	// Without the tools installed, OCR fails up front
+	t.Setenv("PATH", dir)
+	_, err = ProcessFile(context.Background(), path, ProcessorOptions{ChunkTokens: 500, ChunkOverlap: 50, PDFOCR: true})
+	require.ErrorContains(t, err, "pdf_ocr requires pdftoppm to be installed")
+}
+
+func TestFetchPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wiki/runbook":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<html><head><title>Node  Runbook &amp; Tips</title></head><body>
+<p>Power-cycle the node through the BMC before reinstalling.</p>
+<a href="dhcp#setup">DHCP</a> <a href='/wiki/bmc'>BMC</a> <a href="mailto:team@example.com">Mail</a>
+<a href="dhcp">DHCP again</a></body></html>`)
+		case "/sitemap.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0"?><urlset><url><loc>/wiki/runbook</loc></url></urlset>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	page, err := FetchPage(ctx, server.Client(), server.URL+"/wiki/runbook")
+	require.NoError(t, err)
+	assert.Equal(t, ".html", page.Type)
+	assert.Equal(t, "Node Runbook & Tips", page.Title)
+	assert.Equal(t, []string{server.URL + "/wiki/dhcp", server.URL + "/wiki/bmc"}, page.Links)
+
+	docs, err := page.Process(ctx, ProcessorOptions{ChunkTokens: 100, ChunkOverlap: 10})
+	require.NoError(t, err)
+	require.NotEmpty(t, docs)
+	assert.Equal(t, server.URL+"/wiki/runbook", docs[0].Metadata["path"])
+	assert.Contains(t, docs[0].Content, "Power-cycle the node")
+	assert.NotContains(t, docs[0].Content, "<p>")
+
+	sitemap, err := FetchPage(ctx, server.Client(), server.URL+"/sitemap.xml")
+	require.NoError(t, err)
+	assert.True(t, sitemap.Sitemap)
+	assert.Equal(t, []string{server.URL + "/wiki/runbook"}, sitemap.Links)
+
+	_, err = FetchPage(ctx, server.Client(), server.URL+"/missing")
+	assert.Error(t, err)
+}
+
+func TestCollectFiles_Ignore(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{
+		"guide.md",
+		"api/reference.md",
+		"api/overview.md",
+		"vendor/lib/README.md",
+		"notes/draft.tmp.md",
+		"notes/setup.md",
+		".git/description.md",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, path), []byte("# Doc"), 0o644))
+	}
+
+	ignore := "# generated and vendored content\napi/*\n!api/overview.md\nvendor/\n*.tmp.md\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, IgnoreFile), []byte(ignore), 0o644))
+
+	files, err := CollectFiles(root)
+	require.NoError(t, err)
+
+	var relative []string
+	for _, file := range files {
+		rel, err := filepath.Rel(root, file)
+		require.NoError(t, err)
+		relative = append(relative, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, []string{"guide.md", "api/overview.md", "notes/setup.md"}, relative)
+}
+
+func TestProcessorRegistry(t *testing.T) {
+	registry := DefaultRegistry()
+	registry.Register("RST", ExtractorFunc(func(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+		return &Extraction{
+			Sections: []Section{{Breadcrumb: "Install", Text: "Run the installer."}},
+			Metadata: map[string]any{"owner": "docs-team", "path": "ignored"},
+		}, nil
+	}))
+
+	processor := NewProcessorWithOptions(ProcessorOptions{ChunkTokens: 100, ChunkOverlap: 10, Registry: registry})
+	assert.Contains(t, processor.SupportedTypes(), ".rst")
+	assert.NotContains(t, NewProcessor(100, 10, nil).SupportedTypes(), ".rst")
+
+	docs, err := processor.Process(context.Background(), strings.NewReader("ignored"), types.DocumentSource{Path: "guide.rst", Type: ".rst"})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "Run the installer.", docs[0].Content)
+	assert.Equal(t, "Install", docs[0].Metadata["section"])
+	assert.Equal(t, "docs-team", docs[0].Metadata["owner"])
+	assert.Equal(t, "guide.rst", docs[0].Metadata["path"])
+
+	// Unregistered types are read as plain text
+	docs, err = processor.Process(context.Background(), strings.NewReader("Plain notes."), types.DocumentSource{Path: "notes.log", Type: ".log"})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "Plain notes.", docs[0].Content)
+}
+
+func TestProcessor_Process_RawContent(t *testing.T) {
+	processor := NewProcessor(12, 0, nil)
+
+	content := "Install the **operator**:\n\n```sh\noc apply -f operator.yaml\n```\n\nThen check the [status](https://example.com/status) page.\n"
+
+	docs, err := processor.Process(context.Background(), strings.NewReader(content), types.DocumentSource{
+		Path: "/docs/install.md",
+		Type: ".md",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "Install the operator: oc apply -f operator.yaml", docs[0].Content)
+	assert.Equal(t, "Install the **operator**:\n\n```sh\noc apply -f operator.yaml\n```", docs[0].Metadata["raw_content"])
+	assert.Equal(t, "Then check the status page.", docs[1].Content)
+	assert.Equal(t, "Then check the [status](https://example.com/status) page.", DisplayContent(docs[1]))
+}
+
+func TestProcessor_FormatHTML(t *testing.T) {
+	processor := NewProcessor(1000, 200, nil)
+
+	text := processor.formatHTML("<html><body><h1>Setup</h1>\n  <p>Run   <code>make</code> &amp; wait.</p><ul><li>One</li><li>Two</li></ul></body></html>")
+
+	assert.Equal(t, "Setup\n\nRun make & wait.\n\nOne\n\nTwo", text)
+}
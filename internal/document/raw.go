@@ -0,0 +1,107 @@
+package document
+
+import (
+	"regexp"
+	"strings"
+)
+
+// rawWordRe matches the words compared when lining chunks up with formatted text.
+// Punctuation and markup are ignored, since stripping formatting removes them.
+var rawWordRe = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// rawSearchWindow is how many words of formatted text are searched for each word of
+// a chunk, which skips link targets and other markup removed from the chunk.
+const rawSearchWindow = 40
+
+// rawWord is a word of formatted text and the block it is in.
+type rawWord struct {
+	word  string
+	block int
+}
+
+// rawSpans returns, for each chunk cut from the stripped form of raw, the blocks of
+// raw that the chunk was cut from, or "" where they can't be found. Chunks are in
+// document order, as chunkText returns them.
+func rawSpans(raw string, chunks []string) []string {
+	spans := make([]string, len(chunks))
+	blocks := rawBlocks(raw)
+	if len(chunks) == 1 {
+		spans[0] = strings.Join(blocks, "\n\n")
+		return spans
+	}
+
+	var words []rawWord
+	for i, block := range blocks {
+		for _, word := range rawWordRe.FindAllString(block, -1) {
+			words = append(words, rawWord{word: strings.ToLower(word), block: i})
+		}
+	}
+
+	// Each chunk starts at or after the previous one, overlap included
+	from := 0
+	for i, chunk := range chunks {
+		chunkWords := rawWordRe.FindAllString(chunk, -1)
+
+		first, last, matched := -1, -1, 0
+		pos := from
+		for _, word := range chunkWords {
+			word = strings.ToLower(word)
+
+			// The first word may be anywhere after the previous chunk's start
+			limit := len(words)
+			if first >= 0 {
+				limit = min(pos+rawSearchWindow, len(words))
+			}
+
+			for j := pos; j < limit; j++ {
+				if words[j].word == word {
+					if first < 0 {
+						first = j
+					}
+					last, pos = j, j+1
+					matched++
+					break
+				}
+			}
+		}
+
+		// Words the stripping adds, such as table column names, may be missing
+		if first < 0 || matched*2 < len(chunkWords) {
+			continue
+		}
+
+		spans[i] = strings.Join(blocks[words[first].block:words[last].block+1], "\n\n")
+		from = first
+	}
+
+	return spans
+}
+
+// rawBlocks splits formatted text into paragraphs at blank lines, keeping fenced code
+// blocks whole.
+func rawBlocks(raw string) []string {
+	var blocks []string
+	var current []string
+	inCodeBlock := false
+
+	flush := func() {
+		if block := strings.TrimSpace(strings.Join(current, "\n")); block != "" {
+			blocks = append(blocks, block)
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(raw, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+		}
+		if !inCodeBlock && strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return blocks
+}
@@ -0,0 +1,73 @@
+package document
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Redaction masks text matching a pattern before it is chunked and embedded.
+type Redaction struct {
+	Name    string
+	Pattern *regexp.Regexp
+
+	// Replacement may reference capture groups, e.g. "${1}[REDACTED]".
+	Replacement string
+}
+
+// DefaultRedactions masks emails, IP addresses, and obvious secrets.
+// Secrets are masked first so that a password which looks like an email is still caught.
+var DefaultRedactions = []Redaction{
+	{
+		Name:        "private_key",
+		Pattern:     regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		Replacement: "[REDACTED_PRIVATE_KEY]",
+	},
+	{
+		Name:        "secret",
+		Pattern:     regexp.MustCompile(`(?i)\b((?:bmc_|admin_|root_)?(?:password|passwd|pwd|secret|token|api[_-]?key)["']?\s*[:=]\s*)["']?[^\s"',]+["']?`),
+		Replacement: "${1}[REDACTED]",
+	},
+	{
+		Name:        "email",
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[REDACTED_EMAIL]",
+	},
+	{
+		Name:        "ipv6",
+		Pattern:     regexp.MustCompile(`\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b|\b(?:[0-9A-Fa-f]{1,4}:){1,6}(?::[0-9A-Fa-f]{1,4}){1,6}\b`),
+		Replacement: "[REDACTED_IP]",
+	},
+	{
+		Name:        "ipv4",
+		Pattern:     regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`),
+		Replacement: "[REDACTED_IP]",
+	},
+}
+
+// NewRedactions returns the default redactions followed by one for each extra pattern,
+// which are masked as "[REDACTED]".
+func NewRedactions(extraPatterns []string) ([]Redaction, error) {
+	redactions := append([]Redaction(nil), DefaultRedactions...)
+	for _, pattern := range extraPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+
+		redactions = append(redactions, Redaction{
+			Name:        pattern,
+			Pattern:     re,
+			Replacement: "[REDACTED]",
+		})
+	}
+
+	return redactions, nil
+}
+
+// Redact applies each redaction to text in order.
+func Redact(text string, redactions []Redaction) string {
+	for _, redaction := range redactions {
+		text = redaction.Pattern.ReplaceAllString(text, redaction.Replacement)
+	}
+	return text
+}
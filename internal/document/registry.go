@@ -0,0 +1,197 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// Extractor reads the text of one document format for chunking.
+type Extractor interface {
+	// Extract reads a document's content. The processor gives access to the
+	// configured options, such as section awareness and the CSV delimiter.
+	Extract(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error)
+
+// Extract calls f.
+func (f ExtractorFunc) Extract(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	return f(ctx, p, reader, source)
+}
+
+// Extraction is the text read from a document.
+type Extraction struct {
+	// Text is the document's text. If it is empty, the text of Sections is used.
+	Text string
+
+	// Sections, if set, are chunked separately and their breadcrumbs recorded
+	// in Metadata["section"].
+	Sections []Section
+
+	// Raw, if set, is Text as written in the document, with the formatting that Text
+	// strips. Each chunk records the part it was cut from in Metadata["raw_content"].
+	Raw string
+
+	// Metadata is added to every chunk, e.g. Markdown front matter. Keys owned by
+	// the processor, such as "path", are ignored.
+	Metadata map[string]any
+}
+
+// ProcessorRegistry maps file extensions to the extractors that read them.
+type ProcessorRegistry struct {
+	extractors map[string]Extractor
+}
+
+// NewProcessorRegistry creates an empty registry.
+func NewProcessorRegistry() *ProcessorRegistry {
+	return &ProcessorRegistry{extractors: make(map[string]Extractor)}
+}
+
+// DefaultRegistry returns a new registry with the built-in formats: Markdown, plain
+// text, HTML, PDF, DOCX, EPUB, CSV/TSV, and source code. Extractors registered on it
+// don't affect other registries.
+func DefaultRegistry() *ProcessorRegistry {
+	r := NewProcessorRegistry()
+	r.Register(".md", ExtractorFunc(extractMarkdownDocument))
+	r.Register(".markdown", ExtractorFunc(extractMarkdownDocument))
+	r.Register(".txt", ExtractorFunc(extractPlainText))
+	r.Register(".html", ExtractorFunc(extractHTMLDocument))
+	r.Register(".htm", ExtractorFunc(extractHTMLDocument))
+	r.Register(".pdf", ExtractorFunc(extractPDFDocument))
+	r.Register(".docx", ExtractorFunc(extractDOCXDocument))
+	r.Register(".epub", ExtractorFunc(extractEPUBDocument))
+	r.Register(".csv", ExtractorFunc(extractCSVDocument))
+	r.Register(".tsv", ExtractorFunc(extractCSVDocument))
+
+	// Source code keeps its formatting; it is chunked on declaration boundaries
+	for ext := range codeLanguages {
+		r.Register(ext, ExtractorFunc(extractPlainText))
+	}
+
+	return r
+}
+
+// defaultRegistry serves processors created without a registry and IsSupportedFile.
+var defaultRegistry = DefaultRegistry()
+
+// Register makes extractor handle files with the extension ext, such as ".md",
+// replacing any extractor already registered for it.
+func (r *ProcessorRegistry) Register(ext string, extractor Extractor) {
+	r.extractors[normalizeExtension(ext)] = extractor
+}
+
+// Lookup returns the extractor registered for the extension ext.
+func (r *ProcessorRegistry) Lookup(ext string) (Extractor, bool) {
+	extractor, ok := r.extractors[normalizeExtension(ext)]
+	return extractor, ok
+}
+
+// Extensions returns the registered extensions in sorted order.
+func (r *ProcessorRegistry) Extensions() []string {
+	extensions := make([]string, 0, len(r.extractors))
+	for ext := range r.extractors {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+// normalizeExtension lowercases ext and adds the leading dot if it is missing.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// extractPlainText uses the content as is.
+func extractPlainText(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	return &Extraction{Text: string(content)}, nil
+}
+
+// extractMarkdownDocument strips Markdown syntax, turning front matter into metadata.
+// Section-aware processors split the text per header section to keep header context.
+func extractMarkdownDocument(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	frontMatter, body := p.extractFrontMatter(string(content))
+	if p.sectionAware {
+		return &Extraction{Sections: p.extractMarkdownSections(body), Metadata: frontMatter}, nil
+	}
+	return &Extraction{Text: p.extractMarkdown(body), Raw: strings.TrimSpace(body), Metadata: frontMatter}, nil
+}
+
+// extractHTMLDocument strips HTML markup.
+func extractHTMLDocument(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	return &Extraction{Text: p.extractHTML(string(content)), Raw: p.formatHTML(string(content))}, nil
+}
+
+// extractPDFDocument reads the PDF at the source path, which it needs for random access.
+func extractPDFDocument(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	text, err := p.extractPDF(ctx, source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract PDF text: %w", err)
+	}
+	return &Extraction{Text: text}, nil
+}
+
+// extractDOCXDocument reads a Word document's paragraphs.
+func extractDOCXDocument(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	// DOCX files are zip archives and need random access to their contents
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	text, err := p.extractDOCX(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract DOCX text: %w", err)
+	}
+	return &Extraction{Text: text}, nil
+}
+
+// extractEPUBDocument reads an EPUB book, one section per chapter.
+func extractEPUBDocument(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	sections, err := p.extractEPUB(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract EPUB text: %w", err)
+	}
+	return &Extraction{Sections: sections}, nil
+}
+
+// extractCSVDocument renders delimited rows as "header: value" lines.
+func extractCSVDocument(ctx context.Context, p *Processor, reader io.Reader, source types.DocumentSource) (*Extraction, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	text, err := p.extractCSV(content, p.delimiterFor(source.Type))
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract CSV text: %w", err)
+	}
+	return &Extraction{Text: text}, nil
+}
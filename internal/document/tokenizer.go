@@ -0,0 +1,151 @@
+package document
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// llama3SplitPattern approximates the Llama 3 / cl100k pre-tokenizer regex.
+// Go's RE2 engine lacks lookahead, so trailing whitespace handling differs slightly.
+var llama3SplitPattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// BPETokenizer implements byte-level BPE tokenization using tiktoken-style merge ranks.
+type BPETokenizer struct {
+	encoder map[string]int
+	decoder map[int]string
+}
+
+// Ensure BPETokenizer implements the Tokenizer interface
+var _ types.Tokenizer = (*BPETokenizer)(nil)
+
+// NewBPETokenizer creates a tokenizer from a token-to-rank mapping.
+func NewBPETokenizer(ranks map[string]int) *BPETokenizer {
+	decoder := make(map[int]string, len(ranks))
+	for token, rank := range ranks {
+		decoder[rank] = token
+	}
+
+	return &BPETokenizer{
+		encoder: ranks,
+		decoder: decoder,
+	}
+}
+
+// LoadBPETokenizer reads a tiktoken ranks file such as Llama 3's tokenizer.model.
+// Each line contains a base64-encoded token followed by its rank.
+func LoadBPETokenizer(path string) (*BPETokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tokenizer file: %w", err)
+	}
+	defer file.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid tokenizer entry on line %d", lineNum)
+		}
+
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token encoding on line %d: %w", lineNum, err)
+		}
+
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token rank on line %d: %w", lineNum, err)
+		}
+
+		ranks[string(token)] = rank
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer file: %w", err)
+	}
+
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("tokenizer file contains no tokens: %s", path)
+	}
+
+	return NewBPETokenizer(ranks), nil
+}
+
+// Encode converts text into token IDs.
+func (t *BPETokenizer) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range llama3SplitPattern.FindAllString(text, -1) {
+		if rank, ok := t.encoder[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, t.bytePairEncode([]byte(piece))...)
+	}
+	return tokens
+}
+
+// Decode converts token IDs back into text.
+func (t *BPETokenizer) Decode(tokens []int) string {
+	var text strings.Builder
+	for _, token := range tokens {
+		text.WriteString(t.decoder[token])
+	}
+
+	// Token windows may split multi-byte characters at their edges
+	return strings.ToValidUTF8(text.String(), "")
+}
+
+// Count returns the number of tokens in the text.
+func (t *BPETokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// bytePairEncode merges the bytes of a single pre-token by ascending rank.
+func (t *BPETokenizer) bytePairEncode(piece []byte) []int {
+	parts := make([]string, len(piece))
+	for i, b := range piece {
+		parts[i] = string([]byte{b})
+	}
+
+	for len(parts) > 1 {
+		bestRank := -1
+		bestIdx := -1
+		for i := 0; i < len(parts)-1; i++ {
+			rank, ok := t.encoder[parts[i]+parts[i+1]]
+			if ok && (bestRank == -1 || rank < bestRank) {
+				bestRank = rank
+				bestIdx = i
+			}
+		}
+
+		if bestIdx == -1 {
+			break
+		}
+
+		parts[bestIdx] += parts[bestIdx+1]
+		parts = append(parts[:bestIdx+1], parts[bestIdx+2:]...)
+	}
+
+	tokens := make([]int, 0, len(parts))
+	for _, part := range parts {
+		if rank, ok := t.encoder[part]; ok {
+			tokens = append(tokens, rank)
+		}
+	}
+	return tokens
+}
@@ -4,26 +4,183 @@ package prompt
 import (
 	"fmt"
 	"os"
+	"os/user"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/mabulgu/pawdy/internal/document"
 	"github.com/mabulgu/pawdy/pkg/types"
 )
 
 // Builder constructs prompts with context and formatting.
 type Builder struct {
 	systemPromptPath string
-	systemPrompt     string
+
+	// mu guards systemPrompt, which is loaded and expanded on first use by concurrent
+	// requests; expanded records that it has been.
+	mu           sync.Mutex
+	systemPrompt string
+	expanded     bool
+	strictVars   bool
+
+	historyTurns  int
+	historyTokens int
+	contextWindow int
+	maxTokens     int
+	tokenizer     types.Tokenizer
+	citationStyle string
+	language      string
 }
 
+// Default limits on how much conversation history is folded into a prompt.
+const (
+	defaultHistoryTurns  = 4
+	defaultHistoryTokens = 1024
+)
+
+// Citation styles select how FormatResponse lists the sources of an answer.
+const (
+	CitationMarkdown = "markdown" // a **Sources:** block, for rendered markdown (default)
+	CitationPlain    = "plain"    // the same list without markdown, for terminals
+	CitationInline   = "inline"   // [n] markers in the answer, with the list as footnotes
+	CitationNone     = "none"     // the answer alone
+)
+
+// LanguageAuto asks for answers in the language of the question, whatever the
+// language of the documentation.
+const LanguageAuto = "auto"
+
+// placeholder matches a ${NAME} placeholder in the system prompt.
+var placeholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// builtinPlaceholders fill system prompt placeholders whose environment variable is
+// unset, as HOSTNAME usually is outside interactive shells.
+var builtinPlaceholders = map[string]func() (string, error){
+	"HOSTNAME": os.Hostname,
+	"USER": func() (string, error) {
+		u, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		return u.Username, nil
+	},
+}
+
+// sourceMention matches "[Source 2]" or "(Source 2)" in an answer, following the
+// "### Source N" labels of the RAG prompt.
+var sourceMention = regexp.MustCompile(`[\[(]Source (\d+)[\])]`)
+
 // NewBuilder creates a new prompt builder.
-func NewBuilder(systemPromptPath string) *Builder {
+// systemPrompt is either a path to a prompt file or, see IsInlinePrompt, the prompt text itself.
+func NewBuilder(systemPrompt string) *Builder {
+	if IsInlinePrompt(systemPrompt) {
+		return &Builder{
+			systemPrompt:  systemPrompt,
+			historyTurns:  defaultHistoryTurns,
+			historyTokens: defaultHistoryTokens,
+		}
+	}
+
 	return &Builder{
-		systemPromptPath: systemPromptPath,
+		systemPromptPath: systemPrompt,
+		historyTurns:     defaultHistoryTurns,
+		historyTokens:    defaultHistoryTokens,
+	}
+}
+
+// IsInlinePrompt reports whether a system prompt setting is the prompt text rather
+// than a file path: it contains whitespace and does not name an existing file.
+func IsInlinePrompt(value string) bool {
+	if !strings.ContainsAny(value, " \t\n") {
+		return false
+	}
+
+	_, err := os.Stat(value)
+	return err != nil
+}
+
+// SetHistoryLimits bounds the conversation history included in prompts to the
+// most recent maxTurns user/assistant exchanges and roughly maxTokens tokens.
+func (b *Builder) SetHistoryLimits(maxTurns, maxTokens int) {
+	b.historyTurns = maxTurns
+	b.historyTokens = maxTokens
+}
+
+// SetCitationStyle sets how FormatResponse cites sources: CitationMarkdown,
+// CitationPlain, CitationInline, or CitationNone. An empty style means CitationMarkdown.
+func (b *Builder) SetCitationStyle(style string) {
+	b.citationStyle = style
+}
+
+// SetResponseLanguage sets the language answers are requested in, such as "Japanese".
+// LanguageAuto or an empty language asks for the language of the question.
+func (b *Builder) SetResponseLanguage(language string) {
+	b.language = strings.TrimSpace(language)
+}
+
+// SetStrictVariables makes BuildSystemPrompt fail on ${NAME} placeholders that name
+// neither a set environment variable nor a built-in, instead of leaving them as written.
+func (b *Builder) SetStrictVariables(strict bool) {
+	b.strictVars = strict
+}
+
+// SetContextBudget makes FitContext keep prompts within a model's context window of
+// contextWindow tokens, reserving maxTokens for the answer. If tokenizer is nil,
+// token counts are estimated at 4 characters per token.
+func (b *Builder) SetContextBudget(contextWindow, maxTokens int, tokenizer types.Tokenizer) {
+	b.contextWindow = contextWindow
+	b.maxTokens = maxTokens
+	b.tokenizer = tokenizer
+}
+
+// FitContext drops retrieved documents, lowest score first, until the system prompt,
+// the RAG prompt, and the reserved answer tokens fit in the context window.
+// It returns the documents to use and how many were dropped. Without a budget
+// (see SetContextBudget), all documents are kept.
+func (b *Builder) FitContext(systemPrompt string, history []types.Message, query string, docs []*types.Document) ([]*types.Document, int) {
+	if b.contextWindow <= 0 {
+		return docs, 0
+	}
+
+	kept := append([]*types.Document(nil), docs...)
+	for len(kept) > 0 {
+		prompt := b.BuildConversationalRAGPrompt(history, query, kept)
+		if b.countTokens(systemPrompt)+b.countTokens(prompt)+b.maxTokens <= b.contextWindow {
+			break
+		}
+
+		// Drop the weakest document, keeping the others in order
+		weakest := 0
+		for i, doc := range kept {
+			if doc.Score < kept[weakest].Score {
+				weakest = i
+			}
+		}
+		kept = append(kept[:weakest], kept[weakest+1:]...)
 	}
+
+	return kept, len(docs) - len(kept)
+}
+
+// countTokens counts tokens with the configured tokenizer, or estimates them.
+func (b *Builder) countTokens(text string) int {
+	if b.tokenizer != nil {
+		return b.tokenizer.Count(text)
+	}
+	return document.CountTokens(text)
 }
 
 // BuildRAGPrompt creates a prompt with retrieved context.
 func (b *Builder) BuildRAGPrompt(query string, context []*types.Document) string {
+	return b.BuildConversationalRAGPrompt(nil, query, context)
+}
+
+// BuildConversationalRAGPrompt creates a prompt with retrieved context and recent
+// conversation turns, so follow-up questions can refer to earlier answers.
+func (b *Builder) BuildConversationalRAGPrompt(history []types.Message, query string, context []*types.Document) string {
 	var contextText strings.Builder
 	
 	if len(context) > 0 {
@@ -38,6 +195,16 @@ func (b *Builder) BuildRAGPrompt(query string, context []*types.Document) string
 			} else if path, ok := doc.Metadata["path"].(string); ok && path != "" {
 				contextText.WriteString(fmt.Sprintf(" - %s", path))
 			}
+
+			// Add section breadcrumb so the model knows which procedure a chunk belongs to
+			if section, ok := doc.Metadata["section"].(string); ok && section != "" {
+				contextText.WriteString(fmt.Sprintf(" (%s)", section))
+			}
+
+			// Add the owning team from front matter so answers can point to the right people
+			if owner, ok := doc.Metadata["owner"].(string); ok && owner != "" {
+				contextText.WriteString(fmt.Sprintf(" [owner: %s]", owner))
+			}
 			
 			contextText.WriteString(":\n")
 			contextText.WriteString(doc.Content)
@@ -47,6 +214,19 @@ func (b *Builder) BuildRAGPrompt(query string, context []*types.Document) string
 		contextText.WriteString("---\n\n")
 	}
 	
+	// Add recent conversation turns
+	if turns := b.recentHistory(history); len(turns) > 0 {
+		contextText.WriteString("Conversation so far:\n\n")
+		for _, msg := range turns {
+			role := "User"
+			if msg.Role == "assistant" {
+				role = "Assistant"
+			}
+			contextText.WriteString(fmt.Sprintf("%s: %s\n\n", role, strings.TrimSpace(msg.Content)))
+		}
+		contextText.WriteString("---\n\n")
+	}
+
 	// Build the final prompt
 	prompt := contextText.String()
 	prompt += fmt.Sprintf("Question: %s\n\n", query)
@@ -59,35 +239,116 @@ func (b *Builder) BuildRAGPrompt(query string, context []*types.Document) string
 		prompt += "Please answer this question about OpenShift Bare Metal operations. "
 		prompt += "Provide detailed, practical guidance where possible."
 	}
+
+	// The documentation is mostly English, which would otherwise pull answers into English
+	if b.language == "" || strings.EqualFold(b.language, LanguageAuto) {
+		prompt += "\n\nAnswer in the same language as the question."
+	} else {
+		prompt += fmt.Sprintf("\n\nAnswer in %s, even where the question or context is in another language.", b.language)
+	}
 	
 	return prompt
 }
 
-// BuildSystemPrompt loads and formats the system prompt.
+// recentHistory returns the newest user and assistant messages that fit within
+// the turn and token budgets, in chronological order.
+func (b *Builder) recentHistory(history []types.Message) []types.Message {
+	maxMessages := b.historyTurns * 2
+	tokens := 0
+
+	var selected []types.Message
+	for i := len(history) - 1; i >= 0 && len(selected) < maxMessages; i-- {
+		msg := history[i]
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+
+		msgTokens := document.CountTokens(msg.Content)
+		if tokens+msgTokens > b.historyTokens {
+			break
+		}
+		tokens += msgTokens
+
+		selected = append(selected, msg)
+	}
+
+	// Restore chronological order
+	for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+		selected[i], selected[j] = selected[j], selected[i]
+	}
+
+	return selected
+}
+
+// BuildSystemPrompt loads and formats the system prompt. ${NAME} placeholders are
+// replaced with the environment variable NAME or, if it is unset, the built-in
+// ${USER} and ${HOSTNAME}; see SetStrictVariables for the others.
 func (b *Builder) BuildSystemPrompt() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	// Return cached prompt if available
-	if b.systemPrompt != "" {
+	if b.expanded {
 		return b.systemPrompt, nil
 	}
-	
-	// Load from file if path is provided
-	if b.systemPromptPath != "" {
+
+	systemPrompt := b.systemPrompt
+	switch {
+	case systemPrompt != "":
+		// Inline prompt text
+	case b.systemPromptPath != "":
+		// Load from file if path is provided
 		content, err := os.ReadFile(b.systemPromptPath)
 		if err != nil {
 			return "", fmt.Errorf("failed to read system prompt file: %w", err)
 		}
-		b.systemPrompt = string(content)
-		return b.systemPrompt, nil
+		systemPrompt = string(content)
+	default:
+		// Use default system prompt
+		systemPrompt = DefaultSystemPrompt()
 	}
-	
-	// Use default system prompt
-	b.systemPrompt = getDefaultSystemPrompt()
+
+	systemPrompt, err := expandVariables(systemPrompt, b.strictVars)
+	if err != nil {
+		return "", err
+	}
+
+	b.systemPrompt = systemPrompt
+	b.expanded = true
 	return b.systemPrompt, nil
 }
 
-// FormatResponse formats the final response with citations.
+// expandVariables replaces the ${NAME} placeholders in text. Unknown names are left
+// as written, or reported together if strict is set.
+func expandVariables(text string, strict bool) (string, error) {
+	var unknown []string
+	expanded := placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		if builtin, ok := builtinPlaceholders[name]; ok {
+			if value, err := builtin(); err == nil {
+				return value
+			}
+		}
+
+		if !slices.Contains(unknown, name) {
+			unknown = append(unknown, name)
+		}
+		return match
+	})
+
+	if strict && len(unknown) > 0 {
+		return "", fmt.Errorf("system prompt uses unset variables: %s", strings.Join(unknown, ", "))
+	}
+	return expanded, nil
+}
+
+// FormatResponse formats the final response with citations in the configured style
+// (see SetCitationStyle).
 func (b *Builder) FormatResponse(response string, sources []*types.Document) string {
-	if len(sources) == 0 {
+	if len(sources) == 0 || b.citationStyle == CitationNone {
 		return response
 	}
 	
@@ -95,10 +356,20 @@ func (b *Builder) FormatResponse(response string, sources []*types.Document) str
 	formatted := strings.TrimSpace(response)
 	
 	// Add sources section
-	formatted += "\n\n**Sources:**\n"
+	switch b.citationStyle {
+	case CitationPlain:
+		formatted += "\n\nSources:\n"
+	case CitationInline:
+		// Turn the model's "(Source 2)" mentions into footnote markers
+		formatted = sourceMention.ReplaceAllString(formatted, "[$1]")
+		formatted += "\n\n"
+	default:
+		formatted += "\n\n**Sources:**\n"
+	}
 	
-	for i, source := range sources {
-		sourceRef := fmt.Sprintf("[%d]", i+1)
+	for _, group := range GroupSources(sources) {
+		source := sources[group.Best]
+		sourceRef := fmt.Sprintf("[%s]", JoinNumbers(group.Numbers))
 		
 		// Add title or path
 		if title, ok := source.Metadata["title"].(string); ok && title != "" {
@@ -108,8 +379,16 @@ func (b *Builder) FormatResponse(response string, sources []*types.Document) str
 		} else {
 			formatted += fmt.Sprintf("%s Document %s", sourceRef, source.ID)
 		}
+
+		if owner, ok := source.Metadata["owner"].(string); ok && owner != "" {
+			formatted += fmt.Sprintf(" [owner: %s]", owner)
+		}
+
+		if ingestedAt, ok := document.IngestedAt(source.Metadata); ok {
+			formatted += fmt.Sprintf(" [ingested: %s]", ingestedAt.Format("2006-01-02"))
+		}
 		
-		// Add relevance score
+		// Add the best relevance score among the document's chunks
 		if source.Score > 0 {
 			formatted += fmt.Sprintf(" (relevance: %.1f%%)", source.Score*100)
 		}
@@ -120,8 +399,49 @@ func (b *Builder) FormatResponse(response string, sources []*types.Document) str
 	return formatted
 }
 
-// getDefaultSystemPrompt returns the default system prompt for Pawdy.
-func getDefaultSystemPrompt() string {
+// SourceGroup is one document cited by one or more retrieved chunks.
+type SourceGroup struct {
+	Best    int   // index in the sources of the document's highest-scoring chunk
+	Numbers []int // 1-based source numbers, matching "### Source N" in the prompt
+	Chunks  []int // 1-based positions of the chunks in the document, where recorded
+}
+
+// GroupSources merges chunks that come from the same file, keeping the order in
+// which each file first appears. Chunks without a path are kept apart.
+func GroupSources(sources []*types.Document) []*SourceGroup {
+	var groups []*SourceGroup
+	byPath := make(map[string]*SourceGroup)
+	for i, source := range sources {
+		path, _ := source.Metadata["path"].(string)
+		group, ok := byPath[path]
+		if !ok || path == "" {
+			group = &SourceGroup{Best: i}
+			groups = append(groups, group)
+			if path != "" {
+				byPath[path] = group
+			}
+		} else if source.Score > sources[group.Best].Score {
+			group.Best = i
+		}
+		group.Numbers = append(group.Numbers, i+1)
+		if index, ok := document.ChunkIndex(source.Metadata); ok {
+			group.Chunks = append(group.Chunks, index+1)
+		}
+	}
+	return groups
+}
+
+// JoinNumbers renders source or chunk numbers as "1, 3".
+func JoinNumbers(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DefaultSystemPrompt returns the system prompt used when no system_prompt is configured.
+func DefaultSystemPrompt() string {
 	return `You are Pawdy, a helpful AI assistant specializing in OpenShift Bare Metal operations and onboarding. You help engineers learn about bare metal infrastructure, troubleshooting, and best practices.
 
 Your personality:
@@ -3,6 +3,7 @@ package prompt
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/mabulgu/pawdy/pkg/types"
@@ -48,6 +49,84 @@ func TestBuilder_BuildRAGPrompt(t *testing.T) {
 	assert.Contains(t, prompt, "based on the provided context")
 }
 
+func TestBuilder_BuildRAGPrompt_Section(t *testing.T) {
+	builder := NewBuilder("")
+
+	docs := []*types.Document{
+		{
+			ID:      "doc1",
+			Content: "Configure the DHCP range for the provisioning network.",
+			Metadata: map[string]any{
+				"title":   "Networking Guide",
+				"section": "Networking > DHCP setup",
+			},
+		},
+	}
+
+	prompt := builder.BuildRAGPrompt("How do I set up DHCP?", docs)
+
+	assert.Contains(t, prompt, "Source 1 - Networking Guide (Networking > DHCP setup):")
+}
+
+func TestBuilder_BuildConversationalRAGPrompt(t *testing.T) {
+	builder := NewBuilder("")
+
+	history := []types.Message{
+		{Role: "user", Content: "How do I gather initramfs logs?"},
+		{Role: "assistant", Content: "First, boot into rescue mode. Second, run journalctl."},
+	}
+
+	prompt := builder.BuildConversationalRAGPrompt(history, "What about the second step?", nil)
+
+	assert.Contains(t, prompt, "Conversation so far:")
+	assert.Contains(t, prompt, "User: How do I gather initramfs logs?")
+	assert.Contains(t, prompt, "Assistant: First, boot into rescue mode.")
+	assert.Less(t, strings.Index(prompt, "Conversation so far:"), strings.Index(prompt, "Question: What about the second step?"))
+}
+
+func TestBuilder_FitContext(t *testing.T) {
+	builder := NewBuilder("")
+	docs := []*types.Document{
+		{ID: "strong", Content: strings.Repeat("a", 400), Score: 0.9},
+		{ID: "weak", Content: strings.Repeat("b", 400), Score: 0.5},
+		{ID: "medium", Content: strings.Repeat("c", 400), Score: 0.7},
+	}
+
+	kept, dropped := builder.FitContext("system", nil, "question?", docs)
+	assert.Len(t, kept, 3)
+	assert.Equal(t, 0, dropped)
+
+	// Each document is ~100 estimated tokens, so only two fit alongside the answer budget
+	builder.SetContextBudget(400, 100, nil)
+	kept, dropped = builder.FitContext("system", nil, "question?", docs)
+	require.Len(t, kept, 2)
+	assert.Equal(t, 1, dropped)
+	assert.Equal(t, "strong", kept[0].ID)
+	assert.Equal(t, "medium", kept[1].ID)
+	assert.Len(t, docs, 3)
+}
+
+func TestBuilder_BuildConversationalRAGPrompt_Limits(t *testing.T) {
+	builder := NewBuilder("")
+	builder.SetHistoryLimits(1, 1000)
+
+	history := []types.Message{
+		{Role: "user", Content: "old question"},
+		{Role: "assistant", Content: "old answer"},
+		{Role: "user", Content: "recent question"},
+		{Role: "assistant", Content: "recent answer"},
+	}
+
+	prompt := builder.BuildConversationalRAGPrompt(history, "follow-up", nil)
+	assert.NotContains(t, prompt, "old question")
+	assert.Contains(t, prompt, "User: recent question")
+
+	// A token budget too small for any message drops history entirely
+	builder.SetHistoryLimits(4, 1)
+	prompt = builder.BuildConversationalRAGPrompt(history, "follow-up", nil)
+	assert.NotContains(t, prompt, "Conversation so far:")
+}
+
 func TestBuilder_BuildRAGPrompt_NoContext(t *testing.T) {
 	builder := NewBuilder("")
 	
@@ -58,6 +137,15 @@ func TestBuilder_BuildRAGPrompt_NoContext(t *testing.T) {
 	assert.Contains(t, prompt, "OpenShift Bare Metal operations")
 }
 
+func TestBuilder_BuildRAGPrompt_ResponseLanguage(t *testing.T) {
+	builder := NewBuilder("")
+	assert.True(t, strings.HasSuffix(builder.BuildRAGPrompt("DHCP の設定方法は?", nil), "Answer in the same language as the question."))
+
+	builder.SetResponseLanguage("Japanese")
+	assert.True(t, strings.HasSuffix(builder.BuildRAGPrompt("How do I configure DHCP?", nil),
+		"Answer in Japanese, even where the question or context is in another language."))
+}
+
 func TestBuilder_BuildSystemPrompt_File(t *testing.T) {
 	// Create a temporary system prompt file
 	tempDir := t.TempDir()
@@ -97,6 +185,44 @@ func TestBuilder_BuildSystemPrompt_FileNotFound(t *testing.T) {
 	assert.Contains(t, err.Error(), "failed to read system prompt file")
 }
 
+func TestBuilder_BuildSystemPrompt_Inline(t *testing.T) {
+	builder := NewBuilder("You are a terse SRE. Answer in one sentence.")
+
+	systemPrompt, err := builder.BuildSystemPrompt()
+
+	require.NoError(t, err)
+	assert.Equal(t, "You are a terse SRE. Answer in one sentence.", systemPrompt)
+}
+
+func TestBuilder_BuildSystemPrompt_Variables(t *testing.T) {
+	t.Setenv("PAWDY_TEST_CLUSTER", "edge-02")
+	t.Setenv("HOSTNAME", "")
+	os.Unsetenv("HOSTNAME")
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	builder := NewBuilder("You help with ${PAWDY_TEST_CLUSTER} on ${HOSTNAME} for ${PAWDY_TEST_TEAM}.")
+	systemPrompt, err := builder.BuildSystemPrompt()
+	require.NoError(t, err)
+	assert.Equal(t, "You help with edge-02 on "+hostname+" for ${PAWDY_TEST_TEAM}.", systemPrompt)
+
+	strict := NewBuilder("You help with ${PAWDY_TEST_CLUSTER} for ${PAWDY_TEST_TEAM}.")
+	strict.SetStrictVariables(true)
+	_, err = strict.BuildSystemPrompt()
+	assert.ErrorContains(t, err, "unset variables: PAWDY_TEST_TEAM")
+}
+
+func TestIsInlinePrompt(t *testing.T) {
+	dir := t.TempDir()
+	spacedPath := filepath.Join(dir, "my prompt.md")
+	require.NoError(t, os.WriteFile(spacedPath, []byte("From file"), 0644))
+
+	assert.True(t, IsInlinePrompt("You are Pawdy, a helpful assistant."))
+	assert.False(t, IsInlinePrompt("./assets/system_prompt.md"))
+	assert.False(t, IsInlinePrompt(spacedPath))
+	assert.False(t, IsInlinePrompt(""))
+}
+
 func TestBuilder_FormatResponse(t *testing.T) {
 	builder := NewBuilder("")
 	
@@ -129,6 +255,40 @@ func TestBuilder_FormatResponse(t *testing.T) {
 	assert.Contains(t, formatted, "relevance: 72.0%")
 }
 
+func TestBuilder_Owner(t *testing.T) {
+	builder := NewBuilder("")
+
+	sources := []*types.Document{
+		{
+			ID:      "doc1",
+			Content: "Boot into rescue mode.",
+			Metadata: map[string]any{
+				"title": "Gathering initramfs logs",
+				"owner": "bm-platform",
+			},
+		},
+	}
+
+	prompt := builder.BuildRAGPrompt("How do I gather initramfs logs?", sources)
+	assert.Contains(t, prompt, "### Source 1 - Gathering initramfs logs [owner: bm-platform]:")
+
+	formatted := builder.FormatResponse("Use rescue mode.", sources)
+	assert.Contains(t, formatted, "[1] Gathering initramfs logs [owner: bm-platform]")
+}
+
+func TestBuilder_FormatResponse_IngestedAt(t *testing.T) {
+	builder := NewBuilder("")
+
+	sources := []*types.Document{
+		{ID: "doc1", Metadata: map[string]any{"path": "/docs/network.md", "ingested_at": "2025-05-11T09:30:00Z"}},
+		{ID: "doc2", Metadata: map[string]any{"path": "/docs/storage.md"}},
+	}
+
+	formatted := builder.FormatResponse("Use the provisioning network.", sources)
+	assert.Contains(t, formatted, "[1] /docs/network.md [ingested: 2025-05-11]")
+	assert.Contains(t, formatted, "[2] /docs/storage.md\n")
+}
+
 func TestBuilder_FormatResponse_NoSources(t *testing.T) {
 	builder := NewBuilder("")
 	
@@ -138,3 +298,54 @@ func TestBuilder_FormatResponse_NoSources(t *testing.T) {
 	assert.Equal(t, response, formatted)
 	assert.NotContains(t, formatted, "**Sources:**")
 }
+
+func TestBuilder_FormatResponse_GroupsByPath(t *testing.T) {
+	builder := NewBuilder("")
+
+	sources := []*types.Document{
+		{ID: "doc1", Score: 0.61, Metadata: map[string]any{"title": "Runbook", "path": "/docs/runbook.md", "chunk_id": 4}},
+		{ID: "doc2", Score: 0.58, Metadata: map[string]any{"path": "/docs/network.md"}},
+		{ID: "doc3", Score: 0.74, Metadata: map[string]any{"title": "Runbook", "path": "/docs/runbook.md", "chunk_id": 1}},
+		{ID: "doc4", Score: 0.40},
+		{ID: "doc5", Score: 0.35},
+	}
+
+	formatted := builder.FormatResponse("Reboot the host.", sources)
+	assert.Contains(t, formatted, "[1, 3] Runbook (relevance: 74.0%)\n")
+	assert.Contains(t, formatted, "[2] /docs/network.md (relevance: 58.0%)\n")
+	assert.Contains(t, formatted, "[4] Document doc4")
+	assert.Contains(t, formatted, "[5] Document doc5")
+	assert.Equal(t, 1, strings.Count(formatted, "Runbook"))
+
+	groups := GroupSources(sources)
+	require.Len(t, groups, 4)
+	assert.Equal(t, &SourceGroup{Best: 2, Numbers: []int{1, 3}, Chunks: []int{5, 2}}, groups[0])
+	assert.Equal(t, &SourceGroup{Best: 1, Numbers: []int{2}}, groups[1])
+	assert.Equal(t, "5, 2", JoinNumbers(groups[0].Chunks))
+}
+
+func TestBuilder_FormatResponse_CitationStyle(t *testing.T) {
+	sources := []*types.Document{
+		{ID: "doc1", Score: 0.85, Metadata: map[string]any{"title": "Network Configuration"}},
+		{ID: "doc2", Score: 0.72, Metadata: map[string]any{"path": "/docs/troubleshooting.md"}},
+	}
+	response := "Configure the bond first (Source 1). Then check the logs [Source 2]."
+
+	builder := NewBuilder("")
+	builder.SetCitationStyle(CitationPlain)
+	formatted := builder.FormatResponse(response, sources)
+	assert.Contains(t, formatted, "\n\nSources:\n[1] Network Configuration (relevance: 85.0%)\n")
+	assert.NotContains(t, formatted, "**")
+
+	builder.SetCitationStyle(CitationInline)
+	formatted = builder.FormatResponse(response, sources)
+	assert.Equal(t, "Configure the bond first [1]. Then check the logs [2].\n\n"+
+		"[1] Network Configuration (relevance: 85.0%)\n"+
+		"[2] /docs/troubleshooting.md (relevance: 72.0%)\n", formatted)
+
+	builder.SetCitationStyle(CitationNone)
+	assert.Equal(t, response, builder.FormatResponse(response, sources))
+
+	builder.SetCitationStyle(CitationMarkdown)
+	assert.Contains(t, builder.FormatResponse(response, sources), "**Sources:**")
+}
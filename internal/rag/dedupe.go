@@ -0,0 +1,104 @@
+package rag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// ChunkHash returns the hash stored in Metadata["chunk_hash"], used to spot chunks
+// with identical content. Surrounding whitespace is ignored.
+func ChunkHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// chunkHash returns a document's stored chunk hash, computing and storing it if missing.
+func chunkHash(doc *types.Document) string {
+	if hash, ok := doc.Metadata["chunk_hash"].(string); ok && hash != "" {
+		return hash
+	}
+
+	hash := ChunkHash(doc.Content)
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]any)
+	}
+	doc.Metadata["chunk_hash"] = hash
+	return hash
+}
+
+// duplicatePathsKey is the metadata field listing the other sources that contain a stored
+// chunk. DeleteSource hands the chunk to the first of them when its own source is removed,
+// so content shared between files outlives any one of them.
+const duplicatePathsKey = "duplicate_paths"
+
+// duplicatePaths returns the duplicate_paths of a stored chunk's metadata.
+func duplicatePaths(metadata map[string]any) []string {
+	var paths []string
+	switch value := metadata[duplicatePathsKey].(type) {
+	case []string:
+		paths = append(paths, value...)
+	case []any:
+		for _, item := range value {
+			if path, ok := item.(string); ok {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// withDuplicatePath returns paths with path added, or nil if path is owner or already listed.
+func withDuplicatePath(paths []string, owner, path string) []string {
+	if path == "" || path == owner || slices.Contains(paths, path) {
+		return nil
+	}
+	return append(paths, path)
+}
+
+// uniqueDocuments drops documents that duplicate an earlier document in the batch or,
+// according to indexed, a chunk already in the store; indexed records the document's path
+// on the stored chunk. With a positive threshold, documents whose vectors are at least that
+// cosine-similar also count as duplicates. It returns the kept documents with their vectors
+// and how many were dropped. Kept documents take their chunk hash as ID, so a chunk handed
+// to another source by DeleteSource isn't overwritten by its old source's next version.
+func uniqueDocuments(docs []*types.Document, vectors [][]float32, threshold float64, indexed func(doc *types.Document, hash string, vector []float32) (bool, error)) ([]*types.Document, [][]float32, int, error) {
+	var keptDocs []*types.Document
+	var keptVectors [][]float32
+	seen := make(map[string]bool, len(docs))
+
+	for i, doc := range docs {
+		hash := chunkHash(doc)
+		if seen[hash] || (threshold > 0 && similarToAny(vectors[i], keptVectors, threshold)) {
+			continue
+		}
+
+		duplicate, err := indexed(doc, hash, vectors[i])
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if duplicate {
+			continue
+		}
+
+		seen[hash] = true
+		doc.ID = hash
+		keptDocs = append(keptDocs, doc)
+		keptVectors = append(keptVectors, vectors[i])
+	}
+
+	return keptDocs, keptVectors, len(docs) - len(keptDocs), nil
+}
+
+// similarToAny reports whether vector is at least threshold cosine-similar to any of vectors.
+func similarToAny(vector []float32, vectors [][]float32, threshold float64) bool {
+	for _, other := range vectors {
+		if CosineSimilarity(vector, other) >= threshold {
+			return true
+		}
+	}
+	return false
+}
@@ -5,101 +5,271 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/mabulgu/pawdy/internal/backend/ollama"
+	"github.com/mabulgu/pawdy/internal/retry"
 	"github.com/mabulgu/pawdy/pkg/types"
 )
 
 // OllamaEmbeddings implements embeddings using Ollama.
 type OllamaEmbeddings struct {
-	baseURL string
-	model   string
-	client  *http.Client
+	baseURL   string
+	model     string
+	batchSize int
+	retry     retry.Policy
+	client    *http.Client
+
+	// inFlight, if set, holds a slot for each request sent to the server, so parallel
+	// ingestion workers don't overload a single Ollama instance.
+	inFlight chan struct{}
+
+	// legacy is set once the server is found to lack the batched /api/embed endpoint.
+	// It is atomic because Embed may be called from concurrent ingestion workers.
+	legacy atomic.Bool
+
+	// dimensions is learned from the first embedding returned by the model.
+	dimensions atomic.Int64
+
+	// probe embeds a short text once to learn the size of unlisted models.
+	probe sync.Once
 }
 
 // Ensure OllamaEmbeddings implements the EmbeddingProvider interface
 var _ types.EmbeddingProvider = (*OllamaEmbeddings)(nil)
 
 // NewOllamaEmbeddings creates a new Ollama embeddings provider.
-func NewOllamaEmbeddings(baseURL, model string) *OllamaEmbeddings {
+// Up to batchSize texts are sent per request; values below 1 disable batching.
+// Each request must complete within timeout; transient failures are retried according to retryPolicy.
+func NewOllamaEmbeddings(baseURL, model string, batchSize int, timeout time.Duration, retryPolicy retry.Policy) *OllamaEmbeddings {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
 	return &OllamaEmbeddings{
-		baseURL: baseURL,
-		model:   model,
+		baseURL:   baseURL,
+		model:     model,
+		batchSize: batchSize,
+		retry:     retryPolicy,
 		client: &http.Client{
-			Timeout: 60 * time.Second,
+			Timeout: timeout,
 		},
 	}
 }
 
+// SetMaxConcurrency limits how many embedding requests are sent to the server at once,
+// across all callers; later requests wait for a slot. A limit below 1 removes the limit.
+// Call it before the provider is used.
+func (e *OllamaEmbeddings) SetMaxConcurrency(limit int) {
+	if limit < 1 {
+		e.inFlight = nil
+		return
+	}
+	e.inFlight = make(chan struct{}, limit)
+}
+
+// acquire waits for a request slot; release must be called when the request is done.
+func (e *OllamaEmbeddings) acquire(ctx context.Context) error {
+	if e.inFlight == nil {
+		return nil
+	}
+	select {
+	case e.inFlight <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the request slot taken by acquire.
+func (e *OllamaEmbeddings) release() {
+	if e.inFlight != nil {
+		<-e.inFlight
+	}
+}
+
 // Embed generates vector embeddings for the given texts.
 func (e *OllamaEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
-	embeddings := make([][]float32, len(texts))
-	
-	for i, text := range texts {
-		req := embeddingRequest{
-			Model:  e.model,
-			Prompt: text,
+	embeddings := make([][]float32, 0, len(texts))
+
+	for start := 0; start < len(texts); start += e.batchSize {
+		end := start + e.batchSize
+		if end > len(texts) {
+			end = len(texts)
 		}
+		batch := texts[start:end]
 
-		body, err := json.Marshal(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+		if !e.legacy.Load() {
+			batchEmbeddings, err := e.embedBatch(ctx, batch)
+			if err == nil {
+				embeddings = append(embeddings, batchEmbeddings...)
+				continue
+			}
+			if err != errBatchUnsupported {
+				return nil, err
+			}
+			// Older Ollama servers only expose /api/embeddings
+			e.legacy.Store(true)
 		}
 
-		httpReq, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/api/embeddings", bytes.NewReader(body))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create embedding request: %w", err)
+		for _, text := range batch {
+			embedding, err := e.embedSingle(ctx, text)
+			if err != nil {
+				return nil, err
+			}
+			embeddings = append(embeddings, embedding)
 		}
+	}
 
-		httpReq.Header.Set("Content-Type", "application/json")
+	if len(embeddings) > 0 && len(embeddings[0]) > 0 {
+		e.dimensions.Store(int64(len(embeddings[0])))
+	}
+
+	return embeddings, nil
+}
+
+// errBatchUnsupported indicates the server does not provide the /api/embed endpoint.
+var errBatchUnsupported = errors.New("ollama batch embedding API not supported")
+
+// embedBatch embeds multiple texts in a single /api/embed request.
+func (e *OllamaEmbeddings) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	req := batchEmbeddingRequest{
+		Model: e.model,
+		Input: texts,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+
+	resp, err := e.post(ctx, "/api/embed", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errBatchUnsupported
+	}
 
-		resp, err := e.client.Do(httpReq)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama embedding API error (status %d)", resp.StatusCode)
+	}
+
+	var response batchEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
+	}
+
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(response.Embeddings), len(texts))
+	}
+
+	return response.Embeddings, nil
+}
+
+// embedSingle embeds one text using the legacy /api/embeddings endpoint.
+func (e *OllamaEmbeddings) embedSingle(ctx context.Context, text string) ([]float32, error) {
+	req := embeddingRequest{
+		Model:  e.model,
+		Prompt: text,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+
+	resp, err := e.post(ctx, "/api/embeddings", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama embedding API error (status %d)", resp.StatusCode)
+	}
+
+	var response embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
+	}
+
+	return response.Embedding, nil
+}
+
+// post sends an embedding request, retrying connection failures and transient status codes.
+// Any other response, successful or not, is returned for the caller to interpret.
+func (e *OllamaEmbeddings) post(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	var resp *http.Response
+	err := retry.Do(ctx, e.retry, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+path, bytes.NewReader(body))
 		if err != nil {
-			return nil, fmt.Errorf("failed to make embedding request: %w", err)
+			return fmt.Errorf("failed to create embedding request: %w", err)
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("ollama embedding API error (status %d)", resp.StatusCode)
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		// Hold a slot only while the request is in flight, not during retry backoff
+		if err := e.acquire(ctx); err != nil {
+			return err
+		}
+		resp, err = e.client.Do(httpReq)
+		e.release()
+		if err != nil {
+			return retry.FromRequestError(ctx, types.BackendUnavailable(ctx, fmt.Errorf("failed to make embedding request: %w", err)))
 		}
 
-		var response embeddingResponse
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			return nil, fmt.Errorf("failed to decode embedding response: %w", err)
+		if retry.IsTransientStatus(resp.StatusCode) {
+			resp.Body.Close()
+			return retry.Transient(types.BackendUnavailable(ctx, fmt.Errorf("ollama embedding API error (status %d)", resp.StatusCode)))
 		}
 
-		embeddings[i] = response.Embedding
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return embeddings, nil
+	return resp, nil
 }
 
 // GetDimensions returns the dimensionality of the embeddings.
+// Until the model has produced an embedding, the size listed in
+// types.EmbeddingDimensions is assumed. Unlisted models are probed once by
+// embedding a short text; if that fails, the nomic-embed-text size is assumed.
 func (e *OllamaEmbeddings) GetDimensions() int {
-	// nomic-embed-text produces 768-dimensional embeddings
-	return 768
-}
-
-// IsHealthy checks if the embedding service is available.
-func (e *OllamaEmbeddings) IsHealthy(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", e.baseURL+"/api/tags", nil)
-	if err != nil {
-		return fmt.Errorf("failed to create health check request: %w", err)
+	if dimensions := e.dimensions.Load(); dimensions > 0 {
+		return int(dimensions)
 	}
 
-	resp, err := e.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("ollama embedding service unreachable: %w", err)
+	name, _, _ := strings.Cut(e.model, ":")
+	if dimensions, ok := types.EmbeddingDimensions[name]; ok {
+		return dimensions
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ollama embedding service unhealthy (status %d)", resp.StatusCode)
+	// Embed learns the size from the response
+	e.probe.Do(func() {
+		e.Embed(context.Background(), []string{"dimensions"})
+	})
+	if dimensions := e.dimensions.Load(); dimensions > 0 {
+		return int(dimensions)
 	}
 
-	return nil
+	// nomic-embed-text produces 768-dimensional embeddings
+	return 768
+}
+
+// IsHealthy checks if the embedding service is available and the model has been pulled.
+func (e *OllamaEmbeddings) IsHealthy(ctx context.Context) error {
+	return ollama.CheckModel(ctx, e.client, e.baseURL, e.model)
 }
 
 // embeddingRequest represents a request to the Ollama embeddings API.
@@ -112,3 +282,90 @@ type embeddingRequest struct {
 type embeddingResponse struct {
 	Embedding []float32 `json:"embedding"`
 }
+
+// batchEmbeddingRequest represents a request to the Ollama batch embed API.
+type batchEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// batchEmbeddingResponse represents a response from the Ollama batch embed API.
+type batchEmbeddingResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// PartialContentHash replaces the content_hash of the chunks stored when others from the
+// same source failed to embed, so the next ingest of the source indexes it again.
+const PartialContentHash = "partial"
+
+// maxConsecutiveChunkFailures is how many chunks in a row may fail to embed one by one
+// before embedDocuments gives up on the rest, as the provider is probably down.
+const maxConsecutiveChunkFailures = 3
+
+// embedDocuments embeds docs in one call, falling back to one call per chunk if that
+// fails, so a single bad chunk doesn't lose the rest. It returns the documents that
+// were embedded with their vectors, and the chunks that still failed. If none can be
+// embedded, the provider is unavailable, or ctx is done, it returns an error instead.
+func embedDocuments(ctx context.Context, embeddings types.EmbeddingProvider, docs []*types.Document) ([]*types.Document, [][]float32, []types.ChunkError, error) {
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Content
+	}
+
+	vectors, err := embeddings.Embed(ctx, texts)
+	if err == nil {
+		if len(vectors) != len(docs) {
+			return nil, nil, nil, fmt.Errorf("got %d embeddings for %d documents", len(vectors), len(docs))
+		}
+		return docs, vectors, nil, nil
+	}
+	// Retrying chunk by chunk only helps when the chunks themselves are the problem
+	if len(docs) == 1 || ctx.Err() != nil || errors.Is(err, types.ErrBackendUnavailable) {
+		return nil, nil, nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	var embedded []*types.Document
+	var failed []types.ChunkError
+	vectors = nil
+	consecutive := 0
+	for _, doc := range docs {
+		vector, err := embeddings.Embed(ctx, []string{doc.Content})
+		if err == nil && len(vector) != 1 {
+			err = fmt.Errorf("got %d embeddings for 1 document", len(vector))
+		}
+		if err != nil {
+			consecutive++
+			if ctx.Err() != nil || errors.Is(err, types.ErrBackendUnavailable) || consecutive >= maxConsecutiveChunkFailures {
+				return nil, nil, nil, fmt.Errorf("failed to generate embeddings: %w", err)
+			}
+			failed = append(failed, types.ChunkError{ID: doc.ID, Err: err})
+			continue
+		}
+		consecutive = 0
+		embedded = append(embedded, doc)
+		vectors = append(vectors, vector[0])
+	}
+
+	if len(embedded) == 0 {
+		return nil, nil, nil, fmt.Errorf("failed to generate embeddings: %w", failed[0].Err)
+	}
+	if len(failed) > 0 {
+		// A partly indexed source must not look unchanged to SourceHash, or the
+		// failed chunks would never be retried
+		for _, doc := range embedded {
+			if _, ok := doc.Metadata["content_hash"]; ok {
+				doc.Metadata["content_hash"] = PartialContentHash
+			}
+		}
+	}
+	return embedded, vectors, failed, nil
+}
+
+// partialIndexError returns a *types.PartialIndexError for the failed chunks of total,
+// or nil if none failed.
+func partialIndexError(total int, failed []types.ChunkError) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return &types.PartialIndexError{Total: total, Failed: failed}
+}
@@ -0,0 +1,191 @@
+package rag
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// exportRecord is one line of an export file: a point exactly as stored in Qdrant.
+// Payload values keep their protobuf encoding so integers, doubles, and nested
+// values come back with the same types on import.
+type exportRecord struct {
+	ID      string                     `json:"id"`
+	Vector  []float32                  `json:"vector"`
+	Payload map[string]json.RawMessage `json:"payload"`
+}
+
+// exportMaxLineBytes bounds a single export line, which holds one chunk and its vector.
+const exportMaxLineBytes = 64 * 1024 * 1024
+
+// Export writes every stored point to w as JSON lines.
+func (r *QdrantRetriever) Export(ctx context.Context, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	var offset *qdrant.PointId
+	count := 0
+
+	for {
+		points, next, err := r.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: r.collection,
+			Offset:         offset,
+			Limit:          qdrant.PtrOf(uint32(reindexBatchSize)),
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(true),
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to read points from Qdrant: %w", r.qdrantError(ctx, err))
+		}
+
+		for _, point := range points {
+			record, err := newExportRecord(point)
+			if err != nil {
+				return count, err
+			}
+
+			if err := encoder.Encode(record); err != nil {
+				return count, fmt.Errorf("failed to write point %s: %w", record.ID, err)
+			}
+			count++
+		}
+
+		if next == nil {
+			return count, nil
+		}
+		offset = next
+	}
+}
+
+// Import replaces the collection with the points read from r, sized for their vectors.
+// All points are read and checked, then written (see replaceCollection), before the
+// old collection is dropped, so a truncated or mixed-dimension file loses nothing.
+func (r *QdrantRetriever) Import(ctx context.Context, reader io.Reader) (int, error) {
+	var points []*qdrant.PointStruct
+	dimensions := 0
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), exportMaxLineBytes)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record exportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return 0, fmt.Errorf("failed to parse line %d: %w", line, err)
+		}
+
+		point, err := record.point()
+		if err != nil {
+			return 0, fmt.Errorf("invalid point on line %d: %w", line, err)
+		}
+
+		if dimensions == 0 {
+			dimensions = len(record.Vector)
+			if err := r.checkImportDimensions(dimensions); err != nil {
+				return 0, err
+			}
+		} else if len(record.Vector) != dimensions {
+			return 0, fmt.Errorf("point on line %d has %d dimensions, expected %d", line, len(record.Vector), dimensions)
+		}
+
+		points = append(points, point)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	if len(points) == 0 {
+		return 0, nil
+	}
+
+	if err := r.replaceCollection(ctx, dimensions, points); err != nil {
+		return 0, err
+	}
+
+	return len(points), nil
+}
+
+// checkImportDimensions returns an error if exported vectors of the given size don't
+// fit the collection, which is sized for the configured embedding model: questions
+// embedded by that model could not be searched against the imported chunks.
+func (r *QdrantRetriever) checkImportDimensions(dimensions int) error {
+	expected := int(r.dimensions.Load())
+	if expected == 0 || dimensions == expected {
+		return nil
+	}
+
+	return fmt.Errorf("export holds %d-dimensional vectors but collection '%s' stores %d-dimensional vectors; "+
+		"import it with the embedding model it was exported with", dimensions, r.collection, expected)
+}
+
+// newExportRecord converts a stored point, read with its vector, to an export record.
+func newExportRecord(point *qdrant.RetrievedPoint) (exportRecord, error) {
+	record := exportRecord{
+		ID:      pointIDString(point.GetId()),
+		Vector:  pointVector(point.GetVectors()),
+		Payload: make(map[string]json.RawMessage, len(point.GetPayload())),
+	}
+
+	if len(record.Vector) == 0 {
+		return record, fmt.Errorf("point %s has no dense vector", record.ID)
+	}
+
+	for key, value := range point.GetPayload() {
+		encoded, err := protojson.Marshal(value)
+		if err != nil {
+			return record, fmt.Errorf("failed to encode payload field %q of point %s: %w", key, record.ID, err)
+		}
+		record.Payload[key] = encoded
+	}
+
+	return record, nil
+}
+
+// point converts an export record back to a point that can be upserted as-is.
+func (e exportRecord) point() (*qdrant.PointStruct, error) {
+	if e.ID == "" {
+		return nil, fmt.Errorf("missing point ID")
+	}
+	if len(e.Vector) == 0 {
+		return nil, fmt.Errorf("point %s has no vector", e.ID)
+	}
+
+	payload := make(map[string]*qdrant.Value, len(e.Payload))
+	for key, raw := range e.Payload {
+		value := &qdrant.Value{}
+		if err := protojson.Unmarshal(raw, value); err != nil {
+			return nil, fmt.Errorf("failed to decode payload field %q of point %s: %w", key, e.ID, err)
+		}
+		payload[key] = value
+	}
+
+	return &qdrant.PointStruct{
+		Id:      exportPointID(e.ID),
+		Vectors: qdrant.NewVectors(e.Vector...),
+		Payload: payload,
+	}, nil
+}
+
+// exportPointID restores a point ID written by pointIDString.
+func exportPointID(id string) *qdrant.PointId {
+	if num, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return qdrant.NewIDNum(num)
+	}
+	return qdrant.NewIDUUID(id)
+}
+
+// pointVector returns a point's unnamed dense vector, or nil if it has none.
+func pointVector(vectors *qdrant.VectorsOutput) []float32 {
+	vector := vectors.GetVector()
+	if dense := vector.GetDense(); dense != nil {
+		return dense.GetData()
+	}
+	return vector.GetData()
+}
@@ -0,0 +1,114 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// llmRerankMaxChars bounds how much of each chunk is sent to the rerank model.
+const llmRerankMaxChars = 2000
+
+// relevancePattern matches the first number in a relevance rating.
+var relevancePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// LLMReranker rescores the top candidates by asking a language model to rate
+// each chunk's relevance to the query, cross-encoder style.
+type LLMReranker struct {
+	client types.LLMClient
+
+	// maxCandidates caps how many documents are scored, bounding latency.
+	// Documents beyond the cap keep their order after the scored ones.
+	maxCandidates int
+}
+
+// Ensure LLMReranker implements the Reranker interface
+var _ types.Reranker = (*LLMReranker)(nil)
+
+// NewLLMReranker creates a reranker that scores up to maxCandidates documents with client.
+func NewLLMReranker(client types.LLMClient, maxCandidates int) *LLMReranker {
+	return &LLMReranker{
+		client:        client,
+		maxCandidates: maxCandidates,
+	}
+}
+
+// Rerank scores the leading candidates from 0 to 1 and returns them sorted by that score.
+// The previous score is preserved in Metadata["retrieval_score"]. The scored
+// documents are copies, so docs and the documents in it are left unchanged.
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []*types.Document) ([]*types.Document, error) {
+	reranked := make([]*types.Document, len(docs))
+	copy(reranked, docs)
+	scored := reranked
+	if len(scored) > r.maxCandidates {
+		scored = reranked[:r.maxCandidates]
+	}
+
+	for i, doc := range scored {
+		score, err := r.score(ctx, query, doc.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		rescored := *doc
+		rescored.Metadata = maps.Clone(doc.Metadata)
+		if rescored.Metadata == nil {
+			rescored.Metadata = make(map[string]any)
+		}
+		rescored.Metadata["retrieval_score"] = doc.Score
+		rescored.Score = score
+		scored[i] = &rescored
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	return reranked, nil
+}
+
+// score asks the model for a 0-10 relevance rating and normalizes it to 0-1.
+// Unparseable answers score 0 so they sink below rated documents.
+func (r *LLMReranker) score(ctx context.Context, query, content string) (float64, error) {
+	if len(content) > llmRerankMaxChars {
+		end := llmRerankMaxChars
+		for end > 0 && !utf8.RuneStart(content[end]) {
+			end--
+		}
+		content = content[:end]
+	}
+
+	prompt := fmt.Sprintf(`Rate how relevant the passage is to answering the question, from 0 (irrelevant) to 10 (directly answers it).
+Answer with the number only.
+
+Question: %s
+
+Passage:
+%s
+
+Relevance:`, query, content)
+
+	response, err := r.client.Generate(ctx, prompt, types.GenerateOptions{
+		Temperature: 0.0, // Use deterministic output for scoring
+		MaxTokens:   5,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to score document relevance: %w", err)
+	}
+
+	rating, err := strconv.ParseFloat(relevancePattern.FindString(response), 64)
+	if err != nil {
+		return 0, nil
+	}
+	if rating > 10 {
+		rating = 10
+	}
+
+	return rating / 10, nil
+}
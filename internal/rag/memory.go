@@ -0,0 +1,263 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// InMemoryRetriever implements document retrieval with brute-force cosine search over
+// vectors held in memory. It is intended for tests and small, short-lived deployments.
+type InMemoryRetriever struct {
+	embeddings types.EmbeddingProvider
+	mu         sync.RWMutex
+	entries    []memoryEntry
+}
+
+// memoryEntry is a stored document with its embedding.
+type memoryEntry struct {
+	doc    *types.Document
+	vector []float32
+}
+
+// Ensure InMemoryRetriever implements the Retriever, Deduplicator, and VectorSearcher interfaces
+var (
+	_ types.Retriever      = (*InMemoryRetriever)(nil)
+	_ types.Deduplicator   = (*InMemoryRetriever)(nil)
+	_ types.VectorSearcher = (*InMemoryRetriever)(nil)
+)
+
+// NewInMemoryRetriever creates a new in-memory retriever.
+func NewInMemoryRetriever(embeddings types.EmbeddingProvider) *InMemoryRetriever {
+	return &InMemoryRetriever{
+		embeddings: embeddings,
+	}
+}
+
+// Embeddings returns the provider used to embed queries and documents.
+func (r *InMemoryRetriever) Embeddings() types.EmbeddingProvider {
+	return r.embeddings
+}
+
+// Search finds the most relevant documents for a query.
+func (r *InMemoryRetriever) Search(ctx context.Context, query string, topK int) ([]*types.Document, error) {
+	queryEmbeddings, err := r.embeddings.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	if len(queryEmbeddings) == 0 {
+		return []*types.Document{}, nil
+	}
+
+	return r.SearchVector(ctx, queryEmbeddings[0], topK)
+}
+
+// SearchVector finds the topK documents closest to a query embedding.
+func (r *InMemoryRetriever) SearchVector(ctx context.Context, vector []float32, topK int) ([]*types.Document, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make([]*types.Document, 0, len(r.entries))
+	for _, entry := range r.entries {
+		doc := *entry.doc
+		doc.Score = CosineSimilarity(vector, entry.vector)
+		results = append(results, &doc)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	// Rerankers annotate result metadata, so each result gets its own map rather
+	// than sharing the stored document's with concurrent searches.
+	for _, doc := range results {
+		doc.Metadata = maps.Clone(doc.Metadata)
+	}
+
+	return results, nil
+}
+
+// AddDocuments ingests and indexes new documents, replacing any with the same ID.
+// Chunks that fail to embed are reported in a *types.PartialIndexError.
+func (r *InMemoryRetriever) AddDocuments(ctx context.Context, docs []*types.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	embedded, embeddings, failed, err := embedDocuments(ctx, r.embeddings, docs)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.store(embedded, embeddings)
+	return partialIndexError(len(docs), failed)
+}
+
+// AddUniqueDocuments indexes docs, skipping chunks that duplicate stored chunks or each other.
+func (r *InMemoryRetriever) AddUniqueDocuments(ctx context.Context, docs []*types.Document, threshold float64) (int, error) {
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	embedded, embeddings, failed, err := embedDocuments(ctx, r.embeddings, docs)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unique, embeddings, skipped, err := uniqueDocuments(embedded, embeddings, threshold, func(doc *types.Document, hash string, vector []float32) (bool, error) {
+		for _, entry := range r.entries {
+			if entry.doc.Metadata["chunk_hash"] == hash || (threshold > 0 && CosineSimilarity(vector, entry.vector) >= threshold) {
+				owner, _ := entry.doc.Metadata["path"].(string)
+				path, _ := doc.Metadata["path"].(string)
+				if paths := withDuplicatePath(duplicatePaths(entry.doc.Metadata), owner, path); paths != nil {
+					entry.doc.Metadata[duplicatePathsKey] = paths
+				}
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	r.store(unique, embeddings)
+	return skipped, partialIndexError(len(docs), failed)
+}
+
+// store adds documents with their embeddings, replacing any with the same ID.
+// The caller must hold r.mu for writing.
+func (r *InMemoryRetriever) store(docs []*types.Document, embeddings [][]float32) {
+	for i, doc := range docs {
+		entry := memoryEntry{doc: doc, vector: embeddings[i]}
+
+		replaced := false
+		for j := range r.entries {
+			if r.entries[j].doc.ID == doc.ID {
+				r.entries[j] = entry
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			r.entries = append(r.entries, entry)
+		}
+	}
+}
+
+// DeleteCollection removes all documents from the collection.
+func (r *InMemoryRetriever) DeleteCollection(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = nil
+	return nil
+}
+
+// SourceHash returns the content hash stored for a source path, or "" if it has not been ingested.
+func (r *InMemoryRetriever) SourceHash(ctx context.Context, path string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, entry := range r.entries {
+		if entry.doc.Metadata["path"] == path {
+			hash, _ := entry.doc.Metadata["content_hash"].(string)
+			return hash, nil
+		}
+	}
+
+	return "", nil
+}
+
+// DeleteSource removes all documents ingested from a source path. A chunk that other
+// sources duplicate is handed to the first of them instead.
+func (r *InMemoryRetriever) DeleteSource(ctx context.Context, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.entries[:0]
+	for _, entry := range r.entries {
+		paths := duplicatePaths(entry.doc.Metadata)
+		if entry.doc.Metadata["path"] == path {
+			if len(paths) == 0 {
+				continue
+			}
+			// The title named the deleted source
+			entry.doc.Metadata["path"] = paths[0]
+			delete(entry.doc.Metadata, "title")
+			paths = paths[1:]
+		}
+		if _, ok := entry.doc.Metadata[duplicatePathsKey]; ok {
+			entry.doc.Metadata[duplicatePathsKey] = slices.DeleteFunc(paths, func(p string) bool { return p == path })
+		}
+		kept = append(kept, entry)
+	}
+	r.entries = kept
+
+	return nil
+}
+
+// Stats reports how many chunks and source files are indexed.
+func (r *InMemoryRetriever) Stats(ctx context.Context) (*types.CollectionStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.entries) == 0 {
+		return &types.CollectionStats{Dimensions: r.embeddings.GetDimensions()}, nil
+	}
+
+	sources := make(map[any]struct{})
+	for _, entry := range r.entries {
+		sources[entry.doc.Metadata["path"]] = struct{}{}
+	}
+
+	return &types.CollectionStats{
+		Chunks:     len(r.entries),
+		Sources:    len(sources),
+		Dimensions: len(r.entries[0].vector),
+	}, nil
+}
+
+// IsHealthy always succeeds since the store lives in process memory.
+func (r *InMemoryRetriever) IsHealthy(ctx context.Context) error {
+	return nil
+}
+
+// CosineSimilarity returns the cosine similarity of two vectors, or 0 if either is empty
+// or their dimensions differ.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
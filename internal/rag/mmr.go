@@ -0,0 +1,102 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// MMRReranker reorders documents by maximal marginal relevance, trading each
+// document's relevance score against its similarity to documents already picked.
+// This keeps near-duplicate chunks from crowding out other sources.
+type MMRReranker struct {
+	embeddings types.EmbeddingProvider
+
+	// lambda is the weight given to relevance; 1 - lambda penalizes redundancy.
+	lambda float64
+}
+
+// Ensure MMRReranker implements the Reranker interface
+var _ types.Reranker = (*MMRReranker)(nil)
+
+// NewMMRReranker creates an MMR reranker that embeds candidates to compare them with each other.
+func NewMMRReranker(embeddings types.EmbeddingProvider, lambda float64) *MMRReranker {
+	return &MMRReranker{
+		embeddings: embeddings,
+		lambda:     lambda,
+	}
+}
+
+// Rerank greedily orders documents so each pick maximizes
+// lambda*score - (1-lambda)*max similarity to the documents picked before it.
+// Scores are left unchanged; only the order is diversified.
+func (r *MMRReranker) Rerank(ctx context.Context, query string, docs []*types.Document) ([]*types.Document, error) {
+	if len(docs) < 3 {
+		return docs, nil
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Content
+	}
+
+	vectors, err := r.embeddings.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed candidates: %w", err)
+	}
+
+	// maxSimilarity[i] tracks the highest similarity between docs[i] and any selected document
+	maxSimilarity := make([]float64, len(docs))
+	picked := make([]bool, len(docs))
+	reranked := make([]*types.Document, 0, len(docs))
+
+	for len(reranked) < len(docs) {
+		best := -1
+		bestScore := 0.0
+		for i, doc := range docs {
+			if picked[i] {
+				continue
+			}
+
+			score := r.lambda*doc.Score - (1-r.lambda)*maxSimilarity[i]
+			if best == -1 || score > bestScore {
+				best = i
+				bestScore = score
+			}
+		}
+
+		picked[best] = true
+		reranked = append(reranked, docs[best])
+
+		for i := range docs {
+			if picked[i] {
+				continue
+			}
+			if similarity := CosineSimilarity(vectors[i], vectors[best]); similarity > maxSimilarity[i] {
+				maxSimilarity[i] = similarity
+			}
+		}
+	}
+
+	return reranked, nil
+}
+
+// ChainReranker applies several rerankers in order.
+type ChainReranker []types.Reranker
+
+// Ensure ChainReranker implements the Reranker interface
+var _ types.Reranker = ChainReranker(nil)
+
+// Rerank passes the documents through each reranker in turn.
+func (c ChainReranker) Rerank(ctx context.Context, query string, docs []*types.Document) ([]*types.Document, error) {
+	var err error
+	for _, reranker := range c {
+		docs, err = reranker.Rerank(ctx, query, docs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return docs, nil
+}
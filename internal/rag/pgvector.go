@@ -0,0 +1,415 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// PgVectorRetriever implements document retrieval using PostgreSQL with the pgvector extension.
+type PgVectorRetriever struct {
+	table      string
+	embeddings types.EmbeddingProvider
+	pool       *pgxpool.Pool
+
+	// dedupeMu serializes duplicate checks with their inserts, so chunks
+	// ingested concurrently are checked against each other.
+	dedupeMu sync.Mutex
+}
+
+// Ensure PgVectorRetriever implements the Retriever, Deduplicator, VectorSearcher, and DimensionReporter interfaces
+var (
+	_ types.Retriever         = (*PgVectorRetriever)(nil)
+	_ types.Deduplicator      = (*PgVectorRetriever)(nil)
+	_ types.VectorSearcher    = (*PgVectorRetriever)(nil)
+	_ types.DimensionReporter = (*PgVectorRetriever)(nil)
+)
+
+// undefinedTable is the Postgres error code for a query on a missing table.
+const undefinedTable = "42P01"
+
+// pgError marks err, from a query on the table, with ErrCollectionNotFound if the table
+// doesn't exist or types.ErrBackendUnavailable if Postgres couldn't be reached.
+func (r *PgVectorRetriever) pgError(ctx context.Context, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == undefinedTable {
+		return fmt.Errorf("%w: table %s: %w", ErrCollectionNotFound, r.table, err)
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return types.BackendUnavailable(ctx, err)
+	}
+	return err
+}
+
+// PgVectorOptions configures the connection to Postgres.
+type PgVectorOptions struct {
+	// URL is the Postgres connection string, such as postgres://localhost:5432/pawdy.
+	URL string
+
+	// NoCreate fails with ErrCollectionNotFound instead of creating a missing table,
+	// for commands that only act on existing data.
+	NoCreate bool
+}
+
+// NewPgVectorRetriever creates a new pgvector-based retriever.
+// The collection name is used as the table name.
+func NewPgVectorRetriever(postgresURL, collection string, embeddings types.EmbeddingProvider) (*PgVectorRetriever, error) {
+	return NewPgVectorRetrieverWithOptions(PgVectorOptions{URL: postgresURL}, collection, embeddings)
+}
+
+// NewPgVectorRetrieverWithOptions creates a pgvector-based retriever with the given
+// connection options; see NewPgVectorRetriever.
+func NewPgVectorRetrieverWithOptions(opts PgVectorOptions, collection string, embeddings types.EmbeddingProvider) (*PgVectorRetriever, error) {
+	pool, err := pgxpool.New(context.Background(), opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Postgres connection pool: %w", err)
+	}
+
+	retriever := &PgVectorRetriever{
+		table:      pgx.Identifier{collection}.Sanitize(),
+		embeddings: embeddings,
+		pool:       pool,
+	}
+
+	if opts.NoCreate {
+		if err := retriever.checkTable(context.Background()); err != nil {
+			pool.Close()
+			return nil, err
+		}
+		return retriever, nil
+	}
+
+	// Ensure table exists
+	if err := retriever.ensureTable(context.Background()); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ensure table exists: %w", err)
+	}
+
+	return retriever, nil
+}
+
+// checkTable returns ErrCollectionNotFound if the document table doesn't exist.
+func (r *PgVectorRetriever) checkTable(ctx context.Context) error {
+	var exists bool
+	if err := r.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", r.table).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check table existence: %w", r.pgError(ctx, err))
+	}
+	if !exists {
+		return fmt.Errorf("%w: table %s", ErrCollectionNotFound, r.table)
+	}
+	return nil
+}
+
+// ensureTable creates the pgvector extension and document table if they don't exist.
+func (r *PgVectorRetriever) ensureTable(ctx context.Context) error {
+	if _, err := r.pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS vector"); err != nil {
+		return fmt.Errorf("failed to create vector extension: %w", err)
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id TEXT PRIMARY KEY,
+		content TEXT NOT NULL,
+		metadata JSONB NOT NULL DEFAULT '{}',
+		embedding vector(%d) NOT NULL
+	)`, r.table, r.embeddings.GetDimensions())
+
+	if _, err := r.pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	return nil
+}
+
+// CollectionDimensions returns the size declared for the table's embedding column,
+// which pgvector keeps as the column's type modifier.
+func (r *PgVectorRetriever) CollectionDimensions(ctx context.Context) (int, error) {
+	var dimensions int
+	err := r.pool.QueryRow(ctx, `SELECT GREATEST(atttypmod, 0) FROM pg_attribute
+		WHERE attrelid = to_regclass($1) AND attname = 'embedding'`, r.table).Scan(&dimensions)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the embedding column size: %w", r.pgError(ctx, err))
+	}
+	return dimensions, nil
+}
+
+// Embeddings returns the provider used to embed queries and documents.
+func (r *PgVectorRetriever) Embeddings() types.EmbeddingProvider {
+	return r.embeddings
+}
+
+// Search finds the most relevant documents for a query.
+func (r *PgVectorRetriever) Search(ctx context.Context, query string, topK int) ([]*types.Document, error) {
+	queryEmbeddings, err := r.embeddings.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	if len(queryEmbeddings) == 0 {
+		return []*types.Document{}, nil
+	}
+
+	return r.SearchVector(ctx, queryEmbeddings[0], topK)
+}
+
+// SearchVector finds the topK documents closest to a query embedding.
+func (r *PgVectorRetriever) SearchVector(ctx context.Context, vector []float32, topK int) ([]*types.Document, error) {
+	// <=> is cosine distance, so similarity is 1 - distance
+	sql := fmt.Sprintf(`SELECT id, content, metadata, 1 - (embedding <=> $1::vector) AS score
+		FROM %s ORDER BY embedding <=> $1::vector LIMIT $2`, r.table)
+
+	rows, err := r.pool.Query(ctx, sql, formatVector(vector), topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search in Postgres: %w", r.pgError(ctx, err))
+	}
+	defer rows.Close()
+
+	var results []*types.Document
+	for rows.Next() {
+		doc := &types.Document{}
+		var metadata []byte
+
+		if err := rows.Scan(&doc.ID, &doc.Content, &metadata, &doc.Score); err != nil {
+			return nil, fmt.Errorf("failed to read search result: %w", err)
+		}
+
+		if err := json.Unmarshal(metadata, &doc.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode document metadata: %w", err)
+		}
+
+		results = append(results, doc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search in Postgres: %w", r.pgError(ctx, err))
+	}
+
+	return results, nil
+}
+
+// AddDocuments ingests and indexes new documents. Chunks that fail to embed are
+// reported in a *types.PartialIndexError after the rest are stored.
+func (r *PgVectorRetriever) AddDocuments(ctx context.Context, docs []*types.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	// Generate embeddings
+	embedded, embeddings, failed, err := embedDocuments(ctx, r.embeddings, docs)
+	if err != nil {
+		return err
+	}
+
+	if err := r.insert(ctx, embedded, embeddings); err != nil {
+		return err
+	}
+	return partialIndexError(len(docs), failed)
+}
+
+// AddUniqueDocuments indexes docs, skipping chunks that duplicate stored chunks or each other.
+func (r *PgVectorRetriever) AddUniqueDocuments(ctx context.Context, docs []*types.Document, threshold float64) (int, error) {
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	embedded, embeddings, failed, err := embedDocuments(ctx, r.embeddings, docs)
+	if err != nil {
+		return 0, err
+	}
+
+	r.dedupeMu.Lock()
+	defer r.dedupeMu.Unlock()
+
+	unique, embeddings, skipped, err := uniqueDocuments(embedded, embeddings, threshold, func(doc *types.Document, hash string, vector []float32) (bool, error) {
+		return r.isIndexed(ctx, doc, hash, vector, threshold)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(unique) > 0 {
+		if err := r.insert(ctx, unique, embeddings); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, partialIndexError(len(docs), failed)
+}
+
+// isIndexed reports whether a chunk with the given hash, or with threshold > 0 a vector
+// at least that similar, is already stored, and if so records doc's path on it.
+func (r *PgVectorRetriever) isIndexed(ctx context.Context, doc *types.Document, hash string, vector []float32, threshold float64) (bool, error) {
+	var id string
+	sql := fmt.Sprintf(`SELECT id FROM %s WHERE metadata->>'chunk_hash' = $1 LIMIT 1`, r.table)
+	err := r.pool.QueryRow(ctx, sql, hash).Scan(&id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("failed to look up chunk in Postgres: %w", r.pgError(ctx, err))
+	}
+
+	if id == "" && threshold > 0 {
+		// Order by distance so the nearest neighbour can come from a vector index
+		var score float64
+		sql = fmt.Sprintf(`SELECT id, 1 - (embedding <=> $1::vector) FROM %s ORDER BY embedding <=> $1::vector LIMIT 1`, r.table)
+		err := r.pool.QueryRow(ctx, sql, formatVector(vector)).Scan(&id, &score)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return false, fmt.Errorf("failed to search in Postgres: %w", r.pgError(ctx, err))
+		}
+		if score < threshold {
+			id = ""
+		}
+	}
+
+	if id == "" {
+		return false, nil
+	}
+	path, _ := doc.Metadata["path"].(string)
+	if path == "" {
+		return true, nil
+	}
+
+	// Add the path to duplicate_paths unless it is the chunk's own path or already listed
+	sql = fmt.Sprintf(`UPDATE %s
+		SET metadata = jsonb_set(metadata, '{%s}', COALESCE(metadata->'%[2]s', '[]'::jsonb) || to_jsonb($2::text))
+		WHERE id = $1 AND metadata->>'path' <> $2 AND NOT COALESCE(metadata->'%[2]s', '[]'::jsonb) ? $2`, r.table, duplicatePathsKey)
+	if _, err := r.pool.Exec(ctx, sql, id, path); err != nil {
+		return false, fmt.Errorf("failed to record duplicate in Postgres: %w", r.pgError(ctx, err))
+	}
+
+	return true, nil
+}
+
+// insert writes documents with precomputed embeddings, replacing any with the same ID.
+func (r *PgVectorRetriever) insert(ctx context.Context, docs []*types.Document, embeddings [][]float32) error {
+	sql := fmt.Sprintf(`INSERT INTO %s (id, content, metadata, embedding)
+		VALUES ($1, $2, $3, $4::vector)
+		ON CONFLICT (id) DO UPDATE
+		SET content = EXCLUDED.content, metadata = EXCLUDED.metadata, embedding = EXCLUDED.embedding`, r.table)
+
+	batch := &pgx.Batch{}
+	for i, doc := range docs {
+		metadata, err := json.Marshal(doc.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata for %s: %w", doc.ID, err)
+		}
+
+		batch.Queue(sql, doc.ID, doc.Content, metadata, formatVector(embeddings[i]))
+	}
+
+	if err := r.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to upsert documents to Postgres: %w", r.pgError(ctx, err))
+	}
+
+	return nil
+}
+
+// DeleteCollection removes all documents from the collection.
+func (r *PgVectorRetriever) DeleteCollection(ctx context.Context) error {
+	if _, err := r.pool.Exec(ctx, fmt.Sprintf("TRUNCATE %s", r.table)); err != nil {
+		return fmt.Errorf("failed to truncate table: %w", r.pgError(ctx, err))
+	}
+	return nil
+}
+
+// SourceHash returns the content hash stored for a source path, or "" if it has not been ingested.
+func (r *PgVectorRetriever) SourceHash(ctx context.Context, path string) (string, error) {
+	sql := fmt.Sprintf(`SELECT COALESCE(metadata->>'content_hash', '') FROM %s
+		WHERE metadata->>'path' = $1 LIMIT 1`, r.table)
+
+	var hash string
+	err := r.pool.QueryRow(ctx, sql, path).Scan(&hash)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up source in Postgres: %w", r.pgError(ctx, err))
+	}
+
+	return hash, nil
+}
+
+// DeleteSource removes all documents ingested from a source path. A chunk that other
+// sources duplicate is handed to the first of them instead, dropping the title that
+// named the deleted source.
+func (r *PgVectorRetriever) DeleteSource(ctx context.Context, path string) error {
+	batch := &pgx.Batch{}
+	batch.Queue(fmt.Sprintf(`DELETE FROM %s WHERE metadata->>'path' = $1
+		AND COALESCE(jsonb_array_length(metadata->'%s'), 0) = 0`, r.table, duplicatePathsKey), path)
+	batch.Queue(fmt.Sprintf(`UPDATE %s
+		SET metadata = (metadata - 'title') || jsonb_build_object('path', metadata->'%[2]s'->0, '%[2]s', (metadata->'%[2]s') - 0)
+		WHERE metadata->>'path' = $1`, r.table, duplicatePathsKey), path)
+	batch.Queue(fmt.Sprintf(`UPDATE %s
+		SET metadata = jsonb_set(metadata, '{%[2]s}', (metadata->'%[2]s') - $1::text)
+		WHERE metadata->'%[2]s' ? $1`, r.table, duplicatePathsKey), path)
+
+	// A batch runs in one implicit transaction, so searches never see a half-deleted source
+	if err := r.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to delete source from Postgres: %w", r.pgError(ctx, err))
+	}
+	return nil
+}
+
+// Stats reports how many chunks and source files are indexed.
+func (r *PgVectorRetriever) Stats(ctx context.Context) (*types.CollectionStats, error) {
+	sql := fmt.Sprintf(`SELECT COUNT(*), COUNT(DISTINCT metadata->>'path'),
+		COALESCE(MAX(vector_dims(embedding)), 0) FROM %s`, r.table)
+
+	stats := &types.CollectionStats{}
+	if err := r.pool.QueryRow(ctx, sql).Scan(&stats.Chunks, &stats.Sources, &stats.Dimensions); err != nil {
+		return nil, fmt.Errorf("failed to read collection stats from Postgres: %w", r.pgError(ctx, err))
+	}
+
+	if stats.Dimensions == 0 {
+		stats.Dimensions = r.embeddings.GetDimensions()
+	}
+
+	return stats, nil
+}
+
+// IsHealthy checks if the database is accessible and the table exists.
+func (r *PgVectorRetriever) IsHealthy(ctx context.Context) error {
+	if err := r.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("postgres health check failed: %w", r.pgError(ctx, err))
+	}
+
+	var exists bool
+	if err := r.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", r.table).Scan(&exists); err != nil {
+		return fmt.Errorf("postgres health check failed: %w", r.pgError(ctx, err))
+	}
+	if !exists {
+		return fmt.Errorf("%w: table %s", ErrCollectionNotFound, r.table)
+	}
+
+	return nil
+}
+
+// Close releases the connection pool.
+func (r *PgVectorRetriever) Close() error {
+	r.pool.Close()
+	return nil
+}
+
+// formatVector renders a vector in pgvector's text input format, e.g. "[0.1,0.2]".
+func formatVector(vector []float32) string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, v := range vector {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	}
+	b.WriteString("]")
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package rag
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// BM25 tuning parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// KeywordReranker rescores vector search hits using BM25 keyword relevance.
+type KeywordReranker struct {
+	// weight is the share of the final score given to the keyword score;
+	// the remainder comes from the original vector similarity.
+	weight float64
+}
+
+// Ensure KeywordReranker implements the Reranker interface
+var _ types.Reranker = (*KeywordReranker)(nil)
+
+// NewKeywordReranker creates a BM25 reranker that blends keyword and vector scores equally.
+func NewKeywordReranker() *KeywordReranker {
+	return &KeywordReranker{
+		weight: 0.5,
+	}
+}
+
+// Rerank rescores documents against the query terms and returns them sorted by the blended score.
+// The original vector score is preserved in Metadata["vector_score"].
+func (r *KeywordReranker) Rerank(ctx context.Context, query string, docs []*types.Document) ([]*types.Document, error) {
+	queryTerms := tokenize(query)
+	if len(docs) == 0 || len(queryTerms) == 0 {
+		return docs, nil
+	}
+
+	// Compute term frequencies and document frequencies over the candidate set
+	docTerms := make([]map[string]int, len(docs))
+	docLengths := make([]int, len(docs))
+	docFreq := make(map[string]int)
+	totalLength := 0
+
+	for i, doc := range docs {
+		terms := tokenize(doc.Content)
+		freq := make(map[string]int)
+		for _, term := range terms {
+			freq[term]++
+		}
+		for term := range freq {
+			docFreq[term]++
+		}
+
+		docTerms[i] = freq
+		docLengths[i] = len(terms)
+		totalLength += len(terms)
+	}
+
+	avgLength := float64(totalLength) / float64(len(docs))
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	// Score each document with BM25
+	keywordScores := make([]float64, len(docs))
+	maxScore := 0.0
+	for i := range docs {
+		score := 0.0
+		for _, term := range queryTerms {
+			tf := float64(docTerms[i][term])
+			if tf == 0 {
+				continue
+			}
+
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (float64(len(docs))-df+0.5)/(df+0.5))
+			norm := tf + bm25K1*(1-bm25B+bm25B*float64(docLengths[i])/avgLength)
+			score += idf * tf * (bm25K1 + 1) / norm
+		}
+
+		keywordScores[i] = score
+		if score > maxScore {
+			maxScore = score
+		}
+	}
+
+	// Blend normalized keyword scores with vector similarity
+	for i, doc := range docs {
+		keywordScore := 0.0
+		if maxScore > 0 {
+			keywordScore = keywordScores[i] / maxScore
+		}
+
+		if doc.Metadata == nil {
+			doc.Metadata = make(map[string]any)
+		}
+		doc.Metadata["vector_score"] = doc.Score
+		doc.Score = (1-r.weight)*doc.Score + r.weight*keywordScore
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Score > docs[j].Score
+	})
+
+	return docs, nil
+}
+
+// tokenize lowercases text and splits it into alphanumeric terms.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -3,44 +3,108 @@ package rag
 
 import (
 	"context"
+	"crypto/md5"
+	"errors"
 	"fmt"
 	"net/url"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mabulgu/pawdy/pkg/types"
 	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// ErrCollectionNotFound is wrapped by retriever errors when the collection, or the
+// pgvector table, does not exist, e.g. after it was deleted while Pawdy was running.
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// defaultQdrantGRPCPort is the port Qdrant serves gRPC on unless configured otherwise.
+const defaultQdrantGRPCPort = 6334
+
 // QdrantRetriever implements document retrieval using Qdrant vector database.
 type QdrantRetriever struct {
 	collection   string
+	distance     qdrant.Distance
 	embeddings   types.EmbeddingProvider
 	client       *qdrant.Client
 	pointsClient qdrant.PointsClient
+
+	// dimensions is the vector size of the collection, or 0 if unknown.
+	dimensions atomic.Int64
+
+	// dedupeMu serializes duplicate checks with their upserts, so chunks
+	// ingested concurrently are checked against each other.
+	dedupeMu sync.Mutex
+}
+
+// Ensure QdrantRetriever implements the Retriever, Reindexer, Exporter, Deduplicator, VectorSearcher, and DimensionReporter interfaces
+var (
+	_ types.Retriever         = (*QdrantRetriever)(nil)
+	_ types.Reindexer         = (*QdrantRetriever)(nil)
+	_ types.Exporter          = (*QdrantRetriever)(nil)
+	_ types.Deduplicator      = (*QdrantRetriever)(nil)
+	_ types.VectorSearcher    = (*QdrantRetriever)(nil)
+	_ types.DimensionReporter = (*QdrantRetriever)(nil)
+)
+
+// QdrantOptions configures the connection to Qdrant.
+type QdrantOptions struct {
+	// URL is Qdrant's REST URL, such as http://localhost:6333. The client talks
+	// gRPC to the same host, on GRPCPort or the port qdrantGRPCPort derives.
+	URL string
+
+	// APIKey authenticates with a hosted Qdrant, such as Qdrant Cloud.
+	APIKey string
+
+	// UseTLS connects over TLS, which an https:// URL also implies.
+	UseTLS bool
+
+	// GRPCPort, if set, is used instead of the port derived from URL.
+	GRPCPort int
+
+	// NoCreate fails with ErrCollectionNotFound instead of creating a missing
+	// collection, for commands that only act on existing data.
+	NoCreate bool
 }
 
-// NewQdrantRetriever creates a new Qdrant-based retriever.
-func NewQdrantRetriever(qdrantURL, collection string, embeddings types.EmbeddingProvider) (*QdrantRetriever, error) {
+// NewQdrantRetriever creates a new Qdrant-based retriever. distance is the metric
+// used if the collection has to be created: "cosine", "dot", or "euclid".
+func NewQdrantRetriever(qdrantURL, collection, distance string, embeddings types.EmbeddingProvider) (*QdrantRetriever, error) {
+	return NewQdrantRetrieverWithOptions(QdrantOptions{URL: qdrantURL}, collection, distance, embeddings)
+}
+
+// NewQdrantRetrieverWithOptions creates a Qdrant-based retriever with the given
+// connection options; see NewQdrantRetriever.
+func NewQdrantRetrieverWithOptions(opts QdrantOptions, collection, distance string, embeddings types.EmbeddingProvider) (*QdrantRetriever, error) {
+	metric, err := qdrantDistance(distance)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse the Qdrant URL to extract host and port
-	parsedURL, err := url.Parse(qdrantURL)
+	parsedURL, err := url.Parse(opts.URL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid Qdrant URL: %w", err)
 	}
 
-	host := parsedURL.Hostname()
-	port := 6334 // Default Qdrant gRPC port
-	if parsedURL.Port() != "" {
-		// If HTTP port is specified, use gRPC port (HTTP port + 1)
-		if httpPort, err := strconv.Atoi(parsedURL.Port()); err == nil {
-			port = httpPort + 1
+	port := opts.GRPCPort
+	if port == 0 {
+		if port, err = qdrantGRPCPort(parsedURL); err != nil {
+			return nil, err
 		}
 	}
 
 	// Create Qdrant client
 	client, err := qdrant.NewClient(&qdrant.Config{
-		Host: host,
-		Port: port,
+		Host:   parsedURL.Hostname(),
+		Port:   port,
+		APIKey: opts.APIKey,
+		UseTLS: opts.UseTLS || parsedURL.Scheme == "https",
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Qdrant client: %w", err)
@@ -48,47 +112,142 @@ func NewQdrantRetriever(qdrantURL, collection string, embeddings types.Embedding
 
 	retriever := &QdrantRetriever{
 		collection:   collection,
+		distance:     metric,
 		embeddings:   embeddings,
 		client:       client,
 		pointsClient: client.GetPointsClient(),
 	}
 
 	// Ensure collection exists
-	if err := retriever.ensureCollection(context.Background()); err != nil {
+	if err := retriever.ensureCollection(context.Background(), !opts.NoCreate); err != nil {
 		return nil, fmt.Errorf("failed to ensure collection exists: %w", err)
 	}
 
 	return retriever, nil
 }
 
-// ensureCollection creates the collection if it doesn't exist.
-func (r *QdrantRetriever) ensureCollection(ctx context.Context) error {
+// qdrantGRPCPort returns the gRPC port for Qdrant's REST URL. Qdrant serves gRPC one
+// port above REST (6333 and 6334 by default), but a URL without a port, or on the
+// standard HTTP or HTTPS port, is behind a proxy or load balancer, as hosted Qdrant
+// is; it uses the default gRPC port 6334.
+func qdrantGRPCPort(u *url.URL) (int, error) {
+	if u.Port() == "" {
+		return defaultQdrantGRPCPort, nil
+	}
+
+	httpPort, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return 0, fmt.Errorf("invalid Qdrant URL port %q: %w", u.Port(), err)
+	}
+	if httpPort == 80 || httpPort == 443 {
+		return defaultQdrantGRPCPort, nil
+	}
+	return httpPort + 1, nil
+}
+
+// ensureCollection creates the collection if it doesn't exist and create is set, or
+// returns ErrCollectionNotFound otherwise.
+func (r *QdrantRetriever) ensureCollection(ctx context.Context, create bool) error {
 	// Check if collection exists first
 	exists, err := r.client.CollectionExists(ctx, r.collection)
 	if err != nil {
-		return fmt.Errorf("failed to check collection existence: %w", err)
+		return fmt.Errorf("failed to check collection existence: %w", r.qdrantError(ctx, err))
 	}
 
-	if exists {
-		return nil // Collection already exists
+	if !exists {
+		if !create {
+			return fmt.Errorf("%w: %s", ErrCollectionNotFound, r.collection)
+		}
+		return r.createCollection(ctx, r.embeddings.GetDimensions())
 	}
 
-	// Create collection
-	dimensions := r.embeddings.GetDimensions()
-	err = r.client.CreateCollection(ctx, &qdrant.CreateCollection{
-		CollectionName: r.collection,
+	// Remember the existing vector size so a changed embedding model is caught
+	// before Qdrant rejects its vectors
+	info, err := r.client.GetCollectionInfo(ctx, r.collection)
+	if err != nil {
+		return fmt.Errorf("failed to get collection info: %w", r.qdrantError(ctx, err))
+	}
+	r.dimensions.Store(int64(info.GetConfig().GetParams().GetVectorsConfig().GetParams().GetSize()))
+
+	return nil
+}
+
+// qdrantError marks err, from a Qdrant request, with ErrCollectionNotFound if the
+// collection doesn't exist or types.ErrBackendUnavailable if Qdrant couldn't be reached.
+func (r *QdrantRetriever) qdrantError(ctx context.Context, err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s: %w", ErrCollectionNotFound, r.collection, err)
+	case codes.Unavailable:
+		return types.BackendUnavailable(ctx, err)
+	default:
+		return err
+	}
+}
+
+// qdrantDistance maps a distance config value to its Qdrant metric.
+func qdrantDistance(distance string) (qdrant.Distance, error) {
+	switch distance {
+	case "cosine", "":
+		return qdrant.Distance_Cosine, nil
+	case "dot":
+		return qdrant.Distance_Dot, nil
+	case "euclid":
+		return qdrant.Distance_Euclid, nil
+	default:
+		return qdrant.Distance_UnknownDistance, fmt.Errorf("unsupported distance: %s", distance)
+	}
+}
+
+// checkDimensions returns an error if vector doesn't fit the collection, which
+// happens when embedding_model is changed to one with a different vector size.
+// The size the embedding provider reports is only a guess until it has embedded
+// something, so real vectors are checked instead.
+func (r *QdrantRetriever) checkDimensions(vector []float32) error {
+	dimensions := int(r.dimensions.Load())
+	if dimensions == 0 || len(vector) == dimensions {
+		return nil
+	}
+
+	return fmt.Errorf("collection '%s' stores %d-dimensional vectors but the embedding model produces %d; "+
+		"run 'pawdy reindex' to re-embed the indexed documents or 'pawdy reset' to clear them", r.collection, dimensions, len(vector))
+}
+
+// CollectionDimensions returns the vector size of the collection, read when it was opened.
+func (r *QdrantRetriever) CollectionDimensions(ctx context.Context) (int, error) {
+	return int(r.dimensions.Load()), nil
+}
+
+// createCollection creates the collection for vectors of the given size.
+func (r *QdrantRetriever) createCollection(ctx context.Context, dimensions int) error {
+	if err := r.newCollection(ctx, r.collection, dimensions); err != nil {
+		return err
+	}
+
+	r.dimensions.Store(int64(dimensions))
+	return nil
+}
+
+// newCollection creates a collection with the given name for vectors of the given size.
+func (r *QdrantRetriever) newCollection(ctx context.Context, name string, dimensions int) error {
+	err := r.client.CreateCollection(ctx, &qdrant.CreateCollection{
+		CollectionName: name,
 		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
 			Size:     uint64(dimensions),
-			Distance: qdrant.Distance_Cosine,
+			Distance: r.distance,
 		}),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create collection: %w", err)
+		return fmt.Errorf("failed to create collection: %w", r.qdrantError(ctx, err))
 	}
-
 	return nil
 }
 
+// Embeddings returns the provider used to embed queries and documents.
+func (r *QdrantRetriever) Embeddings() types.EmbeddingProvider {
+	return r.embeddings
+}
+
 // Search finds the most relevant documents for a query.
 func (r *QdrantRetriever) Search(ctx context.Context, query string, topK int) ([]*types.Document, error) {
 	// Generate embedding for query
@@ -101,49 +260,31 @@ func (r *QdrantRetriever) Search(ctx context.Context, query string, topK int) ([
 		return []*types.Document{}, nil
 	}
 
+	return r.SearchVector(ctx, queryEmbeddings[0], topK)
+}
+
+// SearchVector finds the topK documents closest to a query embedding.
+func (r *QdrantRetriever) SearchVector(ctx context.Context, vector []float32, topK int) ([]*types.Document, error) {
+	if err := r.checkDimensions(vector); err != nil {
+		return nil, err
+	}
+
 	// Perform vector search in Qdrant using the low-level client
 	searchResult, err := r.pointsClient.Search(ctx, &qdrant.SearchPoints{
 		CollectionName: r.collection,
-		Vector:         queryEmbeddings[0],
+		Vector:         vector,
 		Limit:          uint64(topK),
 		WithPayload:    &qdrant.WithPayloadSelector{SelectorOptions: &qdrant.WithPayloadSelector_Enable{Enable: true}},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to search in Qdrant: %w", err)
+		return nil, fmt.Errorf("failed to search in Qdrant: %w", r.qdrantError(ctx, err))
 	}
 
 	// Convert Qdrant results to documents
 	results := make([]*types.Document, 0, len(searchResult.GetResult()))
 	for _, point := range searchResult.GetResult() {
-		// Get ID as string (works for both UUID and numeric IDs)
-		var docID string
-		if uuid := point.GetId().GetUuid(); uuid != "" {
-			docID = uuid
-		} else {
-			docID = fmt.Sprintf("%d", point.GetId().GetNum())
-		}
-
-		doc := &types.Document{
-			ID:       docID,
-			Score:    float64(point.GetScore()),
-			Metadata: make(map[string]any),
-		}
-
-		// Extract content and metadata from payload
-		if payload := point.GetPayload(); payload != nil {
-			if content, exists := payload["content"]; exists {
-				if contentStr, ok := content.GetKind().(*qdrant.Value_StringValue); ok {
-					doc.Content = contentStr.StringValue
-				}
-			}
-
-			// Copy all payload fields to metadata
-			for key, value := range payload {
-				if key != "content" {
-					doc.Metadata[key] = convertQdrantValue(value)
-				}
-			}
-		}
+		doc := documentFromPayload(pointIDString(point.GetId()), point.GetPayload())
+		doc.Score = float64(point.GetScore())
 
 		results = append(results, doc)
 	}
@@ -151,30 +292,153 @@ func (r *QdrantRetriever) Search(ctx context.Context, query string, topK int) ([
 	return results, nil
 }
 
-// AddDocuments ingests and indexes new documents.
+// AddDocuments ingests and indexes new documents. Chunks that fail to embed are
+// reported in a *types.PartialIndexError after the rest are stored.
 func (r *QdrantRetriever) AddDocuments(ctx context.Context, docs []*types.Document) error {
 	if len(docs) == 0 {
 		return nil
 	}
 
-	// Extract text content for embedding
-	texts := make([]string, len(docs))
-	for i, doc := range docs {
-		texts[i] = doc.Content
+	// Generate embeddings
+	embedded, embeddings, failed, err := embedDocuments(ctx, r.embeddings, docs)
+	if err != nil {
+		return err
 	}
 
-	// Generate embeddings
-	embeddings, err := r.embeddings.Embed(ctx, texts)
+	if err := r.checkDimensions(embeddings[0]); err != nil {
+		return err
+	}
+
+	if err := r.upsert(ctx, embedded, embeddings); err != nil {
+		return err
+	}
+	return partialIndexError(len(docs), failed)
+}
+
+// AddUniqueDocuments indexes docs, skipping chunks that duplicate stored chunks or each other.
+func (r *QdrantRetriever) AddUniqueDocuments(ctx context.Context, docs []*types.Document, threshold float64) (int, error) {
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	embedded, embeddings, failed, err := embedDocuments(ctx, r.embeddings, docs)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.checkDimensions(embeddings[0]); err != nil {
+		return 0, err
+	}
+
+	r.dedupeMu.Lock()
+	defer r.dedupeMu.Unlock()
+
+	unique, embeddings, skipped, err := uniqueDocuments(embedded, embeddings, threshold, func(doc *types.Document, hash string, vector []float32) (bool, error) {
+		return r.isIndexed(ctx, doc, hash, vector, threshold)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(unique) > 0 {
+		if err := r.upsert(ctx, unique, embeddings); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, partialIndexError(len(docs), failed)
+}
+
+// isIndexed reports whether a chunk with the given hash, or with threshold > 0 a vector
+// at least that similar, is already stored, and if so records doc's path on it.
+func (r *QdrantRetriever) isIndexed(ctx context.Context, doc *types.Document, hash string, vector []float32, threshold float64) (bool, error) {
+	fields := qdrant.NewWithPayloadInclude("path", duplicatePathsKey)
+	points, err := r.client.Scroll(ctx, &qdrant.ScrollPoints{
+		CollectionName: r.collection,
+		Filter: &qdrant.Filter{
+			Must: []*qdrant.Condition{qdrant.NewMatch("chunk_hash", hash)},
+		},
+		Limit:       qdrant.PtrOf(uint32(1)),
+		WithPayload: fields,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to generate embeddings: %w", err)
+		return false, fmt.Errorf("failed to look up chunk in Qdrant: %w", r.qdrantError(ctx, err))
 	}
 
-	// Prepare points for Qdrant
+	if len(points) > 0 {
+		return true, r.addDuplicatePath(ctx, points[0].GetId(), points[0].GetPayload(), doc)
+	}
+	if threshold <= 0 {
+		return false, nil
+	}
+
+	result, err := r.pointsClient.Search(ctx, &qdrant.SearchPoints{
+		CollectionName: r.collection,
+		Vector:         vector,
+		Limit:          1,
+		ScoreThreshold: qdrant.PtrOf(float32(threshold)),
+		WithPayload:    fields,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to search in Qdrant: %w", r.qdrantError(ctx, err))
+	}
+
+	if len(result.GetResult()) == 0 {
+		return false, nil
+	}
+	point := result.GetResult()[0]
+	return true, r.addDuplicatePath(ctx, point.GetId(), point.GetPayload(), doc)
+}
+
+// addDuplicatePath adds doc's path to the duplicate_paths of the point with the given id and payload.
+func (r *QdrantRetriever) addDuplicatePath(ctx context.Context, id *qdrant.PointId, payload map[string]*qdrant.Value, doc *types.Document) error {
+	owner, _ := convertQdrantValue(payload["path"]).(string)
+	path, _ := doc.Metadata["path"].(string)
+	paths := withDuplicatePath(duplicatePaths(map[string]any{duplicatePathsKey: convertQdrantValue(payload[duplicatePathsKey])}), owner, path)
+	if paths == nil {
+		return nil
+	}
+	return r.setPayload(ctx, id, map[string]any{duplicatePathsKey: paths})
+}
+
+// setPayload overwrites the given payload fields of a point. String slices are stored as lists.
+func (r *QdrantRetriever) setPayload(ctx context.Context, id *qdrant.PointId, fields map[string]any) error {
+	payload := make(map[string]any, len(fields))
+	for key, value := range fields {
+		if values, ok := value.([]string); ok {
+			list := make([]any, len(values))
+			for i, v := range values {
+				list[i] = v
+			}
+			value = list
+		}
+		payload[key] = value
+	}
+
+	_, err := r.client.SetPayload(ctx, &qdrant.SetPayloadPoints{
+		CollectionName: r.collection,
+		Wait:           qdrant.PtrOf(true),
+		Payload:        qdrant.NewValueMap(payload),
+		PointsSelector: qdrant.NewPointsSelector(id),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update point in Qdrant: %w", r.qdrantError(ctx, err))
+	}
+	return nil
+}
+
+// upsert writes documents with precomputed vectors to the collection.
+func (r *QdrantRetriever) upsert(ctx context.Context, docs []*types.Document, vectors [][]float32) error {
+	return r.upsertPoints(ctx, r.collection, qdrantPoints(docs, vectors))
+}
+
+// qdrantPoints converts documents with precomputed vectors to Qdrant points.
+func qdrantPoints(docs []*types.Document, vectors [][]float32) []*qdrant.PointStruct {
 	points := make([]*qdrant.PointStruct, len(docs))
 	for i, doc := range docs {
 		// Create payload with content and metadata
 		payload := map[string]interface{}{
 			"content": doc.Content,
+			"doc_id":  doc.ID,
 		}
 
 		// Add metadata to payload, converting unsupported types
@@ -191,19 +455,24 @@ func (r *QdrantRetriever) AddDocuments(ctx context.Context, docs []*types.Docume
 		qdrantPayload := qdrant.NewValueMap(payload)
 
 		points[i] = &qdrant.PointStruct{
-			Id:      qdrant.NewIDNum(uint64(i + 1)), // Use numeric IDs instead of UUIDs
-			Vectors: qdrant.NewVectors(embeddings[i]...),
+			Id:      qdrant.NewIDUUID(pointUUID(doc.ID)),
+			Vectors: qdrant.NewVectors(vectors[i]...),
 			Payload: qdrantPayload,
 		}
 	}
+	return points
+}
 
-	// Upsert points to Qdrant
-	_, err = r.client.Upsert(ctx, &qdrant.UpsertPoints{
-		CollectionName: r.collection,
+// upsertPoints writes points to the named collection, waiting so the points are
+// searchable when it returns.
+func (r *QdrantRetriever) upsertPoints(ctx context.Context, collection string, points []*qdrant.PointStruct) error {
+	_, err := r.client.Upsert(ctx, &qdrant.UpsertPoints{
+		CollectionName: collection,
+		Wait:           qdrant.PtrOf(true),
 		Points:         points,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to upsert points to Qdrant: %w", err)
+		return fmt.Errorf("failed to upsert points to Qdrant: %w", r.qdrantError(ctx, err))
 	}
 
 	return nil
@@ -211,27 +480,362 @@ func (r *QdrantRetriever) AddDocuments(ctx context.Context, docs []*types.Docume
 
 // DeleteCollection removes all documents from the collection.
 func (r *QdrantRetriever) DeleteCollection(ctx context.Context) error {
-	err := r.client.DeleteCollection(ctx, r.collection)
+	target, err := r.aliasTarget(ctx)
 	if err != nil {
+		return err
+	}
+
+	name := r.collection
+	if target != "" {
+		// After a reindex or import the name is an alias of the collection holding the points
+		if err := r.client.DeleteAlias(ctx, r.collection); err != nil {
+			return fmt.Errorf("failed to delete alias: %w", r.qdrantError(ctx, err))
+		}
+		name = target
+	}
+
+	if err := r.client.DeleteCollection(ctx, name); err != nil {
 		return fmt.Errorf("failed to delete collection: %w", err)
 	}
 
 	// Recreate the collection
-	return r.ensureCollection(ctx)
+	return r.createCollection(ctx, r.embeddings.GetDimensions())
+}
+
+// Reindex re-embeds every stored chunk with the current embedding provider and
+// rebuilds the collection, sized for the new vectors. The old collection is only
+// dropped once every chunk is embedded and written (see replaceCollection), so a
+// failure part way loses nothing.
+func (r *QdrantRetriever) Reindex(ctx context.Context) (int, error) {
+	docs, err := r.documents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Content
+	}
+
+	vectors, err := r.embeddings.Embed(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	if len(vectors) != len(docs) || len(vectors[0]) == 0 {
+		return 0, fmt.Errorf("embedding provider returned %d vectors for %d documents", len(vectors), len(docs))
+	}
+
+	if err := r.replaceCollection(ctx, len(vectors[0]), qdrantPoints(docs, vectors)); err != nil {
+		return 0, err
+	}
+
+	return len(docs), nil
+}
+
+// reindexBatchSize is the number of points read per scroll and written per upsert during Reindex.
+const reindexBatchSize = 256
+
+// replaceCollection replaces the contents of the collection with points, sized for
+// vectors of the given dimensions. The points are written to a new collection, which
+// then takes over the collection's name as an alias, so the old points are kept
+// until the new ones are all written.
+func (r *QdrantRetriever) replaceCollection(ctx context.Context, dimensions int, points []*qdrant.PointStruct) error {
+	staging := fmt.Sprintf("%s-%d", r.collection, time.Now().UnixNano())
+	if err := r.newCollection(ctx, staging, dimensions); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(points); start += reindexBatchSize {
+		end := min(start+reindexBatchSize, len(points))
+		if err := r.upsertPoints(ctx, staging, points[start:end]); err != nil {
+			// Best effort: the collection in use is untouched either way
+			_ = r.client.DeleteCollection(ctx, staging)
+			return err
+		}
+	}
+
+	previous, err := r.aliasTarget(ctx)
+	if err != nil {
+		_ = r.client.DeleteCollection(ctx, staging)
+		return err
+	}
+
+	if previous == "" {
+		// A collection has to be dropped before its name can become an alias
+		if err := r.client.DeleteCollection(ctx, r.collection); err != nil {
+			_ = r.client.DeleteCollection(ctx, staging)
+			return fmt.Errorf("failed to delete collection: %w", r.qdrantError(ctx, err))
+		}
+		if err := r.client.CreateAlias(ctx, r.collection, staging); err != nil {
+			return fmt.Errorf("failed to point '%s' at the rebuilt collection '%s': %w", r.collection, staging, r.qdrantError(ctx, err))
+		}
+	} else {
+		err := r.client.UpdateAliases(ctx, []*qdrant.AliasOperations{
+			qdrant.NewAliasDelete(r.collection),
+			qdrant.NewAliasCreate(r.collection, staging),
+		})
+		if err != nil {
+			_ = r.client.DeleteCollection(ctx, staging)
+			return fmt.Errorf("failed to swap in the rebuilt collection: %w", r.qdrantError(ctx, err))
+		}
+		if err := r.client.DeleteCollection(ctx, previous); err != nil {
+			return fmt.Errorf("failed to delete the previous collection '%s': %w", previous, r.qdrantError(ctx, err))
+		}
+	}
+
+	r.dimensions.Store(int64(dimensions))
+	return nil
+}
+
+// aliasTarget returns the collection the collection name is an alias of, or "" if
+// it names a collection itself.
+func (r *QdrantRetriever) aliasTarget(ctx context.Context) (string, error) {
+	aliases, err := r.client.ListAliases(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list aliases: %w", r.qdrantError(ctx, err))
+	}
+
+	for _, alias := range aliases {
+		if alias.GetAliasName() == r.collection {
+			return alias.GetCollectionName(), nil
+		}
+	}
+	return "", nil
+}
+
+// documents reads every stored chunk, including its content and metadata, from the collection.
+func (r *QdrantRetriever) documents(ctx context.Context) ([]*types.Document, error) {
+	var docs []*types.Document
+	var offset *qdrant.PointId
+
+	for {
+		points, next, err := r.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: r.collection,
+			Offset:         offset,
+			Limit:          qdrant.PtrOf(uint32(reindexBatchSize)),
+			WithPayload:    qdrant.NewWithPayload(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read points from Qdrant: %w", r.qdrantError(ctx, err))
+		}
+
+		for _, point := range points {
+			docs = append(docs, documentFromPayload(pointIDString(point.GetId()), point.GetPayload()))
+		}
+
+		if next == nil {
+			return docs, nil
+		}
+		offset = next
+	}
+}
+
+// SourceHash returns the content hash stored for a source path, or "" if it has not been ingested.
+func (r *QdrantRetriever) SourceHash(ctx context.Context, path string) (string, error) {
+	points, err := r.client.Scroll(ctx, &qdrant.ScrollPoints{
+		CollectionName: r.collection,
+		Filter: &qdrant.Filter{
+			Must: []*qdrant.Condition{qdrant.NewMatch("path", path)},
+		},
+		Limit:       qdrant.PtrOf(uint32(1)),
+		WithPayload: qdrant.NewWithPayloadInclude("content_hash"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up source in Qdrant: %w", r.qdrantError(ctx, err))
+	}
+
+	if len(points) == 0 {
+		return "", nil
+	}
+
+	hash, _ := convertQdrantValue(points[0].GetPayload()["content_hash"]).(string)
+	return hash, nil
+}
+
+// DeleteSource removes all documents ingested from a source path. A chunk that other
+// sources duplicate is handed to the first of them instead.
+func (r *QdrantRetriever) DeleteSource(ctx context.Context, path string) error {
+	_, err := r.client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: r.collection,
+		Wait:           qdrant.PtrOf(true),
+		Points: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
+			Must: []*qdrant.Condition{qdrant.NewMatch("path", path), qdrant.NewIsEmpty(duplicatePathsKey)},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete source from Qdrant: %w", r.qdrantError(ctx, err))
+	}
+
+	// The points left with this path are duplicated elsewhere, and the points of other
+	// sources may list it as a duplicate
+	points, err := r.scrollAll(ctx, &qdrant.Filter{
+		Should: []*qdrant.Condition{qdrant.NewMatch("path", path), qdrant.NewMatch(duplicatePathsKey, path)},
+	}, qdrant.NewWithPayloadInclude("path", duplicatePathsKey))
+	if err != nil {
+		return err
+	}
+
+	for _, point := range points {
+		paths := duplicatePaths(map[string]any{duplicatePathsKey: convertQdrantValue(point.GetPayload()[duplicatePathsKey])})
+		fields := map[string]any{}
+		if convertQdrantValue(point.GetPayload()["path"]) == path && len(paths) > 0 {
+			// The title named the deleted source
+			if _, err := r.client.DeletePayload(ctx, &qdrant.DeletePayloadPoints{
+				CollectionName: r.collection,
+				Wait:           qdrant.PtrOf(true),
+				Keys:           []string{"title"},
+				PointsSelector: qdrant.NewPointsSelector(point.GetId()),
+			}); err != nil {
+				return fmt.Errorf("failed to update point in Qdrant: %w", r.qdrantError(ctx, err))
+			}
+			fields["path"] = paths[0]
+			paths = paths[1:]
+		}
+		fields[duplicatePathsKey] = slices.DeleteFunc(paths, func(p string) bool { return p == path })
+
+		if err := r.setPayload(ctx, point.GetId(), fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrollAll returns every point matching filter, with the selected payload.
+func (r *QdrantRetriever) scrollAll(ctx context.Context, filter *qdrant.Filter, payload *qdrant.WithPayloadSelector) ([]*qdrant.RetrievedPoint, error) {
+	var all []*qdrant.RetrievedPoint
+	var offset *qdrant.PointId
+	for {
+		points, next, err := r.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: r.collection,
+			Filter:         filter,
+			Offset:         offset,
+			Limit:          qdrant.PtrOf(uint32(reindexBatchSize)),
+			WithPayload:    payload,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read points from Qdrant: %w", r.qdrantError(ctx, err))
+		}
+
+		all = append(all, points...)
+		if next == nil {
+			return all, nil
+		}
+		offset = next
+	}
+}
+
+// Stats reports how many chunks and source files are indexed.
+// Distinct sources are counted by scrolling the path of every point.
+func (r *QdrantRetriever) Stats(ctx context.Context) (*types.CollectionStats, error) {
+	info, err := r.client.GetCollectionInfo(ctx, r.collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection info: %w", r.qdrantError(ctx, err))
+	}
+
+	count, err := r.client.Count(ctx, &qdrant.CountPoints{
+		CollectionName: r.collection,
+		Exact:          qdrant.PtrOf(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count points: %w", r.qdrantError(ctx, err))
+	}
+
+	stats := &types.CollectionStats{
+		Chunks:     int(count),
+		Dimensions: int(info.GetConfig().GetParams().GetVectorsConfig().GetParams().GetSize()),
+	}
+
+	sources := make(map[string]struct{})
+	var offset *qdrant.PointId
+	for {
+		points, next, err := r.client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: r.collection,
+			Offset:         offset,
+			Limit:          qdrant.PtrOf(uint32(reindexBatchSize)),
+			WithPayload:    qdrant.NewWithPayloadInclude("path"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read points from Qdrant: %w", r.qdrantError(ctx, err))
+		}
+
+		for _, point := range points {
+			if path, ok := convertQdrantValue(point.GetPayload()["path"]).(string); ok {
+				sources[path] = struct{}{}
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		offset = next
+	}
+	stats.Sources = len(sources)
+
+	return stats, nil
 }
 
 // IsHealthy checks if the vector database is accessible.
 func (r *QdrantRetriever) IsHealthy(ctx context.Context) error {
 	exists, err := r.client.CollectionExists(ctx, r.collection)
 	if err != nil {
-		return fmt.Errorf("qdrant health check failed: %w", err)
+		return fmt.Errorf("qdrant health check failed: %w", r.qdrantError(ctx, err))
 	}
 	if !exists {
-		return fmt.Errorf("collection %s does not exist", r.collection)
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, r.collection)
 	}
 	return nil
 }
 
+// pointUUID derives a stable, name-based UUID from a document ID so that
+// re-ingesting a chunk overwrites only that chunk's point.
+func pointUUID(docID string) string {
+	sum := md5.Sum([]byte(docID))
+	sum[6] = (sum[6] & 0x0f) | 0x30 // version 3 (MD5, name-based)
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// pointIDString returns a point ID as a string (works for both UUID and numeric IDs).
+func pointIDString(id *qdrant.PointId) string {
+	if uuid := id.GetUuid(); uuid != "" {
+		return uuid
+	}
+	return fmt.Sprintf("%d", id.GetNum())
+}
+
+// documentFromPayload rebuilds a document from a point's payload, falling back to
+// pointID when the payload predates stored document IDs.
+func documentFromPayload(pointID string, payload map[string]*qdrant.Value) *types.Document {
+	doc := &types.Document{
+		ID:       pointID,
+		Metadata: make(map[string]any),
+	}
+
+	if content, ok := convertQdrantValue(payload["content"]).(string); ok {
+		doc.Content = content
+	}
+
+	// Restore the original document ID
+	if id, ok := convertQdrantValue(payload["doc_id"]).(string); ok && id != "" {
+		doc.ID = id
+	}
+
+	// Copy all other payload fields to metadata
+	for key, value := range payload {
+		if key != "content" && key != "doc_id" {
+			doc.Metadata[key] = convertQdrantValue(value)
+		}
+	}
+
+	return doc
+}
+
 // convertQdrantValue converts a Qdrant value to a Go interface{}.
 func convertQdrantValue(value *qdrant.Value) interface{} {
 	switch v := value.GetKind().(type) {
@@ -243,6 +847,18 @@ func convertQdrantValue(value *qdrant.Value) interface{} {
 		return v.DoubleValue
 	case *qdrant.Value_BoolValue:
 		return v.BoolValue
+	case *qdrant.Value_ListValue:
+		values := make([]interface{}, len(v.ListValue.GetValues()))
+		for i, item := range v.ListValue.GetValues() {
+			values[i] = convertQdrantValue(item)
+		}
+		return values
+	case *qdrant.Value_StructValue:
+		fields := make(map[string]interface{}, len(v.StructValue.GetFields()))
+		for key, item := range v.StructValue.GetFields() {
+			fields[key] = convertQdrantValue(item)
+		}
+		return fields
 	default:
 		return nil
 	}
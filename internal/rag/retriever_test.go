@@ -2,11 +2,32 @@ package rag
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/mabulgu/pawdy/internal/backend/ollama"
+	"github.com/mabulgu/pawdy/internal/retry"
 	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/qdrant/go-client/qdrant"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 // MockEmbeddingProvider is a mock implementation for testing
@@ -30,15 +51,207 @@ func (m *MockEmbeddingProvider) IsHealthy(ctx context.Context) error {
 }
 
 func TestOllamaEmbeddings_GetDimensions(t *testing.T) {
-	embeddings := NewOllamaEmbeddings("http://localhost:11434", "nomic-embed-text")
+	embeddings := NewOllamaEmbeddings("http://localhost:11434", "nomic-embed-text", 512, time.Minute, retry.Policy{})
 	assert.Equal(t, 768, embeddings.GetDimensions())
 }
 
+func TestOllamaEmbeddings_Embed_Batched(t *testing.T) {
+	var batchCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/embed", r.URL.Path)
+		batchCalls++
+
+		var req batchEmbeddingRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		resp := batchEmbeddingResponse{}
+		for range req.Input {
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(len(req.Input))})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	embeddings := NewOllamaEmbeddings(server.URL, "nomic-embed-text", 2, time.Minute, retry.Policy{})
+	vectors, err := embeddings.Embed(context.Background(), []string{"a", "b", "c"})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, batchCalls)
+	assert.Equal(t, [][]float32{{2}, {2}, {1}}, vectors)
+}
+
+func TestOllamaEmbeddings_Embed_LegacyFallback(t *testing.T) {
+	var legacyCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/embed" {
+			http.NotFound(w, r)
+			return
+		}
+
+		legacyCalls++
+		var req embeddingRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		json.NewEncoder(w).Encode(embeddingResponse{Embedding: []float32{float32(len(req.Prompt))}})
+	}))
+	defer server.Close()
+
+	embeddings := NewOllamaEmbeddings(server.URL, "nomic-embed-text", 2, time.Minute, retry.Policy{})
+	vectors, err := embeddings.Embed(context.Background(), []string{"a", "bb", "ccc"})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, legacyCalls)
+	assert.True(t, embeddings.legacy.Load())
+	assert.Equal(t, [][]float32{{1}, {2}, {3}}, vectors)
+}
+
+func TestOllamaEmbeddings_Embed_RetriesWhileBusy(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(batchEmbeddingResponse{Embeddings: [][]float32{{1}}})
+	}))
+	defer server.Close()
+
+	embeddings := NewOllamaEmbeddings(server.URL, "nomic-embed-text", 2, time.Minute, retry.Policy{MaxAttempts: 3, Backoff: time.Millisecond})
+	vectors, err := embeddings.Embed(context.Background(), []string{"a"})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, [][]float32{{1}}, vectors)
+}
+
+func TestOllamaEmbeddings_Embed_Unavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	busy := NewOllamaEmbeddings(server.URL, "nomic-embed-text", 2, time.Minute, retry.Policy{})
+	_, err := busy.Embed(context.Background(), []string{"a"})
+	assert.ErrorIs(t, err, types.ErrBackendUnavailable)
+
+	unreachable := NewOllamaEmbeddings("http://127.0.0.1:1", "nomic-embed-text", 2, time.Second, retry.Policy{})
+	_, err = unreachable.Embed(context.Background(), []string{"a"})
+	assert.ErrorIs(t, err, types.ErrBackendUnavailable)
+
+	// A cancelled request is not an outage
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = unreachable.Embed(ctx, []string{"a"})
+	assert.NotErrorIs(t, err, types.ErrBackendUnavailable)
+}
+
+func TestOllamaEmbeddings_SetMaxConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			previous := peak.Load()
+			if current <= previous || peak.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		json.NewEncoder(w).Encode(batchEmbeddingResponse{Embeddings: [][]float32{{1}}})
+	}))
+	defer server.Close()
+
+	embeddings := NewOllamaEmbeddings(server.URL, "nomic-embed-text", 1, time.Minute, retry.Policy{})
+	embeddings.SetMaxConcurrency(2)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := embeddings.Embed(context.Background(), []string{"a"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func TestOllamaEmbeddings_GetDimensions_Learned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(batchEmbeddingResponse{Embeddings: [][]float32{{0.1, 0.2, 0.3}}})
+	}))
+	defer server.Close()
+
+	embeddings := NewOllamaEmbeddings(server.URL, "mxbai-embed-large:latest", 2, time.Minute, retry.Policy{})
+	assert.Equal(t, 1024, embeddings.GetDimensions())
+
+	_, err := embeddings.Embed(context.Background(), []string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, embeddings.GetDimensions())
+}
+
+func TestDocumentFromPayload(t *testing.T) {
+	payload := qdrant.NewValueMap(map[string]any{
+		"content": "Boot into rescue mode.",
+		"doc_id":  "a1b2c3-0",
+		"path":    "/docs/initramfs.md",
+		"tags":    []any{"rescue", "boot"},
+	})
+
+	doc := documentFromPayload("5f0c8d4e-0000-3000-8000-000000000000", payload)
+
+	assert.Equal(t, "a1b2c3-0", doc.ID)
+	assert.Equal(t, "Boot into rescue mode.", doc.Content)
+	assert.Equal(t, "/docs/initramfs.md", doc.Metadata["path"])
+	assert.Equal(t, []interface{}{"rescue", "boot"}, doc.Metadata["tags"])
+	assert.NotContains(t, doc.Metadata, "content")
+}
+
+func TestExportRecord_RoundTrip(t *testing.T) {
+	stored := &qdrant.RetrievedPoint{
+		Id:      qdrant.NewIDUUID("5f0c8d4e-0000-3000-8000-000000000000"),
+		Vectors: &qdrant.VectorsOutput{VectorsOptions: &qdrant.VectorsOutput_Vector{Vector: &qdrant.VectorOutput{Data: []float32{0.25, -1, 3}}}},
+		Payload: qdrant.NewValueMap(map[string]any{
+			"content":     "Boot into rescue mode.",
+			"chunk_index": int64(3),
+			"weight":      2.0,
+			"tags":        []any{"rescue", "boot"},
+			"section":     map[string]any{"title": "Rescue", "level": int64(2)},
+		}),
+	}
+
+	record, err := newExportRecord(stored)
+	require.NoError(t, err)
+
+	line, err := json.Marshal(record)
+	require.NoError(t, err)
+
+	var decoded exportRecord
+	require.NoError(t, json.Unmarshal(line, &decoded))
+
+	point, err := decoded.point()
+	require.NoError(t, err)
+
+	assert.Equal(t, stored.GetId().GetUuid(), point.GetId().GetUuid())
+	assert.Equal(t, []float32{0.25, -1, 3}, point.GetVectors().GetVector().GetData())
+	require.Len(t, point.GetPayload(), len(stored.GetPayload()))
+	for key, value := range stored.GetPayload() {
+		assert.True(t, proto.Equal(value, point.GetPayload()[key]), "payload field %q changed", key)
+	}
+
+	// Doubles with integral values must not come back as integers
+	assert.IsType(t, &qdrant.Value_DoubleValue{}, point.GetPayload()["weight"].GetKind())
+	assert.Equal(t, uint64(42), exportPointID("42").GetNum())
+}
+
 func TestQdrantRetriever_NewQdrantRetriever(t *testing.T) {
 	mockEmbeddings := &MockEmbeddingProvider{}
 	mockEmbeddings.On("GetDimensions").Return(768)
 
-	retriever, err := NewQdrantRetriever("http://localhost:6333", "test_collection", mockEmbeddings)
+	retriever, err := NewQdrantRetriever("http://localhost:6333", "test_collection", "cosine", mockEmbeddings)
 	
 	// Note: This will fail in CI without Qdrant running, but shows the test structure
 	if err != nil {
@@ -49,6 +262,263 @@ func TestQdrantRetriever_NewQdrantRetriever(t *testing.T) {
 	assert.Equal(t, "test_collection", retriever.collection)
 }
 
+func TestPointUUID(t *testing.T) {
+	first := pointUUID("a1b2c3-0")
+
+	assert.Equal(t, first, pointUUID("a1b2c3-0"))
+	assert.NotEqual(t, first, pointUUID("a1b2c3-1"))
+	assert.NotEqual(t, first, pointUUID("d4e5f6-0"))
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-3[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, first)
+}
+
+func TestQdrantRetriever_CheckDimensions(t *testing.T) {
+	retriever := &QdrantRetriever{collection: "pawdy"}
+
+	// Unknown collection size accepts any vector
+	assert.NoError(t, retriever.checkDimensions(make([]float32, 1024)))
+
+	retriever.dimensions.Store(768)
+	assert.NoError(t, retriever.checkDimensions(make([]float32, 768)))
+
+	err := retriever.checkDimensions(make([]float32, 1024))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stores 768-dimensional vectors but the embedding model produces 1024")
+	assert.Contains(t, err.Error(), "pawdy reindex")
+}
+
+func TestQdrantDistance(t *testing.T) {
+	distance, err := qdrantDistance("dot")
+	require.NoError(t, err)
+	assert.Equal(t, qdrant.Distance_Dot, distance)
+
+	distance, err = qdrantDistance("euclid")
+	require.NoError(t, err)
+	assert.Equal(t, qdrant.Distance_Euclid, distance)
+
+	_, err = qdrantDistance("manhattan")
+	assert.Error(t, err)
+}
+
+func TestQdrantRetriever_AddDocuments_MultipleFiles(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("GetDimensions").Return(2)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"networking chunk"}).Return([][]float32{{1, 0}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"storage chunk"}).Return([][]float32{{0, 1}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"query"}).Return([][]float32{{1, 1}}, nil)
+
+	retriever, err := NewQdrantRetriever("http://localhost:6333", "test_multiple_files", "cosine", mockEmbeddings)
+	if err != nil {
+		t.Skip("Skipping test that requires Qdrant connection")
+	}
+	ctx := context.Background()
+	defer retriever.client.DeleteCollection(ctx, "test_multiple_files")
+
+	require.NoError(t, retriever.AddDocuments(ctx, []*types.Document{
+		{ID: "networking-0", Content: "networking chunk", Metadata: map[string]any{"path": "/docs/networking.md"}},
+	}))
+	require.NoError(t, retriever.AddDocuments(ctx, []*types.Document{
+		{ID: "storage-0", Content: "storage chunk", Metadata: map[string]any{"path": "/docs/storage.md"}},
+	}))
+
+	results, err := retriever.Search(ctx, "query", 10)
+	require.NoError(t, err)
+
+	ids := make([]string, len(results))
+	for i, doc := range results {
+		ids[i] = doc.ID
+	}
+	assert.ElementsMatch(t, []string{"networking-0", "storage-0"}, ids)
+}
+
+func TestInMemoryRetriever_AddDocuments_PartialFailure(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	embedErr := errors.New("input too long")
+	mockEmbeddings.On("Embed", mock.Anything, []string{"first chunk", "huge chunk", "last chunk"}).Return([][]float32(nil), embedErr)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"first chunk"}).Return([][]float32{{1, 0}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"huge chunk"}).Return([][]float32(nil), embedErr)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"last chunk"}).Return([][]float32{{0, 1}}, nil)
+
+	retriever := NewInMemoryRetriever(mockEmbeddings)
+	ctx := context.Background()
+
+	err := retriever.AddDocuments(ctx, []*types.Document{
+		{ID: "doc-0", Content: "first chunk", Metadata: map[string]any{"path": "/docs/a.md"}},
+		{ID: "doc-1", Content: "huge chunk", Metadata: map[string]any{"path": "/docs/a.md"}},
+		{ID: "doc-2", Content: "last chunk", Metadata: map[string]any{"path": "/docs/a.md"}},
+	})
+
+	var partial *types.PartialIndexError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, 3, partial.Total)
+	assert.Equal(t, []types.ChunkError{{ID: "doc-1", Err: embedErr}}, partial.Failed)
+	assert.Contains(t, err.Error(), "2/3 chunks indexed")
+
+	stats, err := retriever.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Chunks)
+
+	// Nothing is indexed when every chunk fails
+	mockEmbeddings.On("Embed", mock.Anything, []string{"huge chunk", "huge chunk"}).Return([][]float32(nil), embedErr)
+	err = retriever.AddDocuments(ctx, []*types.Document{
+		{ID: "doc-3", Content: "huge chunk", Metadata: map[string]any{"path": "/docs/b.md"}},
+		{ID: "doc-4", Content: "huge chunk", Metadata: map[string]any{"path": "/docs/b.md"}},
+	})
+	require.ErrorIs(t, err, embedErr)
+	assert.False(t, errors.As(err, &partial))
+}
+
+func TestEmbedDocuments_Outage(t *testing.T) {
+	docs := []*types.Document{
+		{ID: "doc-0", Content: "first chunk"},
+		{ID: "doc-1", Content: "second chunk"},
+		{ID: "doc-2", Content: "third chunk"},
+		{ID: "doc-3", Content: "fourth chunk"},
+		{ID: "doc-4", Content: "fifth chunk"},
+	}
+
+	// An unavailable provider isn't retried chunk by chunk
+	down := &MockEmbeddingProvider{}
+	down.On("Embed", mock.Anything, mock.Anything).Return([][]float32(nil), types.BackendUnavailable(context.Background(), errors.New("connection refused")))
+	_, _, _, err := embedDocuments(context.Background(), down, docs)
+	require.ErrorIs(t, err, types.ErrBackendUnavailable)
+	down.AssertNumberOfCalls(t, "Embed", 1)
+
+	// Nor is the rest of the batch after a few chunks in a row fail
+	failing := &MockEmbeddingProvider{}
+	failing.On("Embed", mock.Anything, mock.Anything).Return([][]float32(nil), errors.New("timeout"))
+	_, _, _, err = embedDocuments(context.Background(), failing, docs)
+	require.Error(t, err)
+	failing.AssertNumberOfCalls(t, "Embed", 1+maxConsecutiveChunkFailures)
+}
+
+func TestInMemoryRetriever_AddDocuments_MultipleFiles(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("Embed", mock.Anything, []string{"networking chunk"}).Return([][]float32{{1, 0}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"storage chunk"}).Return([][]float32{{0, 1}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"query"}).Return([][]float32{{1, 0.5}}, nil)
+
+	retriever := NewInMemoryRetriever(mockEmbeddings)
+	ctx := context.Background()
+
+	require.NoError(t, retriever.AddDocuments(ctx, []*types.Document{
+		{ID: "networking-0", Content: "networking chunk", Metadata: map[string]any{"path": "/docs/networking.md", "content_hash": "abc"}},
+	}))
+	require.NoError(t, retriever.AddDocuments(ctx, []*types.Document{
+		{ID: "storage-0", Content: "storage chunk", Metadata: map[string]any{"path": "/docs/storage.md"}},
+	}))
+
+	results, err := retriever.Search(ctx, "query", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "networking-0", results[0].ID)
+	assert.Equal(t, "storage-0", results[1].ID)
+	assert.Greater(t, results[0].Score, results[1].Score)
+
+	hash, err := retriever.SourceHash(ctx, "/docs/networking.md")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", hash)
+
+	stats, err := retriever.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &types.CollectionStats{Chunks: 2, Sources: 2, Dimensions: 2}, stats)
+
+	require.NoError(t, retriever.DeleteSource(ctx, "/docs/networking.md"))
+	results, err = retriever.Search(ctx, "query", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "storage-0", results[0].ID)
+
+	require.NoError(t, retriever.DeleteCollection(ctx))
+	results, err = retriever.Search(ctx, "query", 10)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestInMemoryRetriever_AddUniqueDocuments(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("Embed", mock.Anything, []string{"Install the prerequisites."}).Return([][]float32{{1, 0}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"Install the prerequisites.\n", "Install the prerequisites first.", "Configure storage."}).
+		Return([][]float32{{1, 0}, {0.99, 0.05}, {0, 1}}, nil)
+
+	ctx := context.Background()
+
+	// Exact: only the identical text is skipped
+	retriever := NewInMemoryRetriever(mockEmbeddings)
+	skipped, err := retriever.AddUniqueDocuments(ctx, []*types.Document{
+		{ID: "networking-0", Content: "Install the prerequisites.", Metadata: map[string]any{"path": "/docs/networking.md"}},
+	}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, skipped)
+
+	skipped, err = retriever.AddUniqueDocuments(ctx, []*types.Document{
+		{ID: "storage-0", Content: "Install the prerequisites.\n", Metadata: map[string]any{"path": "/docs/storage.md"}},
+		{ID: "storage-1", Content: "Install the prerequisites first.", Metadata: map[string]any{"path": "/docs/storage.md"}},
+		{ID: "storage-2", Content: "Configure storage.", Metadata: map[string]any{"path": "/docs/storage.md"}},
+	}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, skipped)
+
+	stats, err := retriever.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Chunks)
+
+	// Semantic: the near-identical chunk is skipped too
+	retriever = NewInMemoryRetriever(mockEmbeddings)
+	_, err = retriever.AddUniqueDocuments(ctx, []*types.Document{
+		{ID: "networking-0", Content: "Install the prerequisites.", Metadata: map[string]any{"path": "/docs/networking.md"}},
+	}, 0.95)
+	require.NoError(t, err)
+
+	skipped, err = retriever.AddUniqueDocuments(ctx, []*types.Document{
+		{ID: "storage-0", Content: "Install the prerequisites.\n", Metadata: map[string]any{"path": "/docs/storage.md"}},
+		{ID: "storage-1", Content: "Install the prerequisites first.", Metadata: map[string]any{"path": "/docs/storage.md"}},
+		{ID: "storage-2", Content: "Configure storage.", Metadata: map[string]any{"path": "/docs/storage.md"}},
+	}, 0.95)
+	require.NoError(t, err)
+	assert.Equal(t, 2, skipped)
+}
+
+func TestInMemoryRetriever_DeleteSource_Duplicates(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("Embed", mock.Anything, mock.Anything).Return([][]float32{{1, 0}}, nil)
+	ctx := context.Background()
+
+	retriever := NewInMemoryRetriever(mockEmbeddings)
+	for _, path := range []string{"/docs/networking.md", "/docs/storage.md", "/docs/compute.md"} {
+		_, err := retriever.AddUniqueDocuments(ctx, []*types.Document{
+			{ID: path, Content: "Install the prerequisites.", Metadata: map[string]any{"path": path, "title": path}},
+		}, 0)
+		require.NoError(t, err)
+	}
+
+	documents, err := retriever.Search(ctx, "prerequisites", 10)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, "/docs/networking.md", documents[0].Metadata["path"])
+	assert.Equal(t, []string{"/docs/storage.md", "/docs/compute.md"}, documents[0].Metadata["duplicate_paths"])
+
+	// A listed duplicate is dropped from the list
+	require.NoError(t, retriever.DeleteSource(ctx, "/docs/storage.md"))
+	documents, err = retriever.Search(ctx, "prerequisites", 10)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, []string{"/docs/compute.md"}, documents[0].Metadata["duplicate_paths"])
+
+	// The owner hands the chunk to the next source, without its own title
+	require.NoError(t, retriever.DeleteSource(ctx, "/docs/networking.md"))
+	documents, err = retriever.Search(ctx, "prerequisites", 10)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, "/docs/compute.md", documents[0].Metadata["path"])
+	assert.Empty(t, documents[0].Metadata["duplicate_paths"])
+	assert.NotContains(t, documents[0].Metadata, "title")
+
+	require.NoError(t, retriever.DeleteSource(ctx, "/docs/compute.md"))
+	documents, err = retriever.Search(ctx, "prerequisites", 10)
+	require.NoError(t, err)
+	assert.Empty(t, documents)
+}
+
 func TestDocumentProcessing(t *testing.T) {
 	// Test document creation and metadata handling
 	doc := &types.Document{
@@ -65,3 +535,471 @@ func TestDocumentProcessing(t *testing.T) {
 	assert.Contains(t, doc.Content, "test content")
 	assert.Equal(t, "Test Document", doc.Metadata["title"])
 }
+
+func TestKeywordReranker_Rerank(t *testing.T) {
+	reranker := NewKeywordReranker()
+
+	docs := []*types.Document{
+		{ID: "doc1", Content: "Storage classes for local volumes.", Score: 0.80},
+		{ID: "doc2", Content: "Gather initramfs logs from the bootstrap node.", Score: 0.70},
+		{ID: "doc3", Content: "Networking overview.", Score: 0.75},
+	}
+
+	reranked, err := reranker.Rerank(context.Background(), "How do I gather initramfs logs?", docs)
+
+	require.NoError(t, err)
+	require.Len(t, reranked, 3)
+	assert.Equal(t, "doc2", reranked[0].ID)
+	assert.InDelta(t, 0.85, reranked[0].Score, 0.001)
+	assert.Equal(t, 0.70, reranked[0].Metadata["vector_score"])
+	assert.Equal(t, "doc1", reranked[1].ID)
+}
+
+func TestFormatVector(t *testing.T) {
+	assert.Equal(t, "[0.5,-1,0.25]", formatVector([]float32{0.5, -1, 0.25}))
+	assert.Equal(t, "[]", formatVector(nil))
+}
+
+func TestOllamaEmbeddings_IsHealthy_ModelNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/tags", r.URL.Path)
+		w.Write([]byte(`{"models":[{"name":"nomic-embed-text:latest"}]}`))
+	}))
+	defer server.Close()
+
+	embeddings := NewOllamaEmbeddings(server.URL, "nomic-embed-text", 2, time.Minute, retry.Policy{})
+	require.NoError(t, embeddings.IsHealthy(context.Background()))
+
+	embeddings = NewOllamaEmbeddings(server.URL, "mxbai-embed-large", 2, time.Minute, retry.Policy{})
+	err := embeddings.IsHealthy(context.Background())
+
+	var notFound *ollama.ModelNotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "mxbai-embed-large", notFound.Model)
+	assert.Contains(t, err.Error(), "ollama pull mxbai-embed-large")
+}
+
+func TestMMRReranker_Rerank(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("Embed", mock.Anything, []string{"dhcp a", "dhcp b", "storage"}).
+		Return([][]float32{{1, 0}, {0.99, 0.01}, {0, 1}}, nil)
+
+	docs := []*types.Document{
+		{ID: "dhcp-0", Content: "dhcp a", Score: 0.90},
+		{ID: "dhcp-1", Content: "dhcp b", Score: 0.88},
+		{ID: "storage-0", Content: "storage", Score: 0.70},
+	}
+
+	reranked, err := NewMMRReranker(mockEmbeddings, 0.5).Rerank(context.Background(), "query", docs)
+
+	require.NoError(t, err)
+	require.Len(t, reranked, 3)
+	assert.Equal(t, "dhcp-0", reranked[0].ID)
+	assert.Equal(t, "storage-0", reranked[1].ID)
+	assert.Equal(t, "dhcp-1", reranked[2].ID)
+	assert.Equal(t, 0.88, reranked[2].Score)
+}
+
+// stubLLMClient answers Generate from a function for reranker tests.
+type stubLLMClient struct {
+	types.LLMClient
+	generate func(prompt string) string
+}
+
+func (c *stubLLMClient) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	return c.generate(prompt), nil
+}
+
+func TestLLMReranker_Rerank(t *testing.T) {
+	ratings := map[string]string{"networking": "3", "initramfs": "9/10", "storage": "no idea"}
+	client := &stubLLMClient{generate: func(prompt string) string {
+		for content, rating := range ratings {
+			if strings.Contains(prompt, "Passage:\n"+content) {
+				return rating
+			}
+		}
+		return "0"
+	}}
+
+	docs := []*types.Document{
+		{ID: "networking", Content: "networking", Score: 0.9},
+		{ID: "initramfs", Content: "initramfs", Score: 0.8},
+		{ID: "storage", Content: "storage", Score: 0.7},
+		{ID: "firmware", Content: "firmware", Score: 0.6},
+	}
+
+	reranked, err := NewLLMReranker(client, 3).Rerank(context.Background(), "How do I gather initramfs logs?", docs)
+
+	require.NoError(t, err)
+	ids := make([]string, len(reranked))
+	for i, doc := range reranked {
+		ids[i] = doc.ID
+	}
+	assert.Equal(t, []string{"initramfs", "networking", "storage", "firmware"}, ids)
+	assert.InDelta(t, 0.9, reranked[0].Score, 0.001)
+	assert.Equal(t, 0.8, reranked[0].Metadata["retrieval_score"])
+	assert.Equal(t, 0.6, reranked[3].Score)
+
+	// The caller's documents are untouched
+	assert.Equal(t, []string{"networking", "initramfs", "storage", "firmware"}, []string{docs[0].ID, docs[1].ID, docs[2].ID, docs[3].ID})
+	assert.Equal(t, 0.8, docs[1].Score)
+	assert.Nil(t, docs[1].Metadata)
+}
+
+func TestLLMReranker_TruncatesOnRuneBoundary(t *testing.T) {
+	var passage string
+	client := &stubLLMClient{generate: func(prompt string) string {
+		passage = prompt[strings.Index(prompt, "Passage:\n")+len("Passage:\n") : strings.Index(prompt, "\n\nRelevance:")]
+		return "5"
+	}}
+
+	// Each "ü" is two bytes, so the limit falls in the middle of one
+	content := "a" + strings.Repeat("ü", llmRerankMaxChars)
+	_, err := NewLLMReranker(client, 1).Rerank(context.Background(), "query", []*types.Document{{ID: "umlaut", Content: content}})
+
+	require.NoError(t, err)
+	assert.True(t, utf8.ValidString(passage))
+	assert.Equal(t, llmRerankMaxChars-1, len(passage))
+}
+
+func TestOllamaEmbeddings_GetDimensions_Probed(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(batchEmbeddingResponse{Embeddings: [][]float32{{0.1, 0.2, 0.3, 0.4, 0.5}}})
+	}))
+	defer server.Close()
+
+	embeddings := NewOllamaEmbeddings(server.URL, "my-embedder:latest", 2, time.Minute, retry.Policy{})
+	assert.Equal(t, 5, embeddings.GetDimensions())
+	assert.Equal(t, 5, embeddings.GetDimensions())
+	assert.Equal(t, 1, calls)
+
+	unreachable := NewOllamaEmbeddings("http://127.0.0.1:1", "my-embedder", 2, time.Second, retry.Policy{})
+	assert.Equal(t, 768, unreachable.GetDimensions())
+}
+
+func TestWeightBySource(t *testing.T) {
+	docs := []*types.Document{
+		{ID: "notes", Score: 0.8, Metadata: map[string]any{}},
+		{ID: "runbook", Score: 0.7, Metadata: map[string]any{"source_weight": 1.5}},
+		{ID: "draft", Score: 0.6, Metadata: map[string]any{"source_weight": int64(0)}},
+	}
+
+	weighted := WeightBySource(docs)
+	require.Len(t, weighted, 3)
+	assert.Equal(t, "runbook", weighted[0].ID)
+	assert.InDelta(t, 1.05, weighted[0].Score, 1e-9)
+	assert.Equal(t, "notes", weighted[1].ID)
+	assert.Equal(t, "draft", weighted[2].ID)
+	assert.Equal(t, 0.6, weighted[2].Score)
+}
+
+func TestQdrantGRPCPort(t *testing.T) {
+	for rawURL, want := range map[string]int{
+		"http://localhost:6333":           6334,
+		"http://localhost":                6334,
+		"http://qdrant":                   6334,
+		"http://qdrant.internal:80":       6334,
+		"https://abc.cloud.qdrant.io":     6334,
+		"https://qdrant.example.com:443":  6334,
+		"https://qdrant.example.com:6333": 6334,
+		"http://qdrant.internal:8333":     8334,
+		"http://[::1]:7000":               7001,
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		port, err := qdrantGRPCPort(u)
+		require.NoError(t, err)
+		assert.Equal(t, want, port, rawURL)
+	}
+
+	u, err := url.Parse("http://qdrant:notaport")
+	if err == nil {
+		_, err = qdrantGRPCPort(u)
+	}
+	assert.Error(t, err)
+}
+
+// fakeQdrant is an in-process Qdrant gRPC server that keeps collections, their
+// points, and aliases in memory.
+type fakeQdrant struct {
+	port        int
+	mu          sync.Mutex
+	collections map[string]*fakeCollection
+	aliases     map[string]string
+	upsertErr   error // returned by every upsert while set
+}
+
+// fakeCollection is a collection held by fakeQdrant.
+type fakeCollection struct {
+	dimensions uint64
+	points     map[string]*qdrant.PointStruct
+}
+
+// newFakeQdrant serves a fakeQdrant on a local port.
+func newFakeQdrant(t *testing.T) *fakeQdrant {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	fake := &fakeQdrant{
+		port:        listener.Addr().(*net.TCPAddr).Port,
+		collections: make(map[string]*fakeCollection),
+		aliases:     make(map[string]string),
+	}
+
+	server := grpc.NewServer()
+	qdrant.RegisterQdrantServer(server, fakeQdrantService{})
+	qdrant.RegisterCollectionsServer(server, fakeQdrantCollections{fakeQdrant: fake})
+	qdrant.RegisterPointsServer(server, fakeQdrantPoints{fakeQdrant: fake})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return fake
+}
+
+// open connects a retriever for the "pawdy" collection to the fake with opts.
+func (f *fakeQdrant) open(opts QdrantOptions, embeddings types.EmbeddingProvider) (*QdrantRetriever, error) {
+	opts.URL = "http://127.0.0.1"
+	opts.GRPCPort = f.port
+	return NewQdrantRetrieverWithOptions(opts, "pawdy", "cosine", embeddings)
+}
+
+// collection returns the collection name refers to, directly or through an alias.
+func (f *fakeQdrant) collection(name string) (*fakeCollection, error) {
+	if target, ok := f.aliases[name]; ok {
+		name = target
+	}
+	collection, ok := f.collections[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "collection %s not found", name)
+	}
+	return collection, nil
+}
+
+// names returns the names of the collections that exist, without aliases.
+func (f *fakeQdrant) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Sorted(maps.Keys(f.collections))
+}
+
+type fakeQdrantService struct {
+	qdrant.UnimplementedQdrantServer
+}
+
+func (fakeQdrantService) HealthCheck(ctx context.Context, req *qdrant.HealthCheckRequest) (*qdrant.HealthCheckReply, error) {
+	return &qdrant.HealthCheckReply{Title: "qdrant", Version: "1.15.0"}, nil
+}
+
+type fakeQdrantCollections struct {
+	qdrant.UnimplementedCollectionsServer
+	*fakeQdrant
+}
+
+func (f fakeQdrantCollections) CollectionExists(ctx context.Context, req *qdrant.CollectionExistsRequest) (*qdrant.CollectionExistsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.collection(req.GetCollectionName())
+	return &qdrant.CollectionExistsResponse{Result: &qdrant.CollectionExists{Exists: err == nil}}, nil
+}
+
+func (f fakeQdrantCollections) Get(ctx context.Context, req *qdrant.GetCollectionInfoRequest) (*qdrant.GetCollectionInfoResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	collection, err := f.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+	return &qdrant.GetCollectionInfoResponse{Result: &qdrant.CollectionInfo{
+		Config: &qdrant.CollectionConfig{Params: &qdrant.CollectionParams{
+			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{Size: collection.dimensions}),
+		}},
+	}}, nil
+}
+
+func (f fakeQdrantCollections) Create(ctx context.Context, req *qdrant.CreateCollection) (*qdrant.CollectionOperationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := req.GetCollectionName()
+	if _, err := f.collection(name); err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "collection %s already exists", name)
+	}
+	f.collections[name] = &fakeCollection{
+		dimensions: req.GetVectorsConfig().GetParams().GetSize(),
+		points:     make(map[string]*qdrant.PointStruct),
+	}
+	return &qdrant.CollectionOperationResponse{Result: true}, nil
+}
+
+func (f fakeQdrantCollections) Delete(ctx context.Context, req *qdrant.DeleteCollection) (*qdrant.CollectionOperationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.collections[req.GetCollectionName()]
+	delete(f.collections, req.GetCollectionName())
+	return &qdrant.CollectionOperationResponse{Result: ok}, nil
+}
+
+func (f fakeQdrantCollections) ListAliases(ctx context.Context, req *qdrant.ListAliasesRequest) (*qdrant.ListAliasesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	response := &qdrant.ListAliasesResponse{}
+	for alias, collection := range f.aliases {
+		response.Aliases = append(response.Aliases, &qdrant.AliasDescription{AliasName: alias, CollectionName: collection})
+	}
+	return response, nil
+}
+
+func (f fakeQdrantCollections) UpdateAliases(ctx context.Context, req *qdrant.ChangeAliases) (*qdrant.CollectionOperationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, action := range req.GetActions() {
+		switch {
+		case action.GetCreateAlias() != nil:
+			create := action.GetCreateAlias()
+			if _, ok := f.collections[create.GetAliasName()]; ok {
+				return nil, status.Errorf(codes.AlreadyExists, "collection %s already exists", create.GetAliasName())
+			}
+			f.aliases[create.GetAliasName()] = create.GetCollectionName()
+		case action.GetDeleteAlias() != nil:
+			delete(f.aliases, action.GetDeleteAlias().GetAliasName())
+		}
+	}
+	return &qdrant.CollectionOperationResponse{Result: true}, nil
+}
+
+type fakeQdrantPoints struct {
+	qdrant.UnimplementedPointsServer
+	*fakeQdrant
+}
+
+func (f fakeQdrantPoints) Upsert(ctx context.Context, req *qdrant.UpsertPoints) (*qdrant.PointsOperationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.upsertErr != nil {
+		return nil, f.upsertErr
+	}
+	collection, err := f.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+	for _, point := range req.GetPoints() {
+		if size := uint64(len(point.GetVectors().GetVector().GetData())); size != collection.dimensions {
+			return nil, status.Errorf(codes.InvalidArgument, "expected dim: %d, got %d", collection.dimensions, size)
+		}
+		collection.points[pointIDString(point.GetId())] = point
+	}
+	return &qdrant.PointsOperationResponse{Result: &qdrant.UpdateResult{Status: qdrant.UpdateStatus_Completed}}, nil
+}
+
+func (f fakeQdrantPoints) Scroll(ctx context.Context, req *qdrant.ScrollPoints) (*qdrant.ScrollResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	collection, err := f.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+	response := &qdrant.ScrollResponse{}
+	for _, point := range collection.points {
+		response.Result = append(response.Result, &qdrant.RetrievedPoint{Id: point.GetId(), Payload: point.GetPayload()})
+	}
+	return response, nil
+}
+
+func TestQdrantRetriever_Reindex(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("GetDimensions").Return(2)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"networking chunk"}).Return([][]float32{{1, 0}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"networking chunk", "storage chunk"}).Return([][]float32{{1, 0, 0}, {0, 1, 0}}, nil)
+	mockEmbeddings.On("Embed", mock.Anything, []string{"storage chunk", "networking chunk"}).Return([][]float32{{0, 1, 0}, {1, 0, 0}}, nil)
+
+	fake := newFakeQdrant(t)
+	retriever, err := fake.open(QdrantOptions{}, mockEmbeddings)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, retriever.upsert(ctx, []*types.Document{
+		{ID: "net-0", Content: "networking chunk", Metadata: map[string]any{"path": "/docs/net.md"}},
+		{ID: "sto-0", Content: "storage chunk", Metadata: map[string]any{"path": "/docs/storage.md"}},
+	}, [][]float32{{1, 0}, {0, 1}}))
+
+	// A failed write leaves the old collection as it was and drops the new one
+	fake.upsertErr = status.Error(codes.Internal, "disk full")
+	_, err = retriever.Reindex(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+	assert.Equal(t, []string{"pawdy"}, fake.names())
+	assert.Len(t, fake.collections["pawdy"].points, 2)
+	assert.Equal(t, uint64(2), fake.collections["pawdy"].dimensions)
+
+	// A successful reindex swaps the new collection in under the same name
+	fake.upsertErr = nil
+	count, err := retriever.Reindex(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	require.Len(t, fake.names(), 1)
+	swapped, err := fake.collection("pawdy")
+	require.NoError(t, err)
+	assert.Len(t, swapped.points, 2)
+	assert.Equal(t, uint64(3), swapped.dimensions)
+	assert.NoError(t, retriever.checkDimensions([]float32{1, 0, 0}))
+
+	// Reindexing again replaces the aliased collection
+	_, err = retriever.Reindex(ctx)
+	require.NoError(t, err)
+	require.Len(t, fake.names(), 1)
+	assert.NotContains(t, fake.names(), "pawdy")
+
+	// Reset drops the alias and its collection and starts over empty
+	require.NoError(t, retriever.DeleteCollection(ctx))
+	assert.Equal(t, []string{"pawdy"}, fake.names())
+	assert.Empty(t, fake.aliases)
+	assert.Empty(t, fake.collections["pawdy"].points)
+}
+
+func TestQdrantRetriever_Import(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("GetDimensions").Return(2)
+	fake := newFakeQdrant(t)
+	retriever, err := fake.open(QdrantOptions{}, mockEmbeddings)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, retriever.upsert(ctx, []*types.Document{
+		{ID: "net-0", Content: "networking chunk", Metadata: map[string]any{"path": "/docs/net.md"}},
+	}, [][]float32{{1, 0}}))
+	dimensions, err := retriever.CollectionDimensions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, dimensions)
+
+	// An export from another embedding model is refused before anything is written
+	_, err = retriever.Import(ctx, strings.NewReader(`{"id":"1","vector":[1,0,0],"payload":{}}`+"\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "export holds 3-dimensional vectors but collection 'pawdy' stores 2-dimensional vectors")
+	assert.Equal(t, []string{"pawdy"}, fake.names())
+	assert.Len(t, fake.collections["pawdy"].points, 1)
+
+	count, err := retriever.Import(ctx, strings.NewReader(`{"id":"1","vector":[0,1],"payload":{}}`+"\n"+`{"id":"2","vector":[1,0],"payload":{}}`+"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	imported, err := fake.collection("pawdy")
+	require.NoError(t, err)
+	assert.Len(t, imported.points, 2)
+}
+
+func TestQdrantRetriever_NoCreate(t *testing.T) {
+	mockEmbeddings := &MockEmbeddingProvider{}
+	mockEmbeddings.On("GetDimensions").Return(2)
+	fake := newFakeQdrant(t)
+
+	_, err := fake.open(QdrantOptions{NoCreate: true}, mockEmbeddings)
+	require.ErrorIs(t, err, ErrCollectionNotFound)
+	assert.Empty(t, fake.names())
+
+	_, err = fake.open(QdrantOptions{}, mockEmbeddings)
+	require.NoError(t, err)
+
+	retriever, err := fake.open(QdrantOptions{NoCreate: true}, mockEmbeddings)
+	require.NoError(t, err)
+
+	// Resetting an existing collection recreates it empty
+	require.NoError(t, retriever.DeleteCollection(context.Background()))
+	assert.Equal(t, []string{"pawdy"}, fake.names())
+}
@@ -0,0 +1,28 @@
+package rag
+
+import (
+	"sort"
+
+	"github.com/mabulgu/pawdy/internal/document"
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// WeightBySource multiplies each document's score by its source weight (see
+// document.SourceWeight) and returns the documents sorted by the weighted score.
+// Documents of equal score keep their order, so unweighted results are unchanged.
+func WeightBySource(docs []*types.Document) []*types.Document {
+	weighted := false
+	for _, doc := range docs {
+		if weight := document.SourceWeight(doc.Metadata); weight != 1 {
+			doc.Score *= weight
+			weighted = true
+		}
+	}
+
+	if weighted {
+		sort.SliceStable(docs, func(i, j int) bool {
+			return docs[i].Score > docs[j].Score
+		})
+	}
+	return docs
+}
@@ -0,0 +1,112 @@
+// Package retry provides exponential backoff for transient backend failures.
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxBackoff caps the delay between attempts.
+const maxBackoff = 30 * time.Second
+
+// Policy configures retry behavior.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first. Values below 1 mean 1.
+	MaxAttempts int
+
+	// Backoff is the delay before the second attempt; it doubles on each further attempt.
+	Backoff time.Duration
+}
+
+// transientError marks an error as safe to retry.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient marks err as a transient failure that Do should retry.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient reports whether err was marked as transient.
+func IsTransient(err error) bool {
+	var t *transientError
+	return errors.As(err, &t)
+}
+
+// FromRequestError marks network failures from an HTTP client as transient, such as
+// connection refused or a client-side timeout. Errors caused by ctx being cancelled
+// or reaching its deadline are returned unchanged so they are not retried.
+func FromRequestError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return Transient(err)
+	}
+
+	return err
+}
+
+// IsTransientStatus reports whether an HTTP status code indicates a temporary condition.
+func IsTransientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Do calls fn until it succeeds, returns an error not marked transient, or the policy's
+// attempts are exhausted. Context cancellation stops retrying immediately.
+// The returned error is the last error from fn with any transient marker removed.
+func Do(ctx context.Context, policy Policy, fn func() error) error {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := policy.Backoff
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		var t *transientError
+		if !errors.As(err, &t) {
+			return err
+		}
+		err = t.err
+
+		if attempt == attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 3, Backoff: time.Millisecond}, func() error {
+		calls++
+		if calls < 3 {
+			return Transient(errors.New("busy"))
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestDo_StopsOnPermanentError(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 5, Backoff: time.Millisecond}, func() error {
+		calls++
+		return errors.New("bad request")
+	})
+
+	assert.EqualError(t, err, "bad request")
+	assert.Equal(t, 1, calls)
+}
+
+func TestDo_ReturnsLastErrorWhenExhausted(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 2, Backoff: time.Millisecond}, func() error {
+		calls++
+		return Transient(errors.New("still busy"))
+	})
+
+	assert.EqualError(t, err, "still busy")
+	assert.False(t, IsTransient(err))
+	assert.Equal(t, 2, calls)
+}
+
+func TestDo_ContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Do(ctx, Policy{MaxAttempts: 5, Backoff: time.Hour}, func() error {
+		calls++
+		cancel()
+		return Transient(errors.New("busy"))
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
+
+func TestFromRequestError(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+	assert.True(t, IsTransient(FromRequestError(context.Background(), netErr)))
+	assert.False(t, IsTransient(FromRequestError(context.Background(), errors.New("other"))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, IsTransient(FromRequestError(ctx, netErr)))
+}
+
+func TestIsTransientStatus(t *testing.T) {
+	assert.True(t, IsTransientStatus(http.StatusServiceUnavailable))
+	assert.True(t, IsTransientStatus(http.StatusTooManyRequests))
+	assert.False(t, IsTransientStatus(http.StatusNotFound))
+	assert.False(t, IsTransientStatus(http.StatusOK))
+}
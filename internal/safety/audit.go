@@ -0,0 +1,77 @@
+package safety
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// AuditEntry is a single line of the safety audit log.
+// The offending text is stored only as a SHA-256 hash.
+type AuditEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Stage      string    `json:"stage"` // "input" or "output"
+	Category   string    `json:"category,omitempty"`
+	Categories []string  `json:"categories,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Score      float64   `json:"score"`
+	TextSHA256 string    `json:"text_sha256"`
+}
+
+// AuditLog appends blocked safety checks to a JSONL file.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens the audit log at path for appending, creating it if needed.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &AuditLog{file: file}, nil
+}
+
+// Record appends an entry for text blocked at the given stage.
+func (l *AuditLog) Record(stage, text string, result *types.SafetyResult) error {
+	hash := sha256.Sum256([]byte(text))
+	line, err := json.Marshal(AuditEntry{
+		Timestamp:  time.Now().UTC(),
+		Stage:      stage,
+		Category:   result.Category,
+		Categories: result.Categories,
+		Reason:     result.Reason,
+		Score:      result.Score,
+		TextSHA256: hex.EncodeToString(hash[:]),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the audit log file.
+func (l *AuditLog) Close() error {
+	return l.file.Close()
+}
@@ -4,7 +4,10 @@ package safety
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/mabulgu/pawdy/pkg/types"
@@ -12,15 +15,113 @@ import (
 
 // Guard implements safety filtering using Llama Guard 3.
 type Guard struct {
-	client  types.LLMClient
-	enabled bool
+	client     types.LLMClient
+	enabled    bool
+	categories map[string]string
+	disabled   map[string]bool
+	audit      *AuditLog
+
+	injectionAction string
+	threshold       float64
+	failMode        string
+	parseRetries    int
+	logger          *slog.Logger
+}
+
+// Coarse scores for guard verdicts, from 0 (certainly safe) to 1 (certainly unsafe).
+// Llama Guard answers with a label rather than a probability, so the score reflects
+// how clearly the response matched the expected format.
+const (
+	scoreSafe          = 0.0
+	scoreUnsafe        = 1.0
+	scoreUncategorized = 0.9 // "unsafe" without a category code
+	scoreUnparseable   = 0.5 // neither "safe" nor "unsafe"
+)
+
+// Fail modes decide what happens when the guard model can't be reached.
+const (
+	FailClosed = "closed" // return the error, so the question fails
+	FailOpen   = "open"   // log the error and treat the content as safe
+)
+
+// DefaultThreshold is the score at or above which content is blocked when
+// GuardOptions.Threshold is unset. Unparseable responses are blocked.
+const DefaultThreshold = 0.5
+
+// GuardOptions customizes the categories a guard checks for.
+type GuardOptions struct {
+	// Categories overrides or adds category descriptions in the guard prompt,
+	// keyed by code (e.g. "S6"). Unlisted codes keep their default description.
+	Categories map[string]string
+
+	// DisabledCategories lists codes whose classifications are treated as safe.
+	DisabledCategories []string
+
+	// InjectionAction is what CheckContext does with retrieved documents that
+	// look like prompt injections: InjectionStrip (default), InjectionFlag, or InjectionOff.
+	// A disabled guard doesn't scan retrieved documents whatever the action.
+	InjectionAction string
+
+	// Threshold is the score at or above which content is blocked, between 0 and 1.
+	// Zero means DefaultThreshold.
+	Threshold float64
+
+	// FailMode is FailClosed (default) or FailOpen.
+	FailMode string
+
+	// ParseRetries is how many more times a check asks the guard model when its
+	// response is neither "safe" nor "unsafe", before scoring it as unparseable.
+	ParseRetries int
+
+	// Logger receives a warning for each check skipped by FailOpen.
+	Logger *slog.Logger
 }
 
 // NewGuard creates a new safety guard instance.
 func NewGuard(client types.LLMClient, enabled bool) *Guard {
+	return NewGuardWithOptions(client, enabled, GuardOptions{})
+}
+
+// NewGuardWithOptions creates a new safety guard instance with custom categories.
+func NewGuardWithOptions(client types.LLMClient, enabled bool, opts GuardOptions) *Guard {
+	categories := make(map[string]string, len(types.SafetyCategories))
+	for code, description := range types.SafetyCategories {
+		categories[code] = description
+	}
+	for code, description := range opts.Categories {
+		categories[strings.ToUpper(code)] = description
+	}
+
+	disabled := make(map[string]bool, len(opts.DisabledCategories))
+	for _, code := range opts.DisabledCategories {
+		disabled[strings.ToUpper(code)] = true
+	}
+
+	injectionAction := opts.InjectionAction
+	if injectionAction == "" {
+		injectionAction = InjectionStrip
+	}
+
+	failMode := opts.FailMode
+	if failMode == "" {
+		failMode = FailClosed
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
 	return &Guard{
-		client:  client,
-		enabled: enabled,
+		client:          client,
+		enabled:         enabled,
+		categories:      categories,
+		disabled:        disabled,
+		injectionAction: injectionAction,
+		threshold:       opts.Threshold,
+		failMode:        failMode,
+		parseRetries:    max(opts.ParseRetries, 0),
+		logger:          logger,
 	}
 }
 
@@ -30,16 +131,7 @@ func (g *Guard) CheckInput(ctx context.Context, text string) (*types.SafetyResul
 		return &types.SafetyResult{IsSafe: true}, nil
 	}
 
-	prompt := g.buildInputPrompt(text)
-	response, err := g.client.Generate(ctx, prompt, types.GenerateOptions{
-		Temperature: 0.0, // Use deterministic output for safety
-		MaxTokens:   100,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to check input safety: %w", err)
-	}
-
-	return g.parseResponse(response), nil
+	return g.check(ctx, "input", text, g.buildInputPrompt(text))
 }
 
 // CheckOutput validates model output for safety violations.
@@ -48,16 +140,63 @@ func (g *Guard) CheckOutput(ctx context.Context, text string) (*types.SafetyResu
 		return &types.SafetyResult{IsSafe: true}, nil
 	}
 
-	prompt := g.buildOutputPrompt(text)
-	response, err := g.client.Generate(ctx, prompt, types.GenerateOptions{
-		Temperature: 0.0, // Use deterministic output for safety
-		MaxTokens:   100,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to check output safety: %w", err)
+	return g.check(ctx, "output", text, g.buildOutputPrompt(text))
+}
+
+// check classifies text with the guard prompt. A response that isn't a verdict, e.g.
+// when the guard model adds chit-chat, is asked for again up to parseRetries times.
+func (g *Guard) check(ctx context.Context, stage, text, prompt string) (*types.SafetyResult, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := g.client.Generate(ctx, prompt, types.GenerateOptions{
+			Temperature: 0.0, // Use deterministic output for safety
+			MaxTokens:   100,
+		})
+		if err != nil {
+			return g.unavailable(ctx, stage, err)
+		}
+
+		if found, _ := verdict(response); found != "" || attempt >= g.parseRetries {
+			return g.audited(stage, text, g.parseResponse(response))
+		}
+		g.logger.Debug("retrying unparseable safety classification", "stage", stage, "attempt", attempt+1, "response", response)
+	}
+}
+
+// unavailable handles a failed guard call. With FailOpen the content is allowed and the
+// failure logged; otherwise, or if ctx itself is done, the error is returned.
+func (g *Guard) unavailable(ctx context.Context, stage string, err error) (*types.SafetyResult, error) {
+	if g.failMode != FailOpen || ctx.Err() != nil {
+		return nil, fmt.Errorf("failed to check %s safety: %w", stage, err)
+	}
+
+	g.logger.Warn("safety guard unavailable, allowing content unchecked", "stage", stage, "error", err)
+	return &types.SafetyResult{IsSafe: true, Reason: "safety check unavailable"}, nil
+}
+
+// SetAuditLog records every blocked input and output to log.
+func (g *Guard) SetAuditLog(log *AuditLog) {
+	g.audit = log
+}
+
+// audited records result in the audit log if it is a block.
+func (g *Guard) audited(stage, text string, result *types.SafetyResult) (*types.SafetyResult, error) {
+	if g.audit == nil || result.IsSafe {
+		return result, nil
+	}
+
+	if err := g.audit.Record(stage, text, result); err != nil {
+		return nil, fmt.Errorf("failed to audit %s safety block: %w", stage, err)
 	}
 
-	return g.parseResponse(response), nil
+	return result, nil
+}
+
+// Close closes the audit log, if one is set.
+func (g *Guard) Close() error {
+	if g.audit == nil {
+		return nil
+	}
+	return g.audit.Close()
 }
 
 // IsEnabled returns whether safety filtering is currently enabled.
@@ -65,6 +204,41 @@ func (g *Guard) IsEnabled() bool {
 	return g.enabled
 }
 
+// description returns the description of a category code.
+func (g *Guard) description(code string) (string, bool) {
+	categories := g.categories
+	if categories == nil {
+		categories = types.SafetyCategories
+	}
+	description, ok := categories[code]
+	return description, ok
+}
+
+// categoryList renders the categories as "S1: Violent Crimes." lines in code order.
+func (g *Guard) categoryList() string {
+	categories := g.categories
+	if categories == nil {
+		categories = types.SafetyCategories
+	}
+
+	codes := make([]string, 0, len(categories))
+	for code := range categories {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if len(codes[i]) != len(codes[j]) {
+			return len(codes[i]) < len(codes[j])
+		}
+		return codes[i] < codes[j]
+	})
+
+	var list strings.Builder
+	for _, code := range codes {
+		fmt.Fprintf(&list, "%s: %s.\n", code, strings.TrimSuffix(categories[code], "."))
+	}
+	return list.String()
+}
+
 // buildInputPrompt constructs the safety check prompt for user input.
 func (g *Guard) buildInputPrompt(text string) string {
 	return fmt.Sprintf(`<|begin_of_text|><|start_header_id|>system<|end_header_id|>
@@ -72,21 +246,7 @@ func (g *Guard) buildInputPrompt(text string) string {
 You are Llama Guard 3, a content policy classifier. Your task is to classify the following user request into one of the safety categories defined below.
 
 <BEGIN UNSAFE CONTENT CATEGORIES>
-S1: Violent Crimes. 
-S2: Non-Violent Crimes.
-S3: Sex Crimes.
-S4: Child Exploitation.
-S5: Defamation.
-S6: Specialized Advice.
-S7: Privacy.
-S8: Intellectual Property.
-S9: Indiscriminate Weapons.
-S10: Hate.
-S11: Self-Harm.
-S12: Sexual Content.
-S13: Elections.
-S14: Code Interpreter Abuse.
-<END UNSAFE CONTENT CATEGORIES>
+%s<END UNSAFE CONTENT CATEGORIES>
 
 <BEGIN CONVERSATION>
 
@@ -94,7 +254,7 @@ S14: Code Interpreter Abuse.
 
 %s<|eot_id|><|start_header_id|>assistant<|end_header_id|>
 
-`, text)
+`, g.categoryList(), text)
 }
 
 // buildOutputPrompt constructs the safety check prompt for model output.
@@ -104,21 +264,7 @@ func (g *Guard) buildOutputPrompt(text string) string {
 You are Llama Guard 3, a content policy classifier. Your task is to classify the following AI assistant response into one of the safety categories defined below.
 
 <BEGIN UNSAFE CONTENT CATEGORIES>
-S1: Violent Crimes. 
-S2: Non-Violent Crimes.
-S3: Sex Crimes.
-S4: Child Exploitation.
-S5: Defamation.
-S6: Specialized Advice.
-S7: Privacy.
-S8: Intellectual Property.
-S9: Indiscriminate Weapons.
-S10: Hate.
-S11: Self-Harm.
-S12: Sexual Content.
-S13: Elections.
-S14: Code Interpreter Abuse.
-<END UNSAFE CONTENT CATEGORIES>
+%s<END UNSAFE CONTENT CATEGORIES>
 
 <BEGIN CONVERSATION>
 
@@ -128,62 +274,126 @@ S14: Code Interpreter Abuse.
 
 Please classify this response.<|eot_id|><|start_header_id|>assistant<|end_header_id|>
 
-`, text)
+`, g.categoryList(), text)
 }
 
+// verdictPattern matches a line of a guard response that starts with a verdict, with
+// the category codes that follow it on the same or later lines, such as "unsafe S6"
+// or "unsafe\nS1,S10".
+var verdictPattern = regexp.MustCompile(`(?im)^\W*(safe|unsafe)\b[\s:.]*((?:s\d+\b[\s,;]*)*)`)
+
+// verdict finds the verdict in a guard response and the text its category codes are
+// read from. A line starting with "unsafe" wins over one starting with "safe", which
+// may be chit-chat such as "Safe to say..."; without either, a response mentioning
+// "unsafe" anywhere, such as "This request is unsafe.\nS1", is unsafe. It returns ""
+// if the response has no verdict.
+func verdict(response string) (string, string) {
+	safe := false
+	for _, match := range verdictPattern.FindAllStringSubmatch(response, -1) {
+		if strings.EqualFold(match[1], "unsafe") {
+			return "unsafe", match[2]
+		}
+		safe = true
+	}
+
+	switch {
+	case safe:
+		return "safe", ""
+	case strings.Contains(strings.ToLower(response), "unsafe"):
+		return "unsafe", response
+	default:
+		return "", ""
+	}
+}
+
+// categoryPattern matches category codes such as "S6" in a guard response.
+var categoryPattern = regexp.MustCompile(`(?i)\bs\d+\b`)
+
 // parseResponse parses the Llama Guard response to determine safety.
 func (g *Guard) parseResponse(response string) *types.SafetyResult {
-	response = strings.TrimSpace(response)
-	
-	// Check for safe response
-	if strings.ToLower(response) == "safe" {
+	result := g.classify(response)
+	result.IsSafe = result.Score < g.blockThreshold()
+	return result
+}
+
+// blockThreshold returns the score at or above which content is blocked.
+func (g *Guard) blockThreshold() float64 {
+	if g.threshold == 0 {
+		return DefaultThreshold
+	}
+	return g.threshold
+}
+
+// classify scores a Llama Guard response and picks the category it flags, if any.
+func (g *Guard) classify(response string) *types.SafetyResult {
+	found, categories := verdict(response)
+	switch found {
+	case "":
+		// Treat a response we can't parse as borderline
 		return &types.SafetyResult{
-			IsSafe: true,
+			Reason: "Unable to determine safety classification",
+			Score:  scoreUnparseable,
 		}
+	case "safe":
+		return &types.SafetyResult{Score: scoreSafe}
 	}
 
-	// Check for unsafe response with category
-	unsafePattern := regexp.MustCompile(`(?i)unsafe\s*(s\d+)?`)
-	matches := unsafePattern.FindStringSubmatch(response)
-	
-	if len(matches) > 0 {
-		category := ""
-		reason := ""
-		
-		if len(matches) > 1 && matches[1] != "" {
-			categoryCode := strings.ToUpper(matches[1])
-			category = categoryCode
-			if description, exists := types.SafetyCategories[categoryCode]; exists {
-				reason = description
-			}
+	// Llama Guard may list several categories
+	codes := categoryPattern.FindAllString(categories, -1)
+	if len(codes) == 0 {
+		return &types.SafetyResult{Score: scoreUncategorized}
+	}
+
+	var flagged, reasons []string
+	for _, code := range codes {
+		code = strings.ToUpper(code)
+		if g.disabled[code] || slices.Contains(flagged, code) {
+			continue
 		}
 
-		return &types.SafetyResult{
-			IsSafe:   false,
-			Category: category,
-			Reason:   reason,
+		flagged = append(flagged, code)
+		if description, ok := g.description(code); ok {
+			reasons = append(reasons, description)
 		}
 	}
 
-	// Default to unsafe if we can't parse the response
+	// Every flagged category is disabled
+	if len(flagged) == 0 {
+		return &types.SafetyResult{Score: scoreSafe}
+	}
+
 	return &types.SafetyResult{
-		IsSafe: false,
-		Reason: "Unable to determine safety classification",
+		Category:   flagged[0],
+		Categories: flagged,
+		Reason:     strings.Join(reasons, "; "),
+		Score:      scoreUnsafe,
 	}
 }
 
-// GetRefusalMessage returns an appropriate refusal message for unsafe content.
-func GetRefusalMessage(category string) string {
+// GetRefusalMessage returns an appropriate refusal message for unsafe content, naming
+// each built-in category it violates. Guard.RefusalMessage uses a guard's own categories.
+func GetRefusalMessage(categories ...string) string {
+	return (&Guard{}).RefusalMessage(categories...)
+}
+
+// RefusalMessage returns an appropriate refusal message for unsafe content, naming
+// each category it violates as the guard describes it.
+func (g *Guard) RefusalMessage(categories ...string) string {
 	baseMessage := "I can't provide assistance with that request as it may violate content safety guidelines"
-	
-	if category == "" {
-		return baseMessage + "."
+
+	var named []string
+	for _, category := range categories {
+		if description, exists := g.description(category); exists {
+			named = append(named, fmt.Sprintf("%s - %s", category, description))
+		}
 	}
-	
-	categoryDescription, exists := types.SafetyCategories[category]
-	if !exists {
+
+	switch len(named) {
+	case 0:
 		return baseMessage + "."
+	case 1:
+		return fmt.Sprintf("%s (category: %s).", baseMessage, named[0])
+	default:
+		return fmt.Sprintf("%s (categories: %s).", baseMessage, strings.Join(named, ", "))
 	}
-	
-	return fmt.Sprintf("%s (category: %s - %s).", baseMessage, category, categoryDescription)
 }
@@ -0,0 +1,83 @@
+package safety
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// Actions taken on retrieved documents that look like prompt injections.
+const (
+	InjectionStrip = "strip" // remove the offending lines
+	InjectionFlag  = "flag"  // keep the content and mark the document
+	InjectionOff   = "off"   // don't scan retrieved documents
+)
+
+// strippedLine replaces lines removed by InjectionStrip.
+const strippedLine = "[removed: possible prompt injection]"
+
+// injectionPatterns match common prompt-injection phrasing in retrieved text.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(of\s+)?(the\s+|your\s+)?(previous|prior|above|earlier|preceding)\s+(instructions|prompts?|messages|rules|directions)`),
+	regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(a|an|in|the)\b`),
+	regexp.MustCompile(`(?i)\b(new|updated|real)\s+system\s+(prompt|instructions)\b`),
+	regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|output)\s+(your|the)\s+(system\s+prompt|hidden\s+instructions|initial\s+instructions)`),
+	regexp.MustCompile(`(?i)\b(do\s+not|don't)\s+(tell|inform|mention\s+this\s+to)\s+the\s+user\b`),
+	regexp.MustCompile(`(?i)\bact\s+as\s+(an?\s+)?(unrestricted|unfiltered|jailbroken)\b`),
+	regexp.MustCompile(`<\|(begin_of_text|start_header_id|end_header_id|eot_id)\|>`),
+}
+
+// CheckContext scans retrieved documents for prompt-injection phrasing before they are
+// added to the prompt. Suspicious documents get Metadata["injection_suspected"] set and,
+// with InjectionStrip, the matching lines removed. Documents are copied, not modified in place.
+func (g *Guard) CheckContext(ctx context.Context, docs []*types.Document) ([]*types.Document, error) {
+	if !g.enabled || g.injectionAction == InjectionOff {
+		return docs, nil
+	}
+
+	checked := make([]*types.Document, len(docs))
+	for i, doc := range docs {
+		if !containsInjection(doc.Content) {
+			checked[i] = doc
+			continue
+		}
+
+		flagged := *doc
+		flagged.Metadata = make(map[string]any, len(doc.Metadata)+1)
+		for key, value := range doc.Metadata {
+			flagged.Metadata[key] = value
+		}
+		flagged.Metadata["injection_suspected"] = true
+
+		if g.injectionAction != InjectionFlag {
+			flagged.Content = stripInjections(doc.Content)
+		}
+
+		checked[i] = &flagged
+	}
+
+	return checked, nil
+}
+
+// containsInjection reports whether text matches any injection pattern.
+func containsInjection(text string) bool {
+	for _, pattern := range injectionPatterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripInjections replaces each line that matches an injection pattern.
+func stripInjections(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if containsInjection(line) {
+			lines[i] = strippedLine
+		}
+	}
+	return strings.Join(lines, "\n")
+}
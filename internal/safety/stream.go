@@ -0,0 +1,98 @@
+package safety
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// StreamChecker checks a streamed response while it is generated, so a violation
+// stops the stream before the unsafe text is shown. Text is held back until it has
+// been checked: once interval bytes are waiting, the guard sees the last window
+// bytes of the response, including everything not yet released.
+//
+// With an interval of 0, text is released as it arrives and only the complete
+// response is checked, after it has been shown.
+type StreamChecker struct {
+	gate     types.SafetyGate
+	interval int
+	window   int
+
+	response strings.Builder
+	released int // bytes of response already returned to the caller
+}
+
+// NewStreamChecker creates a checker that runs gate every interval bytes over a
+// window of the most recent bytes of the response.
+func NewStreamChecker(gate types.SafetyGate, interval, window int) *StreamChecker {
+	return &StreamChecker{gate: gate, interval: interval, window: window}
+}
+
+// Add appends streamed text and returns the text that is now safe to show.
+// A non-nil safety result is returned when the response is blocked.
+func (c *StreamChecker) Add(ctx context.Context, text string) (string, *types.SafetyResult, error) {
+	c.response.WriteString(text)
+
+	if !c.gate.IsEnabled() || c.interval <= 0 {
+		return c.release(), nil, nil
+	}
+
+	if c.response.Len()-c.released < c.interval {
+		return "", nil, nil
+	}
+
+	return c.check(ctx, c.recent())
+}
+
+// Finish checks the complete response and returns any text still held back.
+// A non-nil safety result is returned when the response is blocked.
+func (c *StreamChecker) Finish(ctx context.Context) (string, *types.SafetyResult, error) {
+	if !c.gate.IsEnabled() {
+		return c.release(), nil, nil
+	}
+
+	return c.check(ctx, c.response.String())
+}
+
+// check runs the output guard on text and releases the held-back text if it passes.
+func (c *StreamChecker) check(ctx context.Context, text string) (string, *types.SafetyResult, error) {
+	result, err := c.gate.CheckOutput(ctx, text)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !result.IsSafe {
+		return "", result, nil
+	}
+
+	return c.release(), nil, nil
+}
+
+// recent returns the last window bytes of the response, extended to cover all
+// unreleased text and to start on a rune boundary.
+func (c *StreamChecker) recent() string {
+	response := c.response.String()
+
+	start := len(response) - c.window
+	if start > c.released {
+		start = c.released
+	}
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(response[start]) {
+		start--
+	}
+
+	return response[start:]
+}
+
+// release returns the text added since the last release.
+func (c *StreamChecker) release() string {
+	response := c.response.String()
+	text := response[c.released:]
+	c.released = len(response)
+	return text
+}
@@ -0,0 +1,272 @@
+// Package server exposes Pawdy over HTTP for editor plugins, chat bots, and other clients.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/document"
+	"github.com/mabulgu/pawdy/internal/rag"
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// maxRequestBytes bounds the size of a request body.
+const maxRequestBytes = 1 << 20
+
+// Server handles HTTP requests with a single long-lived App.
+type Server struct {
+	app    *app.App
+	logger *slog.Logger
+	mux    *http.ServeMux
+}
+
+// AskRequest is the body of POST /ask.
+// Zero generation settings use the configured values.
+type AskRequest struct {
+	Question    string  `json:"question"`
+	Temperature float64 `json:"temperature,omitempty"`
+	TopP        float64 `json:"top_p,omitempty"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+}
+
+// IngestRequest is the body of POST /ingest. Path is a file or directory on the
+// server, or an http(s) URL of a single page.
+type IngestRequest struct {
+	Path         string `json:"path"`
+	ChunkTokens  int    `json:"chunk_tokens,omitempty"`
+	ChunkOverlap int    `json:"chunk_overlap,omitempty"`
+	Force        bool   `json:"force,omitempty"`
+}
+
+// IngestResponse reports the outcome of POST /ingest.
+type IngestResponse struct {
+	Files      int            `json:"files"`
+	Chunks     int            `json:"chunks"`
+	Duplicates int            `json:"duplicates"`
+	Unchanged  int            `json:"unchanged"`
+	Empty      []string       `json:"empty"` // files that yielded no chunks
+	Failed     []IngestFailed `json:"failed"`
+}
+
+// IngestFailed names a file that could not be ingested and why.
+type IngestFailed struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // as in error responses, e.g. "backend_unavailable"
+}
+
+// HealthResponse is the body of GET /health.
+type HealthResponse struct {
+	Healthy  bool                  `json:"healthy"`
+	Services []*types.HealthStatus `json:"services"`
+}
+
+// errorResponse is the body of every failed request. Code, if set, names the kind of
+// failure so clients can tell them apart without parsing Error.
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// errorKinds are the failures reported with a status and code of their own, checked
+// in order with errors.Is; any other error is a 500 without a code.
+var errorKinds = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{app.ErrEmptyQuestion, http.StatusBadRequest, "invalid_question"},
+	{app.ErrInputTooLong, http.StatusBadRequest, "invalid_question"},
+	{app.ErrSafetyBlocked, http.StatusUnprocessableEntity, "safety_blocked"},
+	{rag.ErrCollectionNotFound, http.StatusNotFound, "collection_not_found"},
+	{types.ErrBackendUnavailable, http.StatusServiceUnavailable, "backend_unavailable"},
+}
+
+// classify returns the HTTP status and error code for err.
+func classify(err error) (int, string) {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.status, kind.code
+		}
+	}
+	return http.StatusInternalServerError, ""
+}
+
+// New creates a server that answers requests with pawdy and logs to its logger.
+func New(pawdy *app.App) *Server {
+	logger := pawdy.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	s := &Server{
+		app:    pawdy,
+		logger: logger,
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("POST /ask", s.handleAsk)
+	s.mux.HandleFunc("POST /ingest", s.handleIngest)
+	s.mux.HandleFunc("GET /health", s.handleHealth)
+
+	return s
+}
+
+// ServeHTTP dispatches a request to its handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleAsk answers a question with app.Answer, including sources and the safety verdict.
+func (s *Server) handleAsk(w http.ResponseWriter, r *http.Request) {
+	var req AskRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	overrides := types.GenerateOptions{
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxTokens,
+	}
+	if err := s.app.ValidateOverrides(overrides); err != nil {
+		s.fail(w, http.StatusBadRequest, err)
+		return
+	}
+
+	answer, err := s.app.AskDetailed(r.Context(), req.Question, overrides)
+	if err != nil {
+		status, _ := classify(err)
+		if status >= http.StatusInternalServerError {
+			err = fmt.Errorf("failed to get answer: %w", err)
+		}
+		s.fail(w, status, err)
+		return
+	}
+
+	s.respond(w, http.StatusOK, answer)
+}
+
+// handleIngest indexes a file, every supported file in a directory, or a web page.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	var req IngestRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	if strings.TrimSpace(req.Path) == "" {
+		s.fail(w, http.StatusBadRequest, fmt.Errorf("path is required"))
+		return
+	}
+
+	ctx := r.Context()
+	response := IngestResponse{Empty: []string{}, Failed: []IngestFailed{}}
+	record := func(path string, chunks, duplicates int, err error) {
+		response.Files++
+		switch {
+		case errors.Is(err, app.ErrUnchanged):
+			response.Unchanged++
+		case errors.Is(err, app.ErrNoChunks):
+			response.Empty = append(response.Empty, path)
+		case err != nil:
+			// Chunks indexed before a partial failure still count
+			response.Chunks += chunks
+			response.Duplicates += duplicates
+			_, code := classify(err)
+			response.Failed = append(response.Failed, IngestFailed{Path: path, Error: err.Error(), Code: code})
+		default:
+			response.Chunks += chunks
+			response.Duplicates += duplicates
+		}
+	}
+
+	if document.IsURL(req.Path) {
+		_, chunks, duplicates, err := s.app.IngestURL(ctx, req.Path, req.ChunkTokens, req.ChunkOverlap, req.Force)
+		record(req.Path, chunks, duplicates, err)
+		s.respond(w, http.StatusOK, response)
+		return
+	}
+
+	info, err := os.Stat(req.Path)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, fmt.Errorf("failed to access %s: %w", req.Path, err))
+		return
+	}
+
+	files := []string{req.Path}
+	if info.IsDir() {
+		files, err = document.CollectFiles(req.Path)
+		if err != nil {
+			s.fail(w, http.StatusInternalServerError, fmt.Errorf("failed to scan directory: %w", err))
+			return
+		}
+	} else if !document.IsSupportedFile(req.Path) {
+		s.fail(w, http.StatusBadRequest, fmt.Errorf("unsupported file type: %s", req.Path))
+		return
+	}
+
+	for _, file := range files {
+		chunks, duplicates, err := s.app.IngestFile(ctx, file, req.ChunkTokens, req.ChunkOverlap, req.Force)
+		record(file, chunks, duplicates, err)
+	}
+
+	s.respond(w, http.StatusOK, response)
+}
+
+// handleHealth reports the health of every service, with 503 if any is down.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	statuses, err := s.app.HealthCheck(r.Context())
+	if err != nil {
+		s.fail(w, http.StatusInternalServerError, fmt.Errorf("health check failed: %w", err))
+		return
+	}
+
+	response := HealthResponse{Healthy: true, Services: statuses}
+	for _, status := range statuses {
+		if !status.Healthy {
+			response.Healthy = false
+		}
+	}
+
+	code := http.StatusOK
+	if !response.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	s.respond(w, code, response)
+}
+
+// decode reads a JSON request body into v, responding with 400 if it is invalid.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		s.fail(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// respond writes v as a JSON response.
+func (s *Server) respond(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warn("failed to write response", "error", err)
+	}
+}
+
+// fail writes err as a JSON error response and logs server-side failures.
+func (s *Server) fail(w http.ResponseWriter, code int, err error) {
+	if code >= http.StatusInternalServerError {
+		s.logger.Error("request failed", "status", code, "error", err)
+	}
+	_, kind := classify(err)
+	s.respond(w, code, errorResponse{Error: err.Error(), Code: kind})
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mabulgu/pawdy/internal/app"
+	"github.com/mabulgu/pawdy/internal/prompt"
+	"github.com/mabulgu/pawdy/internal/rag"
+	"github.com/mabulgu/pawdy/internal/safety"
+	"github.com/mabulgu/pawdy/internal/testutil"
+	"github.com/mabulgu/pawdy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	handler := New(&app.App{
+		Config:     &types.Config{Backend: "ollama", VectorDB: "memory", Embeddings: "ollama-nomic"},
+		LLMClient:  &testutil.HealthyClient{},
+		SafetyGate: safety.NewGuard(nil, false),
+		Retriever:  rag.NewInMemoryRetriever(&testutil.DownEmbeddings{}),
+	})
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	response := request(http.MethodGet, "/health", "")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+
+	var health HealthResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&health))
+	assert.False(t, health.Healthy)
+	assert.NotEmpty(t, health.Services)
+
+	response = request(http.MethodPost, "/ask", `{"question": "  "}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), app.ErrEmptyQuestion.Error())
+
+	var failure errorResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&failure))
+	assert.Equal(t, "invalid_question", failure.Code)
+
+	response = request(http.MethodPost, "/ask", `{"question": "How do I gather logs?"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&failure))
+	assert.Equal(t, "backend_unavailable", failure.Code)
+
+	response = request(http.MethodPost, "/ask", `{"query": "typo"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), "invalid request body")
+
+	response = request(http.MethodPost, "/ask", `{"question": "How do I gather logs?", "top_p": 1.5}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), "top_p must be between")
+
+	response = request(http.MethodPost, "/ingest", `{"path": ""}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = request(http.MethodGet, "/ask", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+}
+
+func TestServerConcurrentAsk(t *testing.T) {
+	retriever := rag.NewInMemoryRetriever(&testutil.ConstantEmbeddings{})
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*types.Document{
+		{ID: "a1b2c3-0", Content: "Gather logs with journalctl.", Metadata: map[string]any{"path": "/docs/logs.md"}},
+		{ID: "a1b2c3-1", Content: "Boot into rescue mode.", Metadata: map[string]any{"path": "/docs/rescue.md"}},
+	}))
+
+	handler := New(&app.App{
+		Config:        &types.Config{TopK: 5},
+		LLMClient:     &testutil.HealthyClient{Answer: "Use journalctl."},
+		SafetyGate:    safety.NewGuard(nil, false),
+		Retriever:     retriever,
+		Reranker:      rag.NewKeywordReranker(),
+		PromptBuilder: prompt.NewBuilder("You are Pawdy."),
+		Logger:        slog.New(slog.DiscardHandler),
+	})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/ask", strings.NewReader(`{"question": "How do I gather logs?"}`)))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+		})
+	}
+	wg.Wait()
+}
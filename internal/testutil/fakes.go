@@ -0,0 +1,55 @@
+// Package testutil provides fake backends shared by the tests of several packages.
+package testutil
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mabulgu/pawdy/pkg/types"
+)
+
+// HealthyClient is an LLMClient whose backend is always reachable. Generate answers
+// with Answer.
+type HealthyClient struct {
+	types.LLMClient
+	Answer string
+}
+
+// Generate returns Answer.
+func (c *HealthyClient) Generate(ctx context.Context, prompt string, opts types.GenerateOptions) (string, error) {
+	return c.Answer, nil
+}
+
+// IsHealthy always succeeds.
+func (c *HealthyClient) IsHealthy(ctx context.Context) error {
+	return nil
+}
+
+// DownEmbeddings is an EmbeddingProvider whose service is unreachable.
+type DownEmbeddings struct {
+	types.EmbeddingProvider
+}
+
+// Embed fails as if the connection was refused.
+func (e *DownEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, types.BackendUnavailable(ctx, errors.New("connection refused"))
+}
+
+// IsHealthy fails as if the connection was refused.
+func (e *DownEmbeddings) IsHealthy(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+// ConstantEmbeddings is an EmbeddingProvider that embeds every text as the same vector.
+type ConstantEmbeddings struct {
+	types.EmbeddingProvider
+}
+
+// Embed returns the vector [1, 0] for each text.
+func (e *ConstantEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
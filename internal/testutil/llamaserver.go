@@ -0,0 +1,40 @@
+package testutil
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+)
+
+// FakeLlamaServerEnv is set in the environment of a test binary that should act as a fake
+// llama-server. Tests point llamacpp_server at os.Args[0] with it set, and TestMain calls
+// ServeFakeLlamaServer instead of running the tests.
+const FakeLlamaServerEnv = "PAWDY_FAKE_LLAMA_SERVER"
+
+// ServeFakeLlamaServer serves the llama-server API on the --host and --port in args until
+// the process is killed. Every completion answers with answers[name], where name is the
+// file name of the --model, so tests can tell which model a request reached.
+func ServeFakeLlamaServer(args []string, answers map[string]string) error {
+	flags := flag.NewFlagSet("llama-server", flag.ContinueOnError)
+	model := flags.String("model", "", "")
+	host := flags.String("host", "127.0.0.1", "")
+	port := flags.Int("port", 0, "")
+	flags.Int("ctx-size", 0, "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status": "ok"}`)
+	})
+	mux.HandleFunc("POST /completion", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"content": answers[filepath.Base(*model)], "stop": true})
+	})
+
+	return http.ListenAndServe(net.JoinHostPort(*host, fmt.Sprint(*port)), mux)
+}
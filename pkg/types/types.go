@@ -3,6 +3,8 @@ package types
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"time"
 )
@@ -27,6 +29,26 @@ type StreamToken struct {
 	Text  string
 	Done  bool
 	Error error
+
+	// Stats is set on the final token by backends that report generation statistics.
+	Stats *GenerationStats
+}
+
+// GenerationStats reports token usage and timing for a single generation.
+type GenerationStats struct {
+	PromptTokens       int           `json:"prompt_tokens"`
+	CompletionTokens   int           `json:"completion_tokens"`
+	PromptDuration     time.Duration `json:"prompt_duration"`
+	GenerationDuration time.Duration `json:"generation_duration"`
+	TotalDuration      time.Duration `json:"total_duration"`
+}
+
+// TokensPerSecond returns the completion token throughput, or 0 if unknown.
+func (s *GenerationStats) TokensPerSecond() float64 {
+	if s.GenerationDuration <= 0 {
+		return 0
+	}
+	return float64(s.CompletionTokens) / s.GenerationDuration.Seconds()
 }
 
 // GenerateOptions configures text generation parameters.
@@ -46,16 +68,25 @@ type SafetyGate interface {
 	// CheckOutput validates model output for safety violations.
 	CheckOutput(ctx context.Context, text string) (*SafetyResult, error)
 
+	// CheckContext screens retrieved documents for prompt injections before they
+	// are added to a prompt, returning the documents to use instead.
+	CheckContext(ctx context.Context, docs []*Document) ([]*Document, error)
+
 	// IsEnabled returns whether safety filtering is currently enabled.
 	IsEnabled() bool
 }
 
 // SafetyResult contains the result of a safety check.
 type SafetyResult struct {
-	IsSafe   bool    `json:"is_safe"`
-	Category string  `json:"category,omitempty"`
-	Reason   string  `json:"reason,omitempty"`
-	Score    float64 `json:"score,omitempty"`
+	IsSafe bool `json:"is_safe"`
+
+	// Category is the first category flagged, and Categories all of them, in the
+	// order the guard model listed them.
+	Category   string   `json:"category,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+
+	Reason string  `json:"reason,omitempty"`
+	Score  float64 `json:"score,omitempty"`
 }
 
 // SafetyCategories defines known safety violation categories.
@@ -76,21 +107,119 @@ var SafetyCategories = map[string]string{
 	"S14": "Code Interpreter Abuse",
 }
 
+// EmbeddingDimensions lists the vector sizes of common Ollama embedding models,
+// keyed by model name without its tag.
+var EmbeddingDimensions = map[string]int{
+	"nomic-embed-text":        768,
+	"mxbai-embed-large":       1024,
+	"all-minilm":              384,
+	"bge-m3":                  1024,
+	"bge-large":               1024,
+	"paraphrase-multilingual": 768,
+	"snowflake-arctic-embed2": 1024,
+}
+
 // Retriever defines the interface for document retrieval and RAG.
 type Retriever interface {
 	// Search finds the most relevant documents for a query.
 	Search(ctx context.Context, query string, topK int) ([]*Document, error)
 
-	// AddDocuments ingests and indexes new documents.
+	// AddDocuments ingests and indexes new documents. Chunks that cannot be embedded
+	// are left out and reported in a *PartialIndexError once the others are indexed.
 	AddDocuments(ctx context.Context, docs []*Document) error
 
 	// DeleteCollection removes all documents from the collection.
 	DeleteCollection(ctx context.Context) error
 
+	// SourceHash returns the content hash stored for a source path, or "" if it has not been ingested.
+	SourceHash(ctx context.Context, path string) (string, error)
+
+	// DeleteSource removes all documents ingested from a source path.
+	DeleteSource(ctx context.Context, path string) error
+
+	// Stats reports how many chunks and source files are indexed.
+	Stats(ctx context.Context) (*CollectionStats, error)
+
 	// IsHealthy checks if the vector database is accessible.
 	IsHealthy(ctx context.Context) error
 }
 
+// Reindexer is implemented by retrievers that can rebuild their index from stored
+// chunk content, e.g. after switching embedding models.
+type Reindexer interface {
+	// Reindex re-embeds all stored chunks and returns how many were written.
+	Reindex(ctx context.Context) (int, error)
+}
+
+// VectorSearcher is implemented by retrievers that can search with a query embedding
+// computed by the caller, which can then inspect it when debugging retrieval.
+type VectorSearcher interface {
+	// SearchVector finds the topK documents closest to vector, with the backend's raw scores.
+	SearchVector(ctx context.Context, vector []float32, topK int) ([]*Document, error)
+}
+
+// DimensionReporter is implemented by retrievers whose collection has a fixed vector size.
+type DimensionReporter interface {
+	// CollectionDimensions returns the vector size of the collection, or 0 if it isn't known yet.
+	CollectionDimensions(ctx context.Context) (int, error)
+}
+
+// Deduplicator is implemented by retrievers that can skip chunks duplicating indexed content.
+type Deduplicator interface {
+	// AddUniqueDocuments indexes docs like AddDocuments, skipping chunks whose content matches
+	// an indexed chunk or an earlier chunk in docs. With a positive threshold, chunks whose
+	// embeddings are at least that cosine-similar are skipped too. It returns how many were skipped.
+	AddUniqueDocuments(ctx context.Context, docs []*Document, threshold float64) (int, error)
+}
+
+// ChunkError records why a chunk could not be indexed.
+type ChunkError struct {
+	ID  string
+	Err error
+}
+
+// PartialIndexError reports the chunks that AddDocuments could not embed. The other
+// Total-len(Failed) chunks were indexed.
+type PartialIndexError struct {
+	Total  int
+	Failed []ChunkError
+}
+
+func (e *PartialIndexError) Error() string {
+	return fmt.Sprintf("%d/%d chunks indexed; chunk %s failed: %v",
+		e.Total-len(e.Failed), e.Total, e.Failed[0].ID, e.Failed[0].Err)
+}
+
+// ErrBackendUnavailable is wrapped by the errors of LLMClient, EmbeddingProvider, and
+// Retriever requests that could not reach their server or that it turned away as
+// overloaded, so callers can retry or report an outage rather than a failed request.
+var ErrBackendUnavailable = errors.New("backend unavailable")
+
+// BackendUnavailable wraps err, a failed request to a backend, with ErrBackendUnavailable.
+// If ctx is done, the caller gave up rather than the backend, and err is returned as is.
+func BackendUnavailable(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+}
+
+// Exporter is implemented by retrievers that can dump their stored points,
+// vectors included, and restore them without re-embedding.
+type Exporter interface {
+	// Export writes every stored point to w and returns how many were written.
+	Export(ctx context.Context, w io.Writer) (int, error)
+
+	// Import replaces the collection with the points read from r and returns how many were written.
+	Import(ctx context.Context, r io.Reader) (int, error)
+}
+
+// Reranker reorders retrieved documents by relevance to a query.
+type Reranker interface {
+	// Rerank rescores documents against the query and returns them sorted by the new score.
+	Rerank(ctx context.Context, query string, docs []*Document) ([]*Document, error)
+}
+
 // Document represents a document chunk with metadata.
 type Document struct {
 	ID       string         `json:"id"`
@@ -129,11 +258,26 @@ type DocumentProcessor interface {
 	SupportedTypes() []string
 }
 
+// Tokenizer converts text to and from model tokens.
+type Tokenizer interface {
+	// Encode converts text into token IDs.
+	Encode(text string) []int
+
+	// Decode converts token IDs back into text.
+	Decode(tokens []int) string
+
+	// Count returns the number of tokens in the text.
+	Count(text string) int
+}
+
 // PromptBuilder constructs prompts with context and formatting.
 type PromptBuilder interface {
 	// BuildRAGPrompt creates a prompt with retrieved context.
 	BuildRAGPrompt(query string, context []*Document) string
 
+	// BuildConversationalRAGPrompt creates a prompt with retrieved context and recent chat history.
+	BuildConversationalRAGPrompt(history []Message, query string, context []*Document) string
+
 	// BuildSystemPrompt loads and formats the system prompt.
 	BuildSystemPrompt() (string, error)
 
@@ -160,39 +304,109 @@ type Message struct {
 // Config represents the application configuration.
 type Config struct {
 	// LLM Backend Configuration
-	Backend     string `yaml:"backend" mapstructure:"backend"`
-	ModelPath   string `yaml:"model_path" mapstructure:"model_path"`
-	OllamaURL   string `yaml:"ollama_url" mapstructure:"ollama_url"`
-	OllamaModel string `yaml:"ollama_model" mapstructure:"ollama_model"`
-	GuardModel  string `yaml:"guard_model" mapstructure:"guard_model"`
+	Backend        string `yaml:"backend" mapstructure:"backend"`
+	ModelPath      string `yaml:"model_path" mapstructure:"model_path"`
+	LlamaCppServer string `yaml:"llamacpp_server" mapstructure:"llamacpp_server"`
+	OllamaURL      string `yaml:"ollama_url" mapstructure:"ollama_url"`
+	OllamaModel    string `yaml:"ollama_model" mapstructure:"ollama_model"`
+	KeepAlive      string `yaml:"keep_alive" mapstructure:"keep_alive"`
+	OpenAIURL      string `yaml:"openai_url" mapstructure:"openai_url"`
+	OpenAIAPIKey   string `yaml:"openai_api_key" mapstructure:"openai_api_key"`
+	OpenAIModel    string `yaml:"openai_model" mapstructure:"openai_model"`
+	GuardModel     string `yaml:"guard_model" mapstructure:"guard_model"`
+	GuardURL       string `yaml:"guard_url" mapstructure:"guard_url"`
+	GuardModelPath string `yaml:"guard_model_path" mapstructure:"guard_model_path"`
 
 	// Embeddings Configuration
 	Embeddings     string `yaml:"embeddings" mapstructure:"embeddings"`
 	EmbeddingModel string `yaml:"embedding_model" mapstructure:"embedding_model"`
 
 	// Vector Database
-	QdrantURL  string `yaml:"qdrant_url" mapstructure:"qdrant_url"`
-	Collection string `yaml:"collection" mapstructure:"collection"`
+	VectorDB       string `yaml:"vector_db" mapstructure:"vector_db"`
+	QdrantURL      string `yaml:"qdrant_url" mapstructure:"qdrant_url"`
+	QdrantAPIKey   string `yaml:"qdrant_api_key" mapstructure:"qdrant_api_key"`
+	QdrantUseTLS   bool   `yaml:"qdrant_use_tls" mapstructure:"qdrant_use_tls"`
+	QdrantGRPCPort int    `yaml:"qdrant_grpc_port" mapstructure:"qdrant_grpc_port"`
+	PostgresURL    string `yaml:"postgres_url" mapstructure:"postgres_url"`
+	Collection     string `yaml:"collection" mapstructure:"collection"`
+	Distance       string `yaml:"distance" mapstructure:"distance"`
 
 	// RAG Parameters
-	ChunkTokens  int  `yaml:"chunk_tokens" mapstructure:"chunk_tokens"`
-	ChunkOverlap int  `yaml:"chunk_overlap" mapstructure:"chunk_overlap"`
-	TopK         int  `yaml:"top_k" mapstructure:"top_k"`
-	Rerank       bool `yaml:"rerank" mapstructure:"rerank"`
+	ChunkTokens      int                      `yaml:"chunk_tokens" mapstructure:"chunk_tokens"`
+	ChunkOverlap     int                      `yaml:"chunk_overlap" mapstructure:"chunk_overlap"`
+	ChunkOverrides   map[string]ChunkOverride `yaml:"chunk_overrides" mapstructure:"chunk_overrides"`
+	TopK             int                      `yaml:"top_k" mapstructure:"top_k"`
+	MinScore         float64                  `yaml:"min_score" mapstructure:"min_score"`
+	SourceWeight     float64                  `yaml:"source_weight" mapstructure:"source_weight"`
+	MMRLambda        float64                  `yaml:"mmr_lambda" mapstructure:"mmr_lambda"`
+	Rerank           bool                     `yaml:"rerank" mapstructure:"rerank"`
+	RerankModel      string                   `yaml:"rerank_model" mapstructure:"rerank_model"`
+	RerankCandidates int                      `yaml:"rerank_candidates" mapstructure:"rerank_candidates"`
+	TokenizerPath    string                   `yaml:"tokenizer_path" mapstructure:"tokenizer_path"`
+	MarkdownSections bool                     `yaml:"markdown_sections" mapstructure:"markdown_sections"`
+	CSVDelimiter     string                   `yaml:"csv_delimiter" mapstructure:"csv_delimiter"`
+	PDFOCR           bool                     `yaml:"pdf_ocr" mapstructure:"pdf_ocr"`
+	PDFFailedPages   float64                  `yaml:"pdf_failed_pages" mapstructure:"pdf_failed_pages"`
+	Redact           bool                     `yaml:"redact" mapstructure:"redact"`
+	RedactPatterns   []string                 `yaml:"redact_patterns" mapstructure:"redact_patterns"`
+	Dedupe           string                   `yaml:"dedupe" mapstructure:"dedupe"`
+	DedupeThreshold  float64                  `yaml:"dedupe_threshold" mapstructure:"dedupe_threshold"`
 
 	// Generation Parameters
-	Temperature float64 `yaml:"temperature" mapstructure:"temperature"`
-	MaxTokens   int     `yaml:"max_tokens" mapstructure:"max_tokens"`
-	TopP        float64 `yaml:"top_p" mapstructure:"top_p"`
+	Temperature   float64  `yaml:"temperature" mapstructure:"temperature"`
+	MaxTokens     int      `yaml:"max_tokens" mapstructure:"max_tokens"`
+	TopP          float64  `yaml:"top_p" mapstructure:"top_p"`
+	StopSequences []string `yaml:"stop_sequences" mapstructure:"stop_sequences"`
 
 	// System Configuration
-	SystemPrompt string `yaml:"system_prompt" mapstructure:"system_prompt"`
-	Safety       string `yaml:"safety" mapstructure:"safety"`
-	LogLevel     string `yaml:"log_level" mapstructure:"log_level"`
+	SystemPrompt             string            `yaml:"system_prompt" mapstructure:"system_prompt"`
+	SystemPromptStrict       bool              `yaml:"system_prompt_strict" mapstructure:"system_prompt_strict"`
+	CitationStyle            string            `yaml:"citation_style" mapstructure:"citation_style"`
+	ResponseLanguage         string            `yaml:"response_language" mapstructure:"response_language"`
+	Safety                   string            `yaml:"safety" mapstructure:"safety"`
+	SafetyCategories         map[string]string `yaml:"safety_categories" mapstructure:"safety_categories"`
+	SafetyDisabledCategories []string          `yaml:"safety_disabled_categories" mapstructure:"safety_disabled_categories"`
+	PromptInjection          string            `yaml:"prompt_injection" mapstructure:"prompt_injection"`
+	SafetyThreshold          float64           `yaml:"safety_threshold" mapstructure:"safety_threshold"`
+	SafetyFailMode           string            `yaml:"safety_fail_mode" mapstructure:"safety_fail_mode"`
+	SafetyParseRetries       int               `yaml:"safety_parse_retries" mapstructure:"safety_parse_retries"`
+	SafetyStreamInterval     int               `yaml:"safety_stream_interval" mapstructure:"safety_stream_interval"`
+	SafetyStreamWindow       int               `yaml:"safety_stream_window" mapstructure:"safety_stream_window"`
+	SafetyAuditLog           string            `yaml:"safety_audit_log" mapstructure:"safety_audit_log"`
+	LogLevel                 string            `yaml:"log_level" mapstructure:"log_level"`
 
 	// Performance
-	ContextWindow int `yaml:"context_window" mapstructure:"context_window"`
-	BatchSize     int `yaml:"batch_size" mapstructure:"batch_size"`
+	ContextWindow        int           `yaml:"context_window" mapstructure:"context_window"`
+	MaxInputTokens       int           `yaml:"max_input_tokens" mapstructure:"max_input_tokens"`
+	InputOverflow        string        `yaml:"input_overflow" mapstructure:"input_overflow"`
+	BatchSize            int           `yaml:"batch_size" mapstructure:"batch_size"`
+	IngestWorkers        int           `yaml:"ingest_workers" mapstructure:"ingest_workers"`
+	EmbeddingConcurrency int           `yaml:"embedding_concurrency" mapstructure:"embedding_concurrency"`
+	RetryAttempts        int           `yaml:"retry_attempts" mapstructure:"retry_attempts"`
+	EmptyResponseRetries int           `yaml:"empty_response_retries" mapstructure:"empty_response_retries"`
+	RetryBackoff         time.Duration `yaml:"retry_backoff" mapstructure:"retry_backoff"`
+	RequestTimeout       time.Duration `yaml:"request_timeout" mapstructure:"request_timeout"`
+	EmbeddingTimeout     time.Duration `yaml:"embedding_timeout" mapstructure:"embedding_timeout"`
+	Cache                bool          `yaml:"cache" mapstructure:"cache"`
+	CacheTTL             time.Duration `yaml:"cache_ttl" mapstructure:"cache_ttl"`
+
+	// Chat History
+	HistoryTurns  int `yaml:"history_turns" mapstructure:"history_turns"`
+	HistoryTokens int `yaml:"history_tokens" mapstructure:"history_tokens"`
+}
+
+// ChunkOverride tunes chunking for a single file extension.
+// Zero fields fall back to the global chunk_tokens and chunk_overlap.
+type ChunkOverride struct {
+	Tokens  int `yaml:"tokens" mapstructure:"tokens"`
+	Overlap int `yaml:"overlap" mapstructure:"overlap"`
+}
+
+// CollectionStats summarizes the contents of the vector database.
+type CollectionStats struct {
+	Chunks     int `json:"chunks"`
+	Sources    int `json:"sources"`
+	Dimensions int `json:"dimensions"`
 }
 
 // HealthStatus represents the health of a service component.